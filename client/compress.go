@@ -0,0 +1,115 @@
+package client
+
+import (
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// immutableCache is used for assets requested with the current version
+const immutableCache = "public, max-age=31536000, immutable"
+
+// compressible reports whether content of type should be gzipped,
+// already compressed formats such as images and archives are excluded
+func compressible(contentType string) bool {
+	mediatype := strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+	switch {
+	case strings.HasPrefix(mediatype, "text/"):
+		return true
+	case mediatype == "application/javascript",
+		mediatype == "application/json",
+		mediatype == "application/xml",
+		mediatype == "image/svg+xml",
+		mediatype == "image/x-icon",
+		mediatype == "image/vnd.microsoft.icon",
+		mediatype == "font/ttf",
+		mediatype == "application/x-font-ttf",
+		mediatype == "application/vnd.ms-fontobject":
+		return true
+	}
+	return false
+}
+
+// assetHeaders sets caching headers for a file under dir
+func (server *Server) assetHeaders(w http.ResponseWriter, r *http.Request, dir string) {
+	if !server.development && server.Version != "" && r.URL.RawQuery == server.Version {
+		w.Header().Set("Cache-Control", immutableCache)
+	}
+
+	name := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+r.URL.Path)))
+	if stat, err := os.Stat(name); err == nil && !stat.IsDir() {
+		w.Header().Set("ETag", fmt.Sprintf(`W/"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()))
+	}
+}
+
+// gzipHandler compresses responses when the client accepts gzip
+func gzipHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Upgrade") != "" || r.Header.Get("Range") != "" || !acceptsGzip(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Accept-Encoding")
+		gw := &gzipWriter{ResponseWriter: w}
+		defer gw.Close()
+		next.ServeHTTP(gw, r)
+	})
+}
+
+func acceptsGzip(r *http.Request) bool {
+	for _, enc := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		enc = strings.TrimSpace(strings.SplitN(enc, ";", 2)[0])
+		if enc == "gzip" {
+			return true
+		}
+	}
+	return false
+}
+
+type gzipWriter struct {
+	http.ResponseWriter
+	started bool
+	gz      *gzip.Writer
+}
+
+func (w *gzipWriter) start(status int, data []byte) {
+	if w.started {
+		return
+	}
+	w.started = true
+
+	header := w.Header()
+	if header.Get("Content-Type") == "" && data != nil {
+		header.Set("Content-Type", http.DetectContentType(data))
+	}
+
+	bodyless := status == http.StatusNoContent || status == http.StatusNotModified
+	if !bodyless && header.Get("Content-Encoding") == "" && compressible(header.Get("Content-Type")) {
+		header.Del("Content-Length")
+		header.Set("Content-Encoding", "gzip")
+		w.gz = gzip.NewWriter(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) WriteHeader(status int) { w.start(status, nil) }
+
+func (w *gzipWriter) Write(data []byte) (int, error) {
+	w.start(http.StatusOK, data)
+	if w.gz != nil {
+		return w.gz.Write(data)
+	}
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *gzipWriter) Close() error {
+	if w.gz != nil {
+		return w.gz.Close()
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T) *Server {
+	dir, err := ioutil.TempDir("", "kb-client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	files := map[string]string{
+		"assets/js/app.js":  strings.Repeat("console.log('hello');\n", 100),
+		"assets/img/kb.png": "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 100),
+	}
+	for name, content := range files {
+		full := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return NewServer(Info{Version: "20200101"}, nil, dir, false)
+}
+
+func get(server *Server, url string, header map[string]string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", url, nil)
+	for key, value := range header {
+		r.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w
+}
+
+func TestAssetsGzip(t *testing.T) {
+	server := newTestServer(t)
+	accept := map[string]string{"Accept-Encoding": "gzip, deflate"}
+
+	w := get(server, "/assets/js/app.js", accept)
+	if enc := w.Header().Get("Content-Encoding"); enc != "gzip" {
+		t.Fatalf("js: got encoding %q, expected gzip", enc)
+	}
+	gz, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), "console.log") {
+		t.Errorf("js: got unexpected content %q", data[:20])
+	}
+
+	w = get(server, "/assets/img/kb.png", accept)
+	if enc := w.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("png: got encoding %q, expected none", enc)
+	}
+
+	w = get(server, "/assets/js/app.js", nil)
+	if enc := w.Header().Get("Content-Encoding"); enc != "" {
+		t.Errorf("js without gzip: got encoding %q, expected none", enc)
+	}
+}
+
+func TestAssetsCaching(t *testing.T) {
+	server := newTestServer(t)
+
+	w := get(server, "/assets/js/app.js?20200101", nil)
+	if cache := w.Header().Get("Cache-Control"); cache != immutableCache {
+		t.Errorf("versioned: got Cache-Control %q", cache)
+	}
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatalf("ETag missing")
+	}
+
+	w = get(server, "/assets/js/app.js", nil)
+	if cache := w.Header().Get("Cache-Control"); cache != "" {
+		t.Errorf("unversioned: got Cache-Control %q", cache)
+	}
+
+	w = get(server, "/assets/js/app.js", map[string]string{
+		"If-None-Match":   etag,
+		"Accept-Encoding": "gzip",
+	})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("revalidation: got status %d, expected %d", w.Code, http.StatusNotModified)
+	}
+	if w.Body.Len() != 0 || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("revalidation: expected empty uncompressed response")
+	}
+}
@@ -122,6 +122,49 @@ package("kb.item.content", function(exports) {
 		}
 	});
 
+	exports.audio = createReactClass({
+		displayName: "Audio",
+		render: function() {
+			var item = this.props.item;
+			return React.DOM.figure({
+					className: "item-content content-audio"
+				},
+				React.DOM.audio({
+					controls: true,
+					preload: "none",
+					src: item.url
+				}),
+				item.caption ? React.DOM.figcaption({}, item.caption) : null,
+				item.text ? React.DOM.p({}, item.text) : null
+			);
+		}
+	});
+
+	exports.table = createReactClass({
+		displayName: "Table",
+		render: function() {
+			var item = this.props.item;
+			var headers = item.headers || [];
+			var rows = item.rows || [];
+			return React.DOM.div({
+					className: "item-content content-table"
+				},
+				React.DOM.table({},
+					headers.length > 0 ? React.DOM.thead({},
+						React.DOM.tr({}, headers.map(function(header, i) {
+							return React.DOM.th({ key: i }, header);
+						}))
+					) : null,
+					React.DOM.tbody({}, rows.map(function(row, i) {
+						return React.DOM.tr({ key: i }, row.map(function(cell, k) {
+							return React.DOM.td({ key: k }, cell);
+						}));
+					}))
+				)
+			);
+		}
+	});
+
 	exports.paragraph = createReactClass({
 		displayName: "Paragraph",
 		render: function() {
@@ -163,6 +206,28 @@ package("kb.item.content", function(exports) {
 		}
 	});
 
+	exports.collapsible = createReactClass({
+		displayName: "Collapsible",
+		render: function() {
+			var item = this.props.item;
+			var stage = this.props.stage;
+			var story = item.story || [];
+			return React.DOM.details({
+					className: "item-content content-collapsible"
+				},
+				React.DOM.summary({}, item.title),
+				story.map(function(child, i) {
+					var view = exports[child.type] || exports.Unknown;
+					return React.createElement(view, {
+						key: child.id || i,
+						stage: stage,
+						item: child
+					});
+				})
+			);
+		}
+	});
+
 	exports.code = createReactClass({
 		displayName: "Code",
 		render: function() {
@@ -216,7 +281,35 @@ package("kb.item.content", function(exports) {
 					dangerouslySetInnerHTML: {
 						__html: this.props.item.text
 					}
-				})
+				}),
+				item.highlight ? React.DOM.p({
+					className: "entry-highlight",
+					dangerouslySetInnerHTML: {
+						__html: item.highlight
+					}
+				}) : null
+			);
+		}
+	});
+
+	exports.pagination = createReactClass({
+		displayName: "Pagination",
+		render: function() {
+			var item = this.props.item;
+			return React.DOM.div({
+					className: "item-content content-pagination"
+				},
+				item.prev ? React.DOM.a({
+					className: "pagination-prev",
+					href: item.prev
+				}, "Previous") : null,
+				React.DOM.span({
+					className: "pagination-text"
+				}, item.text),
+				item.next ? React.DOM.a({
+					className: "pagination-next",
+					href: item.next
+				}, "Next") : null
 			);
 		}
 	});
@@ -50,13 +50,13 @@ func NewServer(info Info, login *auth.Server, dir string, development bool) *Ser
 		development: development,
 		bootstrap:   filepath.Join(dir, "index.html"),
 		dir:         dir,
-		assets: http.StripPrefix("/assets/",
-			http.FileServer(http.Dir(filepath.Join(dir, "assets")))),
-		client: livepkg.NewServer(
+		assets: gzipHandler(http.StripPrefix("/assets/",
+			http.FileServer(http.Dir(filepath.Join(dir, "assets"))))),
+		client: gzipHandler(livepkg.NewServer(
 			http.Dir(dir),
 			development,
 			"/boot.js",
-		),
+		)),
 	}
 }
 
@@ -108,6 +108,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case r.URL.Path == "/apilogin":
 		server.apiLogin(w, r)
 	case strings.HasPrefix(r.URL.Path, "/assets/"):
+		server.assetHeaders(w, r, server.dir)
 		server.assets.ServeHTTP(w, r)
 	default:
 		server.client.ServeHTTP(w, r)
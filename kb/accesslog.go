@@ -0,0 +1,90 @@
+package kb
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// AccessEntry is a single line written by AccessLog
+type AccessEntry struct {
+	Time     time.Time `json:"time"`
+	Host     string    `json:"host"`
+	Method   string    `json:"method"`
+	Path     string    `json:"path"`
+	User     Slug      `json:"user,omitempty"`
+	Status   int       `json:"status"`
+	Bytes    int64     `json:"bytes"`
+	Duration float64   `json:"duration_ms"`
+}
+
+type accessKey struct{}
+
+// AccessLog writes a JSON line per request to out
+func AccessLog(out io.Writer, next http.Handler) http.Handler {
+	var mu sync.Mutex
+	enc := json.NewEncoder(out)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		entry := &AccessEntry{
+			Time:   start,
+			Host:   r.Host,
+			Method: r.Method,
+			Path:   r.URL.Path,
+		}
+
+		rw := &accessWriter{ResponseWriter: w}
+		r = r.WithContext(context.WithValue(r.Context(), accessKey{}, entry))
+		next.ServeHTTP(rw, r)
+
+		entry.Status = rw.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.Bytes = rw.bytes
+		entry.Duration = float64(time.Since(start)) / float64(time.Millisecond)
+
+		mu.Lock()
+		defer mu.Unlock()
+		enc.Encode(entry)
+	})
+}
+
+// setAccessUser records the authenticated user for the access log
+func setAccessUser(r *http.Request, user Slug) {
+	if entry, ok := r.Context().Value(accessKey{}).(*AccessEntry); ok {
+		entry.User = user
+	}
+}
+
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *accessWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *accessWriter) Write(data []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(data)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *accessWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,47 @@
+package kb
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAccessLog(t *testing.T) {
+	server := NewServer(headerAuth{}, nil)
+	server.AddModule(okModule{})
+
+	var out bytes.Buffer
+	handler := AccessLog(&out, server)
+
+	r := httptest.NewRequest("GET", "http://kb.example.com/test=search", nil)
+	r.Header.Set("X-User", "alice")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	r = httptest.NewRequest("GET", "http://kb.example.com/missing-owner", nil)
+	r.Header.Set("X-User", "bob")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	dec := json.NewDecoder(&out)
+	expected := []AccessEntry{
+		{Host: "kb.example.com", Method: "GET", Path: "/test=search", User: "alice", Status: http.StatusOK, Bytes: 2},
+		{Host: "kb.example.com", Method: "GET", Path: "/missing-owner", User: "bob", Status: http.StatusBadRequest},
+	}
+	for _, exp := range expected {
+		var got AccessEntry
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Host != exp.Host || got.Method != exp.Method || got.Path != exp.Path ||
+			got.User != exp.User || got.Status != exp.Status {
+			t.Errorf("got %+v, expected %+v", got, exp)
+		}
+		if exp.Bytes > 0 && got.Bytes != exp.Bytes {
+			t.Errorf("%s: got %d bytes, expected %d", got.Path, got.Bytes, exp.Bytes)
+		}
+		if got.Time.IsZero() || got.Duration < 0 {
+			t.Errorf("%s: invalid timing %+v", got.Path, got)
+		}
+	}
+}
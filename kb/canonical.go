@@ -0,0 +1,64 @@
+package kb
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CanonicalSlug returns the slug a pasted page path most likely refers to,
+// e.g. "/Billing=Posting_Charges/" is "billing=posting-charges".
+// A path without an owner uses its first '/' as the separator,
+// e.g. "Billing/Posting_Charges" is "billing=posting-charges".
+func CanonicalSlug(path string) Slug {
+	path = strings.Trim(path, "/")
+	if path == "" {
+		return ""
+	}
+	if !strings.Contains(path, "=") {
+		path = strings.Replace(path, "/", "=", 1)
+	}
+	return Slugify(path)
+}
+
+// canonicalRedirect permanently redirects GET and HEAD requests of
+// non-canonical page paths to the canonical slug, when the page exists
+// and user can read it. Paths under modules are never redirected, since
+// modules serve their own routes. It returns whether the request was handled.
+func (server *Server) canonicalRedirect(w http.ResponseWriter, r *http.Request, user User) bool {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		return false
+	}
+
+	slug := CanonicalSlug(r.URL.Path)
+	if slug == "" || "/"+string(slug) == r.URL.Path {
+		return false
+	}
+
+	owner, _ := TokenizeLink(string(slug))
+	if owner == "" {
+		return false
+	}
+	if requested, _ := TokenizeLink(r.URL.Path); server.isModule(requested) || server.isModule(owner) {
+		return false
+	}
+
+	context := server.Context(user.ID)
+	if context.Access().Rights(owner, user.ID) == Blocked {
+		return false
+	}
+	if _, err := context.Pages(owner).LoadRawCtx(r.Context(), slug); err != nil {
+		return false
+	}
+
+	target := *r.URL
+	target.Path = "/" + string(slug)
+	target.RawPath = ""
+	http.Redirect(w, r, target.RequestURI(), http.StatusMovedPermanently)
+	return true
+}
+
+// isModule returns whether owner is served by a module
+func (server *Server) isModule(owner Slug) bool {
+	_, ok := server.Modules[owner]
+	return ok
+}
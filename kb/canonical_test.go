@@ -0,0 +1,126 @@
+package kb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type canonicalDatabase struct {
+	aliasDatabase
+	private map[Slug]bool
+}
+
+func (db canonicalDatabase) Context(user Slug) Context {
+	return canonicalContext{aliasContext{db: db.aliasDatabase}, db}
+}
+
+type canonicalContext struct {
+	aliasContext
+	db canonicalDatabase
+}
+
+func (ctx canonicalContext) Access() Access { return canonicalAccess{db: ctx.db} }
+
+type canonicalAccess struct {
+	Access
+	db canonicalDatabase
+}
+
+func (access canonicalAccess) Rights(group, user Slug) Rights {
+	if access.db.private[group] {
+		return Blocked
+	}
+	return Reader
+}
+
+func canonicalServer() *Server {
+	server := NewServer(headerAuth{}, canonicalDatabase{
+		aliasDatabase: aliasDatabase{
+			pages: map[Slug][]byte{
+				"billing=posting-charges": []byte(`{"slug":"billing=posting-charges"}`),
+				"secret=plans":            []byte(`{"slug":"secret=plans"}`),
+				"test=uploadcontent":      []byte(`{"slug":"test=uploadcontent"}`),
+			},
+		},
+		private: map[Slug]bool{"secret": true},
+	})
+	server.AddModule(okModule{})
+	return server
+}
+
+func canonicalRequest(server *Server, method, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, nil)
+	r.Header.Set("X-User", "reader")
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	return w
+}
+
+func TestCanonicalSlug(t *testing.T) {
+	cases := []struct {
+		Path string
+		Slug Slug
+	}{
+		{"/", ""},
+		{"/billing=posting-charges", "billing=posting-charges"},
+		{"/Billing=Posting_Charges/", "billing=posting-charges"},
+		{"/Billing/Posting_Charges", "billing=posting-charges"},
+		{"/help=billing/Posting Charges", "help=billing/posting-charges"},
+	}
+	for _, test := range cases {
+		if got := CanonicalSlug(test.Path); got != test.Slug {
+			t.Errorf("%q: got %q, expected %q", test.Path, got, test.Slug)
+		}
+	}
+}
+
+func TestCanonicalRedirect(t *testing.T) {
+	server := canonicalServer()
+
+	w := canonicalRequest(server, "GET", "/Billing/Posting_Charges?history=2")
+	if w.Code != http.StatusMovedPermanently {
+		t.Fatalf("got status %d, expected %d", w.Code, http.StatusMovedPermanently)
+	}
+	if location := w.Header().Get("Location"); location != "/billing=posting-charges?history=2" {
+		t.Errorf("got location %q", location)
+	}
+}
+
+func TestCanonicalRedirectPassThrough(t *testing.T) {
+	server := canonicalServer()
+
+	for _, test := range []struct {
+		Method, Path string
+		Status       int
+	}{
+		{"GET", "/billing=posting-charges", http.StatusOK},
+		{"GET", "/Billing=Missing_Page", http.StatusNotFound},
+		{"PUT", "/Billing=Posting_Charges", http.StatusMethodNotAllowed},
+	} {
+		w := canonicalRequest(server, test.Method, test.Path)
+		if w.Code != test.Status {
+			t.Errorf("%s %s: got status %d, expected %d", test.Method, test.Path, w.Code, test.Status)
+		}
+	}
+}
+
+func TestCanonicalRedirectModule(t *testing.T) {
+	server := canonicalServer()
+
+	// module routes are served by the module, even when a page matches the slug
+	w := canonicalRequest(server, "GET", "/test=/uploadContent/")
+	if w.Code != http.StatusOK || w.Body.String() != "OK" {
+		t.Errorf("module route: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestCanonicalRedirectPrivate(t *testing.T) {
+	server := canonicalServer()
+
+	// unreadable pages must not be revealed by redirecting
+	w := canonicalRequest(server, "GET", "/Secret/Plans")
+	if w.Code == http.StatusMovedPermanently {
+		t.Errorf("private page: redirected to %q", w.Header().Get("Location"))
+	}
+}
@@ -2,6 +2,10 @@
 package kb
 
 import (
+	"html"
+	"regexp"
+	"sort"
+	"strconv"
 	"strings"
 )
 
@@ -51,6 +55,68 @@ func Entry(title, synopsis string, slug Slug) Item {
 	}
 }
 
+// Collapsible creates a section that can be expanded to show the nested story
+func Collapsible(title string, body Story) Item {
+	return Item{
+		"type":  "collapsible",
+		"id":    NewID(),
+		"title": title,
+		"story": body,
+	}
+}
+
+// Audio creates an audio player for url with a caption
+func Audio(caption, url, text string) Item {
+	return Item{
+		"type":    "audio",
+		"id":      NewID(),
+		"url":     url,
+		"text":    text,
+		"caption": caption,
+	}
+}
+
+// Table creates a structured table, rows with fewer cells
+// than headers are padded with empty cells
+func Table(headers []string, rows [][]string) Item {
+	h := append([]string{}, headers...)
+	r := make([][]string, 0, len(rows))
+	for _, row := range rows {
+		cells := append([]string{}, row...)
+		for len(cells) < len(h) {
+			cells = append(cells, "")
+		}
+		r = append(r, cells)
+	}
+
+	return Item{
+		"type":    "table",
+		"id":      NewID(),
+		"headers": h,
+		"rows":    r,
+	}
+}
+
+// Pagination describes which window of a listing is shown,
+// prev and next link to the neighboring windows and are empty at the ends
+func Pagination(offset, count, total int, prev, next string) Item {
+	text := "No results."
+	if count > 0 {
+		text = "Showing " + strconv.Itoa(offset+1) + "-" + strconv.Itoa(offset+count) +
+			" of " + strconv.Itoa(total) + "."
+	}
+	return Item{
+		"type":   "pagination",
+		"id":     NewID(),
+		"text":   text,
+		"offset": offset,
+		"count":  count,
+		"total":  total,
+		"prev":   prev,
+		"next":   next,
+	}
+}
+
 func Tags(tags ...string) Item {
 	return Item{
 		"type": "tags",
@@ -59,24 +125,52 @@ func Tags(tags ...string) Item {
 	}
 }
 
+// ExtractTags returns the labels of all tags in the story,
+// see NormalizeTagPairs for the order and de-duplication
 func ExtractTags(page *Page) []string {
-	tags := make(map[string]string)
+	raw := []string{}
 	for _, item := range page.Story {
 		if item.Type() == "tags" {
-			for _, tag := range strings.Split(item.Val("text"), ",") {
-				ntag := string(Slugify(tag))
-				tags[ntag] = strings.TrimSpace(tag)
-			}
+			raw = append(raw, strings.Split(item.Val("text"), ",")...)
 		}
 	}
 
-	result := make([]string, 0, len(tags))
-	for _, tag := range tags {
-		result = append(result, tag)
+	pairs := NormalizeTagPairs(raw)
+	result := make([]string, 0, len(pairs))
+	for _, tag := range pairs {
+		result = append(result, tag.Label)
 	}
 	return result
 }
 
+// Tag is a tag with its display label
+type Tag struct {
+	Slug  Slug   `json:"slug"`
+	Label string `json:"label"`
+}
+
+// NormalizeTagPairs trims tags and removes empty ones and duplicates by slug,
+// the first label of a slug is kept. The result is sorted by slug.
+func NormalizeTagPairs(tags []string) []Tag {
+	seen := make(map[Slug]bool, len(tags))
+	result := make([]Tag, 0, len(tags))
+	for _, label := range tags {
+		label = strings.Join(strings.Fields(label), " ")
+		if label == "" {
+			continue
+		}
+		slug := Slugify(label)
+		if seen[slug] {
+			continue
+		}
+		seen[slug] = true
+		result = append(result, Tag{Slug: slug, Label: label})
+	}
+
+	sort.Slice(result, func(i, k int) bool { return result[i].Slug < result[k].Slug })
+	return result
+}
+
 func SlugifyTags(tags []string) []string {
 	normalized := make([]string, 0, len(tags))
 	for _, tag := range tags {
@@ -86,28 +180,81 @@ func SlugifyTags(tags []string) []string {
 	return normalized
 }
 
-func limitWords(text string, limit int) string {
-	words := strings.Fields(text)
-	if len(words) > limit {
-		words = words[:limit]
+// SynopsisLength is the approximate maximum length of an extracted synopsis
+const SynopsisLength = 200
+
+var (
+	rxExternalLink = regexp.MustCompile(`\[\[\s*https?:[^ \]]+\s+([^\]]+)\]\]`)
+	rxInternalLink = regexp.MustCompile(`\[\[\s*([^\]]+?)\s*\]\]`)
+	rxMarkdownLink = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	rxMarkdownMark = regexp.MustCompile("(?m)^\\s*(#+|>|[-*+]\\s)\\s*|[*_`~]+")
+)
+
+// PlainText removes html tags and entities from text and collapses whitespace
+func PlainText(text string) string {
+	text = html.UnescapeString(rxTag.ReplaceAllString(text, " "))
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// itemText returns the text of an item without markup
+func itemText(item Item) string {
+	text := item.Val("text")
+	switch item.Type() {
+	case "paragraph":
+		text = rxExternalLink.ReplaceAllString(text, "$1")
+		text = rxInternalLink.ReplaceAllStringFunc(text, func(link string) string {
+			link = rxInternalLink.FindStringSubmatch(link)[1]
+			if i := strings.Index(link, "="); i >= 0 {
+				link = link[i+1:]
+			}
+			return link
+		})
+	case "markdown":
+		text = rxMarkdownLink.ReplaceAllString(text, "$1")
+		text = rxMarkdownMark.ReplaceAllString(text, "")
+	}
+	return PlainText(text)
+}
+
+// truncateSentence shortens text to at most limit characters,
+// preferring to cut at the end of a sentence, then at a word
+func truncateSentence(text string, limit int) string {
+	runes := []rune(text)
+	if len(runes) <= limit {
+		return text
 	}
-	r := strings.Join(words, " ")
 
-	if len(r) > 0 {
-		ch := r[len(r)-1]
-		if ch != '.' && ch != '?' && ch != '!' {
-			r += "..."
+	head := string(runes[:limit])
+	if i := strings.LastIndexAny(head, ".!?"); i >= len(head)/2 {
+		if i+1 == len(head) || head[i+1] == ' ' {
+			return head[:i+1]
 		}
 	}
-	return r
+	if i := strings.LastIndex(head, " "); i > 0 {
+		head = head[:i]
+	}
+	return strings.TrimRight(head, " ,;:") + "..."
 }
 
+// ExtractSynopsis returns plain text from the first text item in the story,
+// truncated to about SynopsisLength characters
 func ExtractSynopsis(page *Page) string {
 	for _, item := range page.Story {
-		if item.Type() == "paragraph" {
-			text := item.Val("text")
-			if text != "" {
-				return limitWords(text, 50)
+		switch item.Type() {
+		case "paragraph", "markdown", "html":
+			if text := itemText(item); text != "" {
+				return truncateSentence(text, SynopsisLength)
+			}
+		}
+	}
+
+	// pages without text, e.g. podcasts, are described by their media
+	for _, item := range page.Story {
+		if item.Type() == "audio" {
+			for _, key := range []string{"text", "caption"} {
+				if text := PlainText(item.Val(key)); text != "" {
+					return truncateSentence(text, SynopsisLength)
+				}
 			}
 		}
 	}
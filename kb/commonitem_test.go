@@ -0,0 +1,178 @@
+package kb
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCollapsible(t *testing.T) {
+	body := Story{Paragraph("first"), Tags("alpha")}
+	item := Collapsible("Details", body)
+
+	if item.Type() != "collapsible" {
+		t.Errorf("invalid type %q", item.Type())
+	}
+	if item.Val("title") != "Details" {
+		t.Errorf("invalid title %q", item.Val("title"))
+	}
+
+	story, ok := item["story"].(Story)
+	if !ok || len(story) != 2 {
+		t.Fatalf("invalid nested story %#v", item["story"])
+	}
+	if story[0].Type() != "paragraph" || story[1].Type() != "tags" {
+		t.Errorf("invalid nested items %v", story)
+	}
+}
+
+func TestAudio(t *testing.T) {
+	item := Audio("Episode 1", "/media/episode-1.mp3", "Introduction to scheduling")
+
+	if item.Type() != "audio" {
+		t.Errorf("invalid type %q", item.Type())
+	}
+	if item.ID() == "" {
+		t.Errorf("missing id")
+	}
+	for key, exp := range map[string]string{
+		"url":     "/media/episode-1.mp3",
+		"caption": "Episode 1",
+		"text":    "Introduction to scheduling",
+	} {
+		if got := item.Val(key); got != exp {
+			t.Errorf("invalid %s %q, expected %q", key, got, exp)
+		}
+	}
+
+	page := &Page{Story: Story{Tags("podcast"), item}}
+	if synopsis := ExtractSynopsis(page); synopsis != "Introduction to scheduling" {
+		t.Errorf("invalid synopsis %q", synopsis)
+	}
+
+	page = &Page{Story: Story{Audio("Episode 2", "/media/episode-2.mp3", "")}}
+	if synopsis := ExtractSynopsis(page); synopsis != "Episode 2" {
+		t.Errorf("invalid synopsis from caption %q", synopsis)
+	}
+}
+
+func TestTable(t *testing.T) {
+	cases := []struct {
+		Name    string
+		Headers []string
+		Rows    [][]string
+		Exp     [][]string
+	}{
+		{"empty", nil, nil, [][]string{}},
+		{"header-only", []string{"Code", "Description"}, nil, [][]string{}},
+		{"ragged", []string{"Code", "Description", "Fee"}, [][]string{
+			{"99213", "Office visit", "$75"},
+			{"97110"},
+		}, [][]string{
+			{"99213", "Office visit", "$75"},
+			{"97110", "", ""},
+		}},
+	}
+
+	for _, test := range cases {
+		item := Table(test.Headers, test.Rows)
+		if item.Type() != "table" {
+			t.Errorf("%s: invalid type %q", test.Name, item.Type())
+		}
+
+		headers, ok := item["headers"].([]string)
+		if !ok || len(headers) != len(test.Headers) {
+			t.Errorf("%s: invalid headers %#v", test.Name, item["headers"])
+		}
+
+		rows, ok := item["rows"].([][]string)
+		if !ok || !reflect.DeepEqual(rows, test.Exp) {
+			t.Errorf("%s: got rows %#v, expected %#v", test.Name, item["rows"], test.Exp)
+		}
+	}
+
+	rows := [][]string{{"a"}}
+	Table([]string{"x", "y"}, rows)
+	if len(rows[0]) != 1 {
+		t.Errorf("input rows were modified")
+	}
+}
+
+func TestExtractSynopsis(t *testing.T) {
+	long := strings.Repeat("Appointments are scheduled from the calendar view. ", 3) +
+		strings.Repeat("The provider list can be filtered by location and specialty ", 4)
+
+	cases := []struct {
+		Name  string
+		Story Story
+		Exp   string
+	}{
+		{"image first", Story{
+			Image("Calendar", "/img/calendar.png", "Calendar screenshot"),
+			Paragraph("Use the <b>calendar</b> to book [[help=appointments]] &amp; visits."),
+		}, "Use the calendar to book appointments & visits."},
+		{"tags first", Story{
+			Tags("scheduling", "calendar"),
+			HTML("<h2>Overview</h2><p>Scheduling   overview.</p>"),
+		}, "Overview Scheduling overview."},
+		{"markdown", Story{
+			Item{"type": "markdown", "text": "## Setup\n\n* Open **Settings** and [configure](http://example.com) it."},
+		}, "Setup Open Settings and configure it."},
+		{"external link", Story{
+			Paragraph("See [[https://example.com/docs the documentation]]."),
+		}, "See the documentation."},
+		{"long sentence boundary", Story{
+			Paragraph(long),
+		}, strings.TrimSpace(strings.Repeat("Appointments are scheduled from the calendar view. ", 3))},
+		{"long without sentences", Story{
+			Paragraph(strings.Repeat("word ", 100)),
+		}, strings.Repeat("word ", 39) + "word..."},
+		{"no text", Story{Tags("empty")}, ""},
+	}
+
+	for _, test := range cases {
+		got := ExtractSynopsis(&Page{Story: test.Story})
+		if got != test.Exp {
+			t.Errorf("%s: got %q, expected %q", test.Name, got, test.Exp)
+		}
+		if n := len([]rune(got)); n > SynopsisLength+3 {
+			t.Errorf("%s: synopsis too long %d", test.Name, n)
+		}
+	}
+}
+
+func TestNormalizeTagPairs(t *testing.T) {
+	got := NormalizeTagPairs([]string{
+		"  Billing   Codes ",
+		"scheduling",
+		"",
+		"BILLING CODES",
+		"Scheduling",
+		"  ",
+		"Access Control",
+	})
+	exp := []Tag{
+		{"access-control", "Access Control"},
+		{"billing-codes", "Billing Codes"},
+		{"scheduling", "scheduling"},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestExtractTags(t *testing.T) {
+	page := &Page{Story: Story{
+		Tags("Scheduling", " Billing Codes"),
+		Paragraph("Content."),
+		Tags("billing codes", ""),
+	}}
+
+	tags := ExtractTags(page)
+	if exp := []string{"Billing Codes", "Scheduling"}; !reflect.DeepEqual(tags, exp) {
+		t.Errorf("got tags %v, expected %v", tags, exp)
+	}
+	if slugs, exp := SlugifyTags(tags), []string{"billing-codes", "scheduling"}; !reflect.DeepEqual(slugs, exp) {
+		t.Errorf("got slugs %v, expected %v", slugs, exp)
+	}
+}
@@ -0,0 +1,86 @@
+package kb
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// ParseOrigins splits a comma separated list of origins
+func ParseOrigins(list string) []string {
+	origins := []string{}
+	for _, origin := range strings.Split(list, ",") {
+		origin = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+		if origin != "" {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// OriginAllowed checks whether origin matches one of the allowed origins.
+//
+// Origins are compared including the scheme and port, e.g. "https://kb.example.com".
+// A wildcard entry "https://*.example.com" matches any subdomain of example.com,
+// but not example.com itself.
+func OriginAllowed(allowed []string, origin string) bool {
+	u, err := url.Parse(strings.ToLower(origin))
+	if err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" {
+		return false
+	}
+	origin = u.Scheme + "://" + u.Host
+
+	for _, pattern := range allowed {
+		if pattern == origin {
+			return true
+		}
+
+		prefix := u.Scheme + "://*."
+		if strings.HasPrefix(pattern, prefix) {
+			suffix := "." + strings.TrimPrefix(pattern, prefix)
+			if strings.HasSuffix(u.Host, suffix) && len(u.Host) > len(suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+const (
+	// corsAllowHeaders are the request headers cross-origin clients may send
+	corsAllowHeaders = "Content-Type, Accept, If-Match, X-Filter, X-Auth-Token, Authorization, Idempotency-Key"
+	// corsExposeHeaders are the response headers cross-origin clients may read
+	corsExposeHeaders = "ETag, Retry-After"
+)
+
+// AllowOrigins responds to cross-origin requests from the allowed origins,
+// requests from other origins are served without CORS headers.
+func AllowOrigins(allowed []string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !OriginAllowed(allowed, origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+		w.Header().Set("Access-Control-Expose-Headers", corsExposeHeaders)
+
+		if r.Method == "OPTIONS" && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, PUT, POST, DELETE, OVERWRITE")
+			w.Header().Set("Access-Control-Allow-Headers", corsAllowHeaders)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,87 @@
+package kb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOrigins(t *testing.T) {
+	got := ParseOrigins(" https://KB.example.com/, ,https://*.example.com")
+	exp := []string{"https://kb.example.com", "https://*.example.com"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+}
+
+func TestAllowOrigins(t *testing.T) {
+	allowed := ParseOrigins("https://kb.example.com,https://*.example.com")
+	handler := AllowOrigins(allowed, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("OK"))
+	}))
+
+	cases := []struct {
+		Origin  string
+		Allowed bool
+	}{
+		{"https://kb.example.com", true},
+		{"https://acme.example.com", true},
+		{"http://kb.example.com", false},
+		{"https://example.com", false},
+		{"https://example.com.evil.org", false},
+		{"https://evil.org", false},
+		{"kb.example.com", false},
+	}
+
+	for _, test := range cases {
+		r := httptest.NewRequest("GET", "/search", nil)
+		r.Header.Set("Origin", test.Origin)
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		got := w.Header().Get("Access-Control-Allow-Origin")
+		if test.Allowed && got != test.Origin {
+			t.Errorf("%q: got allow origin %q, expected it to be reflected", test.Origin, got)
+		}
+		if !test.Allowed && got != "" {
+			t.Errorf("%q: got allow origin %q, expected none", test.Origin, got)
+		}
+		if w.Body.String() != "OK" {
+			t.Errorf("%q: request was not served", test.Origin)
+		}
+	}
+}
+
+func TestAllowOriginsPreflight(t *testing.T) {
+	handler := AllowOrigins([]string{"https://kb.example.com"}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("preflight should not reach the handler")
+	}))
+
+	r := httptest.NewRequest("OPTIONS", "/search", nil)
+	r.Header.Set("Origin", "https://kb.example.com")
+	r.Header.Set("Access-Control-Request-Method", "PUT")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusNoContent {
+		t.Errorf("got status %d, expected %d", w.Code, http.StatusNoContent)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") == "" {
+		t.Errorf("allowed methods missing")
+	}
+
+	allowed := map[string]bool{}
+	for _, header := range strings.Split(w.Header().Get("Access-Control-Allow-Headers"), ",") {
+		allowed[strings.TrimSpace(header)] = true
+	}
+	for _, header := range []string{"X-Auth-Token", "Authorization", "Idempotency-Key", "Content-Type", "If-Match"} {
+		if !allowed[header] {
+			t.Errorf("allowed headers missing %s: %q", header, w.Header().Get("Access-Control-Allow-Headers"))
+		}
+	}
+	if exposed := w.Header().Get("Access-Control-Expose-Headers"); exposed != "ETag, Retry-After" {
+		t.Errorf("got exposed headers %q", exposed)
+	}
+}
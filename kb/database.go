@@ -1,12 +1,16 @@
 package kb
 
 import (
+	"context"
 	"encoding/gob"
 	"errors"
+	"fmt"
 	"html/template"
+	"io"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 )
 
 var (
@@ -16,12 +20,37 @@ var (
 	ErrGroupNotExist = errors.New("Group does not exist.")
 	ErrPageExists    = errors.New("Page already exists.")
 	ErrPageNotExist  = errors.New("Page does not exist.")
+	ErrAliasNotExist = errors.New("Alias does not exist.")
 
 	ErrConcurrentEdit = errors.New("Concurrent modification of page.")
 
 	ErrInvalidSlug = errors.New("Invalid slug.")
+
+	ErrAccessDenied = errors.New("Access denied.")
+
+	ErrInviteNotExist = errors.New("Invitation does not exist.")
+	ErrInviteExpired  = errors.New("Invitation has expired.")
+	ErrInviteUsed     = errors.New("Invitation has already been used.")
+
+	ErrStatementExists = errors.New("Statement already exists.")
+
+	ErrTokenNotExist = errors.New("API token does not exist.")
+
+	ErrGroupFrozen = errors.New("Group is frozen.")
 )
 
+// ConcurrentEditError is returned when the page was modified in the meantime,
+// it matches ErrConcurrentEdit when using errors.Is
+type ConcurrentEditError struct {
+	CurrentVersion int
+}
+
+func (err ConcurrentEditError) Error() string {
+	return fmt.Sprintf("%s Current version is %d.", ErrConcurrentEdit, err.CurrentVersion)
+}
+
+func (err ConcurrentEditError) Unwrap() error { return ErrConcurrentEdit }
+
 type Database interface {
 	Context(user Slug) Context
 }
@@ -37,6 +66,10 @@ type Context interface {
 	Pages(group Slug) Pages
 
 	GuestLogin() GuestLogin
+	Invitations() Invitations
+	Statements() Statements
+	Aliases() Aliases
+	APITokens() APITokens
 }
 
 type Rights string
@@ -62,13 +95,52 @@ func (r Rights) Level() int {
 	return -1
 }
 
+// Role is a server wide role of a user, higher roles have more privileges
+type Role int
+
+const (
+	RoleUser Role = iota
+	RoleEditor
+	RoleModerator
+	RoleAdmin
+)
+
+var roleNames = []string{"user", "editor", "moderator", "admin"}
+
+func (role Role) String() string {
+	if role < RoleUser || role > RoleAdmin {
+		return "Role(" + strconv.Itoa(int(role)) + ")"
+	}
+	return roleNames[role]
+}
+
+// ParseRole converts a role name to a Role
+func ParseRole(name string) (Role, error) {
+	for i, roleName := range roleNames {
+		if roleName == name {
+			return Role(i), nil
+		}
+	}
+	return RoleUser, fmt.Errorf("unknown role %q", name)
+}
+
 type Access interface {
 	VerifyUser(user User) error
 
+	// IsAdmin is equivalent to RoleOf(user) == RoleAdmin
 	IsAdmin(user Slug) bool
 	SetAdmin(user Slug, isAdmin bool) error
 
+	SetRole(user Slug, role Role) error
+	RoleOf(user Slug) (Role, error)
+	ListAdmins() ([]User, error)
+
+	// PurgeUser removes all memberships and roles of the user
+	PurgeUser(user Slug) error
+
 	Rights(group, user Slug) Rights
+	// ExplainRights lists the grants that make up Rights
+	ExplainRights(group, user Slug) (RightsExplanation, error)
 
 	// member is either a User or a Group
 	AddUser(group, user Slug) error
@@ -77,7 +149,46 @@ type Access interface {
 	CommunityAdd(group, member Slug, rights Rights) error
 	CommunityRemove(group, member Slug) error
 
+	// SetFrozen makes the pages of group read-only for everyone,
+	// only admins can freeze and unfreeze groups
+	SetFrozen(group Slug, frozen bool) error
+
 	List(group Slug) ([]Member, error)
+	// GroupsOf lists the groups where user is a member, directly or
+	// through community grants, with the effective rights in each
+	GroupsOf(user Slug) ([]Member, error)
+
+	// Export serializes memberships, communities and admins,
+	// Import replaces the current state with the exported one
+	Export() ([]byte, error)
+	Import(data []byte) error
+}
+
+// Sources of rights in a RightsExplanation
+const (
+	SourcePublic    = "public"
+	SourceMember    = "member"
+	SourceOwner     = "owner"
+	SourceCommunity = "community"
+)
+
+// RightsSource is a single grant of rights to a user
+type RightsSource struct {
+	// Kind is one of SourcePublic, SourceMember, SourceOwner or SourceCommunity
+	Kind string
+	// Via is the group whose membership or settings grant the rights
+	Via    Slug
+	Rights Rights
+}
+
+// RightsExplanation describes how the rights of a user in a group are decided
+type RightsExplanation struct {
+	Group     Slug
+	User      Slug
+	Sources   []RightsSource
+	MaxAccess Rights
+	// Rights is the best source limited by MaxAccess
+	Rights Rights
 }
 
 type GuestLogin interface {
@@ -87,9 +198,77 @@ type GuestLogin interface {
 	Verify(name, password string) (User, error)
 }
 
+type Invitations interface {
+	// CreateInvite returns a token that adds a user to the group with rights
+	CreateInvite(group Slug, rights Rights, ttl time.Duration) (token string, err error)
+	RedeemInvite(token string, user Slug) error
+}
+
+// TokenScope limits the requests allowed with an API token
+type TokenScope string
+
+const (
+	// ScopeRead only allows GET and HEAD requests
+	ScopeRead TokenScope = "read"
+	// ScopeReadWrite allows everything the user may do
+	ScopeReadWrite TokenScope = "read-write"
+)
+
+// APIToken authenticates requests of integrations as User,
+// it is sent as "Authorization: Bearer <token>"
+type APIToken struct {
+	ID      int64      `json:"id"`
+	User    Slug       `json:"user"`
+	Name    string     `json:"name"`
+	Scope   TokenScope `json:"scope"`
+	Created time.Time  `json:"created"`
+}
+
+// Allows returns whether requests with method may use the token
+func (token APIToken) Allows(method string) bool {
+	switch token.Scope {
+	case ScopeReadWrite:
+		return true
+	case ScopeRead:
+		return method == "GET" || method == "HEAD"
+	}
+	return false
+}
+
+type APITokens interface {
+	// CreateToken returns a new token of the active user, only its hash is stored
+	CreateToken(name string, scope TokenScope) (token string, err error)
+	// VerifyToken returns the record of token, unknown and revoked tokens
+	// return ErrTokenNotExist
+	VerifyToken(token string) (APIToken, error)
+	// RevokeToken revokes a token of the active user, admins may revoke any token
+	RevokeToken(id int64) error
+	// ListTokens lists tokens of the active user that have not been revoked
+	ListTokens() ([]APIToken, error)
+}
+
+// Aliases are old slugs of pages, e.g. after renaming, that resolve to the page
+type Aliases interface {
+	// AddAlias makes alias resolve to target, aliases of aliases resolve
+	// to the final target
+	AddAlias(alias, target Slug) error
+	// Resolve returns the page the alias refers to
+	Resolve(alias Slug) (Slug, error)
+	RemoveAlias(alias Slug) error
+}
+
+type Statements interface {
+	// Record stores the statement for the active user and returns its id
+	Record(statement Statement) (id string, err error)
+	// ByActor lists statements of the user, newest first
+	ByActor(user Slug) ([]Statement, error)
+}
+
 type Users interface {
 	ByID(id Slug) (User, error)
 	Create(user User) error
+	// EnsureGuest creates a guest user with email, unless it already exists
+	EnsureGuest(name, email string, rights Rights) error
 	Delete(id Slug) error
 	List() ([]User, error)
 }
@@ -103,27 +282,155 @@ type Groups interface {
 
 type Pages interface {
 	Create(page *Page) error
+	// CreateFromTemplate creates page slug from the template page,
+	// see InstantiateTemplate
+	CreateFromTemplate(slug, template Slug, vars map[string]string) error
 
 	Load(id Slug) (*Page, error)
 	LoadRaw(id Slug) ([]byte, error)
+	// LoadCtx and LoadRawCtx are cancelled together with ctx
+	LoadCtx(ctx context.Context, id Slug) (*Page, error)
+	LoadRawCtx(ctx context.Context, id Slug) ([]byte, error)
 	LoadRawVersion(id Slug, version int) ([]byte, error)
+	// RestoreVersion makes the content of page version targetVersion current again
+	RestoreVersion(id Slug, targetVersion, currentVersion int) error
 
 	Overwrite(id Slug, version int, page *Page) error
+	// Upsert creates the page or replaces it unconditionally,
+	// including a deleted page with the same slug
+	Upsert(page *Page) error
 	Edit(id Slug, version int, action Action) error
+	// Rename changes the page slug, keeping its history
+	Rename(oldID, newID Slug, version int) error
+	// Move transfers the page to newGroup, the user must moderate newGroup
+	Move(id Slug, newGroup Slug) error
+	// ForceVersion resets the page version, only for admins
+	ForceVersion(id Slug, version int) error
+	// Delete marks the page as deleted, Restore undoes it
 	Delete(id Slug, version int) error
-
+	Restore(id Slug) error
+	// Purge permanently removes the page
+	Purge(id Slug) error
+
+	// ImportBatch creates all pages or none of them
+	ImportBatch(pages []*Page) error
+	// ExportArchive writes all pages of the group, ImportArchive recreates them
+	ExportArchive(w io.Writer) error
+	ImportArchive(r io.Reader) error
 	BatchReplace(pages map[Slug]*Page, complete func(string, Slug)) error
 	BatchReplaceDelta(pages map[Slug]*Page, complete func(string, Slug)) error
+	// Reindex recomputes the synopsis and tags of all pages in the group,
+	// without changing their versions or journaling edits
+	Reindex() error
 
 	List() ([]PageEntry, error)
-	History(id Slug) ([]PageEntry, error)
+	// ListCtx is List cancelled together with ctx
+	ListCtx(ctx context.Context) ([]PageEntry, error)
+	ListFiltered(opts ListOptions) ([]PageEntry, error)
+	// ListByPrefix lists pages whose slug starts with prefix,
+	// e.g. "help=billing/" lists the pages under billing
+	ListByPrefix(prefix Slug) ([]PageEntry, error)
+	Count() (int, error)
+	Stats() (GroupStats, error)
+	// ExportCSV writes slug, title, tags, modified and version
+	// of the group pages as CSV with a header row
+	ExportCSV(w io.Writer) error
+	// History lists overwritten versions, newest first
+	History(id Slug, offset, limit int) ([]PageEntry, error)
+	// HistoryWithDeletes also lists who deleted the page and when
+	HistoryWithDeletes(id Slug, offset, limit int) ([]PageEntry, error)
+	// CompactJournal removes journal entries not needed for the newest versions
+	CompactJournal(id Slug, keepVersions int) error
+
+	// CheckLinks lists internal links of the group pages to pages that
+	// do not exist, see InternalLinks. Links to groups that are not in
+	// the database, such as modules, are not checked.
+	CheckLinks() ([]BrokenLink, error)
+	// Backlinks lists pages of any group with an internal link to id,
+	// see InternalLinks. Links of the page to itself are not included.
+	Backlinks(id Slug) ([]PageEntry, error)
+
+	// AcquireLock takes an advisory edit lock on id for ttl, a non-positive
+	// ttl uses DefaultLockTTL. When another user holds an unexpired lock,
+	// it returns false and the holder. The holder can acquire it again to
+	// extend it. Locks do not block writing the page.
+	AcquireLock(id Slug, user Slug, ttl time.Duration) (acquired bool, holder Slug)
+	// ReleaseLock removes the lock of user on id, if any
+	ReleaseLock(id Slug, user Slug) error
+}
+
+// DefaultLockTTL is how long an edit lock is held unless extended
+const DefaultLockTTL = 5 * time.Minute
+
+// DefaultHistoryLimit is the number of versions listed when no limit is given
+const DefaultHistoryLimit = 1000
+
+// FullHistory lists up to DefaultHistoryLimit versions of the page
+//
+// Deprecated: use Pages.History with an explicit window.
+func FullHistory(pages Pages, id Slug) ([]PageEntry, error) {
+	return pages.History(id, 0, DefaultHistoryLimit)
+}
+
+// ListOptions filters and orders page listings
+type ListOptions struct {
+	// Tags matches pages with any of the tags, when empty all pages match
+	Tags []string
+	// SortBy is one of SortBySlug, SortByModified or SortByCreated
+	SortBy     string
+	Descending bool
+}
+
+// GroupStats summarizes the pages of a group
+type GroupStats struct {
+	Pages        int
+	Tags         int
+	LastModified time.Time
+}
+
+const (
+	SortBySlug     = "slug"
+	SortByModified = "modified"
+	SortByCreated  = "created"
+)
+
+// Search result windows
+const (
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+)
+
+// SearchWindow clamps offset and limit of a search,
+// a non-positive limit is replaced with DefaultSearchLimit
+func SearchWindow(offset, limit int) (int, int) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = DefaultSearchLimit
+	}
+	if limit > MaxSearchLimit {
+		limit = MaxSearchLimit
+	}
+	return offset, limit
 }
 
 type Index interface {
 	List() ([]PageEntry, error)
+	// ListCtx is List cancelled together with ctx
+	ListCtx(ctx context.Context) ([]PageEntry, error)
+
+	// Search returns a window of the matching pages and the number of all matches
+	Search(text string, offset, limit int) (entries []PageEntry, total int, err error)
+	SearchFilter(text, exclude, include string, offset, limit int) (entries []PageEntry, total int, err error)
+	// SearchFiltered is Search limited to pages that have all of the tags,
+	// a non-empty exclude additionally filters owners like SearchFilter
+	SearchFiltered(text string, tags []string, exclude, include string, offset, limit int) (entries []PageEntry, total int, err error)
 
-	Search(text string) ([]PageEntry, error)
-	SearchFilter(text, exclude, include string) ([]PageEntry, error)
+	// SearchCtx, SearchFilterCtx and SearchFilteredCtx are cancelled together with ctx
+	SearchCtx(ctx context.Context, text string, offset, limit int) (entries []PageEntry, total int, err error)
+	SearchFilterCtx(ctx context.Context, text, exclude, include string, offset, limit int) (entries []PageEntry, total int, err error)
+	SearchFilteredCtx(ctx context.Context, text string, tags []string, exclude, include string, offset, limit int) (entries []PageEntry, total int, err error)
 
 	Tags() ([]TagEntry, error)
 	ByTag(tag Slug) ([]PageEntry, error)
@@ -136,6 +443,12 @@ type Index interface {
 
 	RecentChanges(n int) ([]PageEntry, error)
 	RecentChangesByGroup(n int, groupID Slug) ([]PageEntry, error)
+	// RecentChangesSince lists pages modified after since,
+	// when groupID is empty pages of all groups are listed
+	RecentChangesSince(n int, groupID Slug, since time.Time) ([]PageEntry, error)
+	// RecentChangesByActor lists readable pages changed by actor after since,
+	// only admins can list changes of other users
+	RecentChangesByActor(actor Slug, n int, since time.Time) ([]PageEntry, error)
 }
 
 func init() { gob.Register(User{}) }
@@ -157,6 +470,8 @@ type Group struct {
 	OwnerID Slug
 	Name    string
 	Public  bool
+	// Frozen groups reject all page writes, see Access.SetFrozen
+	Frozen bool
 
 	Description string
 }
@@ -0,0 +1,38 @@
+package kb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestConcurrentEditError(t *testing.T) {
+	err := fmt.Errorf("saving: %w", ConcurrentEditError{CurrentVersion: 3})
+	if !errors.Is(err, ErrConcurrentEdit) {
+		t.Errorf("expected %v to match ErrConcurrentEdit", err)
+	}
+
+	var conflict ConcurrentEditError
+	if !errors.As(err, &conflict) || conflict.CurrentVersion != 3 {
+		t.Errorf("expected current version 3, got %v", conflict)
+	}
+}
+
+func TestRoleOrdering(t *testing.T) {
+	if !(RoleUser < RoleEditor && RoleEditor < RoleModerator && RoleModerator < RoleAdmin) {
+		t.Errorf("roles are not ordered by privilege")
+	}
+	if RoleModerator < RoleEditor {
+		t.Errorf("moderator should include editor")
+	}
+
+	for _, role := range []Role{RoleUser, RoleEditor, RoleModerator, RoleAdmin} {
+		parsed, err := ParseRole(role.String())
+		if err != nil || parsed != role {
+			t.Errorf("%v: parsed as %v, %v", role, parsed, err)
+		}
+	}
+	if _, err := ParseRole("owner"); err == nil {
+		t.Errorf("parsing unknown role should fail")
+	}
+}
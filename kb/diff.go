@@ -0,0 +1,170 @@
+package kb
+
+import (
+	"reflect"
+	"regexp"
+)
+
+// Kinds of StoryChange
+const (
+	ItemAdded    = "added"
+	ItemRemoved  = "removed"
+	ItemModified = "modified"
+	ItemMoved    = "moved"
+)
+
+// StoryChange describes a difference of a single item between two stories
+type StoryChange struct {
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Type string `json:"type"`
+
+	Old Item `json:"old,omitempty"`
+	New Item `json:"new,omitempty"`
+
+	// Text contains the word diff of text items when modified
+	Text []TextChange `json:"text,omitempty"`
+}
+
+// Operations of TextChange
+const (
+	TextEqual  = "="
+	TextInsert = "+"
+	TextDelete = "-"
+)
+
+// TextChange is a span of text that is kept, inserted or deleted
+type TextChange struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// DiffStory compares stories by item ids. Changes are reported in the order
+// of the new story, followed by the removed items in the order of the old.
+// An item that is both moved and edited is reported twice.
+func DiffStory(old, new Story) []StoryChange {
+	changes := []StoryChange{}
+
+	oldByID := map[string]Item{}
+	for _, item := range old {
+		oldByID[item.ID()] = item
+	}
+	newByID := map[string]Item{}
+	for _, item := range new {
+		newByID[item.ID()] = item
+	}
+
+	// items that keep their relative order are not considered moved
+	oldIDs, newIDs := []string{}, []string{}
+	for _, item := range old {
+		if _, ok := newByID[item.ID()]; ok {
+			oldIDs = append(oldIDs, item.ID())
+		}
+	}
+	for _, item := range new {
+		if _, ok := oldByID[item.ID()]; ok {
+			newIDs = append(newIDs, item.ID())
+		}
+	}
+	stable := map[string]bool{}
+	for _, op := range diffTokens(oldIDs, newIDs) {
+		if op.Op == TextEqual {
+			stable[op.Text] = true
+		}
+	}
+
+	for _, item := range new {
+		id := item.ID()
+		prev, existed := oldByID[id]
+		if !existed {
+			changes = append(changes, StoryChange{Kind: ItemAdded, ID: id, Type: item.Type(), New: item})
+			continue
+		}
+
+		if !stable[id] {
+			changes = append(changes, StoryChange{Kind: ItemMoved, ID: id, Type: item.Type(), Old: prev, New: item})
+		}
+		if !reflect.DeepEqual(prev, item) {
+			change := StoryChange{Kind: ItemModified, ID: id, Type: item.Type(), Old: prev, New: item}
+			if hasText(prev) && hasText(item) && prev.Val("text") != item.Val("text") {
+				change.Text = DiffText(prev.Val("text"), item.Val("text"))
+			}
+			changes = append(changes, change)
+		}
+	}
+
+	for _, item := range old {
+		if _, ok := newByID[item.ID()]; !ok {
+			changes = append(changes, StoryChange{Kind: ItemRemoved, ID: item.ID(), Type: item.Type(), Old: item})
+		}
+	}
+
+	return changes
+}
+
+func hasText(item Item) bool {
+	switch item.Type() {
+	case "paragraph", "html", "markdown":
+		return true
+	}
+	return false
+}
+
+var rxWords = regexp.MustCompile(`\s+|[^\s]+`)
+
+// DiffText returns a word diff between a and b
+func DiffText(a, b string) []TextChange {
+	changes := []TextChange{}
+	for _, token := range diffTokens(rxWords.FindAllString(a, -1), rxWords.FindAllString(b, -1)) {
+		if n := len(changes); n > 0 && changes[n-1].Op == token.Op {
+			changes[n-1].Text += token.Text
+			continue
+		}
+		changes = append(changes, token)
+	}
+	return changes
+}
+
+// diffTokens returns an operation for each token using
+// the longest common subsequence of a and b
+func diffTokens(a, b []string) []TextChange {
+	// lcs[i][k] is the length of the common subsequence of a[i:] and b[k:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for k := len(b) - 1; k >= 0; k-- {
+			if a[i] == b[k] {
+				lcs[i][k] = lcs[i+1][k+1] + 1
+			} else if lcs[i+1][k] >= lcs[i][k+1] {
+				lcs[i][k] = lcs[i+1][k]
+			} else {
+				lcs[i][k] = lcs[i][k+1]
+			}
+		}
+	}
+
+	ops := []TextChange{}
+	i, k := 0, 0
+	for i < len(a) && k < len(b) {
+		switch {
+		case a[i] == b[k]:
+			ops = append(ops, TextChange{TextEqual, a[i]})
+			i, k = i+1, k+1
+		case lcs[i+1][k] >= lcs[i][k+1]:
+			ops = append(ops, TextChange{TextDelete, a[i]})
+			i++
+		default:
+			ops = append(ops, TextChange{TextInsert, b[k]})
+			k++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, TextChange{TextDelete, a[i]})
+	}
+	for ; k < len(b); k++ {
+		ops = append(ops, TextChange{TextInsert, b[k]})
+	}
+	return ops
+}
@@ -0,0 +1,65 @@
+package kb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func kinds(changes []StoryChange) []string {
+	result := []string{}
+	for _, change := range changes {
+		result = append(result, change.Kind+" "+change.ID)
+	}
+	return result
+}
+
+func TestDiffStory(t *testing.T) {
+	a := Item{"type": "paragraph", "id": "a", "text": "First paragraph."}
+	b := Item{"type": "tags", "id": "b", "text": "alpha"}
+	c := Item{"type": "paragraph", "id": "c", "text": "Third paragraph."}
+	d := Item{"type": "paragraph", "id": "d", "text": "Added paragraph."}
+
+	cases := []struct {
+		Name     string
+		Old, New Story
+		Exp      []string
+	}{
+		{"unchanged", Story{a, b, c}, Story{a, b, c}, []string{}},
+		{"added", Story{a, b}, Story{a, d, b}, []string{"added d"}},
+		{"removed", Story{a, b, c}, Story{a, c}, []string{"removed b"}},
+		{"reordered", Story{a, b, c}, Story{a, c, b}, []string{"moved b"}},
+		{"moved to front", Story{a, b, c}, Story{c, a, b}, []string{"moved c"}},
+		{"edited", Story{a, b}, Story{
+			a, Item{"type": "tags", "id": "b", "text": "alpha, beta"},
+		}, []string{"modified b"}},
+	}
+
+	for _, test := range cases {
+		got := kinds(DiffStory(test.Old, test.New))
+		if !reflect.DeepEqual(got, test.Exp) {
+			t.Errorf("%s: got %v, expected %v", test.Name, got, test.Exp)
+		}
+	}
+}
+
+func TestDiffStoryText(t *testing.T) {
+	old := Story{Item{"type": "paragraph", "id": "a", "text": "Open the calendar view."}}
+	new := Story{Item{"type": "paragraph", "id": "a", "text": "Open the scheduling view first."}}
+
+	changes := DiffStory(old, new)
+	if len(changes) != 1 || changes[0].Kind != ItemModified {
+		t.Fatalf("got %v", kinds(changes))
+	}
+
+	exp := []TextChange{
+		{TextEqual, "Open the "},
+		{TextDelete, "calendar"},
+		{TextInsert, "scheduling"},
+		{TextEqual, " "},
+		{TextDelete, "view."},
+		{TextInsert, "view first."},
+	}
+	if !reflect.DeepEqual(changes[0].Text, exp) {
+		t.Errorf("got %#v, expected %#v", changes[0].Text, exp)
+	}
+}
@@ -0,0 +1,93 @@
+package kb
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// HTTPError is an error with an explicit status and code
+type HTTPError struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+func (err *HTTPError) Error() string { return err.Message }
+
+// BadRequest creates an error for invalid input from the client
+func BadRequest(message string) error {
+	return &HTTPError{
+		Status:  http.StatusBadRequest,
+		Code:    "bad-request",
+		Message: message,
+	}
+}
+
+// ErrorStatus returns the http status and error code for err
+func ErrorStatus(err error) (status int, code string) {
+	var herr *HTTPError
+	switch {
+	case errors.As(err, &herr):
+		return herr.Status, herr.Code
+	case errors.Is(err, ErrPageNotExist),
+		errors.Is(err, ErrAliasNotExist),
+		errors.Is(err, ErrUserNotExist),
+		errors.Is(err, ErrGroupNotExist),
+		errors.Is(err, ErrInviteNotExist),
+		errors.Is(err, ErrTokenNotExist):
+		return http.StatusNotFound, "not-found"
+	case errors.Is(err, ErrInviteExpired),
+		errors.Is(err, ErrInviteUsed):
+		return http.StatusGone, "invite-unavailable"
+	case errors.Is(err, ErrPageExists):
+		return http.StatusForbidden, "exists"
+	case errors.Is(err, ErrUserExists),
+		errors.Is(err, ErrGroupExists),
+		errors.Is(err, ErrStatementExists):
+		return http.StatusConflict, "exists"
+	case errors.Is(err, ErrConcurrentEdit):
+		return http.StatusConflict, "concurrent-edit"
+	case errors.Is(err, ErrInvalidSlug):
+		return http.StatusBadRequest, "invalid-slug"
+	case errors.Is(err, ErrAccessDenied):
+		return http.StatusForbidden, "access-denied"
+	case errors.Is(err, ErrGroupFrozen):
+		return http.StatusForbidden, "group-frozen"
+	}
+	return http.StatusInternalServerError, "internal"
+}
+
+type errorEnvelope struct {
+	Error errorBody `json:"error"`
+}
+
+type errorBody struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// WriteError writes err as {"error":{"code":"...","message":"..."}}
+// when the client accepts JSON, otherwise as plain text.
+func WriteError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := ErrorStatus(err)
+	if !acceptsJSON(r) {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	data, _ := json.Marshal(errorEnvelope{errorBody{
+		Code:    code,
+		Message: err.Error(),
+	}})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func acceptsJSON(r *http.Request) bool {
+	return r != nil && strings.Contains(r.Header.Get("Accept"), "application/json")
+}
@@ -0,0 +1,66 @@
+package kb
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWriteError(t *testing.T) {
+	cases := []struct {
+		Err    error
+		Status int
+		Code   string
+	}{
+		{ErrPageNotExist, http.StatusNotFound, "not-found"},
+		{BadRequest("Page title is missing."), http.StatusBadRequest, "bad-request"},
+		{ConcurrentEditError{CurrentVersion: 2}, http.StatusConflict, "concurrent-edit"},
+	}
+
+	for _, test := range cases {
+		r := httptest.NewRequest("GET", "/test=page", nil)
+		r.Header.Set("Accept", "application/json")
+		w := httptest.NewRecorder()
+
+		WriteError(w, r, test.Err)
+
+		if w.Code != test.Status {
+			t.Errorf("%v: got status %d, expected %d", test.Err, w.Code, test.Status)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%v: got content type %q", test.Err, ct)
+		}
+
+		var envelope struct {
+			Error struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &envelope); err != nil {
+			t.Fatalf("%v: invalid envelope %q: %v", test.Err, w.Body.String(), err)
+		}
+		if envelope.Error.Code != test.Code || envelope.Error.Message != test.Err.Error() {
+			t.Errorf("%v: got %+v", test.Err, envelope.Error)
+		}
+	}
+}
+
+func TestWriteErrorPlain(t *testing.T) {
+	r := httptest.NewRequest("GET", "/test=page", nil)
+	w := httptest.NewRecorder()
+
+	WriteError(w, r, ErrPageNotExist)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("got status %d", w.Code)
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		t.Errorf("got content type %q", w.Header().Get("Content-Type"))
+	}
+	if strings.TrimSpace(w.Body.String()) != ErrPageNotExist.Error() {
+		t.Errorf("got body %q", w.Body.String())
+	}
+}
@@ -0,0 +1,42 @@
+package kb
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// ReadyTimeout limits how long ReadyHandler waits for the databases
+const ReadyTimeout = 5 * time.Second
+
+// Pinger is implemented by databases that can verify their connection
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// HealthHandler responds OK as long as the process is serving requests
+func HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		fmt.Fprint(w, "OK")
+	})
+}
+
+// ReadyHandler responds OK only when every database responds to a ping
+func ReadyHandler(databases ...Pinger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		ctx, cancel := context.WithTimeout(r.Context(), ReadyTimeout)
+		defer cancel()
+
+		for _, db := range databases {
+			if err := db.PingContext(ctx); err != nil {
+				http.Error(w, "Database unavailable: "+err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+		}
+		fmt.Fprint(w, "OK")
+	})
+}
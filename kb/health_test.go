@@ -0,0 +1,42 @@
+package kb
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type testPinger struct{ err error }
+
+func (db testPinger) PingContext(ctx context.Context) error { return db.err }
+
+func TestHealthHandler(t *testing.T) {
+	r := httptest.NewRequest("GET", "/healthz", nil)
+	w := httptest.NewRecorder()
+	HealthHandler().ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("got status %d, expected %d", w.Code, http.StatusOK)
+	}
+}
+
+func TestReadyHandler(t *testing.T) {
+	cases := []struct {
+		Databases []Pinger
+		Status    int
+	}{
+		{nil, http.StatusOK},
+		{[]Pinger{testPinger{}, testPinger{}}, http.StatusOK},
+		{[]Pinger{testPinger{}, testPinger{errors.New("connection refused")}}, http.StatusServiceUnavailable},
+	}
+
+	for i, test := range cases {
+		r := httptest.NewRequest("GET", "/readyz", nil)
+		w := httptest.NewRecorder()
+		ReadyHandler(test.Databases...).ServeHTTP(w, r)
+		if w.Code != test.Status {
+			t.Errorf("%d: got status %d, expected %d", i, w.Code, test.Status)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package kb
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// HighlightLength is the maximum number of characters in a search highlight
+const HighlightLength = 160
+
+// Markers around the matched terms in a highlight
+const (
+	HighlightStart = "<mark>"
+	HighlightEnd   = "</mark>"
+)
+
+var rxTag = regexp.MustCompile(`<[^>]*>`)
+
+// Highlight returns an escaped snippet of text around the first match of
+// any word in query, all matches in the snippet are wrapped in HighlightStart
+// and HighlightEnd. Text may contain html, which is removed.
+// Highlight returns an empty string when nothing matches.
+func Highlight(text, query string, maxLength int) string {
+	words := []string{}
+	for _, word := range strings.Fields(query) {
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	if len(words) == 0 || maxLength <= 0 {
+		return ""
+	}
+	rxQuery := regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+
+	text = PlainText(text)
+
+	first := rxQuery.FindStringIndex(text)
+	if first == nil {
+		return ""
+	}
+
+	// center the window around the first match
+	before := (maxLength - utf8.RuneCountInString(text[first[0]:first[1]])) / 2
+	start := first[0]
+	for ; before > 0 && start > 0; before-- {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+	end := start
+	for n := 0; n < maxLength && end < len(text); n++ {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+	}
+	// use the remaining space before the match when the text ends early
+	for n := utf8.RuneCountInString(text[start:end]); n < maxLength && start > 0; n++ {
+		_, size := utf8.DecodeLastRuneInString(text[:start])
+		start -= size
+	}
+
+	snippet := text[start:end]
+	var out strings.Builder
+	if start > 0 {
+		out.WriteString("…")
+	}
+	last := 0
+	for _, match := range rxQuery.FindAllStringIndex(snippet, -1) {
+		out.WriteString(html.EscapeString(snippet[last:match[0]]))
+		out.WriteString(HighlightStart)
+		out.WriteString(html.EscapeString(snippet[match[0]:match[1]]))
+		out.WriteString(HighlightEnd)
+		last = match[1]
+	}
+	out.WriteString(html.EscapeString(snippet[last:]))
+	if end < len(text) {
+		out.WriteString("…")
+	}
+	return out.String()
+}
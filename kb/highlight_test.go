@@ -0,0 +1,48 @@
+package kb
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		text, query, expected string
+	}{
+		{"Posting charges to an account.", "charges", "Posting <mark>charges</mark> to an account."},
+		{"<p>Posting <b>Charges</b> &amp; fees</p>", "charges", "Posting <mark>Charges</mark> &amp; fees"},
+		{"Charges and more charges.", "CHARGES", "<mark>Charges</mark> and more <mark>charges</mark>."},
+		{"Posting charges to an account.", "account post", "<mark>Post</mark>ing charges to an <mark>account</mark>."},
+		{"Nothing matches here.", "charges", ""},
+		{"Anything", "", ""},
+	}
+	for _, test := range tests {
+		if got := Highlight(test.text, test.query, HighlightLength); got != test.expected {
+			t.Errorf("Highlight(%q, %q): got %q, expected %q", test.text, test.query, got, test.expected)
+		}
+	}
+}
+
+func TestHighlightTruncate(t *testing.T) {
+	text := strings.Repeat("lorem ipsum ", 50) + "needle " + strings.Repeat("dolor sit ", 50)
+
+	got := Highlight(text, "needle", 40)
+	if !strings.Contains(got, "<mark>needle</mark>") {
+		t.Errorf("missing marked term in %q", got)
+	}
+	if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") {
+		t.Errorf("missing ellipsis in %q", got)
+	}
+
+	plain := strings.NewReplacer(HighlightStart, "", HighlightEnd, "", "…", "").Replace(got)
+	if n := utf8.RuneCountInString(plain); n != 40 {
+		t.Errorf("got %d characters, expected 40: %q", n, plain)
+	}
+
+	got = Highlight("short needle at the end", "end", 10)
+	plain = strings.NewReplacer(HighlightStart, "", HighlightEnd, "", "…", "").Replace(got)
+	if n := utf8.RuneCountInString(plain); n != 10 || !strings.HasSuffix(got, "<mark>end</mark>") {
+		t.Errorf("match at the end: got %q", got)
+	}
+}
@@ -0,0 +1,68 @@
+package kb
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"time"
+)
+
+// IDLength is the length of ids returned by NewID
+const IDLength = 26
+
+// crockford is the Crockford base32 alphabet used by ULID
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewID returns a new item id in ULID format: 48 bits of milliseconds since
+// Unix epoch followed by 80 random bits, encoded as 26 characters of Crockford
+// base32. The ids are URL-safe and sort by creation time.
+func NewID() string { return newID(time.Now()) }
+
+func newID(now time.Time) string {
+	var data [16]byte
+	ms := uint64(now.UnixNano() / int64(time.Millisecond))
+	binary.BigEndian.PutUint64(data[:8], ms<<16)
+	if _, err := rand.Read(data[6:]); err != nil {
+		panic("kb: unable to read random bytes: " + err.Error())
+	}
+
+	hi := binary.BigEndian.Uint64(data[:8])
+	lo := binary.BigEndian.Uint64(data[8:])
+
+	var id [IDLength]byte
+	for i := IDLength - 1; i >= 0; i-- {
+		id[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(id[:])
+}
+
+// ValidID checks whether id has the format returned by NewID.
+//
+// Items created by the web client or CanonicalizeIDs use hex ids,
+// hence ValidID should not be used to reject stored stories.
+func ValidID(id string) bool {
+	if len(id) != IDLength {
+		return false
+	}
+	// 26 characters hold 130 bits, the first can encode only 3
+	if id[0] > '7' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if !isCrockford(id[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isCrockford(ch byte) bool {
+	switch {
+	case '0' <= ch && ch <= '9':
+		return true
+	case 'A' <= ch && ch <= 'Z':
+		return ch != 'I' && ch != 'L' && ch != 'O' && ch != 'U'
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package kb
+
+import (
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestNewIDUnique(t *testing.T) {
+	const N = 100000
+	seen := make(map[string]bool, N)
+	for i := 0; i < N; i++ {
+		id := NewID()
+		if !ValidID(id) {
+			t.Fatalf("invalid id %q", id)
+		}
+		if seen[id] {
+			t.Fatalf("duplicate id %q", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestNewIDSortable(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	ids := []string{}
+	for i := 0; i < 10; i++ {
+		ids = append(ids, newID(start.Add(time.Duration(i)*time.Millisecond)))
+	}
+	if !sort.StringsAreSorted(ids) {
+		t.Errorf("ids are not sorted by time: %v", ids)
+	}
+}
+
+func TestValidID(t *testing.T) {
+	cases := []struct {
+		ID    string
+		Valid bool
+	}{
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAV", true},
+		{"7ZZZZZZZZZZZZZZZZZZZZZZZZZ", true},
+		{"", false},
+		{"01ARZ3NDEKTSV4RRFFQ69G5FA", false},
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAVX", false},
+		{"01arz3ndektsv4rrffq69g5fav", false},
+		{"01ARZ3NDEKTSV4RRFFQ69G5FAU", false},
+		{"01ARZ3NDEKTSV4RRFFQ69G5-AV", false},
+		{"8ZZZZZZZZZZZZZZZZZZZZZZZZZ", false},
+		{"0123456789abcdef", false},
+	}
+
+	for _, test := range cases {
+		if got := ValidID(test.ID); got != test.Valid {
+			t.Errorf("%q: got %v, expected %v", test.ID, got, test.Valid)
+		}
+	}
+}
@@ -11,6 +11,11 @@ type PageEntry struct {
 	Synopsis string    `json:"synopsis"`
 	Tags     []string  `json:"tags"`
 	Modified time.Time `json:"modified"`
+	// ModifiedBy is the user who last changed the page,
+	// it is only set when listing recent changes
+	ModifiedBy Slug `json:"modifiedBy,omitempty"`
+	// Highlight is a snippet where the page matched a search, see Highlight
+	Highlight string `json:"highlight,omitempty"`
 }
 
 func (page *PageEntry) HasTag(tag string) bool {
@@ -105,11 +110,15 @@ func StoryFromEntries(entries []PageEntry) Story {
 func ItemsFromEntries(entries []PageEntry) []Item {
 	items := []Item{}
 	for _, entry := range entries {
-		items = append(items, Entry(
+		item := Entry(
 			entry.Title,
 			entry.Synopsis,
 			entry.Slug,
-		))
+		)
+		if entry.Highlight != "" {
+			item["highlight"] = entry.Highlight
+		}
+		items = append(items, item)
 	}
 	return items
 }
@@ -0,0 +1,115 @@
+package kb
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// StoryLink is a link to a page of this site
+type StoryLink struct {
+	// Item is the id of the item containing the link
+	Item   string
+	Target Slug
+}
+
+// BrokenLink is a link to a page that does not exist
+type BrokenLink struct {
+	// Page contains the link
+	Page   Slug   `json:"page"`
+	Item   string `json:"item"`
+	Target Slug   `json:"target"`
+}
+
+var (
+	rxHTMLHref       = regexp.MustCompile(`(?i)<a\s[^>]*\bhref\s*=\s*["']([^"']*)["']`)
+	rxMarkdownTarget = regexp.MustCompile(`(?:^|[^!])\[[^\]]*\]\(\s*([^)\s]+)`)
+)
+
+// InternalLinks returns the links to pages of this site in story, including
+// nested stories. External urls and anchors are ignored, links without
+// an owner refer to pages of group.
+func InternalLinks(group Slug, story Story) []StoryLink {
+	var links []StoryLink
+	add := func(item Item, link string) {
+		if target, ok := internalTarget(group, link); ok {
+			links = append(links, StoryLink{Item: item.ID(), Target: target})
+		}
+	}
+
+	for _, item := range story {
+		switch item.Type() {
+		case "entry":
+			add(item, item.Val("link"))
+		case "reference":
+			add(item, item.Val("url"))
+		case "paragraph":
+			for _, match := range rxInternalLink.FindAllStringSubmatch(item.Val("text"), -1) {
+				add(item, match[1])
+			}
+		case "html":
+			for _, match := range rxHTMLHref.FindAllStringSubmatch(item.Val("text"), -1) {
+				add(item, match[1])
+			}
+		case "markdown":
+			for _, match := range rxMarkdownTarget.FindAllStringSubmatch(item.Val("text"), -1) {
+				add(item, match[1])
+			}
+		}
+
+		if nested := nestedStory(item); len(nested) > 0 {
+			links = append(links, InternalLinks(group, nested)...)
+		}
+	}
+	return links
+}
+
+// internalTarget returns the page slug of a link within this site
+func internalTarget(group Slug, link string) (Slug, bool) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return "", false
+	}
+
+	u, err := url.Parse(link)
+	if err != nil || u.Scheme != "" || u.Host != "" {
+		return "", false
+	}
+
+	path := strings.TrimPrefix(u.Path, "/")
+	if path == "" {
+		return "", false
+	}
+
+	owner, slug := TokenizeLink(path)
+	if owner == "" {
+		return group + "=" + slug, true
+	}
+	return slug, true
+}
+
+// LinkKeyword returns the longest word of the page name of target that
+// every link to target contains, ignoring case. Words that may come from
+// a symbol, such as "amp" for '&', are skipped. It returns "" when
+// there is no such word.
+func LinkKeyword(target Slug) string {
+	name := string(target)
+	if i := strings.Index(name, "="); i >= 0 {
+		name = name[i+1:]
+	}
+
+	symbols := make(map[string]bool, len(runename))
+	for _, symbol := range runename {
+		symbols[symbol] = true
+	}
+
+	keyword := ""
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !('a' <= r && r <= 'z' || '0' <= r && r <= '9')
+	}) {
+		if len(word) > len(keyword) && !symbols[word] {
+			keyword = word
+		}
+	}
+	return keyword
+}
@@ -0,0 +1,49 @@
+package kb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInternalLinks(t *testing.T) {
+	story := Story{
+		Entry("Setup", "", "help=setup"),
+		Reference("External", "https://example.com/help=setup", ""),
+		Item{"type": "paragraph", "id": "p", "text": "See [[Getting Started]], [[team=Plans]] and [[https://example.com Example]]."},
+		Item{"type": "html", "id": "h", "text": `<a href="/help=faq#billing">FAQ</a> <a href="mailto:kb@example.com">mail</a> <a href="#top">top</a>`},
+		Item{"type": "markdown", "id": "m", "text": "[Intro](help=intro) ![logo](/logo.png)"},
+		Collapsible("More", Story{
+			Item{"type": "entry", "id": "nested", "link": "help=nested"},
+		}),
+	}
+
+	exp := []StoryLink{
+		{Item: "help=setup", Target: "help=setup"},
+		{Item: "p", Target: "help=getting-started"},
+		{Item: "p", Target: "team=plans"},
+		{Item: "h", Target: "help=faq"},
+		{Item: "m", Target: "help=intro"},
+		{Item: "nested", Target: "help=nested"},
+	}
+	if got := InternalLinks("help", story); !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+}
+
+func TestLinkKeyword(t *testing.T) {
+	cases := []struct {
+		Target  Slug
+		Keyword string
+	}{
+		{"test=intro-page", "intro"},
+		{"help=billing/posting-charges", "billing"},
+		{"test=q-amp-answers", "answers"},
+		{"test=amp", ""},
+		{"test=世界", ""},
+	}
+	for _, test := range cases {
+		if got := LinkKeyword(test.Target); got != test.Keyword {
+			t.Errorf("%q: got %q, expected %q", test.Target, got, test.Keyword)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package kb
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OutlineEntry is a single heading of a page
+type OutlineEntry struct {
+	Text  string `json:"text"`
+	Level int    `json:"level"`
+	// ID is the anchor of the heading, unique within the page
+	ID string `json:"id"`
+}
+
+var (
+	rxHTMLHeading     = regexp.MustCompile(`(?is)<h([1-6])\b([^>]*)>(.*?)</h[1-6]\s*>`)
+	rxHTMLID          = regexp.MustCompile(`(?i)\bid\s*=\s*["']([^"']+)["']`)
+	rxMarkdownHeading = regexp.MustCompile(`^ {0,3}(#{1,6})[ \t]+(.*?)(?:[ \t]+#+)?[ \t]*$`)
+	rxMarkdownInline  = regexp.MustCompile("[*_`~]+")
+)
+
+// Outline returns the headings of html and markdown items in the story,
+// in the order they appear. Headings without an id attribute get an anchor
+// based on their text, repeated anchors are suffixed with -1, -2, ...
+func Outline(page *Page) []OutlineEntry {
+	outline := []OutlineEntry{}
+	used := map[string]bool{}
+
+	add := func(level int, text, id string) {
+		text = PlainText(text)
+		if text == "" {
+			return
+		}
+		if id == "" {
+			id = string(Slugify(text))
+		}
+		anchor := id
+		for n := 1; used[anchor]; n++ {
+			anchor = id + "-" + strconv.Itoa(n)
+		}
+		used[anchor] = true
+		outline = append(outline, OutlineEntry{Text: text, Level: level, ID: anchor})
+	}
+
+	for _, item := range page.Story {
+		switch item.Type() {
+		case "html":
+			for _, match := range rxHTMLHeading.FindAllStringSubmatch(item.Val("text"), -1) {
+				level, _ := strconv.Atoi(match[1])
+				id := ""
+				if attr := rxHTMLID.FindStringSubmatch(match[2]); attr != nil {
+					id = attr[1]
+				}
+				add(level, match[3], id)
+			}
+		case "markdown":
+			fence := ""
+			for _, line := range strings.Split(item.Val("text"), "\n") {
+				trimmed := strings.TrimSpace(line)
+				if fence != "" {
+					if strings.HasPrefix(trimmed, fence) {
+						fence = ""
+					}
+					continue
+				}
+				if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+					fence = trimmed[:3]
+					continue
+				}
+
+				if match := rxMarkdownHeading.FindStringSubmatch(line); match != nil {
+					text := rxMarkdownLink.ReplaceAllString(match[2], "$1")
+					add(len(match[1]), rxMarkdownInline.ReplaceAllString(text, ""), "")
+				}
+			}
+		}
+	}
+	return outline
+}
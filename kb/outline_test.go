@@ -0,0 +1,41 @@
+package kb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOutline(t *testing.T) {
+	page := &Page{Story: Story{
+		Item{"type": "markdown", "text": "# Guide\n\nIntro text.\n\n## Getting *Started*\n\n```\n# not a heading\n```\n\n### Install [tools](http://example.com) ##"},
+		Paragraph("# not a heading either"),
+		HTML(`<h2 id="config">Configuration</h2><p>text</p><H3>Files &amp; Folders</H3>`),
+	}}
+
+	exp := []OutlineEntry{
+		{Text: "Guide", Level: 1, ID: "guide"},
+		{Text: "Getting Started", Level: 2, ID: "getting-started"},
+		{Text: "Install tools", Level: 3, ID: "install-tools"},
+		{Text: "Configuration", Level: 2, ID: "config"},
+		{Text: "Files & Folders", Level: 3, ID: string(Slugify("Files & Folders"))},
+	}
+	if got := Outline(page); !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+}
+
+func TestOutlineDuplicates(t *testing.T) {
+	page := &Page{Story: Story{
+		Item{"type": "markdown", "text": "## Example\n\n## Example\n\n## Example 1"},
+		HTML("<h2>Example</h2>"),
+	}}
+
+	var ids []string
+	for _, entry := range Outline(page) {
+		ids = append(ids, entry.ID)
+	}
+	exp := []string{"example", "example-1", "example-1-1", "example-2"}
+	if !reflect.DeepEqual(ids, exp) {
+		t.Errorf("got %v, expected %v", ids, exp)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"strings"
 	"time"
 )
 
@@ -153,15 +154,17 @@ func (s *Story) RemoveByID(id string) (item Item, err error) {
 	return item, fmt.Errorf("missing item id '%v'", id)
 }
 
-func NewID() string { return fmt.Sprintf("%016x", rand.Int63()) }
-
 // Item represents a federated wiki Story item
 type Item map[string]interface{}
 
 // Val returns a string value from key
 func (item Item) Val(key string) string {
-	if s, ok := item[key].(string); ok {
-		return s
+	switch v := item[key].(type) {
+	case string:
+		return v
+	case Slug:
+		// set by constructors such as Entry
+		return string(v)
 	}
 	return ""
 }
@@ -245,6 +248,74 @@ func (action Action) Time() (t time.Time, err error) {
 	return time.Time{}, fmt.Errorf("unknown date format")
 }
 
+// AddTagAction creates an action that adds tag to the tags item of the page
+func AddTagAction(tag string) Action {
+	return Action{"type": "add-tag", "tag": tag}
+}
+
+// RemoveTagAction creates an action that removes tag from the tags items of the page
+func RemoveTagAction(tag string) Action {
+	return Action{"type": "remove-tag", "tag": tag}
+}
+
+// addTag adds tag to the first tags item, creating one when needed
+func (p *Page) addTag(tag string) error {
+	tag = strings.TrimSpace(tag)
+	if tag == "" || strings.Contains(tag, ",") {
+		return fmt.Errorf("invalid tag %q", tag)
+	}
+
+	slug := string(Slugify(tag))
+	for _, existing := range SlugifyTags(ExtractTags(p)) {
+		if existing == slug {
+			return nil
+		}
+	}
+
+	for _, item := range p.Story {
+		if item.Type() == "tags" {
+			tags := splitTags(item.Val("text"))
+			item["text"] = strings.Join(append(tags, tag), ", ")
+			return nil
+		}
+	}
+	p.Story.Prepend(Tags(tag))
+	return nil
+}
+
+// removeTag removes tag from all tags items, emptied items are removed
+func (p *Page) removeTag(tag string) error {
+	slug := Slugify(tag)
+	story := p.Story[:0]
+	for _, item := range p.Story {
+		if item.Type() == "tags" {
+			kept := []string{}
+			for _, t := range splitTags(item.Val("text")) {
+				if Slugify(t) != slug {
+					kept = append(kept, t)
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			item["text"] = strings.Join(kept, ", ")
+		}
+		story = append(story, item)
+	}
+	p.Story = story
+	return nil
+}
+
+func splitTags(text string) []string {
+	tags := []string{}
+	for _, tag := range strings.Split(text, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
 // actionfns defines how each action type is applied
 var actionfns = map[string]func(p *Page, a Action) error{
 	"add": func(p *Page, action Action) error {
@@ -274,6 +345,12 @@ var actionfns = map[string]func(p *Page, a Action) error{
 	"move": func(p *Page, action Action) error {
 		return p.Story.Move(action.Str("id"), action.Str("after"))
 	},
+	"add-tag": func(p *Page, action Action) error {
+		return p.addTag(action.Str("tag"))
+	},
+	"remove-tag": func(p *Page, action Action) error {
+		return p.removeTag(action.Str("tag"))
+	},
 	"create": func(p *Page, action Action) error {
 		return nil
 	},
@@ -0,0 +1,59 @@
+package kb
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func sortedTags(page *Page) []string {
+	tags := SlugifyTags(ExtractTags(page))
+	sort.Strings(tags)
+	return tags
+}
+
+func TestTagActions(t *testing.T) {
+	page := &Page{Story: Story{Paragraph("Content.")}}
+
+	apply := func(action Action) {
+		t.Helper()
+		if err := page.Apply(action); err != nil {
+			t.Fatalf("%v: %v", action, err)
+		}
+	}
+
+	apply(AddTagAction("Scheduling"))
+	if page.Story[0].Type() != "tags" || page.Story[0].Val("text") != "Scheduling" {
+		t.Fatalf("expected new tags item, got %v", page.Story)
+	}
+
+	apply(AddTagAction(" Billing Codes "))
+	apply(AddTagAction("scheduling"))
+	if got, exp := page.Story[0].Val("text"), "Scheduling, Billing Codes"; got != exp {
+		t.Errorf("got tags %q, expected %q", got, exp)
+	}
+	if got, exp := sortedTags(page), []string{"billing-codes", "scheduling"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got tag slugs %v, expected %v", got, exp)
+	}
+
+	apply(RemoveTagAction("billing codes"))
+	if got, exp := sortedTags(page), []string{"scheduling"}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("after remove: got %v, expected %v", got, exp)
+	}
+
+	apply(RemoveTagAction("Scheduling"))
+	if len(page.Story) != 1 || page.Story[0].Type() != "paragraph" {
+		t.Errorf("expected empty tags item to be removed, got %v", page.Story)
+	}
+
+	apply(RemoveTagAction("missing"))
+	if page.Version != 6 {
+		t.Errorf("got version %d, expected 6", page.Version)
+	}
+
+	for _, tag := range []string{"  ", "alpha, beta"} {
+		if err := page.Apply(AddTagAction(tag)); err == nil {
+			t.Errorf("expected error for tag %q", tag)
+		}
+	}
+}
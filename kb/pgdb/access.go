@@ -1,7 +1,10 @@
 package pgdb
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 
 	"github.com/raintreeinc/knowledgebase/kb"
 )
@@ -22,11 +25,33 @@ func (db Access) VerifyUser(user kb.User) error {
 }
 
 func (db Access) IsAdmin(user kb.Slug) bool {
-	return db.BoolQuery(`SELECT FROM Users WHERE ID = $1 AND Admin`, user)
+	role, err := db.RoleOf(user)
+	return err == nil && role == kb.RoleAdmin
 }
 
 func (db Access) SetAdmin(user kb.Slug, isAdmin bool) error {
-	r, err := db.Exec(`UPDATE Users SET Admin = $2 WHERE ID = $1`, user, isAdmin)
+	if isAdmin {
+		return db.SetRole(user, kb.RoleAdmin)
+	}
+
+	role, err := db.RoleOf(user)
+	if err != nil || role != kb.RoleAdmin {
+		return err
+	}
+	return db.SetRole(user, kb.RoleUser)
+}
+
+func (db Access) SetRole(user kb.Slug, role kb.Role) error {
+	if role < kb.RoleUser || role > kb.RoleAdmin {
+		return fmt.Errorf("invalid role %v", role)
+	}
+
+	defer db.rights.invalidateUser(user)
+	r, err := db.Exec(`
+		UPDATE Users
+		SET Role = $2, Admin = $3
+		WHERE ID = $1
+	`, user, role.String(), role == kb.RoleAdmin)
 	if err != nil {
 		return err
 	}
@@ -37,7 +62,45 @@ func (db Access) SetAdmin(user kb.Slug, isAdmin bool) error {
 	return nil
 }
 
+func (db Access) RoleOf(user kb.Slug) (kb.Role, error) {
+	var role string
+	err := db.QueryRow(`SELECT Role FROM Users WHERE ID = $1`, user).Scan(&role)
+	if err == sql.ErrNoRows {
+		return kb.RoleUser, kb.ErrUserNotExist
+	}
+	if err != nil {
+		return kb.RoleUser, err
+	}
+	return kb.ParseRole(role)
+}
+
+func (db Access) ListAdmins() (users []kb.User, err error) {
+	rows, err := db.Query(`
+		SELECT ID, Name, Email
+		FROM Users
+		WHERE Admin
+		ORDER BY ID
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		user := kb.User{Admin: true}
+		if err := rows.Scan(&user.ID, &user.Name, &user.Email); err != nil {
+			return users, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
 func (db Access) Rights(group, user kb.Slug) kb.Rights {
+	if rights, ok := db.rights.get(group, user); ok {
+		return rights
+	}
+
 	var rights string
 
 	// If a person is a direct member of the owner group,
@@ -47,12 +110,95 @@ func (db Access) Rights(group, user kb.Slug) kb.Rights {
 		WHERE GroupID = $1 AND UserID = $2
 	`, group, user).Scan(&rights)
 	if err == nil {
+		db.rights.put(group, user, kb.Rights(rights))
 		return kb.Rights(rights)
 	}
+	if err == sql.ErrNoRows {
+		db.rights.put(group, user, kb.Blocked)
+	}
 	return kb.Blocked
 }
 
+func (db Access) ExplainRights(group, user kb.Slug) (kb.RightsExplanation, error) {
+	explanation := kb.RightsExplanation{
+		Group:  group,
+		User:   user,
+		Rights: kb.Blocked,
+	}
+
+	var maxaccess string
+	err := db.QueryRow(`SELECT MaxAccess FROM Users WHERE ID = $1`, user).Scan(&maxaccess)
+	if err == sql.ErrNoRows {
+		return explanation, kb.ErrUserNotExist
+	}
+	if err != nil {
+		return explanation, err
+	}
+	explanation.MaxAccess = kb.Rights(maxaccess)
+
+	// same sources as AccessView
+	rows, err := db.Query(`
+	WITH RECURSIVE Communities(GroupID, MemberID, Access, Path) AS (
+			SELECT Community.GroupID, Community.MemberID, Community.Access,
+				ARRAY[Community.GroupID, Community.MemberID]
+			FROM Community
+		UNION ALL
+			SELECT Community.GroupID, Communities.MemberID,
+				LEAST(Community.Access, Communities.Access),
+				Community.GroupID || Communities.Path
+			FROM Community
+			JOIN Communities ON Communities.GroupID = Community.MemberID
+			WHERE NOT Community.GroupID = ANY(Communities.Path)
+	)
+		SELECT 'public', Groups.ID, 'reader'::Rights
+			FROM Groups
+			WHERE Groups.ID = $1 AND Groups.Public
+	UNION ALL
+		SELECT 'member', Membership.GroupID, Membership.Access
+			FROM Membership
+			WHERE Membership.GroupID = $1 AND Membership.UserID = $2
+	UNION ALL
+		SELECT 'owner', Groups.OwnerID, Membership.Access
+			FROM Groups
+			JOIN Membership ON Membership.GroupID = Groups.OwnerID
+			WHERE Groups.ID = $1 AND Membership.UserID = $2
+	UNION ALL
+		SELECT 'community', Communities.MemberID, LEAST(Communities.Access, Membership.Access)
+			FROM Communities
+			JOIN Membership ON Membership.GroupID = Communities.MemberID
+			WHERE Communities.GroupID = $1 AND Membership.UserID = $2
+	`, group, user)
+	if err != nil {
+		return explanation, err
+	}
+	defer rows.Close()
+
+	best := kb.Blocked
+	for rows.Next() {
+		var source kb.RightsSource
+		var rights string
+		if err := rows.Scan(&source.Kind, &source.Via, &rights); err != nil {
+			return explanation, err
+		}
+		source.Rights = kb.Rights(rights)
+		if source.Rights.Level() > best.Level() {
+			best = source.Rights
+		}
+		explanation.Sources = append(explanation.Sources, source)
+	}
+	if err := rows.Err(); err != nil {
+		return explanation, err
+	}
+
+	explanation.Rights = best
+	if explanation.MaxAccess.Level() < best.Level() {
+		explanation.Rights = explanation.MaxAccess
+	}
+	return explanation, nil
+}
+
 func (db Access) AddUser(group, user kb.Slug) error {
+	defer db.rights.invalidateUser(user)
 	_, err := db.Exec(`
 		INSERT INTO
 		Membership (GroupID, UserID)
@@ -63,6 +209,7 @@ func (db Access) AddUser(group, user kb.Slug) error {
 }
 
 func (db Access) RemoveUser(group, user kb.Slug) error {
+	defer db.rights.invalidateUser(user)
 	_, err := db.Exec(`
 		DELETE FROM Membership
 		WHERE GroupID = $1 AND UserID = $2
@@ -71,6 +218,7 @@ func (db Access) RemoveUser(group, user kb.Slug) error {
 }
 
 func (db Access) CommunityAdd(group, member kb.Slug, rights kb.Rights) error {
+	defer db.rights.invalidateAll()
 	_, err := db.Exec(`
 		INSERT INTO
 		Community (GroupID, MemberID, Access)
@@ -87,6 +235,7 @@ func (db Access) CommunityAdd(group, member kb.Slug, rights kb.Rights) error {
 }
 
 func (db Access) CommunityRemove(group, member kb.Slug) error {
+	defer db.rights.invalidateAll()
 	_, err := db.Exec(`
 		DELETE FROM Community
 		WHERE GroupID = $1 AND MemberID = $2
@@ -94,6 +243,102 @@ func (db Access) CommunityRemove(group, member kb.Slug) error {
 	return err
 }
 
+func (db Access) SetFrozen(group kb.Slug, frozen bool) error {
+	if !db.IsAdmin(db.ActiveUser) {
+		return kb.ErrAccessDenied
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	r, err := tx.Exec(`
+		UPDATE Groups
+		SET Frozen = $2
+		WHERE ID = $1
+	`, group, frozen)
+	if err != nil {
+		return err
+	}
+	if affected, _ := r.RowsAffected(); affected == 0 {
+		return kb.ErrGroupNotExist
+	}
+
+	action := "unfreeze-group"
+	if frozen {
+		action = "freeze-group"
+	}
+	if err := db.record(tx, action, group, ""); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// PurgeUser removes the memberships, community grants and admin flag of
+// user, the grants reach other members too, so all cached rights are dropped
+func (db Access) PurgeUser(user kb.Slug) error {
+	if !db.IsAdmin(db.ActiveUser) {
+		return kb.ErrAccessDenied
+	}
+	defer db.rights.invalidateAll()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var purged struct {
+		Memberships int64 `json:"memberships"`
+		Communities int64 `json:"communities"`
+	}
+
+	r, err := tx.Exec(`DELETE FROM Membership WHERE UserID = $1`, user)
+	if err != nil {
+		return err
+	}
+	purged.Memberships, _ = r.RowsAffected()
+
+	r, err = tx.Exec(`DELETE FROM Community WHERE MemberID = $1`, user)
+	if err != nil {
+		return err
+	}
+	purged.Communities, _ = r.RowsAffected()
+
+	r, err = tx.Exec(`
+		UPDATE Users
+		SET Admin = false, Role = 'user'
+		WHERE ID = $1
+	`, user)
+	if err != nil {
+		return err
+	}
+	if affected, _ := r.RowsAffected(); affected == 0 {
+		return kb.ErrUserNotExist
+	}
+
+	if err := db.record(tx, "purge-user", user, purged); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// record adds an entry to the access journal
+func (db Access) record(exec execer, action string, target kb.Slug, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = exec.Exec(`
+		INSERT INTO
+		AccessJournal(Actor, Action, Target, Data)
+		VALUES($1, $2, $3, $4)
+	`, db.ActiveUser, action, target, data)
+	return err
+}
+
 //TODO: fix this for OwnerID, GroupID
 func (db Access) List(group kb.Slug) (members []kb.Member, err error) {
 	rows, err := db.Query(`
@@ -123,3 +368,250 @@ func (db Access) List(group kb.Slug) (members []kb.Member, err error) {
 	}
 	return members, rows.Err()
 }
+
+func (db Access) GroupsOf(user kb.Slug) (groups []kb.Member, err error) {
+	if !db.BoolQuery(`SELECT FROM Users WHERE ID = $1`, user) {
+		return nil, kb.ErrUserNotExist
+	}
+
+	// same sources as AccessView, except public groups
+	rows, err := db.Query(`
+	WITH RECURSIVE Communities(GroupID, MemberID, Access, Path) AS (
+			SELECT Community.GroupID, Community.MemberID, Community.Access,
+				ARRAY[Community.GroupID, Community.MemberID]
+			FROM Community
+		UNION ALL
+			SELECT Community.GroupID, Communities.MemberID,
+				LEAST(Community.Access, Communities.Access),
+				Community.GroupID || Communities.Path
+			FROM Community
+			JOIN Communities ON Communities.GroupID = Community.MemberID
+			WHERE NOT Community.GroupID = ANY(Communities.Path)
+	),
+	Reached AS (
+			SELECT Membership.GroupID
+			FROM Membership
+			WHERE Membership.UserID = $1
+		UNION
+			SELECT Groups.ID
+			FROM Groups
+			JOIN Membership ON Membership.GroupID = Groups.OwnerID
+			WHERE Membership.UserID = $1
+		UNION
+			SELECT Communities.GroupID
+			FROM Communities
+			JOIN Membership ON Membership.GroupID = Communities.MemberID
+			WHERE Membership.UserID = $1
+	)
+	SELECT Groups.ID, Groups.Name, AccessView.Access
+		FROM Reached
+		JOIN Groups ON Groups.ID = Reached.GroupID
+		JOIN AccessView ON AccessView.GroupID = Groups.ID AND AccessView.UserID = $1
+		ORDER BY Groups.ID
+	`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		group := kb.Member{IsGroup: true}
+		var access string
+		if err := rows.Scan(&group.ID, &group.Name, &access); err != nil {
+			return groups, err
+		}
+		group.Access = kb.Rights(access)
+		groups = append(groups, group)
+	}
+	return groups, rows.Err()
+}
+
+type accessSnapshot struct {
+	Admins     []kb.Slug         `json:"admins"`
+	Membership []membershipEntry `json:"membership"`
+	Community  []communityEntry  `json:"community"`
+}
+
+type membershipEntry struct {
+	GroupID kb.Slug   `json:"group"`
+	UserID  kb.Slug   `json:"user"`
+	Access  kb.Rights `json:"access,omitempty"`
+}
+
+type communityEntry struct {
+	GroupID  kb.Slug   `json:"group"`
+	MemberID kb.Slug   `json:"member"`
+	Access   kb.Rights `json:"access"`
+}
+
+func (db Access) Export() ([]byte, error) {
+	snapshot := accessSnapshot{
+		Admins:     []kb.Slug{},
+		Membership: []membershipEntry{},
+		Community:  []communityEntry{},
+	}
+
+	rows, err := db.Query(`SELECT ID FROM Users WHERE Role = 'admin' ORDER BY ID`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id kb.Slug
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snapshot.Admins = append(snapshot.Admins, id)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT GroupID, UserID, Access
+		FROM Membership
+		ORDER BY GroupID, UserID
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var entry membershipEntry
+		var access string
+		if err := rows.Scan(&entry.GroupID, &entry.UserID, &access); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entry.Access = kb.Rights(access)
+		snapshot.Membership = append(snapshot.Membership, entry)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`
+		SELECT GroupID, MemberID, Access
+		FROM Community
+		ORDER BY GroupID, MemberID
+	`)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var entry communityEntry
+		var access string
+		if err := rows.Scan(&entry.GroupID, &entry.MemberID, &access); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entry.Access = kb.Rights(access)
+		snapshot.Community = append(snapshot.Community, entry)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(snapshot)
+}
+
+func (db Access) Import(data []byte) error {
+	defer db.rights.invalidateAll()
+
+	var snapshot accessSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("invalid access snapshot: %v", err)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	exists := func(table string, id kb.Slug) bool {
+		err := tx.QueryRow(`SELECT FROM `+table+` WHERE ID = $1`, id).Scan()
+		return err == nil
+	}
+	checkUser := func(id kb.Slug) error {
+		if !exists("Users", id) {
+			return fmt.Errorf("%s: %w", id, kb.ErrUserNotExist)
+		}
+		return nil
+	}
+	checkGroup := func(id kb.Slug) error {
+		if !exists("Groups", id) {
+			return fmt.Errorf("%s: %w", id, kb.ErrGroupNotExist)
+		}
+		return nil
+	}
+
+	for _, id := range snapshot.Admins {
+		if err := checkUser(id); err != nil {
+			return err
+		}
+	}
+	for i := range snapshot.Membership {
+		entry := &snapshot.Membership[i]
+		if err := checkGroup(entry.GroupID); err != nil {
+			return err
+		}
+		if err := checkUser(entry.UserID); err != nil {
+			return err
+		}
+		if entry.Access == "" {
+			entry.Access = kb.Moderator
+		}
+		if entry.Access.Level() < 0 {
+			return fmt.Errorf("invalid rights %q for %s in %s", entry.Access, entry.UserID, entry.GroupID)
+		}
+	}
+	for _, entry := range snapshot.Community {
+		if err := checkGroup(entry.GroupID); err != nil {
+			return err
+		}
+		if err := checkGroup(entry.MemberID); err != nil {
+			return err
+		}
+		if entry.Access.Level() < 0 {
+			return fmt.Errorf("invalid rights %q for %s in %s", entry.Access, entry.MemberID, entry.GroupID)
+		}
+	}
+
+	for _, q := range []string{
+		`DELETE FROM Membership`,
+		`DELETE FROM Community`,
+		`UPDATE Users SET Admin = false, Role = 'user' WHERE Role = 'admin'`,
+	} {
+		if _, err := tx.Exec(q); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range snapshot.Admins {
+		if _, err := tx.Exec(`UPDATE Users SET Admin = true, Role = 'admin' WHERE ID = $1`, id); err != nil {
+			return err
+		}
+	}
+	for _, entry := range snapshot.Membership {
+		_, err := tx.Exec(`
+			INSERT INTO
+			Membership (GroupID, UserID, Access)
+			VALUES ($1, $2, $3)
+		`, entry.GroupID, entry.UserID, string(entry.Access))
+		if err != nil {
+			return err
+		}
+	}
+	for _, entry := range snapshot.Community {
+		_, err := tx.Exec(`
+			INSERT INTO
+			Community (GroupID, MemberID, Access)
+			VALUES ($1, $2, $3)
+		`, entry.GroupID, entry.MemberID, string(entry.Access))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
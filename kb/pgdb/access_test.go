@@ -0,0 +1,483 @@
+package pgdb_test
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+	"github.com/raintreeinc/knowledgebase/kb/pgdb"
+)
+
+func TestAccessExportImport(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Groups().Create(kb.Group{ID: "team", OwnerID: "team", Name: "Team"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.AddUser("team", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.CommunityAdd("test", "team", kb.Editor); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.SetAdmin("alice", true); err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := access.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := access.Import([]byte(`{}`)); err != nil {
+		t.Fatal(err)
+	}
+	if access.IsAdmin("alice") || access.IsAdmin("admin") {
+		t.Errorf("admins were not cleared")
+	}
+	if members, _ := access.List("team"); len(members) != 0 {
+		t.Errorf("memberships were not cleared: %v", members)
+	}
+
+	if err := access.Import(exported); err != nil {
+		t.Fatal(err)
+	}
+	reexported, err := access.Export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exported, reexported) {
+		t.Errorf("access does not round-trip:\n%s\n%s", exported, reexported)
+	}
+	if rights := access.Rights("test", "alice"); rights != kb.Editor {
+		t.Errorf("community rights not restored: %v", rights)
+	}
+
+	err = access.Import([]byte(`{"membership":[{"group":"team","user":"bob"}]}`))
+	if !errors.Is(err, kb.ErrUserNotExist) {
+		t.Errorf("importing unknown user: got %v", err)
+	}
+	if !access.IsAdmin("alice") {
+		t.Errorf("failed import modified state")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+
+	if role, err := access.RoleOf("admin"); err != nil || role != kb.RoleAdmin {
+		t.Errorf("created admin: got %v, %v", role, err)
+	}
+	if role, err := access.RoleOf("alice"); err != nil || role != kb.RoleUser {
+		t.Errorf("created user: got %v, %v", role, err)
+	}
+	if _, err := access.RoleOf("bob"); err != kb.ErrUserNotExist {
+		t.Errorf("missing user: got %v", err)
+	}
+
+	if err := access.SetRole("alice", kb.RoleModerator); err != nil {
+		t.Fatal(err)
+	}
+	role, err := access.RoleOf("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != kb.RoleModerator || role < kb.RoleEditor || role >= kb.RoleAdmin {
+		t.Errorf("moderator: got %v", role)
+	}
+	if access.IsAdmin("alice") {
+		t.Errorf("moderator should not be admin")
+	}
+
+	if err := access.SetAdmin("alice", false); err != nil {
+		t.Fatal(err)
+	}
+	if role, _ := access.RoleOf("alice"); role != kb.RoleModerator {
+		t.Errorf("removing admin from moderator changed role to %v", role)
+	}
+
+	if err := access.SetAdmin("alice", true); err != nil {
+		t.Fatal(err)
+	}
+	if !access.IsAdmin("alice") {
+		t.Errorf("alice should be admin")
+	}
+	if user, _ := context.Users().ByID("alice"); !user.Admin {
+		t.Errorf("admin flag not updated")
+	}
+
+	if err := access.SetRole("bob", kb.RoleEditor); err != kb.ErrUserNotExist {
+		t.Errorf("setting role of missing user: got %v", err)
+	}
+}
+
+func TestListAdmins(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	for _, id := range []kb.Slug{"alice", "bob"} {
+		if err := context.Users().Create(kb.User{ID: id, Name: string(id), Email: string(id) + "@example.com", MaxAccess: kb.Moderator}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := access.SetAdmin("alice", true); err != nil {
+		t.Fatal(err)
+	}
+
+	admins, err := access.ListAdmins()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []kb.Slug
+	for _, admin := range admins {
+		ids = append(ids, admin.ID)
+	}
+	if !reflect.DeepEqual(ids, []kb.Slug{"admin", "alice"}) {
+		t.Errorf("got admins %v", ids)
+	}
+	if admins[1].Email != "alice@example.com" || admins[1].Name != "alice" {
+		t.Errorf("incomplete admin %+v", admins[1])
+	}
+}
+
+func TestExplainRights(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Editor}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []kb.Slug{"team", "private"} {
+		if err := context.Groups().Create(kb.Group{ID: id, OwnerID: id, Name: string(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := access.AddUser("team", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.CommunityAdd("private", "team", kb.Reader); err != nil {
+		t.Fatal(err)
+	}
+
+	explanation, err := access.ExplainRights("private", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []kb.RightsSource{{Kind: kb.SourceCommunity, Via: "team", Rights: kb.Reader}}
+	if !reflect.DeepEqual(explanation.Sources, exp) || explanation.Rights != kb.Reader {
+		t.Errorf("community grant: got %+v", explanation)
+	}
+	if explanation.Rights != access.Rights("private", "alice") {
+		t.Errorf("explanation %v differs from rights %v", explanation.Rights, access.Rights("private", "alice"))
+	}
+
+	explanation, err = access.ExplainRights("team", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hasMember := false
+	for _, source := range explanation.Sources {
+		if source.Kind == kb.SourceMember && source.Via == "team" && source.Rights == kb.Moderator {
+			hasMember = true
+		}
+	}
+	if !hasMember {
+		t.Errorf("direct membership missing: %+v", explanation.Sources)
+	}
+	if explanation.MaxAccess != kb.Editor || explanation.Rights != kb.Editor {
+		t.Errorf("rights should be capped by max access: %+v", explanation)
+	}
+
+	if _, err := access.ExplainRights("team", "bob"); err != kb.ErrUserNotExist {
+		t.Errorf("missing user: got %v", err)
+	}
+}
+
+func TestNestedCommunities(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	for _, id := range []kb.Slug{"alice", "bob"} {
+		if err := context.Users().Create(kb.User{ID: id, Name: string(id), MaxAccess: kb.Moderator}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, id := range []kb.Slug{"team", "dept", "docs", "x", "y"} {
+		if err := context.Groups().Create(kb.Group{ID: id, OwnerID: id, Name: string(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// two levels: team is a member of dept, dept is a member of docs
+	if err := access.AddUser("team", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.CommunityAdd("dept", "team", kb.Editor); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.CommunityAdd("docs", "dept", kb.Moderator); err != nil {
+		t.Fatal(err)
+	}
+	if rights := access.Rights("docs", "alice"); rights != kb.Editor {
+		t.Errorf("two levels: got %v, expected the weakest grant %v", rights, kb.Editor)
+	}
+
+	// cycle: x and y are members of each other
+	if err := access.AddUser("y", "bob"); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.CommunityAdd("x", "y", kb.Editor); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.CommunityAdd("y", "x", kb.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.CommunityAdd("docs", "x", kb.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if rights := access.Rights("x", "bob"); rights != kb.Editor {
+		t.Errorf("cycle: got %v on x", rights)
+	}
+	if rights := access.Rights("docs", "bob"); rights != kb.Reader {
+		t.Errorf("cycle: got %v on docs", rights)
+	}
+	if rights := access.Rights("team", "bob"); rights != kb.Blocked {
+		t.Errorf("unrelated group: got %v", rights)
+	}
+}
+
+func TestPurgeUser(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []kb.Slug{"alice", "team", "dept"} {
+		if err := context.Groups().Create(kb.Group{ID: id, OwnerID: id, Name: string(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, group := range []kb.Slug{"alice", "team", "dept"} {
+		if err := access.AddUser(group, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := access.CommunityAdd("dept", "alice", kb.Editor); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.SetAdmin("alice", true); err != nil {
+		t.Fatal(err)
+	}
+
+	// carol gets access to dept through the alice group
+	if err := context.Users().Create(kb.User{ID: "carol", Name: "Carol", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+	if err := access.AddUser("alice", "carol"); err != nil {
+		t.Fatal(err)
+	}
+	if rights := access.Rights("dept", "carol"); rights != kb.Editor {
+		t.Fatalf("carol before purge: got %v", rights)
+	}
+
+	carol := context.(pgdb.Context).Database.Context("carol")
+	if err := carol.Access().PurgeUser("alice"); err != kb.ErrAccessDenied {
+		t.Errorf("non-admin purging: got %v", err)
+	}
+
+	if err := access.PurgeUser("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if rights := access.Rights("dept", "carol"); rights != kb.Blocked {
+		t.Errorf("carol kept cached rights %v", rights)
+	}
+
+	for _, group := range []kb.Slug{"alice", "team", "dept"} {
+		if rights := access.Rights(group, "alice"); rights != kb.Blocked {
+			t.Errorf("%s: still has %v", group, rights)
+		}
+	}
+	if members, _ := access.List("dept"); len(members) != 0 {
+		t.Errorf("dept still has members %v", members)
+	}
+	if access.IsAdmin("alice") {
+		t.Errorf("admin flag not cleared")
+	}
+
+	var action string
+	err := context.(pgdb.Context).QueryRow(`
+		SELECT Action FROM AccessJournal WHERE Target = 'alice'
+	`).Scan(&action)
+	if err != nil || action != "purge-user" {
+		t.Errorf("purge not journaled: %q %v", action, err)
+	}
+
+	if err := access.PurgeUser("bob"); err != kb.ErrUserNotExist {
+		t.Errorf("purging missing user: got %v", err)
+	}
+}
+
+func TestRightsCacheInvalidation(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Groups().Create(kb.Group{ID: "team", OwnerID: "team", Name: "Team"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Groups().Create(kb.Group{ID: "private", OwnerID: "private", Name: "Private"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if rights := access.Rights("team", "alice"); rights != kb.Blocked {
+		t.Fatalf("before joining: got %v", rights)
+	}
+	if err := access.AddUser("team", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if rights := access.Rights("team", "alice"); rights != kb.Moderator {
+		t.Errorf("after joining: got %v", rights)
+	}
+
+	if rights := access.Rights("private", "alice"); rights != kb.Blocked {
+		t.Fatalf("before community: got %v", rights)
+	}
+	if err := access.CommunityAdd("private", "team", kb.Reader); err != nil {
+		t.Fatal(err)
+	}
+	if rights := access.Rights("private", "alice"); rights != kb.Reader {
+		t.Errorf("after community: got %v", rights)
+	}
+
+	if err := access.RemoveUser("team", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if rights := access.Rights("team", "alice"); rights != kb.Blocked {
+		t.Errorf("after leaving: got %v", rights)
+	}
+	if rights := access.Rights("private", "alice"); rights != kb.Blocked {
+		t.Errorf("after leaving community: got %v", rights)
+	}
+}
+
+func TestGroupsOf(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []kb.Slug{"team", "docs", "private", "other"} {
+		if err := context.Groups().Create(kb.Group{ID: id, OwnerID: id, Name: string(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// alice is a member of team and docs with different rights,
+	// private is reached only through team
+	err := access.Import([]byte(`{
+		"membership": [
+			{"group": "team", "user": "alice", "access": "moderator"},
+			{"group": "docs", "user": "alice", "access": "reader"}
+		],
+		"community": [
+			{"group": "private", "member": "team", "access": "editor"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups, err := access.GroupsOf("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []kb.Member{
+		{ID: "docs", Name: "docs", IsGroup: true, Access: kb.Reader},
+		{ID: "private", Name: "private", IsGroup: true, Access: kb.Editor},
+		{ID: "team", Name: "team", IsGroup: true, Access: kb.Moderator},
+	}
+	if !reflect.DeepEqual(groups, exp) {
+		t.Errorf("got %+v, expected %+v", groups, exp)
+	}
+
+	if _, err := access.GroupsOf("bob"); err != kb.ErrUserNotExist {
+		t.Errorf("missing user: got %v", err)
+	}
+}
+
+func TestFrozenGroup(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+	pages := context.Pages("test")
+
+	if err := pages.Create(testPage("test=page", "Page")); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+	alice := context.(pgdb.Context).Database.Context("alice")
+	if err := alice.Access().SetFrozen("test", true); err != kb.ErrAccessDenied {
+		t.Errorf("non-admin freezing: got %v", err)
+	}
+
+	if err := access.SetFrozen("test", true); err != nil {
+		t.Fatal(err)
+	}
+	if group, err := context.Groups().ByID("test"); err != nil || !group.Frozen {
+		t.Errorf("expected frozen group, got %+v %v", group, err)
+	}
+
+	page, err := pages.Load("test=page")
+	if err != nil {
+		t.Fatal("frozen group should allow reads:", err)
+	}
+	if _, err := pages.List(); err != nil {
+		t.Fatal("frozen group should allow listing:", err)
+	}
+
+	if err := pages.Create(testPage("test=other", "Other")); err != kb.ErrGroupFrozen {
+		t.Errorf("create: got %v", err)
+	}
+	changed := *page
+	changed.Version++
+	if err := pages.Overwrite(page.Slug, page.Version, &changed); err != kb.ErrGroupFrozen {
+		t.Errorf("overwrite: got %v", err)
+	}
+	if err := pages.Edit(page.Slug, page.Version, kb.Action{"type": "add", "item": kb.Paragraph("More.")}); err != kb.ErrGroupFrozen {
+		t.Errorf("edit: got %v", err)
+	}
+	if err := pages.Delete(page.Slug, page.Version); err != kb.ErrGroupFrozen {
+		t.Errorf("delete: got %v", err)
+	}
+
+	if err := access.SetFrozen("test", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Overwrite(page.Slug, page.Version, &changed); err != nil {
+		t.Errorf("overwrite after unfreezing: %v", err)
+	}
+	if err := pages.Create(testPage("test=other", "Other")); err != nil {
+		t.Errorf("create after unfreezing: %v", err)
+	}
+
+	if err := access.SetFrozen("missing", true); err != kb.ErrGroupNotExist {
+		t.Errorf("freezing missing group: got %v", err)
+	}
+}
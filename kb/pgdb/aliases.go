@@ -0,0 +1,103 @@
+package pgdb
+
+import (
+	"database/sql"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type Aliases struct{ Context }
+
+func (db Aliases) AddAlias(alias, target kb.Slug) error {
+	if err := kb.ValidateSlug(alias); err != nil {
+		return kb.ErrInvalidSlug
+	}
+	if err := kb.ValidateSlug(target); err != nil {
+		return kb.ErrInvalidSlug
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// an existing page takes precedence over an alias
+	var exists bool
+	err = tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM Pages WHERE Slug = $1 AND Deleted IS NULL)
+	`, alias).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return kb.ErrPageExists
+	}
+
+	if err := addAlias(tx, alias, target); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// addAlias makes alias resolve to target and redirects aliases of alias to target
+func addAlias(tx *sql.Tx, alias, target kb.Slug) error {
+	var isPage bool
+	err := tx.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM Pages WHERE Slug = $1 AND Deleted IS NULL)
+	`, target).Scan(&isPage)
+	if err != nil {
+		return err
+	}
+
+	if isPage {
+		// e.g. a page renamed back to its old slug is no longer an alias
+		if _, err := tx.Exec(`DELETE FROM Aliases WHERE Alias = $1`, target); err != nil {
+			return err
+		}
+	} else {
+		// an alias of an alias resolves to the final target
+		var final kb.Slug
+		err := tx.QueryRow(`SELECT Target FROM Aliases WHERE Alias = $1`, target).Scan(&final)
+		if err == nil {
+			target = final
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	if alias == target {
+		return kb.ErrInvalidSlug
+	}
+
+	if _, err := tx.Exec(`UPDATE Aliases SET Target = $2 WHERE Target = $1`, alias, target); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO Aliases (Alias, Target)
+		VALUES ($1, $2)
+		ON CONFLICT (Alias) DO UPDATE
+		SET Target = EXCLUDED.Target, Created = current_timestamp
+	`, alias, target)
+	return err
+}
+
+func (db Aliases) Resolve(alias kb.Slug) (kb.Slug, error) {
+	var target kb.Slug
+	err := db.QueryRow(`SELECT Target FROM Aliases WHERE Alias = $1`, alias).Scan(&target)
+	if err == sql.ErrNoRows {
+		return "", kb.ErrAliasNotExist
+	}
+	return target, err
+}
+
+func (db Aliases) RemoveAlias(alias kb.Slug) error {
+	r, err := db.Exec(`DELETE FROM Aliases WHERE Alias = $1`, alias)
+	if err != nil {
+		return err
+	}
+	if affected, _ := r.RowsAffected(); affected == 0 {
+		return kb.ErrAliasNotExist
+	}
+	return nil
+}
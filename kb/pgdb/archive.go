@@ -0,0 +1,74 @@
+package pgdb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// ExportArchive writes all pages of the group as newline-delimited JSON
+func (db Pages) ExportArchive(w io.Writer) error {
+	rows, err := db.Query(`
+		SELECT Data
+		FROM Pages
+		WHERE OwnerID = $1 AND Deleted IS NULL
+		ORDER BY Slug
+	`, db.GroupID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return err
+		}
+		if _, err := w.Write(append(data, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// ImportArchive creates all pages from an archive written by ExportArchive,
+// nothing is created when any of the pages fails
+func (db Pages) ImportArchive(r io.Reader) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	dec := json.NewDecoder(r)
+	for {
+		var data json.RawMessage
+		if err := dec.Decode(&data); err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("invalid archive: %v", err)
+		}
+
+		page := &kb.Page{}
+		if err := json.Unmarshal(data, page); err != nil {
+			return fmt.Errorf("invalid archive page: %v", err)
+		}
+
+		if err := db.insertPage(tx, page, data); err != nil {
+			return fmt.Errorf("failed to import %s: %w", page.Slug, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.refreshGroupIndex(db.GroupID)
+	return nil
+}
@@ -2,6 +2,7 @@ package pgdb
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -49,7 +50,96 @@ func (db Pages) createPageInfos(pages map[kb.Slug]*kb.Page) (map[kb.Slug]*pageIn
 	return infos, nil
 }
 
+func (db Pages) ImportBatch(pages []*kb.Page) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, page := range pages {
+		if err := db.importPage(tx, page); err != nil {
+			return fmt.Errorf("failed to import %s: %w", page.Slug, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.refreshGroupIndex(db.GroupID)
+	return nil
+}
+
+func (db Pages) importPage(tx *sql.Tx, page *kb.Page) error {
+	page.Synopsis = kb.ExtractSynopsis(page)
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("failed to serialize page: %v", err)
+	}
+
+	return db.insertPage(tx, page, data)
+}
+
+// insertPage inserts page using data as the stored content
+func (db Pages) insertPage(tx *sql.Tx, page *kb.Page, data []byte) error {
+	if owner, _ := kb.TokenizeLink(string(page.Slug)); owner != db.GroupID {
+		return fmt.Errorf("mismatching page.Slug (%s) and group (%s)", page.Slug, db.GroupID)
+	}
+	if err := kb.ValidateSlug(page.Slug); err != nil {
+		return kb.ErrInvalidSlug
+	}
+
+	tags := kb.ExtractTags(page)
+	tagSlugs := kb.SlugifyTags(tags)
+
+	hash, err := page.Hash()
+	if err != nil {
+		return fmt.Errorf("failed to get page hash: %v", err)
+	}
+
+	// a deleted page must not block importing
+	_, err = tx.Exec(`
+		DELETE FROM Pages
+		WHERE Slug = $1 AND Deleted IS NOT NULL
+	`, page.Slug)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO Pages(
+			OwnerID, Slug, Data, Version,
+			Tags, TagSlugs,
+			Created, Modified, Hash
+		) VALUES (
+			$1, $2, $3, $4,
+			$5, $6,
+			$7, $8, $9
+		)
+	`, db.GroupID, page.Slug, data, page.Version,
+		stringSlice(tags), stringSlice(tagSlugs),
+		page.Modified, page.Modified, hash)
+	if dupkey(err) {
+		return kb.ErrPageExists
+	}
+	if err != nil {
+		return err
+	}
+
+	db.recordTo(tx, "create", page.Slug, 0, page)
+	return nil
+}
+
 func (db Pages) BatchReplace(pages map[kb.Slug]*kb.Page, complete func(string, kb.Slug)) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
 	infos, err := db.createPageInfos(pages)
 	if err != nil {
 		return err
@@ -96,10 +186,18 @@ func (db Pages) BatchReplace(pages map[kb.Slug]*kb.Page, complete func(string, k
 	}
 
 	insert.Close()
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.refreshGroupIndex(db.GroupID)
+	return nil
 }
 
 func (db Pages) BatchReplaceDelta(pages map[kb.Slug]*kb.Page, complete func(string, kb.Slug)) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
 	infos, err := db.createPageInfos(pages)
 	if err != nil {
 		return err
@@ -113,7 +211,11 @@ func (db Pages) BatchReplaceDelta(pages map[kb.Slug]*kb.Page, complete func(stri
 
 	oldHashes := map[kb.Slug][]byte{}
 	{
-		rows, err := tx.Query("SELECT Slug, Hash FROM Pages WHERE OwnerID = $1", db.GroupID)
+		// deleted pages are kept for Restore, unless they are imported again
+		rows, err := tx.Query(`
+			SELECT Slug, Hash
+			FROM Pages WHERE OwnerID = $1 AND Deleted IS NULL
+		`, db.GroupID)
 		if err != nil {
 			return fmt.Errorf("failed to get current headers: %v", err)
 		}
@@ -158,6 +260,16 @@ func (db Pages) BatchReplaceDelta(pages map[kb.Slug]*kb.Page, complete func(stri
 		}
 	}
 
+	// a deleted page must not block importing
+	undelete, err := tx.Prepare(`
+		DELETE FROM Pages
+		WHERE Slug = $1 AND Deleted IS NOT NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create undelete statement: %v", err)
+	}
+	defer undelete.Close()
+
 	insert, err := tx.Prepare(`
 		INSERT INTO Pages(
 			OwnerID, Slug,
@@ -182,6 +294,13 @@ func (db Pages) BatchReplaceDelta(pages map[kb.Slug]*kb.Page, complete func(stri
 			continue
 		}
 
+		if !exists {
+			if _, err := undelete.Exec(info.Page.Slug); err != nil {
+				insert.Close()
+				return fmt.Errorf("failed to clear deleted page: %v", err)
+			}
+		}
+
 		_, err = insert.Exec(
 			db.GroupID, info.Page.Slug, info.Data, info.Page.Version,
 			stringSlice(info.Tags), stringSlice(info.TagSlugs),
@@ -200,5 +319,100 @@ func (db Pages) BatchReplaceDelta(pages map[kb.Slug]*kb.Page, complete func(stri
 	}
 
 	insert.Close()
-	return tx.Commit()
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.refreshGroupIndex(db.GroupID)
+	return nil
+}
+
+// ReindexBatchSize is the number of pages updated in a single transaction by Reindex
+const ReindexBatchSize = 100
+
+func (db Pages) Reindex() error {
+	after := kb.Slug("")
+	for {
+		last, err := db.reindexBatch(after, ReindexBatchSize)
+		if err != nil {
+			return err
+		}
+		if last == "" {
+			db.refreshGroupIndex(db.GroupID)
+			return nil
+		}
+		after = last
+	}
+}
+
+// reindexBatch reindexes up to limit pages following the slug after,
+// it returns the last reindexed slug or "" when there are no more pages
+func (db Pages) reindexBatch(after kb.Slug, limit int) (kb.Slug, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT Slug, Data
+		FROM Pages
+		WHERE OwnerID = $1 AND Slug > $2
+		ORDER BY Slug
+		LIMIT $3
+		FOR UPDATE
+	`, db.GroupID, after, limit)
+	if err != nil {
+		return "", err
+	}
+
+	pages := []*kb.Page{}
+	for rows.Next() {
+		var slug kb.Slug
+		var data []byte
+		if err := rows.Scan(&slug, &data); err != nil {
+			rows.Close()
+			return "", err
+		}
+		page := &kb.Page{}
+		if err := json.Unmarshal(data, page); err != nil {
+			rows.Close()
+			return "", fmt.Errorf("failed to read %s: %v", slug, err)
+		}
+		// the stored slug is authoritative
+		page.Slug = slug
+		pages = append(pages, page)
+	}
+	if err := rows.Close(); err != nil {
+		return "", err
+	}
+	if len(pages) == 0 {
+		return "", nil
+	}
+
+	for _, page := range pages {
+		page.Synopsis = kb.ExtractSynopsis(page)
+		tags := kb.ExtractTags(page)
+		tagSlugs := kb.SlugifyTags(tags)
+
+		data, err := json.Marshal(page)
+		if err != nil {
+			return "", fmt.Errorf("failed to serialize page: %v", err)
+		}
+
+		_, err = tx.Exec(`
+			UPDATE Pages
+			SET Data = $2,
+				Tags = $3,
+				TagSlugs = $4
+			WHERE Slug = $1
+		`, page.Slug, data, stringSlice(tags), stringSlice(tagSlugs))
+		if err != nil {
+			return "", fmt.Errorf("failed to reindex %s: %w", page.Slug, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+	return pages[len(pages)-1].Slug, nil
 }
@@ -1,11 +1,13 @@
 package pgdb
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/raintreeinc/knowledgebase/kb"
 
@@ -18,6 +20,13 @@ var _ kb.Database = &Database{}
 
 type Database struct {
 	*sql.DB
+	rights *rightsCache
+	stmts  *statementCache
+	index  *pageIndex
+
+	observer QueryObserver
+
+	knownSite func(site string) bool
 }
 
 func New(params string) (*Database, error) {
@@ -26,10 +35,27 @@ func New(params string) (*Database, error) {
 		return nil, fmt.Errorf("failed to open database: %s", err)
 	}
 
-	db := &Database{DB: sdb}
+	db := &Database{
+		DB:     sdb,
+		rights: newRightsCache(DefaultRightsCacheSize, DefaultRightsCacheTTL),
+		stmts:  newStatementCache(sdb),
+	}
+	db.ConfigurePool(DefaultPoolConfig)
 	return db, nil
 }
 
+// CacheRights configures caching of effective rights,
+// size or ttl <= 0 disables the cache. It must be called before use.
+func (db *Database) CacheRights(size int, ttl time.Duration) {
+	db.rights = newRightsCache(size, ttl)
+}
+
+// ValidateReferences makes Pages.Create reject reference items to sites
+// not accepted by known, nil disables the check. It must be called before use.
+func (db *Database) ValidateReferences(known func(site string) bool) {
+	db.knownSite = known
+}
+
 func (db Access) BoolQuery(q string, args ...interface{}) bool {
 	err := db.QueryRow(q, args...).Scan()
 	if err == sql.ErrNoRows {
@@ -52,7 +78,11 @@ func (ctx Context) Access() kb.Access     { return Access{ctx} }
 func (ctx Context) Users() kb.Users       { return Users{ctx} }
 func (ctx Context) Groups() kb.Groups     { return Groups{ctx} }
 
-func (ctx Context) GuestLogin() kb.GuestLogin { return GuestLogin{ctx} }
+func (ctx Context) GuestLogin() kb.GuestLogin   { return GuestLogin{ctx} }
+func (ctx Context) Invitations() kb.Invitations { return Invitations{ctx} }
+func (ctx Context) Statements() kb.Statements   { return Statements{ctx} }
+func (ctx Context) Aliases() kb.Aliases         { return Aliases{ctx} }
+func (ctx Context) APITokens() kb.APITokens     { return APITokens{ctx} }
 
 func (ctx Context) Index(user kb.Slug) kb.Index  { return Index{ctx, user} }
 func (ctx Context) Pages(group kb.Slug) kb.Pages { return Pages{ctx, group} }
@@ -61,19 +91,63 @@ func dupkey(err error) bool {
 	return err != nil && strings.Contains(err.Error(), "duplicate key")
 }
 
+// escapeLike escapes the metacharacters of a LIKE pattern, using backslash as ESCAPE
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
 func (ctx Context) pageEntries(filter string, args ...interface{}) (entries []kb.PageEntry, err error) {
-	rows, err := ctx.Query(`
+	return ctx.queryEntries(context.Background(), `''`, filter, args...)
+}
+
+// preparedEntries is pageEntriesCtx using a cached prepared statement,
+// filter must come from a small fixed set of queries
+func (db Context) preparedEntries(ctx context.Context, filter string, args ...interface{}) (entries []kb.PageEntry, err error) {
+	rows, err := db.queryPrepared(ctx, entriesQuery(`''`, filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+// pageEntriesCtx is pageEntries cancelled together with ctx
+func (db Context) pageEntriesCtx(ctx context.Context, filter string, args ...interface{}) (entries []kb.PageEntry, err error) {
+	return db.queryEntries(ctx, `''`, filter, args...)
+}
+
+// changeEntries is pageEntries with ModifiedBy set to the last actor in the journal
+func (ctx Context) changeEntries(filter string, args ...interface{}) (entries []kb.PageEntry, err error) {
+	return ctx.queryEntries(context.Background(), `
+		COALESCE((
+			SELECT Actor FROM PageJournal
+			WHERE PageJournal.Slug = Pages.Slug AND Action <> 'try-edit'
+			ORDER BY Date DESC
+			LIMIT 1
+		), '')`, filter, args...)
+}
+
+func (db Context) queryEntries(ctx context.Context, modifiedBy string, filter string, args ...interface{}) (entries []kb.PageEntry, err error) {
+	rows, err := db.QueryContext(ctx, entriesQuery(modifiedBy, filter), args...)
+	if err != nil {
+		return nil, err
+	}
+	return scanEntries(rows)
+}
+
+func entriesQuery(modifiedBy string, filter string) string {
+	return `
 	SELECT
 		Slug,
 		Title,
 		Synopsis,
 		Tags,
-		Modified
+		Modified,
+		` + modifiedBy + `
 	FROM Pages
-	`+filter, args...)
-	if err != nil {
-		return nil, err
-	}
+	` + filter
+}
+
+func scanEntries(rows *sql.Rows) (entries []kb.PageEntry, err error) {
 	defer rows.Close()
 
 	for rows.Next() {
@@ -86,6 +160,7 @@ func (ctx Context) pageEntries(filter string, args ...interface{}) (entries []kb
 			&entry.Synopsis,
 			&xtags,
 			&entry.Modified,
+			&entry.ModifiedBy,
 		)
 		entry.Tags = []string(xtags)
 
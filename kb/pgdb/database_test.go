@@ -1,6 +1,8 @@
 package pgdb_test
 
 import (
+	"errors"
+	"strings"
 	"testing"
 
 	"github.com/raintreeinc/knowledgebase/kb"
@@ -202,7 +204,7 @@ func TestIntegration(t *testing.T) {
 	assert("Correct page", samePage(page, welcomePage))
 
 	log("Overwrite page", context.Pages("private").Overwrite("private=welcome", 1, welcomePage2))
-	assert("Concurrent edit", context.Pages("private").Overwrite("private=welcome", 1, welcomePage2) == kb.ErrConcurrentEdit)
+	assert("Concurrent edit", errors.Is(context.Pages("private").Overwrite("private=welcome", 1, welcomePage2), kb.ErrConcurrentEdit))
 
 	log("Add paragraph", context.Pages("private").Edit("private=welcome", 4, kb.Action{
 		"type": "add",
@@ -213,7 +215,7 @@ func TestIntegration(t *testing.T) {
 	log("List pages", err)
 	assert("Must have 1 entry", len(pages) == 1)
 
-	assert("Concurrent delete page", context.Pages("private").Delete("private=welcome", 1) == kb.ErrConcurrentEdit)
+	assert("Concurrent delete page", errors.Is(context.Pages("private").Delete("private=welcome", 1), kb.ErrConcurrentEdit))
 	log("Delete page", context.Pages("private").Delete("private=welcome", 5))
 	_, err = context.Pages("private").Load("private=welcome")
 	assert("Loading deleted page", err == kb.ErrPageNotExist)
@@ -228,9 +230,30 @@ func TestIntegration(t *testing.T) {
 	log("List index", err)
 	assert("List single page", len(pages) == 1)
 
-	pages, err = context.Index("reader").Search("lorem")
+	pages, total, err := context.Index("reader").Search("lorem", 0, 0)
 	log("Search index", err)
-	assert("Search single page", len(pages) == 1)
+	assert("Search single page", len(pages) == 1 && total == 1)
+	assert("Search highlight", len(pages) == 1 && strings.Contains(pages[0].Highlight, kb.HighlightStart))
+
+	pages, total, err = context.Index("reader").Search("lorem", 1, 10)
+	log("Search index window", err)
+	assert("Search past the matches", len(pages) == 0 && total == 1)
+
+	pages, total, err = context.Index("reader").SearchFiltered("lorem", []string{"Welcome"}, "", "", 0, 0)
+	log("Search index with tag", err)
+	assert("Search single tag", len(pages) == 1 && total == 1)
+
+	pages, total, err = context.Index("reader").SearchFiltered("lorem", []string{"welcome", "lorem"}, "", "", 0, 0)
+	log("Search index with tags", err)
+	assert("Search all tags", len(pages) == 1 && total == 1)
+
+	pages, total, err = context.Index("reader").SearchFiltered("lorem", []string{"welcome", "missing"}, "", "", 0, 0)
+	log("Search index with missing tag", err)
+	assert("Search requires all tags", len(pages) == 0 && total == 0)
+
+	pages, total, err = context.Index("reader").SearchFiltered("lorem", []string{"welcome"}, "priv", "", 0, 0)
+	log("Search index with tag and owner filter", err)
+	assert("Search tags with owner filter", len(pages) == 0 && total == 0)
 
 	tags, err := context.Index("reader").Tags()
 	log("List tags", err)
@@ -270,3 +293,61 @@ func samePage(a, b *kb.Page) bool {
 		a.Version == b.Version &&
 		a.Synopsis == b.Synopsis
 }
+
+// newTestContext resets the integration database and returns an admin context
+// with an empty "test" group. The test is skipped when the database is unreachable.
+func newTestContext(t testing.TB) kb.Context {
+	db, err := pgdb.New(dbparams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := db.Ping(); err != nil {
+		t.Skip("integration database unavailable:", err)
+	}
+
+	_, err = db.Exec(`
+		DROP SCHEMA public CASCADE;
+		CREATE SCHEMA public;
+		GRANT ALL ON SCHEMA public TO integration;
+		GRANT ALL ON SCHEMA public TO public;
+	`)
+	if err != nil {
+		t.Fatal("Destroying database:", err)
+	}
+	if err := db.Initialize(); err != nil {
+		t.Fatal("Initializing database:", err)
+	}
+
+	context := db.Context("admin")
+	if err := context.Users().Create(kb.User{
+		ID:        "admin",
+		Name:      "Admin",
+		Admin:     true,
+		MaxAccess: kb.Moderator,
+	}); err != nil {
+		t.Fatal("Creating admin:", err)
+	}
+	if err := context.Groups().Create(kb.Group{
+		ID:      "test",
+		OwnerID: "test",
+		Name:    "Test",
+		Public:  true,
+	}); err != nil {
+		t.Fatal("Creating group:", err)
+	}
+	return context
+}
+
+func testPage(slug kb.Slug, title string, tags ...string) *kb.Page {
+	return &kb.Page{
+		Slug:    slug,
+		Title:   title,
+		Version: 1,
+		Story: kb.Story{
+			kb.Tags(tags...),
+			kb.Paragraph("Content of " + title + "."),
+		},
+	}
+}
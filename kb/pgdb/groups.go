@@ -10,10 +10,10 @@ type Groups struct{ Context }
 
 func (db Groups) ByID(id kb.Slug) (group kb.Group, err error) {
 	err = db.QueryRow(`
-		SELECT  ID, OwnerID, Name, Public, Description
+		SELECT  ID, OwnerID, Name, Public, Frozen, Description
 		FROM    Groups
 		WHERE   ID = $1
-	`, id).Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Description)
+	`, id).Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Frozen, &group.Description)
 
 	if err == sql.ErrNoRows {
 		return group, kb.ErrGroupNotExist
@@ -22,6 +22,7 @@ func (db Groups) ByID(id kb.Slug) (group kb.Group, err error) {
 }
 
 func (db Groups) Create(group kb.Group) error {
+	defer db.rights.invalidateAll()
 	_, err := db.Exec(`
 		INSERT INTO
 		Groups (ID, OwnerID, Name, Public, Description)
@@ -35,13 +36,14 @@ func (db Groups) Create(group kb.Group) error {
 }
 
 func (db Groups) Delete(id kb.Slug) error {
+	defer db.rights.invalidateAll()
 	_, err := db.Exec(`DELETE FROM Groups WHERE ID = $1`, id)
 	return err
 }
 
 func (db Groups) List() (groups []kb.Group, err error) {
 	rows, err := db.Query(`
-		SELECT  ID, OwnerID, Name, Public, Description
+		SELECT  ID, OwnerID, Name, Public, Frozen, Description
 		FROM    Groups
 	`)
 	if err != nil {
@@ -51,7 +53,7 @@ func (db Groups) List() (groups []kb.Group, err error) {
 
 	for rows.Next() {
 		var group kb.Group
-		err := rows.Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Description)
+		err := rows.Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Frozen, &group.Description)
 		if err != nil {
 			return groups, err
 		}
@@ -1,6 +1,12 @@
 package pgdb
 
-import "github.com/raintreeinc/knowledgebase/kb"
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
 
 type Index struct {
 	Context
@@ -8,34 +14,135 @@ type Index struct {
 }
 
 func (db Index) List() ([]kb.PageEntry, error) {
-	return db.pageEntries(`
+	return db.ListCtx(context.Background())
+}
+
+func (db Index) ListCtx(ctx context.Context) ([]kb.PageEntry, error) {
+	if db.index.ready() {
+		readable, err := db.readableGroups()
+		if err != nil {
+			return nil, err
+		}
+		return db.index.list(func(page *indexedPage) bool {
+			return readable[page.owner]
+		}), nil
+	}
+
+	return db.pageEntriesCtx(ctx, `
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		ORDER BY Slug`, db.UserID)
 }
 
-func (db Index) Search(text string) ([]kb.PageEntry, error) {
-	return db.pageEntries(`
+func (db Index) Search(text string, offset, limit int) ([]kb.PageEntry, int, error) {
+	return db.SearchCtx(context.Background(), text, offset, limit)
+}
+
+func (db Index) SearchCtx(ctx context.Context, text string, offset, limit int) ([]kb.PageEntry, int, error) {
+	return db.searchWindow(ctx, `
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		  AND Content @@ plainto_tsquery('english', $2)
-		ORDER BY ts_rank(Content, plainto_tsquery('english', $2)) DESC
-		LIMIT 100
-		`, db.UserID, text)
+		`, offset, limit, db.UserID, text)
 }
 
-func (db Index) SearchFilter(text, exclude, include string) ([]kb.PageEntry, error) {
-	return db.pageEntries(`
+func (db Index) SearchFilter(text, exclude, include string, offset, limit int) ([]kb.PageEntry, int, error) {
+	return db.SearchFilterCtx(context.Background(), text, exclude, include, offset, limit)
+}
+
+func (db Index) SearchFilterCtx(ctx context.Context, text, exclude, include string, offset, limit int) ([]kb.PageEntry, int, error) {
+	return db.searchWindow(ctx, `
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		  AND (OwnerID NOT LIKE $3 || '%' OR OwnerID = $4)
 		  AND Content @@ plainto_tsquery('english', $2)
+		`, offset, limit, db.UserID, text, exclude, include)
+}
+
+func (db Index) SearchFiltered(text string, tags []string, exclude, include string, offset, limit int) ([]kb.PageEntry, int, error) {
+	return db.SearchFilteredCtx(context.Background(), text, tags, exclude, include, offset, limit)
+}
+
+func (db Index) SearchFilteredCtx(ctx context.Context, text string, tags []string, exclude, include string, offset, limit int) ([]kb.PageEntry, int, error) {
+	tagSlugs := stringSlice(kb.SlugifyTags(tags))
+	return db.searchWindow(ctx, `
+		JOIN AccessView ON OwnerID = AccessView.GroupID
+		WHERE AccessView.UserID = $1
+		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
+		  AND TagSlugs @> $3
+		  AND ($4 = '' OR OwnerID NOT LIKE $4 || '%' OR OwnerID = $5)
+		  AND Content @@ plainto_tsquery('english', $2)
+		`, offset, limit, db.UserID, text, tagSlugs, exclude, include)
+}
+
+// searchWindow counts pages matching filter and returns the ranked window,
+// the search text must be the second argument
+func (db Index) searchWindow(ctx context.Context, filter string, offset, limit int, args ...interface{}) ([]kb.PageEntry, int, error) {
+	offset, limit = kb.SearchWindow(offset, limit)
+
+	var total int
+	if err := db.QueryRowContext(ctx, `SELECT count(*) FROM Pages `+filter, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	n := len(args)
+	text, _ := args[1].(string)
+	entries, err := db.searchEntries(ctx, text, filter+`
 		ORDER BY ts_rank(Content, plainto_tsquery('english', $2)) DESC
-		LIMIT 100
-		`, db.UserID, text, exclude, include)
+		OFFSET $`+strconv.Itoa(n+1)+` LIMIT $`+strconv.Itoa(n+2),
+		append(args, offset, limit)...)
+	return entries, total, err
+}
+
+// searchEntries is pageEntries with a highlight of text in the page story
+func (db Index) searchEntries(ctx context.Context, text, filter string, args ...interface{}) (entries []kb.PageEntry, err error) {
+	rows, err := db.QueryContext(ctx, `
+	SELECT
+		Slug,
+		Title,
+		Synopsis,
+		Tags,
+		Modified,
+		coalesce((
+			SELECT string_agg(Item->>'text', ' ')
+			FROM jsonb_array_elements(Data->'story') Item
+		), '')
+	FROM Pages
+	`+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry kb.PageEntry
+		var story string
+
+		xtags := stringSlice{}
+		err := rows.Scan(
+			&entry.Slug,
+			&entry.Title,
+			&entry.Synopsis,
+			&xtags,
+			&entry.Modified,
+			&story,
+		)
+		entry.Tags = []string(xtags)
+
+		if err != nil {
+			return nil, err
+		}
+		entry.Highlight = kb.Highlight(story, text, kb.HighlightLength)
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
 }
 
 func (db Index) Tags() ([]kb.TagEntry, error) {
@@ -46,6 +153,7 @@ func (db Index) Tags() ([]kb.TagEntry, error) {
 		FROM Pages
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1 AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		GROUP BY Tag
 		ORDER BY Tag
 	`, db.UserID)
@@ -70,10 +178,21 @@ func (db Index) ByTag(tag kb.Slug) ([]kb.PageEntry, error) {
 	tags := kb.SlugifyTags([]string{string(tag)})
 	tagSlugs := stringSlice(tags)
 
+	if db.index.ready() {
+		readable, err := db.readableGroups()
+		if err != nil {
+			return nil, err
+		}
+		return db.index.list(func(page *indexedPage) bool {
+			return readable[page.owner] && hasAnyTag(page, tags)
+		}), nil
+	}
+
 	return db.pageEntries(`
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		  AND TagSlugs && $2
 	`, db.UserID, tagSlugs)
 }
@@ -92,6 +211,7 @@ func (db Index) ByTagFilter(tags []kb.Slug, exclude, include string) ([]kb.PageE
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		  AND (OwnerID NOT LIKE $3 || '%' OR OwnerID = $4)
 		  AND TagSlugs && $2
 		`, db.UserID, stringSlice(tagSlugs), exclude, include)
@@ -99,7 +219,7 @@ func (db Index) ByTagFilter(tags []kb.Slug, exclude, include string) ([]kb.PageE
 
 func (db Index) readable() (groups []kb.Group, err error) {
 	rows, err := db.Query(`
-		SELECT  ID, OwnerID, Name, Public, Description
+		SELECT  ID, OwnerID, Name, Public, Frozen, Description
 		FROM    Groups
 		JOIN AccessView ON Groups.ID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
@@ -112,7 +232,7 @@ func (db Index) readable() (groups []kb.Group, err error) {
 
 	for rows.Next() {
 		var group kb.Group
-		rows.Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Description)
+		rows.Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Frozen, &group.Description)
 		groups = append(groups, group)
 	}
 	return groups, nil
@@ -129,7 +249,7 @@ func (db Index) Groups(min kb.Rights) (groups []kb.Group, err error) {
 	}
 
 	rows, err := db.Query(`
-		SELECT  ID, OwnerID, Name, Public, Description
+		SELECT  ID, OwnerID, Name, Public, Frozen, Description
 		FROM    Groups
 		JOIN AccessView ON Groups.ID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
@@ -142,17 +262,28 @@ func (db Index) Groups(min kb.Rights) (groups []kb.Group, err error) {
 
 	for rows.Next() {
 		var group kb.Group
-		rows.Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Description)
+		rows.Scan(&group.ID, &group.OwnerID, &group.Name, &group.Public, &group.Frozen, &group.Description)
 		groups = append(groups, group)
 	}
 	return groups, nil
 }
 
 func (db Index) ByGroup(groupID kb.Slug) ([]kb.PageEntry, error) {
+	if db.index.ready() {
+		readable, err := db.readableGroups()
+		if err != nil {
+			return nil, err
+		}
+		return db.index.list(func(page *indexedPage) bool {
+			return page.owner == groupID && readable[page.owner]
+		}), nil
+	}
+
 	return db.pageEntries(`
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		  AND OwnerID = $2
 	`, db.UserID, groupID)
 }
@@ -162,25 +293,83 @@ func (db Index) ByTitle(suffix kb.Slug) ([]kb.PageEntry, error) {
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		  AND Slug LIKE '%=' || $2
 	`, db.UserID, suffix)
 }
 
 func (db Index) RecentChanges(n int) ([]kb.PageEntry, error) {
-	return db.pageEntries(`
+	if db.index.ready() {
+		readable, err := db.readableGroups()
+		if err != nil {
+			return nil, err
+		}
+		return db.index.recent(n, func(page *indexedPage) bool {
+			return readable[page.owner]
+		}), nil
+	}
+
+	return db.changeEntries(`
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		ORDER BY Modified DESC, OwnerID, Slug
 		LIMIT $2
 	`, db.UserID, n)
 }
 
+func (db Index) RecentChangesSince(n int, groupID kb.Slug, since time.Time) ([]kb.PageEntry, error) {
+	return db.changeEntries(`
+		JOIN AccessView ON OwnerID = AccessView.GroupID
+		WHERE AccessView.UserID = $1
+		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
+		  AND ($2 = '' OR OwnerID = $2)
+		  AND Modified > $3
+		ORDER BY Modified DESC, OwnerID, Slug
+		LIMIT $4
+	`, db.UserID, groupID, since, n)
+}
+
+func (db Index) RecentChangesByActor(actor kb.Slug, n int, since time.Time) ([]kb.PageEntry, error) {
+	if actor != db.UserID && !db.Access().IsAdmin(db.UserID) {
+		return nil, kb.ErrAccessDenied
+	}
+
+	return db.changeEntries(`
+		JOIN AccessView ON OwnerID = AccessView.GroupID
+		JOIN (
+			SELECT Slug AS ChangedSlug, max(Date) AS Changed
+			FROM PageJournal
+			WHERE Actor = $2 AND Action <> 'try-edit'
+			GROUP BY Slug
+		) Changes ON Changes.ChangedSlug = Pages.Slug
+		WHERE AccessView.UserID = $1
+		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
+		  AND Changes.Changed > $4
+		ORDER BY Changes.Changed DESC, OwnerID, Slug
+		LIMIT $3
+	`, db.UserID, actor, n, since)
+}
+
 func (db Index) RecentChangesByGroup(n int, groupID kb.Slug) ([]kb.PageEntry, error) {
-	return db.pageEntries(`
+	if db.index.ready() {
+		readable, err := db.readableGroups()
+		if err != nil {
+			return nil, err
+		}
+		return db.index.recent(n, func(page *indexedPage) bool {
+			return page.owner == groupID && readable[page.owner]
+		}), nil
+	}
+
+	return db.changeEntries(`
 		JOIN AccessView ON OwnerID = AccessView.GroupID
 		WHERE AccessView.UserID = $1
 		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
 		  AND OwnerID = $2
 		ORDER BY Modified DESC, OwnerID, Slug
 		LIMIT $3
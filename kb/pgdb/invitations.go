@@ -0,0 +1,118 @@
+package pgdb
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type Invitations struct{ Context }
+
+// only the hash of the token is stored
+func hashToken(token string) []byte {
+	hash := sha256.Sum256([]byte(token))
+	return hash[:]
+}
+
+func (db Invitations) CreateInvite(group kb.Slug, rights kb.Rights, ttl time.Duration) (string, error) {
+	if rights.Level() < 0 {
+		return "", fmt.Errorf("invalid rights %q", rights)
+	}
+	if ttl <= 0 {
+		return "", fmt.Errorf("invitation must expire in the future, got %v", ttl)
+	}
+
+	access := db.Access()
+	if !access.IsAdmin(db.ActiveUser) &&
+		access.Rights(group, db.ActiveUser).Level() < kb.Rights(kb.Moderator).Level() {
+		return "", kb.ErrAccessDenied
+	}
+
+	var code [32]byte
+	if _, err := rand.Read(code[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(code[:])
+
+	_, err := db.Exec(`
+		INSERT INTO
+		Invitations (TokenHash, GroupID, Access, CreatedBy, Expires)
+		VALUES ($1, $2, $3, $4, $5)
+	`, hashToken(token), group, string(rights), db.ActiveUser, time.Now().Add(ttl))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (db Invitations) RedeemInvite(token string, user kb.Slug) error {
+	defer db.rights.invalidateUser(user)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	hash := hashToken(token)
+
+	var group kb.Slug
+	var rights string
+	var expires time.Time
+	var used sql.NullTime
+	err = tx.QueryRow(`
+		SELECT GroupID, Access, Expires, Used
+		FROM Invitations
+		WHERE TokenHash = $1
+		FOR UPDATE
+	`, hash).Scan(&group, &rights, &expires, &used)
+	if err == sql.ErrNoRows {
+		return kb.ErrInviteNotExist
+	}
+	if err != nil {
+		return err
+	}
+
+	if used.Valid {
+		return kb.ErrInviteUsed
+	}
+	if time.Now().After(expires) {
+		return kb.ErrInviteExpired
+	}
+
+	err = tx.QueryRow(`SELECT FROM Users WHERE ID = $1`, user).Scan()
+	if err == sql.ErrNoRows {
+		return kb.ErrUserNotExist
+	}
+	if err != nil {
+		return err
+	}
+
+	// an existing member keeps the better rights
+	_, err = tx.Exec(`
+		INSERT INTO
+		Membership (GroupID, UserID, Access)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (GroupID, UserID) DO UPDATE
+		SET Access = GREATEST(Membership.Access, EXCLUDED.Access)
+	`, group, user, rights)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE Invitations
+		SET Used = current_timestamp, UsedBy = $2
+		WHERE TokenHash = $1
+	`, hash, user)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,62 @@
+package pgdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+	"github.com/raintreeinc/knowledgebase/kb/pgdb"
+)
+
+func TestInvitations(t *testing.T) {
+	context := newTestContext(t)
+	invitations := context.Invitations()
+
+	for _, id := range []kb.Slug{"alice", "bob"} {
+		if err := context.Users().Create(kb.User{ID: id, Name: string(id), MaxAccess: kb.Moderator}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := context.Groups().Create(kb.Group{ID: "team", OwnerID: "team", Name: "Team"}); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := invitations.CreateInvite("team", kb.Editor, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := invitations.RedeemInvite("unknown", "alice"); err != kb.ErrInviteNotExist {
+		t.Errorf("unknown token: got %v", err)
+	}
+
+	if err := invitations.RedeemInvite(token, "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if rights := context.Access().Rights("team", "alice"); rights != kb.Editor {
+		t.Errorf("redeemed rights: got %v", rights)
+	}
+	if err := invitations.RedeemInvite(token, "bob"); err != kb.ErrInviteUsed {
+		t.Errorf("redeeming twice: got %v", err)
+	}
+
+	expired, err := invitations.CreateInvite("team", kb.Reader, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = context.(pgdb.Context).Exec(`UPDATE Invitations SET Expires = current_timestamp - interval '1 minute' WHERE Used IS NULL`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := invitations.RedeemInvite(expired, "bob"); err != kb.ErrInviteExpired {
+		t.Errorf("expired token: got %v", err)
+	}
+	if rights := context.Access().Rights("team", "bob"); rights != kb.Blocked {
+		t.Errorf("expired token granted %v", rights)
+	}
+
+	guest := context.(pgdb.Context).Context("guest").Invitations()
+	if _, err := guest.CreateInvite("team", kb.Reader, time.Hour); err != kb.ErrAccessDenied {
+		t.Errorf("inviting without rights: got %v", err)
+	}
+}
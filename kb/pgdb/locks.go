@@ -0,0 +1,53 @@
+package pgdb
+
+import (
+	"database/sql"
+	"log"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func (db Pages) AcquireLock(id kb.Slug, user kb.Slug, ttl time.Duration) (bool, kb.Slug) {
+	if ttl <= 0 {
+		ttl = kb.DefaultLockTTL
+	}
+	now := time.Now()
+
+	// the lock is taken when it is free, expired or already held by user
+	var holder kb.Slug
+	err := db.QueryRow(`
+		INSERT INTO PageLocks (Slug, Holder, Expires)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (Slug) DO UPDATE
+		SET Holder = EXCLUDED.Holder, Expires = EXCLUDED.Expires
+		WHERE PageLocks.Holder = EXCLUDED.Holder
+		   OR PageLocks.Expires <= $4
+		RETURNING Holder
+	`, id, user, now.Add(ttl), now).Scan(&holder)
+	if err == nil {
+		return true, holder
+	}
+	if err != sql.ErrNoRows {
+		log.Printf("Acquiring lock on %v failed: %v", id, err)
+		return false, ""
+	}
+
+	err = db.QueryRow(`
+		SELECT Holder FROM PageLocks
+		WHERE Slug = $1
+	`, id).Scan(&holder)
+	if err != nil {
+		log.Printf("Reading lock holder of %v failed: %v", id, err)
+		return false, ""
+	}
+	return false, holder
+}
+
+func (db Pages) ReleaseLock(id kb.Slug, user kb.Slug) error {
+	_, err := db.Exec(`
+		DELETE FROM PageLocks
+		WHERE Slug = $1 AND Holder = $2
+	`, id, user)
+	return err
+}
@@ -0,0 +1,62 @@
+package pgdb_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func TestPageLocks(t *testing.T) {
+	context := newTestContext(t)
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Editor}); err != nil {
+		t.Fatal(err)
+	}
+	pages := context.Pages("test")
+
+	if acquired, holder := pages.AcquireLock("test=page", "admin", time.Minute); !acquired || holder != "admin" {
+		t.Fatalf("acquire: got %v %q", acquired, holder)
+	}
+	if acquired, _ := pages.AcquireLock("test=page", "admin", time.Minute); !acquired {
+		t.Errorf("holder should be able to extend the lock")
+	}
+
+	if acquired, holder := pages.AcquireLock("test=page", "alice", time.Minute); acquired || holder != "admin" {
+		t.Errorf("contended acquire: got %v %q", acquired, holder)
+	}
+	if acquired, _ := pages.AcquireLock("test=other", "alice", time.Minute); !acquired {
+		t.Errorf("locks of other pages should not conflict")
+	}
+
+	// releasing a lock of someone else does nothing
+	if err := pages.ReleaseLock("test=page", "alice"); err != nil {
+		t.Fatal(err)
+	}
+	if acquired, _ := pages.AcquireLock("test=page", "alice", time.Minute); acquired {
+		t.Errorf("lock was released by another user")
+	}
+
+	if err := pages.ReleaseLock("test=page", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	if acquired, holder := pages.AcquireLock("test=page", "alice", time.Minute); !acquired || holder != "alice" {
+		t.Errorf("acquire after release: got %v %q", acquired, holder)
+	}
+}
+
+func TestPageLockExpiry(t *testing.T) {
+	context := newTestContext(t)
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Editor}); err != nil {
+		t.Fatal(err)
+	}
+	pages := context.Pages("test")
+
+	if acquired, _ := pages.AcquireLock("test=page", "admin", 50*time.Millisecond); !acquired {
+		t.Fatal("acquire failed")
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if acquired, holder := pages.AcquireLock("test=page", "alice", time.Minute); !acquired || holder != "alice" {
+		t.Errorf("expired lock: got %v %q", acquired, holder)
+	}
+}
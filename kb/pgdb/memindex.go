@@ -0,0 +1,270 @@
+package pgdb
+
+import (
+	"log"
+	"sort"
+	"sync"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// pageIndex keeps the entries of live pages in memory, so that listings
+// and recent changes do not query the pages. A nil index is never ready.
+//
+// The index is built by BuildIndex and updated after every write of Pages.
+// Full-text searches still use the database.
+type pageIndex struct {
+	mu     sync.RWMutex
+	loaded bool
+	pages  map[kb.Slug]*indexedPage
+
+	// refreshing serializes reading changed pages and applying them,
+	// so that an older read cannot overwrite a newer one
+	refreshing sync.Mutex
+}
+
+type indexedPage struct {
+	owner    kb.Slug
+	tagSlugs []string
+	// entry has ModifiedBy set to the last actor in the journal
+	entry kb.PageEntry
+}
+
+// ready returns whether the index can be used for reading
+func (index *pageIndex) ready() bool {
+	if index == nil {
+		return false
+	}
+	index.mu.RLock()
+	defer index.mu.RUnlock()
+	return index.loaded
+}
+
+// reset replaces all pages
+func (index *pageIndex) reset(pages []*indexedPage) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	index.pages = make(map[kb.Slug]*indexedPage, len(pages))
+	for _, page := range pages {
+		index.pages[page.entry.Slug] = page
+	}
+	index.loaded = true
+}
+
+// unload makes readers use the database until the index is built again
+func (index *pageIndex) unload() {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	index.pages = nil
+	index.loaded = false
+}
+
+// update replaces slugs with pages, slugs missing from pages are removed
+func (index *pageIndex) update(slugs []kb.Slug, pages []*indexedPage) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if !index.loaded {
+		return
+	}
+	for _, slug := range slugs {
+		delete(index.pages, slug)
+	}
+	for _, page := range pages {
+		index.pages[page.entry.Slug] = page
+	}
+}
+
+// replaceGroup replaces all pages of owner
+func (index *pageIndex) replaceGroup(owner kb.Slug, pages []*indexedPage) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if !index.loaded {
+		return
+	}
+	for slug, page := range index.pages {
+		if page.owner == owner {
+			delete(index.pages, slug)
+		}
+	}
+	for _, page := range pages {
+		index.pages[page.entry.Slug] = page
+	}
+}
+
+// collect returns copies of the entries that match, sorted by slug
+func (index *pageIndex) collect(match func(page *indexedPage) bool) []kb.PageEntry {
+	index.mu.RLock()
+	var entries []kb.PageEntry
+	for _, page := range index.pages {
+		if match(page) {
+			entry := page.entry
+			entry.Tags = append([]string{}, page.entry.Tags...)
+			entries = append(entries, entry)
+		}
+	}
+	index.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Slug < entries[j].Slug
+	})
+	return entries
+}
+
+// list returns the matching entries sorted by slug
+func (index *pageIndex) list(match func(page *indexedPage) bool) []kb.PageEntry {
+	entries := index.collect(match)
+	for i := range entries {
+		entries[i].ModifiedBy = ""
+	}
+	return entries
+}
+
+// recent returns at most n matching entries, most recently modified first
+func (index *pageIndex) recent(n int, match func(page *indexedPage) bool) []kb.PageEntry {
+	entries := index.collect(match)
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Modified.After(entries[j].Modified)
+	})
+	if n >= 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+	return entries
+}
+
+// CacheIndex configures whether listings are served from memory,
+// BuildIndex must be called afterwards. It must be called before use.
+func (db *Database) CacheIndex(enabled bool) {
+	db.index = nil
+	if enabled {
+		db.index = &pageIndex{}
+	}
+}
+
+// BuildIndex loads all live pages into the memory index
+func (db Database) BuildIndex() error {
+	if db.index == nil {
+		return nil
+	}
+	db.index.refreshing.Lock()
+	defer db.index.refreshing.Unlock()
+
+	pages, err := db.indexedPages(``)
+	if err != nil {
+		return err
+	}
+	db.index.reset(pages)
+	return nil
+}
+
+// indexedPages reads live pages for the memory index
+func (db Database) indexedPages(filter string, args ...interface{}) ([]*indexedPage, error) {
+	rows, err := db.Query(`
+		SELECT
+			OwnerID, TagSlugs,
+			Slug, Title, Synopsis, Tags, Modified,
+			COALESCE((
+				SELECT Actor FROM PageJournal
+				WHERE PageJournal.Slug = Pages.Slug AND Action <> 'try-edit'
+				ORDER BY Date DESC
+				LIMIT 1
+			), '')
+		FROM Pages
+		WHERE Deleted IS NULL
+		`+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pages []*indexedPage
+	for rows.Next() {
+		page := &indexedPage{}
+		tagSlugs, tags := stringSlice{}, stringSlice{}
+		err := rows.Scan(
+			&page.owner, &tagSlugs,
+			&page.entry.Slug,
+			&page.entry.Title,
+			&page.entry.Synopsis,
+			&tags,
+			&page.entry.Modified,
+			&page.entry.ModifiedBy,
+		)
+		if err != nil {
+			return nil, err
+		}
+		page.tagSlugs = []string(tagSlugs)
+		page.entry.Tags = []string(tags)
+		pages = append(pages, page)
+	}
+	return pages, rows.Err()
+}
+
+// refreshIndex updates the memory index after slugs were written
+func (db Context) refreshIndex(slugs ...kb.Slug) {
+	if !db.index.ready() {
+		return
+	}
+	db.index.refreshing.Lock()
+	defer db.index.refreshing.Unlock()
+
+	pages, err := db.indexedPages(`AND Slug = ANY($1)`, slugSlice(slugs))
+	if err != nil {
+		log.Println("Updating page index failed, using the database until rebuilt:", err)
+		db.index.unload()
+		return
+	}
+	db.index.update(slugs, pages)
+}
+
+// refreshGroupIndex updates the memory index after a batch write to group
+func (db Context) refreshGroupIndex(group kb.Slug) {
+	if !db.index.ready() {
+		return
+	}
+	db.index.refreshing.Lock()
+	defer db.index.refreshing.Unlock()
+
+	pages, err := db.indexedPages(`AND OwnerID = $1`, group)
+	if err != nil {
+		log.Println("Updating page index failed, using the database until rebuilt:", err)
+		db.index.unload()
+		return
+	}
+	db.index.replaceGroup(group, pages)
+}
+
+func slugSlice(slugs []kb.Slug) stringSlice {
+	values := make(stringSlice, len(slugs))
+	for i, slug := range slugs {
+		values[i] = string(slug)
+	}
+	return values
+}
+
+// readableGroups returns the groups the user can read, for filtering the memory index
+func (db Index) readableGroups() (map[kb.Slug]bool, error) {
+	groups, err := db.readable()
+	if err != nil {
+		return nil, err
+	}
+	readable := make(map[kb.Slug]bool, len(groups))
+	for _, group := range groups {
+		readable[group.ID] = true
+	}
+	return readable, nil
+}
+
+func hasAnyTag(page *indexedPage, tagSlugs []string) bool {
+	for _, tag := range tagSlugs {
+		for _, has := range page.tagSlugs {
+			if tag == has {
+				return true
+			}
+		}
+	}
+	return false
+}
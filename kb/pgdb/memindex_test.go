@@ -0,0 +1,128 @@
+package pgdb
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func indexed(owner kb.Slug, slug kb.Slug, modified time.Time, tags ...string) *indexedPage {
+	return &indexedPage{
+		owner:    owner,
+		tagSlugs: kb.SlugifyTags(tags),
+		entry: kb.PageEntry{
+			Slug:       slug,
+			Title:      string(slug),
+			Tags:       tags,
+			Modified:   modified,
+			ModifiedBy: "editor",
+		},
+	}
+}
+
+func slugsOf(entries []kb.PageEntry) []kb.Slug {
+	slugs := []kb.Slug{}
+	for _, entry := range entries {
+		slugs = append(slugs, entry.Slug)
+	}
+	return slugs
+}
+
+func TestPageIndexUpdate(t *testing.T) {
+	var disabled *pageIndex
+	if disabled.ready() {
+		t.Fatal("nil index is ready")
+	}
+
+	now := time.Now()
+	index := &pageIndex{}
+	index.update([]kb.Slug{"a=x"}, []*indexedPage{indexed("a", "a=x", now)})
+	if index.ready() || len(index.pages) != 0 {
+		t.Fatal("index was updated before it was built")
+	}
+
+	index.reset([]*indexedPage{
+		indexed("a", "a=beta", now.Add(-time.Hour), "Billing"),
+		indexed("a", "a=alpha", now.Add(-2*time.Hour)),
+		indexed("b", "b=gamma", now),
+	})
+	all := func(page *indexedPage) bool { return true }
+
+	// a create and a delete only touch their own slugs
+	index.update([]kb.Slug{"a=created", "a=alpha"}, []*indexedPage{
+		indexed("a", "a=created", now.Add(time.Hour)),
+	})
+	if got := slugsOf(index.list(all)); len(got) != 3 || got[0] != "a=beta" || got[1] != "a=created" || got[2] != "b=gamma" {
+		t.Errorf("list: got %v", got)
+	}
+	if got := index.list(all); got[0].ModifiedBy != "" || got[0].Tags[0] != "Billing" {
+		t.Errorf("list entry: got %+v", got[0])
+	}
+
+	recent := index.recent(2, all)
+	if got := slugsOf(recent); len(got) != 2 || got[0] != "a=created" || got[1] != "b=gamma" {
+		t.Errorf("recent: got %v", got)
+	}
+	if recent[0].ModifiedBy != "editor" {
+		t.Errorf("recent changes should keep the actor, got %+v", recent[0])
+	}
+
+	billing := kb.SlugifyTags([]string{"billing"})
+	if got := slugsOf(index.list(func(page *indexedPage) bool { return hasAnyTag(page, billing) })); len(got) != 1 || got[0] != "a=beta" {
+		t.Errorf("by tag: got %v", got)
+	}
+
+	index.replaceGroup("a", []*indexedPage{indexed("a", "a=replaced", now)})
+	if got := slugsOf(index.list(all)); len(got) != 2 || got[0] != "a=replaced" || got[1] != "b=gamma" {
+		t.Errorf("replaced group: got %v", got)
+	}
+
+	index.unload()
+	if index.ready() {
+		t.Error("unloaded index is ready")
+	}
+}
+
+func TestPageIndexConcurrent(t *testing.T) {
+	index := &pageIndex{}
+	index.reset(nil)
+	all := func(page *indexedPage) bool { return true }
+
+	var wg sync.WaitGroup
+	for writer := 0; writer < 4; writer++ {
+		wg.Add(1)
+		go func(writer int) {
+			defer wg.Done()
+			owner := kb.Slug("group" + strconv.Itoa(writer))
+			for i := 0; i < 100; i++ {
+				slug := owner + "=page-" + kb.Slug(strconv.Itoa(i))
+				index.update([]kb.Slug{slug}, []*indexedPage{indexed(owner, slug, time.Now())})
+				if i%10 == 0 {
+					index.update([]kb.Slug{slug}, nil)
+				}
+			}
+			index.replaceGroup(owner, []*indexedPage{indexed(owner, owner+"=last", time.Now())})
+		}(writer)
+	}
+	for reader := 0; reader < 4; reader++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				for _, entry := range index.list(all) {
+					entry.Tags = append(entry.Tags, "modified")
+				}
+				index.recent(10, all)
+				index.ready()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := slugsOf(index.list(all)); len(got) != 4 {
+		t.Errorf("expected the last page of each group, got %v", got)
+	}
+}
@@ -0,0 +1,91 @@
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"reflect"
+	"runtime"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// QueryObserver is called after each query with the name of the method
+// that issued it, e.g. "Pages.Load", and how long the query took.
+// Queries inside transactions are not observed.
+type QueryObserver func(name string, duration time.Duration)
+
+// SlowQueryLogger returns an observer that logs queries taking longer than threshold
+func SlowQueryLogger(threshold time.Duration) QueryObserver {
+	return func(name string, duration time.Duration) {
+		if duration > threshold {
+			log.Printf("slow query %s: %v", name, duration)
+		}
+	}
+}
+
+// ObserveQueries sets the observer of all queries, the default nil observer
+// does nothing. It must be called before use.
+func (db *Database) ObserveQueries(observer QueryObserver) {
+	db.observer = observer
+}
+
+// observe reports a query started at start to the observer
+func (db Database) observe(start time.Time) {
+	if db.observer == nil {
+		return
+	}
+	db.observer(queryName(), time.Since(start))
+}
+
+var packagePrefix = reflect.TypeOf(Database{}).PkgPath() + "."
+
+// queryName finds the outermost exported method of this package on the stack
+func queryName() string {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(3, pcs)])
+
+	name := "unknown"
+	for {
+		frame, more := frames.Next()
+		if strings.HasPrefix(frame.Function, packagePrefix) {
+			parts := strings.Split(strings.TrimPrefix(frame.Function, packagePrefix), ".")
+			if len(parts) == 2 && unicode.IsUpper([]rune(parts[1])[0]) {
+				name = parts[0] + "." + parts[1]
+			}
+		}
+		if !more {
+			return name
+		}
+	}
+}
+
+// The following shadow the methods of sql.DB to observe the queries.
+
+func (db Database) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+func (db Database) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer db.observe(time.Now())
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db Database) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+func (db Database) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	defer db.observe(time.Now())
+	return db.DB.QueryContext(ctx, query, args...)
+}
+
+func (db Database) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+func (db Database) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	defer db.observe(time.Now())
+	return db.DB.QueryRowContext(ctx, query, args...)
+}
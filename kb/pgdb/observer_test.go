@@ -0,0 +1,28 @@
+package pgdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestObserverNames(t *testing.T) {
+	// queries on a closed database fail immediately, but are still observed
+	db, err := New("user=nobody dbname=none sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.Close()
+
+	var names []string
+	db.ObserveQueries(func(name string, duration time.Duration) {
+		names = append(names, name)
+	})
+
+	pages := db.Context("admin").Pages("test")
+	pages.Load("test=missing")
+	pages.List()
+
+	if len(names) != 2 || names[0] != "Pages.Load" || names[1] != "Pages.List" {
+		t.Fatalf("got %v, expected [Pages.Load Pages.List]", names)
+	}
+}
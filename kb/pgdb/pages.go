@@ -1,11 +1,16 @@
 package pgdb
 
 import (
+	"context"
 	"database/sql"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"sort"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/raintreeinc/knowledgebase/kb"
@@ -16,9 +21,18 @@ type Pages struct {
 	GroupID kb.Slug
 }
 
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
 func (db Pages) record(action string, slug kb.Slug, version int, v interface{}) {
+	db.recordTo(preparedExecer{db.Database}, action, slug, version, v)
+}
+
+// recordTo journals an action using exec, which can be a transaction
+func (db Pages) recordTo(exec execer, action string, slug kb.Slug, version int, v interface{}) {
 	data, _ := json.Marshal(v)
-	_, err := db.Exec(`
+	_, err := exec.Exec(`
 		INSERT INTO
 		PageJournal(Actor, Slug, Version, Action, Data)
 		VALUES($1, $2, $3, $4, $5)
@@ -27,14 +41,23 @@ func (db Pages) record(action string, slug kb.Slug, version int, v interface{})
 		log.Println(err)
 	}
 }
+
 func (db Pages) Create(page *kb.Page) error {
 	owner, _ := kb.TokenizeLink(string(page.Slug))
 	if owner != db.GroupID {
 		return fmt.Errorf("mismatching page.Slug (%s) and group (%s)", page.Slug, db.GroupID)
 	}
+	if err := db.writable(); err != nil {
+		return err
+	}
 	if err := kb.ValidateSlug(page.Slug); err != nil {
 		return kb.ErrInvalidSlug
 	}
+	if db.knownSite != nil {
+		if errs := kb.ResolveReferences(page.Story, db.knownSite); len(errs) > 0 {
+			return kb.BadRequest(errs[0].Error())
+		}
+	}
 
 	page.Synopsis = kb.ExtractSynopsis(page)
 	tags := kb.ExtractTags(page)
@@ -45,6 +68,15 @@ func (db Pages) Create(page *kb.Page) error {
 		return fmt.Errorf("failed to serialize page: %v", err)
 	}
 
+	// a deleted page must not block creating a new one
+	_, err = db.Exec(`
+		DELETE FROM Pages
+		WHERE Slug = $1 AND Deleted IS NOT NULL
+	`, page.Slug)
+	if err != nil {
+		return err
+	}
+
 	_, err = db.Exec(`
 		INSERT INTO Pages(
 			OwnerID, Slug, Data, Version,
@@ -63,12 +95,34 @@ func (db Pages) Create(page *kb.Page) error {
 	}
 	if err == nil {
 		db.record("create", page.Slug, 0, page)
+		db.refreshIndex(page.Slug)
 	}
 	return err
 }
 
+// CreateFromTemplate creates page slug from template,
+// the active user must be able to read the group of template
+func (db Pages) CreateFromTemplate(slug, template kb.Slug, vars map[string]string) error {
+	owner, _ := kb.TokenizeLink(string(template))
+	access := db.Access()
+	if !access.IsAdmin(db.ActiveUser) &&
+		access.Rights(owner, db.ActiveUser).Level() < kb.Rights(kb.Reader).Level() {
+		return kb.ErrAccessDenied
+	}
+
+	source, err := db.Context.Pages(owner).Load(template)
+	if err != nil {
+		return err
+	}
+	return db.Create(kb.InstantiateTemplate(source, slug, vars))
+}
+
 func (db Pages) Load(id kb.Slug) (*kb.Page, error) {
-	data, err := db.LoadRaw(id)
+	return db.LoadCtx(context.Background(), id)
+}
+
+func (db Pages) LoadCtx(ctx context.Context, id kb.Slug) (*kb.Page, error) {
+	data, err := db.LoadRawCtx(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -78,11 +132,15 @@ func (db Pages) Load(id kb.Slug) (*kb.Page, error) {
 }
 
 func (db Pages) LoadRaw(id kb.Slug) ([]byte, error) {
+	return db.LoadRawCtx(context.Background(), id)
+}
+
+func (db Pages) LoadRawCtx(ctx context.Context, id kb.Slug) ([]byte, error) {
 	var data []byte
-	err := db.QueryRow(`
+	err := db.queryRowPrepared(ctx, `
 		SELECT Data
 		FROM Pages
-		Where Slug = $1
+		Where Slug = $1 AND Deleted IS NULL
 	`, id).Scan(&data)
 	if err == sql.ErrNoRows {
 		return nil, kb.ErrPageNotExist
@@ -95,6 +153,9 @@ func (db Pages) Overwrite(id kb.Slug, version int, page *kb.Page) error {
 	if owner != db.GroupID {
 		return fmt.Errorf("mismatching page.Slug (%s) and group (%s)", page.Slug, db.GroupID)
 	}
+	if err := db.writable(); err != nil {
+		return err
+	}
 
 	page.Synopsis = kb.ExtractSynopsis(page)
 	tags := kb.ExtractTags(page)
@@ -114,27 +175,135 @@ func (db Pages) Overwrite(id kb.Slug, version int, page *kb.Page) error {
 			Created = $8,
 			Modified = $9
 		WHERE OwnerID = $1 AND Slug = $2 AND Version = $3
+		  AND Deleted IS NULL
 	`, db.GroupID, page.Slug, version,
 		data, page.Version, stringSlice(tags), stringSlice(tagSlugs),
 		page.Modified, page.Modified)
 
+	if err != nil {
+		return err
+	}
+
 	affected, _ := r.RowsAffected()
 	if affected == 0 {
-		return kb.ErrConcurrentEdit
+		return db.conflict(page.Slug)
 	}
-	if err == nil {
-		db.record("overwrite", page.Slug, version, page)
+	db.record("overwrite", page.Slug, version, page)
+	db.refreshIndex(page.Slug)
+	return nil
+}
+
+func (db Pages) Upsert(page *kb.Page) error {
+	owner, _ := kb.TokenizeLink(string(page.Slug))
+	if owner != db.GroupID {
+		return fmt.Errorf("mismatching page.Slug (%s) and group (%s)", page.Slug, db.GroupID)
 	}
-	return err
+	if err := db.writable(); err != nil {
+		return err
+	}
+	if err := kb.ValidateSlug(page.Slug); err != nil {
+		return kb.ErrInvalidSlug
+	}
+	if db.knownSite != nil {
+		if errs := kb.ResolveReferences(page.Story, db.knownSite); len(errs) > 0 {
+			return kb.BadRequest(errs[0].Error())
+		}
+	}
+
+	page.Synopsis = kb.ExtractSynopsis(page)
+	tags := kb.ExtractTags(page)
+	tagSlugs := kb.SlugifyTags(tags)
+
+	data, err := json.Marshal(page)
+	if err != nil {
+		return fmt.Errorf("failed to serialize page: %v", err)
+	}
+	hash, err := page.Hash()
+	if err != nil {
+		return fmt.Errorf("failed to get page hash: %v", err)
+	}
+
+	r, err := db.Exec(`
+		INSERT INTO Pages(
+			OwnerID, Slug, Data, Version,
+			Tags, TagSlugs,
+			Created, Modified, Hash
+		) VALUES (
+			$1, $2, $3, $4,
+			$5, $6,
+			$7, $8, $9
+		)
+		ON CONFLICT (Slug) DO UPDATE
+		SET Data = EXCLUDED.Data,
+			Version = EXCLUDED.Version,
+			Tags = EXCLUDED.Tags,
+			TagSlugs = EXCLUDED.TagSlugs,
+			Modified = EXCLUDED.Modified,
+			Hash = EXCLUDED.Hash,
+			Deleted = NULL
+		WHERE Pages.OwnerID = EXCLUDED.OwnerID
+	`, db.GroupID, page.Slug, data, page.Version,
+		stringSlice(tags), stringSlice(tagSlugs),
+		page.Modified, page.Modified, hash)
+	if err != nil {
+		return err
+	}
+	// the slug belongs to a page moved to another group
+	if affected, _ := r.RowsAffected(); affected == 0 {
+		return kb.ErrPageExists
+	}
+
+	db.record("upsert", page.Slug, page.Version, page)
+	db.refreshIndex(page.Slug)
+	return nil
+}
+
+// writable returns ErrGroupFrozen when the group is frozen,
+// pages of groups missing from the database are writable
+func (db Pages) writable() error {
+	var frozen bool
+	err := db.QueryRow(`
+		SELECT Frozen
+		FROM Groups
+		WHERE ID = $1
+	`, db.GroupID).Scan(&frozen)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if frozen {
+		return kb.ErrGroupFrozen
+	}
+	return nil
+}
+
+// conflict returns the concurrent edit error with the live version of the page
+func (db Pages) conflict(id kb.Slug) error {
+	var version int
+	err := db.QueryRow(`
+		SELECT Version
+		FROM Pages
+		WHERE Slug = $1 AND Deleted IS NULL
+	`, id).Scan(&version)
+	if err != nil {
+		return kb.ErrConcurrentEdit
+	}
+	return kb.ConcurrentEditError{CurrentVersion: version}
 }
 
 func (db Pages) Edit(id kb.Slug, version int, action kb.Action) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
 	page, err := db.Load(id)
 	if err != nil {
 		return err
 	}
 	if version > 0 && page.Version != version {
-		return kb.ErrConcurrentEdit
+		return kb.ConcurrentEditError{CurrentVersion: page.Version}
 	}
 	version = page.Version
 	page.Modified = time.Now()
@@ -146,35 +315,424 @@ func (db Pages) Edit(id kb.Slug, version int, action kb.Action) error {
 	return db.Overwrite(id, version, page)
 }
 
-func (db Pages) Delete(id kb.Slug, version int) (err error) {
-	var r sql.Result
-	if version > 0 {
-		r, err = db.Exec(`
-			DELETE FROM Pages
-			WHERE Slug = $1 AND Version = $2
-		`, id, version)
-	} else {
-		r, err = db.Exec(`
-			DELETE FROM Pages
-			WHERE Slug = $1
-		`, id)
+func (db Pages) Rename(oldID, newID kb.Slug, version int) error {
+	owner, _ := kb.TokenizeLink(string(newID))
+	if owner != db.GroupID {
+		return fmt.Errorf("mismatching slug (%s) and group (%s)", newID, db.GroupID)
+	}
+	if err := kb.ValidateSlug(newID); err != nil {
+		return kb.ErrInvalidSlug
+	}
+
+	return db.relocate("rename", oldID, newID, db.GroupID, version)
+}
+
+// Move transfers the page to newGroup, the active user must be
+// a moderator of newGroup or an admin
+func (db Pages) Move(id kb.Slug, newGroup kb.Slug) error {
+	owner, _ := kb.TokenizeLink(string(id))
+	if owner != db.GroupID {
+		return fmt.Errorf("mismatching slug (%s) and group (%s)", id, db.GroupID)
+	}
+
+	access := db.Access()
+	if !access.IsAdmin(db.ActiveUser) &&
+		access.Rights(newGroup, db.ActiveUser).Level() < kb.Rights(kb.Moderator).Level() {
+		return kb.ErrAccessDenied
+	}
+
+	newID := newGroup + id[len(owner):]
+	if err := kb.ValidateSlug(newID); err != nil {
+		return kb.ErrInvalidSlug
+	}
+
+	return db.relocate("move", id, newID, newGroup, -1)
+}
+
+// relocate changes the slug and owner of a page together with its history
+func (db Pages) relocate(action string, oldID, newID, newOwner kb.Slug, version int) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+	if err := (Pages{db.Context, newOwner}).writable(); err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// a deleted page must not block relocating
+	_, err = tx.Exec(`
+		DELETE FROM Pages
+		WHERE Slug = $1 AND Deleted IS NOT NULL
+	`, newID)
+	if err != nil {
+		return err
+	}
+
+	r, err := tx.Exec(`
+		UPDATE Pages
+		SET OwnerID = $5,
+			Slug = $3,
+			Data = jsonb_set(Data, '{slug}', to_jsonb($3::TEXT))
+		WHERE OwnerID = $1 AND Slug = $2 AND Deleted IS NULL
+		  AND ($4 <= 0 OR Version = $4)
+	`, db.GroupID, oldID, newID, version, newOwner)
+	if dupkey(err) {
+		return kb.ErrPageExists
+	}
+	if err != nil {
+		return err
 	}
 
 	affected, _ := r.RowsAffected()
-	if err == sql.ErrNoRows || affected == 0 {
-		return kb.ErrConcurrentEdit
+	if affected == 0 {
+		if version > 0 {
+			return kb.ErrConcurrentEdit
+		}
+		return kb.ErrPageNotExist
 	}
+
+	// move history to the new slug
+	_, err = tx.Exec(`
+		UPDATE PageJournal
+		SET Slug = $2
+		WHERE Slug = $1
+	`, oldID, newID)
 	if err != nil {
-		db.record("delete", id, version, "")
+		return err
+	}
+
+	// keep links to the old slug working
+	if err := addAlias(tx, oldID, newID); err != nil {
+		return err
+	}
+
+	db.recordTo(tx, action, newID, version, map[string]kb.Slug{
+		"from": oldID,
+		"to":   newID,
+	})
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	db.refreshIndex(oldID, newID)
+	return nil
+}
+
+func (db Pages) ForceVersion(id kb.Slug, version int) error {
+	if !db.Access().IsAdmin(db.ActiveUser) {
+		return kb.ErrAccessDenied
+	}
+
+	var previous int
+	err := db.QueryRow(`
+		SELECT Version
+		FROM Pages
+		WHERE OwnerID = $1 AND Slug = $2 AND Deleted IS NULL
+	`, db.GroupID, id).Scan(&previous)
+	if err == sql.ErrNoRows {
+		return kb.ErrPageNotExist
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE Pages
+		SET Version = $3,
+			Data = jsonb_set(Data, '{version}', to_jsonb($3::INT))
+		WHERE OwnerID = $1 AND Slug = $2
+	`, db.GroupID, id, version)
+	if err == nil {
+		db.record("force-version", id, previous, version)
 	}
 	return err
 }
 
+func (db Pages) Delete(id kb.Slug, version int) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	var deleted int
+	err := db.QueryRow(`
+		UPDATE Pages
+		SET Deleted = current_timestamp
+		WHERE Slug = $1 AND ($2 <= 0 OR Version = $2) AND Deleted IS NULL
+		RETURNING Version
+	`, id, version).Scan(&deleted)
+	if err == sql.ErrNoRows {
+		return db.conflict(id)
+	}
+	if err != nil {
+		return err
+	}
+
+	db.record("delete", id, deleted, deleteInfo{
+		Actor:   db.ActiveUser,
+		Version: deleted,
+	})
+	db.refreshIndex(id)
+	return nil
+}
+
+// deleteInfo is the journaled data of a delete
+type deleteInfo struct {
+	Actor   kb.Slug `json:"actor"`
+	Version int     `json:"version"`
+}
+
+func (db Pages) Restore(id kb.Slug) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	r, err := db.Exec(`
+		UPDATE Pages
+		SET Deleted = NULL
+		WHERE OwnerID = $1 AND Slug = $2 AND Deleted IS NOT NULL
+	`, db.GroupID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, _ := r.RowsAffected()
+	if affected == 0 {
+		return kb.ErrPageNotExist
+	}
+	db.record("restore", id, 0, "")
+	db.refreshIndex(id)
+	return nil
+}
+
+func (db Pages) Purge(id kb.Slug) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	r, err := db.Exec(`
+		DELETE FROM Pages
+		WHERE OwnerID = $1 AND Slug = $2
+	`, db.GroupID, id)
+	if err != nil {
+		return err
+	}
+
+	affected, _ := r.RowsAffected()
+	if affected == 0 {
+		return kb.ErrPageNotExist
+	}
+	db.record("purge", id, 0, "")
+	db.refreshIndex(id)
+	return nil
+}
+
 func (db Pages) List() ([]kb.PageEntry, error) {
+	return db.ListFiltered(kb.ListOptions{})
+}
+
+func (db Pages) ListCtx(ctx context.Context) ([]kb.PageEntry, error) {
+	return db.listFiltered(ctx, kb.ListOptions{})
+}
+
+func (db Pages) ListFiltered(opts kb.ListOptions) ([]kb.PageEntry, error) {
+	return db.listFiltered(context.Background(), opts)
+}
+
+func (db Pages) listFiltered(ctx context.Context, opts kb.ListOptions) ([]kb.PageEntry, error) {
+	var order string
+	switch opts.SortBy {
+	case "", kb.SortBySlug:
+		order = "Slug"
+	case kb.SortByModified:
+		order = "Modified"
+	case kb.SortByCreated:
+		order = "Created"
+	default:
+		return nil, fmt.Errorf("invalid sort order %q", opts.SortBy)
+	}
+	if opts.Descending {
+		order += " DESC"
+	}
+
+	if db.index.ready() && opts.SortBy != kb.SortByCreated {
+		return db.indexedList(opts), nil
+	}
+
+	if len(opts.Tags) == 0 {
+		return db.preparedEntries(ctx, `
+			WHERE OwnerID = $1 AND Deleted IS NULL
+			ORDER BY `+order+`, Slug
+		`, db.GroupID)
+	}
+
+	return db.pageEntriesCtx(ctx, `
+		WHERE OwnerID = $1 AND Deleted IS NULL
+		  AND TagSlugs && $2
+		ORDER BY `+order+`, Slug
+	`, db.GroupID, stringSlice(kb.SlugifyTags(opts.Tags)))
+}
+
+// indexedList is listFiltered using the memory index
+func (db Pages) indexedList(opts kb.ListOptions) []kb.PageEntry {
+	tagSlugs := kb.SlugifyTags(opts.Tags)
+	entries := db.index.list(func(page *indexedPage) bool {
+		return page.owner == db.GroupID &&
+			(len(tagSlugs) == 0 || hasAnyTag(page, tagSlugs))
+	})
+
+	if opts.SortBy == kb.SortByModified {
+		sort.SliceStable(entries, func(i, j int) bool {
+			if opts.Descending {
+				return entries[i].Modified.After(entries[j].Modified)
+			}
+			return entries[i].Modified.Before(entries[j].Modified)
+		})
+	} else if opts.Descending {
+		sort.SliceStable(entries, func(i, j int) bool {
+			return entries[i].Slug > entries[j].Slug
+		})
+	}
+	return entries
+}
+
+func (db Pages) ListByPrefix(prefix kb.Slug) ([]kb.PageEntry, error) {
 	return db.pageEntries(`
-		WHERE OwnerID = $1
+		WHERE OwnerID = $1 AND Deleted IS NULL
+		  AND Slug LIKE $2 || '%' ESCAPE '\'
+		ORDER BY Slug
+	`, db.GroupID, escapeLike(string(prefix)))
+}
+
+func (db Pages) CheckLinks() ([]kb.BrokenLink, error) {
+	rows, err := db.Query(`
+		SELECT Slug, Data
+		FROM Pages
+		WHERE OwnerID = $1 AND Deleted IS NULL
 		ORDER BY Slug
 	`, db.GroupID)
+	if err != nil {
+		return nil, err
+	}
+
+	links := []kb.BrokenLink{}
+	targets, owners := stringSlice{}, stringSlice{}
+	for rows.Next() {
+		var slug kb.Slug
+		var data []byte
+		if err := rows.Scan(&slug, &data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		page := &kb.Page{}
+		if err := json.Unmarshal(data, page); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %v", slug, err)
+		}
+
+		for _, link := range kb.InternalLinks(db.GroupID, page.Story) {
+			owner, _ := kb.TokenizeLink(string(link.Target))
+			links = append(links, kb.BrokenLink{Page: slug, Item: link.Item, Target: link.Target})
+			targets = append(targets, string(link.Target))
+			owners = append(owners, string(owner))
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if len(links) == 0 {
+		return links, nil
+	}
+
+	pages, groups := map[string]bool{}, map[string]bool{}
+	for _, q := range []struct {
+		query string
+		ids   stringSlice
+		found map[string]bool
+	}{
+		{`SELECT Slug FROM Pages WHERE Slug = ANY($1) AND Deleted IS NULL`, targets, pages},
+		{`SELECT ID FROM Groups WHERE ID = ANY($1)`, owners, groups},
+	} {
+		rows, err := db.Query(q.query, q.ids)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			q.found[id] = true
+		}
+		if err := rows.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	broken := []kb.BrokenLink{}
+	for _, link := range links {
+		owner, _ := kb.TokenizeLink(string(link.Target))
+		if groups[string(owner)] && !pages[string(link.Target)] {
+			broken = append(broken, link)
+		}
+	}
+	return broken, nil
+}
+
+// Backlinks scans the stories of pages the active user can read, links
+// may be written as titles, such as [[Intro Page]], so the slug cannot be
+// matched in SQL. Only pages containing kb.LinkKeyword of id are scanned.
+func (db Pages) Backlinks(id kb.Slug) ([]kb.PageEntry, error) {
+	rows, err := db.Query(`
+		SELECT Slug, OwnerID, Data
+		FROM Pages
+		JOIN AccessView ON OwnerID = AccessView.GroupID
+		WHERE AccessView.UserID = $2
+		  AND AccessView.Access >= 'reader'
+		  AND Deleted IS NULL
+		  AND Slug <> $1
+		  AND Data::text ILIKE '%' || $3 || '%'
+	`, id, db.ActiveUser, kb.LinkKeyword(id))
+	if err != nil {
+		return nil, err
+	}
+
+	sources := stringSlice{}
+	for rows.Next() {
+		var slug, owner kb.Slug
+		var data []byte
+		if err := rows.Scan(&slug, &owner, &data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		page := &kb.Page{}
+		if err := json.Unmarshal(data, page); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("%s: %v", slug, err)
+		}
+
+		for _, link := range kb.InternalLinks(owner, page.Story) {
+			if link.Target == id {
+				sources = append(sources, string(slug))
+				break
+			}
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if len(sources) == 0 {
+		return []kb.PageEntry{}, nil
+	}
+
+	return db.pageEntries(`
+		WHERE Slug = ANY($1)
+		  AND Deleted IS NULL
+		ORDER BY Slug`, sources)
 }
 
 func (db Pages) LoadRawVersion(id kb.Slug, version int) ([]byte, error) {
@@ -190,13 +748,152 @@ func (db Pages) LoadRawVersion(id kb.Slug, version int) ([]byte, error) {
 	return data, err
 }
 
-func (db Pages) History(id kb.Slug) (entries []kb.PageEntry, err error) {
+// loadRawSnapshot returns the newest journaled content of id whose page
+// version is version, overwrite entries are journaled with the version they
+// replaced, so the version of the content is read from the data itself
+func (db Pages) loadRawSnapshot(id kb.Slug, version int) ([]byte, error) {
+	var data []byte
+	err := db.QueryRow(`
+		SELECT Data
+		FROM PageJournal
+		WHERE Slug = $1
+		  AND Action IN ('create', 'overwrite')
+		  AND (Data->>'version')::int = $2
+		ORDER BY Date DESC
+		LIMIT 1
+	`, id, version).Scan(&data)
+	if err == sql.ErrNoRows {
+		return nil, kb.ErrPageNotExist
+	}
+	return data, err
+}
+
+// RestoreVersion makes the content that page id had at targetVersion
+// current again, versions reached by edits have no snapshot to restore
+func (db Pages) RestoreVersion(id kb.Slug, targetVersion, currentVersion int) error {
+	if err := db.writable(); err != nil {
+		return err
+	}
+
+	data, err := db.loadRawSnapshot(id, targetVersion)
+	if err != nil {
+		return err
+	}
+
+	page := &kb.Page{}
+	if err := json.Unmarshal(data, page); err != nil {
+		return fmt.Errorf("failed to deserialize page: %v", err)
+	}
+
+	page.Slug = id
+	page.Version = currentVersion + 1
+	page.Modified = time.Now()
+
+	if err := db.Overwrite(id, currentVersion, page); err != nil {
+		return err
+	}
+	db.record("restore-version", id, currentVersion, targetVersion)
+	return nil
+}
+
+// ExportCSV streams the rows, tags are joined with ", "
+func (db Pages) ExportCSV(w io.Writer) error {
 	rows, err := db.Query(`
-		SELECT Actor, Date, Version
+		SELECT Slug, Title, Tags, Modified, Version
+		FROM Pages
+		WHERE OwnerID = $1 AND Deleted IS NULL
+		ORDER BY Slug
+	`, db.GroupID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"slug", "title", "tags", "modified", "version"}); err != nil {
+		return err
+	}
+	for rows.Next() {
+		var slug kb.Slug
+		var title string
+		var tags stringSlice
+		var modified time.Time
+		var version int
+		if err := rows.Scan(&slug, &title, &tags, &modified, &version); err != nil {
+			return err
+		}
+		err := out.Write([]string{
+			string(slug),
+			title,
+			strings.Join(tags, ", "),
+			modified.UTC().Format(time.RFC3339),
+			strconv.Itoa(version),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func (db Pages) Count() (int, error) {
+	var count int
+	err := db.QueryRow(`
+		SELECT COUNT(*)
+		FROM Pages
+		WHERE OwnerID = $1 AND Deleted IS NULL
+	`, db.GroupID).Scan(&count)
+	return count, err
+}
+
+func (db Pages) Stats() (kb.GroupStats, error) {
+	var stats kb.GroupStats
+	var modified sql.NullTime
+	err := db.QueryRow(`
+		SELECT
+			COUNT(*),
+			(
+				SELECT COUNT(DISTINCT Tag)
+				FROM Pages, unnest(TagSlugs) Tag
+				WHERE OwnerID = $1 AND Deleted IS NULL
+			),
+			MAX(Modified)
+		FROM Pages
+		WHERE OwnerID = $1 AND Deleted IS NULL
+	`, db.GroupID).Scan(&stats.Pages, &stats.Tags, &modified)
+	stats.LastModified = modified.Time
+	return stats, err
+}
+
+func (db Pages) History(id kb.Slug, offset, limit int) ([]kb.PageEntry, error) {
+	return db.history(id, offset, limit, false)
+}
+
+func (db Pages) HistoryWithDeletes(id kb.Slug, offset, limit int) ([]kb.PageEntry, error) {
+	return db.history(id, offset, limit, true)
+}
+
+func (db Pages) history(id kb.Slug, offset, limit int, deletes bool) (entries []kb.PageEntry, err error) {
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = kb.DefaultHistoryLimit
+	}
+
+	rows, err := db.Query(`
+		SELECT Actor, Date, Version, Action
 		FROM PageJournal
-		WHERE Slug = $1 AND Action = 'overwrite'
-		ORDER BY VERSION DESC
-	`, id)
+		WHERE Slug = $1
+		  AND (Action = 'overwrite' OR ($4 AND Action = 'delete'))
+		ORDER BY VERSION DESC, Date DESC
+		LIMIT $2 OFFSET $3
+	`, id, limit, offset, deletes)
 
 	if err != nil {
 		return nil, err
@@ -204,21 +901,91 @@ func (db Pages) History(id kb.Slug) (entries []kb.PageEntry, err error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var actor string
+		var actor, action string
 		var date time.Time
 		var version int
-		err := rows.Scan(&actor, &date, &version)
+		err := rows.Scan(&actor, &date, &version, &action)
 		if err != nil {
 			return nil, err
 		}
 
 		var entry kb.PageEntry
-		entry.Slug = id + "?history=" + kb.Slug(strconv.Itoa(version))
-		entry.Title = "Version " + strconv.Itoa(version)
 		entry.Modified = date
-		entry.Synopsis = "Modified by " + actor + " on " + date.Format("2006-01-02 15:04")
+		if action == "delete" {
+			entry.Slug = id
+			entry.Title = "Deleted version " + strconv.Itoa(version)
+			entry.Synopsis = "Deleted by " + actor + " on " + date.Format("2006-01-02 15:04")
+		} else {
+			entry.Slug = id + "?history=" + kb.Slug(strconv.Itoa(version))
+			entry.Title = "Version " + strconv.Itoa(version)
+			entry.Synopsis = "Modified by " + actor + " on " + date.Format("2006-01-02 15:04")
+		}
 		entries = append(entries, entry)
 	}
 
 	return entries, nil
 }
+
+func (db Pages) CompactJournal(id kb.Slug, keepVersions int) error {
+	if keepVersions <= 0 {
+		return fmt.Errorf("must keep at least one version, got %d", keepVersions)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// collapse repeated snapshots of a version, keeping the newest one
+	_, err = tx.Exec(`
+		DELETE FROM PageJournal Old
+		USING PageJournal New
+		WHERE Old.Slug = $1 AND New.Slug = $1
+		  AND Old.Action = 'overwrite' AND New.Action = 'overwrite'
+		  AND Old.Version = New.Version
+		  AND (Old.Date, Old.ctid) < (New.Date, New.ctid)
+	`, id)
+	if err != nil {
+		return fmt.Errorf("failed to collapse snapshots: %v", err)
+	}
+
+	var oldest, newest sql.NullInt64
+	err = tx.QueryRow(`
+		SELECT MIN(Version), MAX(Version)
+		FROM (
+			SELECT Version
+			FROM PageJournal
+			WHERE Slug = $1 AND Action = 'overwrite'
+			ORDER BY Version DESC
+			LIMIT $2
+		) Kept
+	`, id, keepVersions).Scan(&oldest, &newest)
+	if err != nil {
+		return err
+	}
+	if !oldest.Valid {
+		// nothing has been overwritten yet
+		return tx.Commit()
+	}
+
+	// snapshots contain the full page, so older ones are not needed by kept versions
+	_, err = tx.Exec(`
+		DELETE FROM PageJournal
+		WHERE Slug = $1 AND Action = 'overwrite' AND Version < $2
+	`, id, oldest.Int64)
+	if err != nil {
+		return fmt.Errorf("failed to remove snapshots: %v", err)
+	}
+
+	// edits before the newest snapshot are already part of it
+	_, err = tx.Exec(`
+		DELETE FROM PageJournal
+		WHERE Slug = $1 AND Action = 'try-edit' AND Version < $2
+	`, id, newest.Int64)
+	if err != nil {
+		return fmt.Errorf("failed to remove edits: %v", err)
+	}
+
+	return tx.Commit()
+}
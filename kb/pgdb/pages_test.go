@@ -0,0 +1,1487 @@
+package pgdb_test
+
+import (
+	"bytes"
+	gocontext "context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+	"github.com/raintreeinc/knowledgebase/kb/pgdb"
+)
+
+func TestSoftDelete(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Delete("test=alpha", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := pages.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("deleted page listed: %v", entries)
+	}
+	if _, err := pages.Load("test=alpha"); err != kb.ErrPageNotExist {
+		t.Errorf("loading deleted page: got %v", err)
+	}
+	if err := pages.Delete("test=alpha", 0); !errors.Is(err, kb.ErrConcurrentEdit) {
+		t.Errorf("deleting twice: got %v", err)
+	}
+
+	if err := pages.Restore("test=alpha"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = pages.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Slug != "test=alpha" {
+		t.Errorf("restored page not listed: %v", entries)
+	}
+	if err := pages.Restore("test=alpha"); err != kb.ErrPageNotExist {
+		t.Errorf("restoring live page: got %v", err)
+	}
+
+	if err := pages.Purge("test=alpha"); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Restore("test=alpha"); err != kb.ErrPageNotExist {
+		t.Errorf("restoring purged page: got %v", err)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	page := testPage("test=alpha", "Alpha")
+	if err := pages.Create(page); err != nil {
+		t.Fatal(err)
+	}
+	for version, title := range []string{"Beta", "Gamma"} {
+		next := testPage("test=alpha", title)
+		next.Version = version + 2
+		if err := pages.Overwrite("test=alpha", version+1, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// versions: 1 Alpha, 2 Beta, 3 Gamma
+	if err := pages.RestoreVersion("test=alpha", 2, 1); !errors.Is(err, kb.ErrConcurrentEdit) {
+		t.Errorf("restoring with stale version: got %v", err)
+	}
+	if err := pages.RestoreVersion("test=alpha", 2, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	var restores int
+	err := context.(pgdb.Context).QueryRow(`
+		SELECT COUNT(*) FROM PageJournal
+		WHERE Slug = 'test=alpha' AND Action = 'restore-version'
+	`).Scan(&restores)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restores != 1 {
+		t.Errorf("expected only the successful restore journaled, got %d", restores)
+	}
+
+	restored, err := pages.Load("test=alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "Beta" || restored.Version != 4 {
+		t.Errorf("restored page: got %q version %d", restored.Title, restored.Version)
+	}
+
+	history, err := pages.History("test=alpha", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 3 || history[0].Title != "Version 3" {
+		t.Errorf("history does not show the restore: %v", history)
+	}
+
+	// the created version has no overwrite entry, but can be restored
+	if err := pages.RestoreVersion("test=alpha", 1, 4); err != nil {
+		t.Fatal(err)
+	}
+	restored, err = pages.Load("test=alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "Alpha" || restored.Version != 5 {
+		t.Errorf("restored first version: got %q version %d", restored.Title, restored.Version)
+	}
+	if err := pages.RestoreVersion("test=alpha", 9, 5); err != kb.ErrPageNotExist {
+		t.Errorf("restoring unknown version: got %v", err)
+	}
+}
+
+func TestForceVersion(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha")); err != nil {
+		t.Fatal(err)
+	}
+
+	guest := context.(pgdb.Context).Context("guest").Pages("test")
+	if err := guest.ForceVersion("test=alpha", 7); err != kb.ErrAccessDenied {
+		t.Errorf("non-admin forcing version: got %v", err)
+	}
+
+	if err := pages.ForceVersion("test=alpha", 7); err != nil {
+		t.Fatal(err)
+	}
+	page, err := pages.Load("test=alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Version != 7 {
+		t.Errorf("forced version: got %d", page.Version)
+	}
+
+	next := testPage("test=alpha", "Beta")
+	next.Version = 8
+	if err := pages.Overwrite("test=alpha", 7, next); err != nil {
+		t.Errorf("overwrite after forcing version: %v", err)
+	}
+	if err := pages.ForceVersion("test=missing", 1); err != kb.ErrPageNotExist {
+		t.Errorf("forcing missing page: got %v", err)
+	}
+}
+
+func TestListFiltered(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	now := time.Now()
+	for i, page := range []*kb.Page{
+		testPage("test=alpha", "Alpha", "Billing"),
+		testPage("test=beta", "Beta", "Scheduling"),
+		testPage("test=gamma", "Gamma", "billing", "Reports"),
+	} {
+		page.Modified = now.Add(time.Duration(i) * time.Hour)
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	slugs := func(opts kb.ListOptions) (r []kb.Slug) {
+		entries, err := pages.ListFiltered(opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			r = append(r, entry.Slug)
+		}
+		return r
+	}
+
+	cases := []struct {
+		Opts kb.ListOptions
+		Exp  []kb.Slug
+	}{
+		{kb.ListOptions{}, []kb.Slug{"test=alpha", "test=beta", "test=gamma"}},
+		{kb.ListOptions{Tags: []string{"BILLING"}}, []kb.Slug{"test=alpha", "test=gamma"}},
+		{kb.ListOptions{Tags: []string{"reports", "scheduling"}}, []kb.Slug{"test=beta", "test=gamma"}},
+		{kb.ListOptions{SortBy: kb.SortByModified, Descending: true}, []kb.Slug{"test=gamma", "test=beta", "test=alpha"}},
+	}
+
+	for _, test := range cases {
+		got := slugs(test.Opts)
+		if !reflect.DeepEqual(got, test.Exp) {
+			t.Errorf("ListFiltered(%+v): got %v expected %v", test.Opts, got, test.Exp)
+		}
+	}
+
+	if _, err := pages.ListFiltered(kb.ListOptions{SortBy: "title; DROP TABLE Pages"}); err == nil {
+		t.Errorf("expected error for invalid sort order")
+	}
+}
+
+func TestRename(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha")); err != nil {
+		t.Fatal(err)
+	}
+	next := testPage("test=alpha", "Alpha")
+	next.Version = 2
+	if err := pages.Overwrite("test=alpha", 1, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Create(testPage("test=beta", "Beta")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pages.Rename("test=alpha", "test=beta", 2); err != kb.ErrPageExists {
+		t.Errorf("renaming onto existing page: got %v", err)
+	}
+	if err := pages.Rename("test=alpha", "test=first", 1); !errors.Is(err, kb.ErrConcurrentEdit) {
+		t.Errorf("renaming with stale version: got %v", err)
+	}
+	if err := pages.Rename("test=alpha", "other=first", 2); err == nil {
+		t.Errorf("renaming into another group should fail")
+	}
+
+	if err := pages.Rename("test=alpha", "test=first", 2); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pages.Load("test=alpha"); err != kb.ErrPageNotExist {
+		t.Errorf("loading old slug: got %v", err)
+	}
+	page, err := pages.Load("test=first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Slug != "test=first" || page.Title != "Alpha" {
+		t.Errorf("renamed page: got %v %q", page.Slug, page.Title)
+	}
+
+	history, err := pages.History("test=first", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Errorf("pre-rename history missing: %v", history)
+	}
+}
+
+func TestConcurrentEditVersion(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha")); err != nil {
+		t.Fatal(err)
+	}
+	next := testPage("test=alpha", "Alpha")
+	next.Version = 2
+	if err := pages.Overwrite("test=alpha", 1, next); err != nil {
+		t.Fatal(err)
+	}
+
+	stale := testPage("test=alpha", "Stale")
+	stale.Version = 2
+	check := func(name string, err error) {
+		t.Helper()
+		var conflict kb.ConcurrentEditError
+		if !errors.As(err, &conflict) {
+			t.Errorf("%s: expected conflict, got %v", name, err)
+			return
+		}
+		if !errors.Is(err, kb.ErrConcurrentEdit) {
+			t.Errorf("%s: conflict should match ErrConcurrentEdit", name)
+		}
+		if conflict.CurrentVersion != 2 {
+			t.Errorf("%s: current version %d, expected 2", name, conflict.CurrentVersion)
+		}
+	}
+
+	check("overwrite", pages.Overwrite("test=alpha", 1, stale))
+	check("edit", pages.Edit("test=alpha", 1, kb.Action{"type": "add", "item": kb.Paragraph("x")}))
+	check("delete", pages.Delete("test=alpha", 1))
+}
+
+func TestImportBatch(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	err := pages.ImportBatch([]*kb.Page{
+		testPage("test=alpha", "Alpha", "first"),
+		testPage("test=Not Valid", "Invalid"),
+		testPage("test=gamma", "Gamma"),
+	})
+	if !errors.Is(err, kb.ErrInvalidSlug) {
+		t.Fatalf("expected invalid slug error, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "test=Not Valid") {
+		t.Errorf("error does not mention failing slug: %v", err)
+	}
+
+	entries, err := pages.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("failed batch committed pages: %v", entries)
+	}
+
+	err = pages.ImportBatch([]*kb.Page{
+		testPage("test=alpha", "Alpha", "first"),
+		testPage("test=gamma", "Gamma"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alpha, err := pages.Load("test=alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alpha.Synopsis != "Content of Alpha." {
+		t.Errorf("synopsis not computed: %q", alpha.Synopsis)
+	}
+	if entries, _ := pages.ListFiltered(kb.ListOptions{Tags: []string{"first"}}); len(entries) != 1 {
+		t.Errorf("tags not computed: %v", entries)
+	}
+}
+
+func TestArchive(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	for _, page := range []*kb.Page{
+		testPage("test=alpha", "Alpha", "first"),
+		testPage("test=beta", "Beta"),
+	} {
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	next := testPage("test=beta", "Beta", "second")
+	next.Version = 2
+	if err := pages.Overwrite("test=beta", 1, next); err != nil {
+		t.Fatal(err)
+	}
+
+	var exported bytes.Buffer
+	if err := pages.ExportArchive(&exported); err != nil {
+		t.Fatal(err)
+	}
+
+	err := pages.BatchReplace(map[kb.Slug]*kb.Page{}, func(string, kb.Slug) {})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := pages.List(); len(entries) != 0 {
+		t.Fatalf("group was not wiped: %v", entries)
+	}
+
+	if err := pages.ImportArchive(bytes.NewReader(exported.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+
+	var reexported bytes.Buffer
+	if err := pages.ExportArchive(&reexported); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(exported.Bytes(), reexported.Bytes()) {
+		t.Errorf("archive does not round-trip:\n%s\n%s", exported.String(), reexported.String())
+	}
+
+	beta, err := pages.Load("test=beta")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if beta.Version != 2 {
+		t.Errorf("version not preserved: %d", beta.Version)
+	}
+}
+
+func TestHistoryWindow(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha")); err != nil {
+		t.Fatal(err)
+	}
+	for version := 1; version <= 5; version++ {
+		next := testPage("test=alpha", "Alpha")
+		next.Version = version + 1
+		if err := pages.Overwrite("test=alpha", version, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	versions := func(entries []kb.PageEntry) (titles []string) {
+		for _, entry := range entries {
+			titles = append(titles, entry.Title)
+		}
+		return titles
+	}
+
+	history, err := pages.History("test=alpha", 1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"Version 4", "Version 3"}
+	if got := versions(history); !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+	for _, entry := range history {
+		if !strings.HasPrefix(entry.Synopsis, "Modified by admin on ") {
+			t.Errorf("invalid synopsis %q", entry.Synopsis)
+		}
+	}
+
+	history, err = pages.History("test=alpha", 4, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := versions(history); !reflect.DeepEqual(got, []string{"Version 1"}) {
+		t.Errorf("last window: got %v", got)
+	}
+
+	history, err = kb.FullHistory(pages, "test=alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 5 {
+		t.Errorf("full history: got %v", versions(history))
+	}
+}
+
+func TestCompactJournal(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha")); err != nil {
+		t.Fatal(err)
+	}
+	for version := 1; version <= 4; version++ {
+		err := pages.Edit("test=alpha", version, kb.Action{
+			"type": "add",
+			"item": kb.Paragraph("Edit " + strconv.Itoa(version)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pages.CompactJournal("test=alpha", 0); err == nil {
+		t.Errorf("compacting to zero versions should fail")
+	}
+	if err := pages.CompactJournal("test=alpha", 2); err != nil {
+		t.Fatal(err)
+	}
+
+	history, err := pages.History("test=alpha", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected 2 kept versions, got %v", history)
+	}
+	for _, version := range []int{4, 3} {
+		data, err := pages.LoadRawVersion("test=alpha", version)
+		if err != nil {
+			t.Fatalf("loading kept version %d: %v", version, err)
+		}
+		page := &kb.Page{}
+		if err := json.Unmarshal(data, page); err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Story) != 2+version {
+			t.Errorf("version %d has %d items", version, len(page.Story))
+		}
+	}
+	if _, err := pages.LoadRawVersion("test=alpha", 2); err != kb.ErrPageNotExist {
+		t.Errorf("loading compacted version: got %v", err)
+	}
+
+	var edits int
+	err = context.(pgdb.Context).QueryRow(`
+		SELECT COUNT(*) FROM PageJournal
+		WHERE Slug = 'test=alpha' AND Action = 'try-edit'
+	`).Scan(&edits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edits != 1 {
+		t.Errorf("expected only the newest edit to remain, got %d", edits)
+	}
+}
+
+func TestStats(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	stats, err := pages.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats != (kb.GroupStats{}) {
+		t.Errorf("empty group: got %+v", stats)
+	}
+
+	latest := time.Date(2020, 3, 4, 5, 6, 7, 0, time.UTC)
+	for i, page := range []*kb.Page{
+		testPage("test=alpha", "Alpha", "first", "Shared"),
+		testPage("test=beta", "Beta", "second", "shared"),
+		testPage("test=gamma", "Gamma"),
+	} {
+		page.Modified = latest.Add(-time.Duration(i) * time.Hour)
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pages.Delete("test=gamma", 1); err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := pages.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 2 {
+		t.Errorf("count: got %d", count)
+	}
+
+	stats, err = pages.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Pages != 2 || stats.Tags != 3 || !stats.LastModified.Equal(latest) {
+		t.Errorf("stats: got %+v", stats)
+	}
+}
+
+func TestDeleteHistory(t *testing.T) {
+	context := newTestContext(t)
+	if err := context.Users().Create(kb.User{ID: "editor", Name: "Editor", MaxAccess: kb.Moderator}); err != nil {
+		t.Fatal(err)
+	}
+
+	pages := context.Pages("test")
+	if err := pages.Create(testPage("test=alpha", "Alpha")); err != nil {
+		t.Fatal(err)
+	}
+	next := testPage("test=alpha", "Alpha")
+	next.Version = 2
+	if err := pages.Overwrite("test=alpha", 1, next); err != nil {
+		t.Fatal(err)
+	}
+
+	editor := context.(pgdb.Context).Context("editor").Pages("test")
+	if err := editor.Delete("test=alpha", -1); err != nil {
+		t.Fatal(err)
+	}
+
+	var actor string
+	var data []byte
+	err := context.(pgdb.Context).QueryRow(`
+		SELECT Actor, Data FROM PageJournal
+		WHERE Slug = 'test=alpha' AND Action = 'delete'
+	`).Scan(&actor, &data)
+	if err != nil {
+		t.Fatalf("delete was not journaled: %v", err)
+	}
+	if actor != "editor" {
+		t.Errorf("journaled actor %q", actor)
+	}
+	var info struct {
+		Actor   string
+		Version int
+	}
+	if err := json.Unmarshal(data, &info); err != nil {
+		t.Fatal(err)
+	}
+	if info.Actor != "editor" || info.Version != 2 {
+		t.Errorf("journaled delete %s", data)
+	}
+
+	history, err := pages.History("test=alpha", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 1 {
+		t.Errorf("history should not list deletes: %v", history)
+	}
+
+	history, err = pages.HistoryWithDeletes("test=alpha", 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("expected delete in history: %v", history)
+	}
+	if history[0].Title != "Deleted version 2" || !strings.HasPrefix(history[0].Synopsis, "Deleted by editor on ") {
+		t.Errorf("invalid delete entry %+v", history[0])
+	}
+}
+
+func TestMove(t *testing.T) {
+	context := newTestContext(t)
+	if err := context.Groups().Create(kb.Group{ID: "other", OwnerID: "other", Name: "Other", Public: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	pages, other := context.Pages("test"), context.Pages("other")
+	for _, page := range []*kb.Page{
+		testPage("test=alpha", "Alpha"),
+		testPage("test=beta", "Beta"),
+	} {
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := other.Create(testPage("other=beta", "Other Beta")); err != nil {
+		t.Fatal(err)
+	}
+
+	guest := context.(pgdb.Context).Context("guest").Pages("test")
+	if err := guest.Move("test=alpha", "other"); err != kb.ErrAccessDenied {
+		t.Errorf("moving without rights: got %v", err)
+	}
+
+	if err := pages.Move("test=beta", "other"); err != kb.ErrPageExists {
+		t.Errorf("moving onto existing page: got %v", err)
+	}
+	if _, err := pages.Load("test=beta"); err != nil {
+		t.Errorf("failed move removed page: %v", err)
+	}
+
+	if err := pages.Move("test=alpha", "other"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pages.Load("test=alpha"); err != kb.ErrPageNotExist {
+		t.Errorf("loading old slug: got %v", err)
+	}
+	page, err := other.Load("other=alpha")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Slug != "other=alpha" || page.Title != "Alpha" {
+		t.Errorf("moved page: got %v %q", page.Slug, page.Title)
+	}
+	if entries, _ := other.List(); len(entries) != 2 {
+		t.Errorf("destination listing: got %v", entries)
+	}
+}
+
+func TestRecentChangesByActor(t *testing.T) {
+	context := newTestContext(t)
+	access := context.Access()
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Editor}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []kb.Slug{"team", "private"} {
+		if err := context.Groups().Create(kb.Group{ID: id, OwnerID: id, Name: string(id)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := access.AddUser("team", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := context.(pgdb.Context).Context("alice")
+	for _, page := range []*kb.Page{
+		testPage("team=alpha", "Alpha"),
+		testPage("team=beta", "Beta"),
+	} {
+		if err := alice.Pages("team").Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// alice cannot read private, her changes there must not be listed
+	if err := alice.Pages("private").Create(testPage("private=secret", "Secret")); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Pages("team").Create(testPage("team=gamma", "Gamma")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := alice.Index("alice").RecentChangesByActor("alice", 10, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slugs := []kb.Slug{}
+	for _, entry := range entries {
+		slugs = append(slugs, entry.Slug)
+	}
+	if expected := []kb.Slug{"team=beta", "team=alpha"}; !reflect.DeepEqual(slugs, expected) {
+		t.Errorf("got %v, expected %v", slugs, expected)
+	}
+
+	if _, err := alice.Index("alice").RecentChangesByActor("admin", 10, time.Time{}); err != kb.ErrAccessDenied {
+		t.Errorf("listing changes of other user: got %v", err)
+	}
+	if entries, err := context.Index("admin").RecentChangesByActor("alice", 10, time.Time{}); err != nil || len(entries) != 3 {
+		t.Errorf("admin listing changes of alice: got %v %v", entries, err)
+	}
+	if entries, err := context.Index("admin").RecentChangesByActor("alice", 10, time.Now().Add(time.Hour)); err != nil || len(entries) != 0 {
+		t.Errorf("changes of alice in the future: got %v %v", entries, err)
+	}
+}
+
+func TestRecentChangesModifiedBy(t *testing.T) {
+	context := newTestContext(t)
+
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Editor}); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Access().AddUser("test", "alice"); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := context.(pgdb.Context).Context("alice")
+	if err := alice.Pages("test").Create(testPage("test=changes", "Changes")); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := context.Index("admin").RecentChangesSince(10, "test", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, entry := range entries {
+		if entry.Slug == "test=changes" && entry.ModifiedBy != "alice" {
+			t.Errorf("got modified by %q, expected alice", entry.ModifiedBy)
+		}
+	}
+
+	if entries, err := context.Index("admin").List(); err != nil || len(entries) == 0 || entries[0].ModifiedBy != "" {
+		t.Errorf("listing should not look up actors: %v %v", entries, err)
+	}
+}
+
+func TestEditTags(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha", "Scheduling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Edit("test=alpha", 1, kb.AddTagAction("Billing Codes")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Edit("test=alpha", 2, kb.RemoveTagAction("scheduling")); err != nil {
+		t.Fatal(err)
+	}
+
+	index := context.Index("admin")
+	tagged, err := index.ByTag("billing-codes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tagged) != 1 || tagged[0].Slug != "test=alpha" {
+		t.Errorf("added tag: got %v", tagged)
+	}
+	removed, err := index.ByTag("scheduling")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) != 0 {
+		t.Errorf("removed tag: got %v", removed)
+	}
+
+	rows, err := context.(pgdb.Context).Query(`
+		SELECT Data->>'type' FROM PageJournal
+		WHERE Slug = 'test=alpha' AND Action = 'try-edit'
+		ORDER BY Version
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	actions := []string{}
+	for rows.Next() {
+		var action string
+		if err := rows.Scan(&action); err != nil {
+			t.Fatal(err)
+		}
+		actions = append(actions, action)
+	}
+	if exp := []string{"add-tag", "remove-tag"}; !reflect.DeepEqual(actions, exp) {
+		t.Errorf("journaled actions %v, expected %v", actions, exp)
+	}
+}
+
+func TestCreateValidatesReferences(t *testing.T) {
+	context := newTestContext(t).(pgdb.Context)
+	context.Database.ValidateReferences(func(site string) bool {
+		return site == "kb.example.com"
+	})
+	pages := context.Pages("test")
+
+	valid := testPage("test=valid", "Valid")
+	valid.Story.Append(kb.Reference("Setup", "//kb.example.com/help=setup", ""))
+	if err := pages.Create(valid); err != nil {
+		t.Errorf("known site: %v", err)
+	}
+
+	unknown := testPage("test=unknown", "Unknown")
+	unknown.Story.Append(kb.Reference("Other", "//unknown.example.org/page", ""))
+	err := pages.Create(unknown)
+	if status, _ := kb.ErrorStatus(err); status != http.StatusBadRequest {
+		t.Errorf("unknown site: got %v", err)
+	}
+}
+
+func TestListByPrefix(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	for _, slug := range []kb.Slug{
+		"test=billing/invoices",
+		"test=billing/payments",
+		"test=billing-overview",
+		"test=a_b/page",
+		"test=axb/page",
+	} {
+		if err := pages.Create(testPage(slug, string(slug))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	cases := []struct {
+		Prefix kb.Slug
+		Exp    []kb.Slug
+	}{
+		{"test=billing/", []kb.Slug{"test=billing/invoices", "test=billing/payments"}},
+		{"test=billing", []kb.Slug{"test=billing/invoices", "test=billing/payments", "test=billing-overview"}},
+		{"test=a_b/", []kb.Slug{"test=a_b/page"}},
+		{"test=50%", []kb.Slug{}},
+	}
+
+	for _, test := range cases {
+		entries, err := pages.ListByPrefix(test.Prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// order depends on the collation of the database
+		found := map[kb.Slug]bool{}
+		for _, entry := range entries {
+			found[entry.Slug] = true
+		}
+		for _, slug := range test.Exp {
+			if !found[slug] {
+				t.Errorf("%q: missing %v", test.Prefix, slug)
+			}
+		}
+		if len(entries) != len(test.Exp) {
+			t.Errorf("%q: got %v, expected %v", test.Prefix, entries, test.Exp)
+		}
+	}
+}
+
+func TestCheckLinks(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	page := testPage("test=links", "Links")
+	page.Story.Append(
+		kb.Entry("Target", "", "test=target"),
+		kb.Paragraph("See [[Missing Page]] and [[https://example.com/test=missing External]]."),
+		kb.Reference("Module", "/page=pages", ""),
+	)
+	for _, page := range []*kb.Page{page, testPage("test=target", "Target")} {
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	broken, err := pages.CheckLinks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 1 || broken[0].Page != "test=links" || broken[0].Target != "test=missing-page" {
+		t.Errorf("got %+v, expected the link to test=missing-page", broken)
+	}
+}
+
+func TestBacklinks(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	entry := testPage("test=entry", "Entry")
+	entry.Story.Append(kb.Entry("Target", "", "test=target"))
+	paragraph := testPage("test=paragraph", "Paragraph")
+	paragraph.Story.Append(kb.Paragraph("See [[Target]] for details."))
+	other := testPage("test=other", "Other")
+	other.Story.Append(kb.Paragraph("See [[Elsewhere]]."))
+	self := testPage("test=target", "Target")
+	self.Story.Append(kb.Paragraph("Back to [[Target]]."))
+
+	for _, page := range []*kb.Page{entry, paragraph, other, self} {
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	backlinks, err := pages.Backlinks("test=target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []kb.Slug{}
+	for _, backlink := range backlinks {
+		got = append(got, backlink.Slug)
+	}
+	if !reflect.DeepEqual(got, []kb.Slug{"test=entry", "test=paragraph"}) {
+		t.Errorf("got %v, expected test=entry and test=paragraph", got)
+	}
+
+	if err := pages.Delete("test=entry", 1); err != nil {
+		t.Fatal(err)
+	}
+	backlinks, err = pages.Backlinks("test=target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlinks) != 1 || backlinks[0].Slug != "test=paragraph" {
+		t.Errorf("got %v after delete, expected test=paragraph", backlinks)
+	}
+
+	if err := context.Groups().Create(kb.Group{
+		ID:      "secret",
+		OwnerID: "secret",
+		Name:    "Secret",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	hidden := testPage("secret=hidden", "Hidden")
+	hidden.Story.Append(kb.Entry("Target", "", "test=target"))
+	if err := context.Pages("secret").Create(hidden); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Editor}); err != nil {
+		t.Fatal(err)
+	}
+	alice := context.(pgdb.Context).Context("alice").Pages("test")
+	backlinks, err = alice.Backlinks("test=target")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backlinks) != 1 || backlinks[0].Slug != "test=paragraph" {
+		t.Errorf("got %v for alice, expected test=paragraph", backlinks)
+	}
+}
+
+func TestExportCSV(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	for _, page := range []*kb.Page{
+		testPage("test=alpha", "Alpha"),
+		testPage("test=beta", "Beta, the second", "Billing", "Setup"),
+		testPage("test=gamma", "Gamma"),
+	} {
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := pages.ExportCSV(&out); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), `test=beta,"Beta, the second","Billing, Setup",`) {
+		t.Errorf("title and tags are not quoted:\n%s", out.String())
+	}
+
+	records, err := csv.NewReader(&out).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected header and 3 rows, got %v", records)
+	}
+	if !reflect.DeepEqual(records[0], []string{"slug", "title", "tags", "modified", "version"}) {
+		t.Errorf("header: got %v", records[0])
+	}
+	beta := records[2]
+	if beta[0] != "test=beta" || beta[1] != "Beta, the second" || beta[2] != "Billing, Setup" || beta[4] != "1" {
+		t.Errorf("row: got %v", beta)
+	}
+	if _, err := time.Parse(time.RFC3339, beta[3]); err != nil {
+		t.Errorf("modified: %v", err)
+	}
+}
+
+func TestCreateFromTemplate(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	template := testPage("test=template", "{{product}} Overview")
+	template.Story.Append(kb.Paragraph("{{product}} is maintained by {{team}}."))
+	if err := pages.Create(template); err != nil {
+		t.Fatal(err)
+	}
+
+	err := pages.CreateFromTemplate("test=billing", "test=template", map[string]string{
+		"product": "Billing",
+		"team":    "Finance",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	page, err := pages.Load("test=billing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Billing Overview" || page.Story[2].Val("text") != "Billing is maintained by Finance." {
+		t.Errorf("got %q %v", page.Title, page.Story)
+	}
+	if page.Version != 1 || time.Since(page.Modified) > time.Hour {
+		t.Errorf("got version %d modified %v", page.Version, page.Modified)
+	}
+	for i, item := range page.Story {
+		if item.ID() == template.Story[i].ID() {
+			t.Errorf("item %d kept the template id", i)
+		}
+	}
+
+	if err := pages.CreateFromTemplate("test=other", "test=missing", nil); err != kb.ErrPageNotExist {
+		t.Errorf("missing template: got %v", err)
+	}
+
+	if err := context.Groups().Create(kb.Group{
+		ID:      "secret",
+		OwnerID: "secret",
+		Name:    "Secret",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Pages("secret").Create(testPage("secret=template", "Secret")); err != nil {
+		t.Fatal(err)
+	}
+	guest := context.(pgdb.Context).Context("guest").Pages("test")
+	if err := guest.CreateFromTemplate("test=copy", "secret=template", nil); err != kb.ErrAccessDenied {
+		t.Errorf("template without read rights: got %v", err)
+	}
+}
+
+func TestMemoryIndex(t *testing.T) {
+	context := newTestContext(t).(pgdb.Context)
+	context.Database.CacheIndex(true)
+	if err := context.Database.BuildIndex(); err != nil {
+		t.Fatal(err)
+	}
+	pages := context.Pages("test")
+	index := context.Index("admin")
+
+	if err := pages.Create(testPage("test=alpha", "Alpha", "Billing")); err != nil {
+		t.Fatal(err)
+	}
+
+	// changes bypassing Pages are not seen, listings do not query the pages
+	_, err := context.Exec(`UPDATE Pages SET Data = jsonb_set(Data, '{title}', '"Changed"') WHERE Slug = 'test=alpha'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := index.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Title != "Alpha" {
+		t.Errorf("got %v, expected the indexed title", entries)
+	}
+
+	if err := pages.Create(testPage("test=beta", "Beta")); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = pages.ListFiltered(kb.ListOptions{Tags: []string{"billing"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Slug != "test=alpha" {
+		t.Errorf("by tag: got %v", entries)
+	}
+
+	if err := pages.Delete("test=alpha", 1); err != nil {
+		t.Fatal(err)
+	}
+	changes, err := index.RecentChanges(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || changes[0].Slug != "test=beta" || changes[0].ModifiedBy != "admin" {
+		t.Errorf("recent changes: got %+v", changes)
+	}
+}
+
+func TestReindex(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	for i := 0; i < pgdb.ReindexBatchSize+5; i++ {
+		page := testPage(kb.Slug("test=reindex-"+strconv.Itoa(i)), "Reindex", "Billing", "Setup")
+		if err := pages.Create(page); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// simulate rows written by an older version of the extraction
+	_, err := context.(pgdb.Context).Exec(`
+		UPDATE Pages
+		SET Tags = '{stale}', TagSlugs = '{stale}',
+			Data = jsonb_set(Data, '{synopsis}', '"stale"')
+		WHERE OwnerID = 'test'
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	before, err := pages.Load("test=reindex-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pages.Reindex(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := pages.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != pgdb.ReindexBatchSize+5 {
+		t.Fatalf("got %d pages", len(entries))
+	}
+	for _, entry := range entries {
+		if !reflect.DeepEqual(entry.Tags, []string{"Billing", "Setup"}) || entry.Synopsis != "Content of Reindex." {
+			t.Errorf("%s not reindexed: %v %q", entry.Slug, entry.Tags, entry.Synopsis)
+		}
+	}
+	if tagged, err := pages.ListFiltered(kb.ListOptions{Tags: []string{"billing"}}); err != nil || len(tagged) != len(entries) {
+		t.Errorf("tag slugs not reindexed: %d %v", len(tagged), err)
+	}
+
+	after, err := pages.Load("test=reindex-0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Version != before.Version {
+		t.Errorf("version changed from %d to %d", before.Version, after.Version)
+	}
+	history, err := pages.History("test=reindex-0", 0, 10)
+	if err != nil || len(history) != 0 {
+		t.Errorf("reindex was journaled: %v %v", history, err)
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+
+	first := testPage("test=upsert", "First", "Alpha")
+	if err := pages.Upsert(first); err != nil {
+		t.Fatal(err)
+	}
+	page, err := pages.Load("test=upsert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "First" || page.Version != 1 {
+		t.Errorf("insert: got %+v", page)
+	}
+
+	second := testPage("test=upsert", "Second", "Beta")
+	second.Version = 5
+	if err := pages.Upsert(second); err != nil {
+		t.Fatal(err)
+	}
+	page, err = pages.Load("test=upsert")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Title != "Second" || page.Version != 5 || page.Synopsis != "Content of Second." {
+		t.Errorf("update: got %+v", page)
+	}
+
+	entries, err := pages.ListFiltered(kb.ListOptions{Tags: []string{"beta"}})
+	if err != nil || len(entries) != 1 || !reflect.DeepEqual(entries[0].Tags, []string{"Beta"}) {
+		t.Errorf("tags not updated: %v %v", entries, err)
+	}
+
+	var upserts int
+	err = context.(pgdb.Context).QueryRow(`
+		SELECT COUNT(*) FROM PageJournal
+		WHERE Slug = 'test=upsert' AND Action = 'upsert'
+	`).Scan(&upserts)
+	if err != nil || upserts != 2 {
+		t.Errorf("got %d journaled upserts, %v", upserts, err)
+	}
+
+	// replaces deleted pages
+	if err := pages.Delete("test=upsert", 5); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Upsert(testPage("test=upsert", "Third")); err != nil {
+		t.Fatal(err)
+	}
+	if page, err := pages.Load("test=upsert"); err != nil || page.Title != "Third" {
+		t.Errorf("deleted page not replaced: %v %v", page, err)
+	}
+}
+
+func TestQueryCancel(t *testing.T) {
+	context := newTestContext(t)
+	pages := context.Pages("test")
+	if err := pages.Create(testPage("test=locked", "Locked")); err != nil {
+		t.Fatal(err)
+	}
+
+	// block all readers of Pages until the test is done
+	lock, err := context.(pgdb.Context).Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lock.Rollback()
+	if _, err := lock.Exec(`LOCK TABLE Pages IN ACCESS EXCLUSIVE MODE`); err != nil {
+		t.Fatal(err)
+	}
+
+	queries := map[string]func(ctx gocontext.Context) error{
+		"LoadCtx": func(ctx gocontext.Context) error {
+			_, err := pages.LoadCtx(ctx, "test=locked")
+			return err
+		},
+		"ListCtx": func(ctx gocontext.Context) error {
+			_, err := pages.ListCtx(ctx)
+			return err
+		},
+		"SearchCtx": func(ctx gocontext.Context) error {
+			_, _, err := context.Index("admin").SearchCtx(ctx, "locked", 0, 10)
+			return err
+		},
+	}
+
+	for name, query := range queries {
+		ctx, cancel := gocontext.WithTimeout(gocontext.Background(), 100*time.Millisecond)
+		start := time.Now()
+		err := query(ctx)
+		cancel()
+
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: returned after %v", name, elapsed)
+		}
+	}
+}
+
+func TestPreparedStatements(t *testing.T) {
+	context := newTestContext(t).(pgdb.Context)
+	if err := context.Pages("test").Create(testPage("test=prepared", "Prepared")); err != nil {
+		t.Fatal(err)
+	}
+
+	uncached := context
+	uncached.Database.CacheStatements(false)
+
+	for name, context := range map[string]pgdb.Context{"cached": context, "uncached": uncached} {
+		pages := context.Pages("test")
+		// the second call reuses the statement
+		for i := 0; i < 2; i++ {
+			if _, err := pages.LoadRaw("test=prepared"); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			entries, err := pages.List()
+			if err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+			if len(entries) != 1 {
+				t.Fatalf("%s: expected a single entry, got %v", name, entries)
+			}
+		}
+	}
+
+	if err := context.Database.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := context.Pages("test").LoadRaw("test=prepared"); err == nil {
+		t.Fatal("expected an error after closing")
+	}
+}
+
+// BenchmarkLoadRaw compares loading a page with and without prepared statements
+func BenchmarkLoadRaw(b *testing.B) {
+	context := newTestContext(b).(pgdb.Context)
+	if err := context.Pages("test").Create(testPage("test=bench", "Bench")); err != nil {
+		b.Fatal(err)
+	}
+
+	uncached := context
+	uncached.Database.CacheStatements(false)
+
+	for name, context := range map[string]pgdb.Context{"prepared": context, "unprepared": uncached} {
+		pages := context.Pages("test")
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := pages.LoadRaw("test=bench"); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestQueryObserver(t *testing.T) {
+	context := newTestContext(t).(pgdb.Context)
+
+	observed := map[string]int{}
+	context.Database.ObserveQueries(func(name string, duration time.Duration) {
+		if duration <= 0 {
+			t.Errorf("%s: invalid duration %v", name, duration)
+		}
+		observed[name]++
+	})
+
+	pages := context.Pages("test")
+	if err := pages.Create(testPage("test=observed", "Observed")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pages.Load("test=observed"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"Pages.Create", "Pages.Load"} {
+		if observed[name] == 0 {
+			t.Errorf("%s was not observed, got %v", name, observed)
+		}
+	}
+}
+
+func TestBatchReplaceDelta(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	bundle := map[kb.Slug]*kb.Page{
+		"test=one":   testPage("test=one", "One"),
+		"test=two":   testPage("test=two", "Two"),
+		"test=three": testPage("test=three", "Three"),
+	}
+	replace := func() map[string][]kb.Slug {
+		results := map[string][]kb.Slug{}
+		err := pages.BatchReplaceDelta(bundle, func(description string, slug kb.Slug) {
+			results[description] = append(results[description], slug)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	if got := replace(); len(got["added"]) != 3 {
+		t.Fatalf("first import: %v", got)
+	}
+
+	bundle["test=two"] = testPage("test=two", "Two", "changed")
+	delete(bundle, "test=three")
+
+	got := replace()
+	expected := map[string][]kb.Slug{
+		"unchanged": {"test=one"},
+		"updated":   {"test=two"},
+		"deleted":   {"test=three"},
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("second import got %v, expected %v", got, expected)
+	}
+
+	page, err := pages.Load("test=two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tags := kb.ExtractTags(page); len(tags) != 1 || tags[0] != "changed" {
+		t.Errorf("changed page was not written: %v", page.Story)
+	}
+	if _, err := pages.Load("test=three"); err != kb.ErrPageNotExist {
+		t.Errorf("removed page: got %v, expected ErrPageNotExist", err)
+	}
+}
+
+func TestBatchReplaceDeltaDeleted(t *testing.T) {
+	pages := newTestContext(t).Pages("test")
+
+	bundle := map[kb.Slug]*kb.Page{
+		"test=one": testPage("test=one", "One"),
+		"test=two": testPage("test=two", "Two"),
+	}
+	replace := func() map[string][]kb.Slug {
+		results := map[string][]kb.Slug{}
+		err := pages.BatchReplaceDelta(bundle, func(description string, slug kb.Slug) {
+			results[description] = append(results[description], slug)
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return results
+	}
+
+	replace()
+	for _, slug := range []kb.Slug{"test=one", "test=two"} {
+		if err := pages.Delete(slug, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// test=one is imported again, test=two stays deleted
+	delete(bundle, "test=two")
+	got := replace()
+	expected := map[string][]kb.Slug{"added": {"test=one"}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("import over deleted pages got %v, expected %v", got, expected)
+	}
+	if _, err := pages.Load("test=one"); err != nil {
+		t.Errorf("reimported page: %v", err)
+	}
+	if err := pages.Restore("test=two"); err != nil {
+		t.Errorf("restoring page missing from import: %v", err)
+	}
+}
+
+func TestAliases(t *testing.T) {
+	context := newTestContext(t)
+	pages, aliases := context.Pages("test"), context.Aliases()
+
+	if err := pages.Create(testPage("test=first", "First")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pages.Rename("test=first", "test=second", -1); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := aliases.Resolve("test=first"); err != nil || target != "test=second" {
+		t.Fatalf("after rename: got %q, %v", target, err)
+	}
+
+	// chained renames resolve to the current slug
+	if err := pages.Rename("test=second", "test=third", -1); err != nil {
+		t.Fatal(err)
+	}
+	for _, alias := range []kb.Slug{"test=first", "test=second"} {
+		if target, err := aliases.Resolve(alias); err != nil || target != "test=third" {
+			t.Errorf("%v: got %q, %v", alias, target, err)
+		}
+	}
+
+	// renaming back removes the alias of the current slug
+	if err := pages.Rename("test=third", "test=first", -1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := aliases.Resolve("test=first"); err != kb.ErrAliasNotExist {
+		t.Errorf("current slug: got %v, expected ErrAliasNotExist", err)
+	}
+	if target, err := aliases.Resolve("test=third"); err != nil || target != "test=first" {
+		t.Errorf("after renaming back: got %q, %v", target, err)
+	}
+
+	// manual aliases
+	if err := aliases.AddAlias("test=other", "test=third"); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := aliases.Resolve("test=other"); err != nil || target != "test=first" {
+		t.Errorf("alias of alias: got %q, %v", target, err)
+	}
+	if err := aliases.AddAlias("test=first", "test=other"); err != kb.ErrPageExists {
+		t.Errorf("alias of existing page: got %v", err)
+	}
+	if err := aliases.RemoveAlias("test=other"); err != nil {
+		t.Fatal(err)
+	}
+	if err := aliases.RemoveAlias("test=other"); err != kb.ErrAliasNotExist {
+		t.Errorf("removing twice: got %v", err)
+	}
+}
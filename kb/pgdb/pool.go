@@ -0,0 +1,39 @@
+package pgdb
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DefaultMaxOpenConns    = 20
+	DefaultMaxIdleConns    = 10
+	DefaultConnMaxLifetime = 30 * time.Minute
+)
+
+// PoolConfig limits the connections kept by the database,
+// values <= 0 mean no limit, except MaxIdleConns where it means no idle connections
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// DefaultPoolConfig is applied by New
+var DefaultPoolConfig = PoolConfig{
+	MaxOpenConns:    DefaultMaxOpenConns,
+	MaxIdleConns:    DefaultMaxIdleConns,
+	ConnMaxLifetime: DefaultConnMaxLifetime,
+}
+
+// ConfigurePool applies the connection limits, it can be called at any time
+func (db *Database) ConfigurePool(conf PoolConfig) {
+	db.SetMaxOpenConns(conf.MaxOpenConns)
+	db.SetMaxIdleConns(conf.MaxIdleConns)
+	db.SetConnMaxLifetime(conf.ConnMaxLifetime)
+}
+
+// Ping verifies that the database can be reached, it fails when ctx is done
+func (db Context) Ping(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
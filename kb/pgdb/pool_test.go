@@ -0,0 +1,49 @@
+package pgdb_test
+
+import (
+	gocontext "context"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb/pgdb"
+)
+
+func TestConfigurePool(t *testing.T) {
+	// connections are opened lazily, so no server is needed
+	db, err := pgdb.New("user=nobody dbname=none sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if got := db.Stats().MaxOpenConnections; got != pgdb.DefaultMaxOpenConns {
+		t.Errorf("default max open connections: got %v, expected %v", got, pgdb.DefaultMaxOpenConns)
+	}
+
+	db.ConfigurePool(pgdb.PoolConfig{
+		MaxOpenConns:    3,
+		MaxIdleConns:    2,
+		ConnMaxLifetime: time.Minute,
+	})
+	if got := db.Stats().MaxOpenConnections; got != 3 {
+		t.Errorf("max open connections: got %v, expected 3", got)
+	}
+
+	db.ConfigurePool(pgdb.PoolConfig{})
+	if got := db.Stats().MaxOpenConnections; got != 0 {
+		t.Errorf("unlimited open connections: got %v, expected 0", got)
+	}
+}
+
+func TestPingClosed(t *testing.T) {
+	db, err := pgdb.New("user=nobody dbname=none sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	context := db.Context("admin").(pgdb.Context)
+	db.Close()
+
+	if err := context.Ping(gocontext.Background()); err == nil {
+		t.Fatal("expected an error from a closed database")
+	}
+}
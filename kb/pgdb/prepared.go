@@ -0,0 +1,119 @@
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// statementCache keeps prepared statements of frequently used queries,
+// a nil cache prepares nothing.
+//
+// Preparing avoids parsing and planning the query on every request,
+// BenchmarkLoadRaw compares LoadRaw with and without the cache.
+type statementCache struct {
+	mu       sync.Mutex
+	db       *sql.DB
+	prepared map[string]*sql.Stmt
+}
+
+func newStatementCache(db *sql.DB) *statementCache {
+	return &statementCache{
+		db:       db,
+		prepared: make(map[string]*sql.Stmt),
+	}
+}
+
+// get returns the prepared statement for query, preparing it on first use,
+// it returns nil when the statement cannot be prepared
+func (cache *statementCache) get(ctx context.Context, query string) *sql.Stmt {
+	if cache == nil {
+		return nil
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if stmt, ok := cache.prepared[query]; ok {
+		return stmt
+	}
+	if cache.db == nil {
+		// closed
+		return nil
+	}
+
+	stmt, err := cache.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil
+	}
+	cache.prepared[query] = stmt
+	return stmt
+}
+
+// close closes all statements, later queries are not prepared
+func (cache *statementCache) close() error {
+	if cache == nil {
+		return nil
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	var err error
+	for query, stmt := range cache.prepared {
+		if cerr := stmt.Close(); err == nil {
+			err = cerr
+		}
+		delete(cache.prepared, query)
+	}
+	cache.db = nil
+	return err
+}
+
+// CacheStatements configures whether frequently used queries are prepared
+// once and reused. It must be called before use.
+func (db *Database) CacheStatements(enabled bool) {
+	db.stmts.close()
+	db.stmts = nil
+	if enabled {
+		db.stmts = newStatementCache(db.DB)
+	}
+}
+
+// Close closes the prepared statements and the database
+func (db *Database) Close() error {
+	err := db.stmts.close()
+	if cerr := db.DB.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// queryRowPrepared is QueryRowContext using a cached prepared statement
+func (db Database) queryRowPrepared(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if stmt := db.stmts.get(ctx, query); stmt != nil {
+		defer db.observe(time.Now())
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return db.QueryRowContext(ctx, query, args...)
+}
+
+// queryPrepared is QueryContext using a cached prepared statement
+func (db Database) queryPrepared(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if stmt := db.stmts.get(ctx, query); stmt != nil {
+		defer db.observe(time.Now())
+		return stmt.QueryContext(ctx, args...)
+	}
+	return db.QueryContext(ctx, query, args...)
+}
+
+// preparedExecer executes using cached prepared statements
+type preparedExecer struct{ Database }
+
+func (db preparedExecer) Exec(query string, args ...interface{}) (sql.Result, error) {
+	ctx := context.Background()
+	if stmt := db.stmts.get(ctx, query); stmt != nil {
+		defer db.observe(time.Now())
+		return stmt.ExecContext(ctx, args...)
+	}
+	return db.ExecContext(ctx, query, args...)
+}
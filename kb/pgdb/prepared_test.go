@@ -0,0 +1,31 @@
+package pgdb
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestStatementCacheClosed(t *testing.T) {
+	var disabled *statementCache
+	if stmt := disabled.get(context.Background(), "SELECT 1"); stmt != nil {
+		t.Error("nil cache prepared a statement")
+	}
+	if err := disabled.close(); err != nil {
+		t.Error(err)
+	}
+
+	sdb, err := sql.Open("postgres", "user=nobody dbname=none sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sdb.Close()
+
+	cache := newStatementCache(sdb)
+	if err := cache.close(); err != nil {
+		t.Fatal(err)
+	}
+	if stmt := cache.get(context.Background(), "SELECT 1"); stmt != nil {
+		t.Error("closed cache prepared a statement")
+	}
+}
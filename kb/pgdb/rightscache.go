@@ -0,0 +1,129 @@
+package pgdb
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+const (
+	DefaultRightsCacheSize = 4096
+	DefaultRightsCacheTTL  = 10 * time.Second
+)
+
+type rightsKey struct{ group, user kb.Slug }
+
+type rightsEntry struct {
+	key     rightsKey
+	rights  kb.Rights
+	expires time.Time
+}
+
+// rightsCache is a least recently used cache of effective rights,
+// a nil cache caches nothing
+type rightsCache struct {
+	mu   sync.Mutex
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	// most recently used entries are at the front
+	order   *list.List
+	entries map[rightsKey]*list.Element
+}
+
+func newRightsCache(size int, ttl time.Duration) *rightsCache {
+	if size <= 0 || ttl <= 0 {
+		return nil
+	}
+	return &rightsCache{
+		size:    size,
+		ttl:     ttl,
+		now:     time.Now,
+		order:   list.New(),
+		entries: make(map[rightsKey]*list.Element, size),
+	}
+}
+
+func (cache *rightsCache) get(group, user kb.Slug) (kb.Rights, bool) {
+	if cache == nil {
+		return "", false
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	elem, ok := cache.entries[rightsKey{group, user}]
+	if !ok {
+		return "", false
+	}
+
+	entry := elem.Value.(*rightsEntry)
+	if cache.now().After(entry.expires) {
+		cache.remove(elem)
+		return "", false
+	}
+
+	cache.order.MoveToFront(elem)
+	return entry.rights, true
+}
+
+func (cache *rightsCache) put(group, user kb.Slug, rights kb.Rights) {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	key := rightsKey{group, user}
+	expires := cache.now().Add(cache.ttl)
+	if elem, ok := cache.entries[key]; ok {
+		entry := elem.Value.(*rightsEntry)
+		entry.rights, entry.expires = rights, expires
+		cache.order.MoveToFront(elem)
+		return
+	}
+
+	cache.entries[key] = cache.order.PushFront(&rightsEntry{
+		key:     key,
+		rights:  rights,
+		expires: expires,
+	})
+	for cache.order.Len() > cache.size {
+		cache.remove(cache.order.Back())
+	}
+}
+
+func (cache *rightsCache) remove(elem *list.Element) {
+	entry := cache.order.Remove(elem).(*rightsEntry)
+	delete(cache.entries, entry.key)
+}
+
+// invalidateUser removes the rights of user in all groups
+func (cache *rightsCache) invalidateUser(user kb.Slug) {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for key, elem := range cache.entries {
+		if key.user == user {
+			cache.remove(elem)
+		}
+	}
+}
+
+// invalidateAll is used when a change may affect any user,
+// e.g. community grants apply transitively
+func (cache *rightsCache) invalidateAll() {
+	if cache == nil {
+		return
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.order.Init()
+	cache.entries = make(map[rightsKey]*list.Element, cache.size)
+}
@@ -0,0 +1,106 @@
+package pgdb
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func TestRightsCacheEviction(t *testing.T) {
+	cache := newRightsCache(2, time.Minute)
+
+	cache.put("a", "alice", kb.Reader)
+	cache.put("b", "alice", kb.Editor)
+	if _, ok := cache.get("a", "alice"); !ok {
+		t.Fatal("expected a/alice to be cached")
+	}
+	cache.put("c", "alice", kb.Moderator)
+
+	if _, ok := cache.get("b", "alice"); ok {
+		t.Error("least recently used entry b/alice was not evicted")
+	}
+	if rights, ok := cache.get("a", "alice"); !ok || rights != kb.Reader {
+		t.Errorf("a/alice: got %v %v", rights, ok)
+	}
+	if rights, ok := cache.get("c", "alice"); !ok || rights != kb.Moderator {
+		t.Errorf("c/alice: got %v %v", rights, ok)
+	}
+}
+
+func TestRightsCacheExpiry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newRightsCache(10, time.Second)
+	cache.now = func() time.Time { return now }
+
+	cache.put("a", "alice", kb.Editor)
+	now = now.Add(500 * time.Millisecond)
+	if _, ok := cache.get("a", "alice"); !ok {
+		t.Error("entry expired too early")
+	}
+	now = now.Add(time.Second)
+	if _, ok := cache.get("a", "alice"); ok {
+		t.Error("entry did not expire")
+	}
+}
+
+func TestRightsCacheInvalidate(t *testing.T) {
+	cache := newRightsCache(10, time.Minute)
+	cache.put("a", "alice", kb.Editor)
+	cache.put("b", "alice", kb.Editor)
+	cache.put("a", "bob", kb.Reader)
+
+	cache.invalidateUser("alice")
+	if _, ok := cache.get("a", "alice"); ok {
+		t.Error("a/alice was not invalidated")
+	}
+	if _, ok := cache.get("b", "alice"); ok {
+		t.Error("b/alice was not invalidated")
+	}
+	if _, ok := cache.get("a", "bob"); !ok {
+		t.Error("a/bob should not be invalidated")
+	}
+
+	cache.invalidateAll()
+	if _, ok := cache.get("a", "bob"); ok {
+		t.Error("a/bob was not invalidated")
+	}
+}
+
+func TestRightsCacheDisabled(t *testing.T) {
+	cache := newRightsCache(0, time.Minute)
+	cache.put("a", "alice", kb.Editor)
+	if _, ok := cache.get("a", "alice"); ok {
+		t.Error("disabled cache returned an entry")
+	}
+	cache.invalidateUser("alice")
+	cache.invalidateAll()
+}
+
+func TestRightsCacheConcurrent(t *testing.T) {
+	cache := newRightsCache(16, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := kb.Slug("user-" + strconv.Itoa(i))
+			for k := 0; k < 1000; k++ {
+				group := kb.Slug("group-" + strconv.Itoa(k%32))
+				cache.put(group, user, kb.Reader)
+				cache.get(group, user)
+				if k%100 == 0 {
+					cache.invalidateUser(user)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if n := cache.order.Len(); n > 16 || n != len(cache.entries) {
+		t.Errorf("cache inconsistent: %d in order, %d in entries", n, len(cache.entries))
+	}
+}
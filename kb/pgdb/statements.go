@@ -0,0 +1,74 @@
+package pgdb
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type Statements struct{ Context }
+
+func (db Statements) Record(statement kb.Statement) (string, error) {
+	if err := statement.Validate(); err != nil {
+		return "", err
+	}
+
+	if statement.ID == "" {
+		statement.ID = uuid.New().String()
+	}
+	statement.Stored = time.Now().UTC()
+	if statement.Timestamp.IsZero() {
+		statement.Timestamp = statement.Stored
+	}
+
+	data, err := json.Marshal(statement)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO
+		LRSStatements (ID, UserID, Verb, ObjectID, Data, Stored)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, statement.ID, db.ActiveUser, statement.Verb.ID, statement.Object.ID, data, statement.Stored)
+	if dupkey(err) {
+		return "", kb.ErrStatementExists
+	}
+	if err != nil {
+		return "", err
+	}
+	return statement.ID, nil
+}
+
+func (db Statements) ByActor(user kb.Slug) ([]kb.Statement, error) {
+	if user != db.ActiveUser && !db.Access().IsAdmin(db.ActiveUser) {
+		return nil, kb.ErrAccessDenied
+	}
+
+	rows, err := db.Query(`
+		SELECT Data
+		FROM LRSStatements
+		WHERE UserID = $1
+		ORDER BY Stored DESC
+	`, user)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	statements := []kb.Statement{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return statements, err
+		}
+		var statement kb.Statement
+		if err := json.Unmarshal(data, &statement); err != nil {
+			return statements, err
+		}
+		statements = append(statements, statement)
+	}
+	return statements, rows.Err()
+}
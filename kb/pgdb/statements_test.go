@@ -0,0 +1,58 @@
+package pgdb_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+	"github.com/raintreeinc/knowledgebase/kb/pgdb"
+)
+
+func TestStatements(t *testing.T) {
+	context := newTestContext(t)
+	if err := context.Users().Create(kb.User{ID: "alice", Name: "Alice", MaxAccess: kb.Reader}); err != nil {
+		t.Fatal(err)
+	}
+	alice := context.(pgdb.Context).Context("alice")
+
+	completed := kb.Statement{
+		Actor:  json.RawMessage(`{"name":"Alice","mbox":"mailto:alice@example.com"}`),
+		Verb:   kb.StatementVerb{ID: "http://adlnet.gov/expapi/verbs/completed"},
+		Object: kb.StatementObject{ID: "https://example.com/lessons/abc"},
+		Result: json.RawMessage(`{"completion":true}`),
+	}
+	id, err := alice.Statements().Record(completed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id == "" {
+		t.Fatal("statement id missing")
+	}
+
+	completed.ID = id
+	if _, err := alice.Statements().Record(completed); err != kb.ErrStatementExists {
+		t.Errorf("recording twice: got %v", err)
+	}
+
+	statements, err := alice.Statements().ByActor("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(statements) != 1 {
+		t.Fatalf("expected 1 statement, got %d", len(statements))
+	}
+	got := statements[0]
+	if got.ID != id || got.Verb.ID != completed.Verb.ID || got.Object.ID != completed.Object.ID {
+		t.Errorf("got %+v", got)
+	}
+	if got.Stored.IsZero() {
+		t.Error("stored time missing")
+	}
+
+	if statements, err := context.Statements().ByActor("admin"); err != nil || len(statements) != 0 {
+		t.Errorf("admin statements: got %v %v", statements, err)
+	}
+	if _, err := alice.Statements().ByActor("admin"); err != kb.ErrAccessDenied {
+		t.Errorf("reading statements of others: got %v", err)
+	}
+}
@@ -0,0 +1,88 @@
+package pgdb
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type APITokens struct{ Context }
+
+func (db APITokens) CreateToken(name string, scope kb.TokenScope) (string, error) {
+	if scope != kb.ScopeRead && scope != kb.ScopeReadWrite {
+		return "", fmt.Errorf("invalid token scope %q", scope)
+	}
+
+	var code [32]byte
+	if _, err := rand.Read(code[:]); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(code[:])
+
+	_, err := db.Exec(`
+		INSERT INTO
+		APITokens (TokenHash, UserID, Name, Scope)
+		VALUES ($1, $2, $3, $4)
+	`, hashToken(token), db.ActiveUser, name, string(scope))
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func (db APITokens) VerifyToken(token string) (kb.APIToken, error) {
+	var apitoken kb.APIToken
+	err := db.QueryRow(`
+		SELECT ID, UserID, Name, Scope, Created
+		FROM APITokens
+		WHERE TokenHash = $1 AND Revoked IS NULL
+	`, hashToken(token)).Scan(&apitoken.ID, &apitoken.User, &apitoken.Name, &apitoken.Scope, &apitoken.Created)
+	if err == sql.ErrNoRows {
+		return kb.APIToken{}, kb.ErrTokenNotExist
+	}
+	return apitoken, err
+}
+
+func (db APITokens) RevokeToken(id int64) error {
+	res, err := db.Exec(`
+		UPDATE APITokens
+		SET Revoked = current_timestamp
+		WHERE ID = $1 AND Revoked IS NULL
+		  AND (UserID = $2 OR $3)
+	`, id, db.ActiveUser, db.Access().IsAdmin(db.ActiveUser))
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return kb.ErrTokenNotExist
+	}
+	return nil
+}
+
+func (db APITokens) ListTokens() ([]kb.APIToken, error) {
+	rows, err := db.Query(`
+		SELECT ID, UserID, Name, Scope, Created
+		FROM APITokens
+		WHERE UserID = $1 AND Revoked IS NULL
+		ORDER BY Created, ID
+	`, db.ActiveUser)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []kb.APIToken{}
+	for rows.Next() {
+		var apitoken kb.APIToken
+		if err := rows.Scan(&apitoken.ID, &apitoken.User, &apitoken.Name, &apitoken.Scope, &apitoken.Created); err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, apitoken)
+	}
+	return tokens, rows.Err()
+}
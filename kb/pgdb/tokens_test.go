@@ -0,0 +1,50 @@
+package pgdb_test
+
+import (
+	"testing"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func TestAPITokens(t *testing.T) {
+	context := newTestContext(t)
+	tokens := context.APITokens()
+
+	token, err := tokens.CreateToken("integration", kb.ScopeRead)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	apitoken, err := tokens.VerifyToken(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apitoken.User != context.ActiveUserID() || apitoken.Scope != kb.ScopeRead || apitoken.Name != "integration" {
+		t.Errorf("got %+v", apitoken)
+	}
+	if _, err := tokens.VerifyToken("unknown"); err != kb.ErrTokenNotExist {
+		t.Errorf("unknown token: got %v", err)
+	}
+
+	list, err := tokens.ListTokens()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != apitoken.ID {
+		t.Errorf("listed %+v", list)
+	}
+
+	if err := tokens.RevokeToken(apitoken.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tokens.VerifyToken(token); err != kb.ErrTokenNotExist {
+		t.Errorf("revoked token: got %v", err)
+	}
+	if err := tokens.RevokeToken(apitoken.ID); err != kb.ErrTokenNotExist {
+		t.Errorf("revoking twice: got %v", err)
+	}
+
+	if _, err := tokens.CreateToken("invalid", "admin"); err == nil {
+		t.Errorf("expected invalid scope to fail")
+	}
+}
@@ -29,13 +29,14 @@ func (db Users) ByID(id kb.Slug) (user kb.User, err error) {
 }
 
 func (db Users) Create(user kb.User) error {
+	defer db.rights.invalidateUser(user.ID)
 	_, err := db.Exec(`
 		INSERT INTO Users(
 			ID, Email, Name, Company, Admin, MaxAccess,
-			AuthID, AuthProvider
+			AuthID, AuthProvider, Role
 		) VALUES (
 			$1, $2, $3, $4, $5, $6,
-			$7, $8
+			$7, $8, CASE WHEN $5 THEN 'admin' ELSE 'user' END
 		)
 	`, user.ID, user.Email, user.Name, user.Company, user.Admin, string(user.MaxAccess),
 		user.AuthID, user.AuthProvider,
@@ -46,7 +47,28 @@ func (db Users) Create(user kb.User) error {
 	return err
 }
 
+func (db Users) EnsureGuest(name, email string, rights kb.Rights) error {
+	_, err := db.ByID(kb.Slugify(name))
+	if err != kb.ErrUserNotExist {
+		return err
+	}
+
+	err = db.Create(kb.User{
+		AuthID:       name,
+		AuthProvider: "guest",
+		ID:           kb.Slugify(name),
+		Email:        email,
+		Name:         name,
+		MaxAccess:    rights,
+	})
+	if err == kb.ErrUserExists {
+		return nil
+	}
+	return err
+}
+
 func (db Users) Delete(id kb.Slug) error {
+	defer db.rights.invalidateUser(id)
 	_, err := db.Exec(`DELETE FROM Users WHERE ID = $1`, id)
 	return err
 }
@@ -0,0 +1,33 @@
+package pgdb_test
+
+import (
+	"testing"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func TestEnsureGuest(t *testing.T) {
+	users := newTestContext(t).Users()
+
+	for i := 0; i < 2; i++ {
+		if err := users.EnsureGuest("LMS User", "lms@example.com", kb.Reader); err != nil {
+			t.Fatalf("call %d: %v", i+1, err)
+		}
+	}
+
+	user, err := users.ByID("lms-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.AuthProvider != "guest" || user.Email != "lms@example.com" || user.MaxAccess != kb.Reader {
+		t.Errorf("unexpected guest: %+v", user)
+	}
+
+	list, err := users.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 {
+		t.Errorf("expected admin and guest, got %v", list)
+	}
+}
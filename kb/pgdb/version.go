@@ -175,6 +175,202 @@ var migrations = []*migration{
 				ADD COLUMN Hash BYTEA`,
 		},
 	},
+	{
+		Name:    "Add Page Tombstones",
+		Version: 7,
+		Scripts: []string{
+			`ALTER TABLE Pages
+				ADD COLUMN Deleted TIMESTAMPTZ`,
+		},
+	},
+	{
+		Name:    "Add User Roles",
+		Version: 8,
+		Scripts: []string{
+			`ALTER TABLE Users
+				ADD COLUMN Role TEXT NOT NULL DEFAULT 'user'`,
+			`UPDATE Users SET Role = 'admin' WHERE Admin`,
+		},
+	},
+	{
+		Name:    "Add Nested Communities",
+		Version: 9,
+		Scripts: []string{
+			`CREATE OR REPLACE VIEW AccessView AS
+				WITH RECURSIVE Communities(GroupID, MemberID, Access, Path) AS (
+						SELECT Community.GroupID, Community.MemberID, Community.Access,
+							ARRAY[Community.GroupID, Community.MemberID]
+						FROM Community
+					UNION ALL
+						-- members of a community member inherit its grants,
+						-- limited by the weakest grant in the chain
+						SELECT Community.GroupID, Communities.MemberID,
+							LEAST(Community.Access, Communities.Access),
+							Community.GroupID || Communities.Path
+						FROM Community
+						JOIN Communities ON Communities.GroupID = Community.MemberID
+						WHERE NOT Community.GroupID = ANY(Communities.Path)
+				),
+				Accesses AS (
+					-- public pages
+					SELECT Groups.ID AS GroupID, Users.ID AS UserID, 'reader'::Rights AS Access
+					FROM Groups
+					CROSS JOIN Users
+					WHERE Groups.Public = true
+				UNION ALL
+					-- member of group
+					SELECT Membership.GroupID, Membership.UserID, 'moderator'::Rights AS Rights
+					FROM Membership
+				UNION ALL
+					-- member of group owner
+					SELECT Groups.ID, Membership.UserID, 'moderator'::Rights AS Rights
+					FROM Groups
+					JOIN Membership ON Membership.GroupID = Groups.OwnerID
+				UNION ALL
+					-- member of group community, directly or through nested communities
+					SELECT Communities.GroupID, Membership.UserID, Communities.Access
+					FROM Communities
+					JOIN Membership ON Membership.GroupID = Communities.MemberID
+				)
+			SELECT Accesses.GroupID, Accesses.UserID, LEAST(MAX(Accesses.Access), Users.MaxAccess) AS Access
+			FROM Accesses
+			JOIN Users ON Users.ID = Accesses.UserID
+			GROUP BY Accesses.GroupID, Accesses.UserID, Users.ID
+			ORDER BY Accesses.GroupID, Accesses.UserID;`,
+		},
+	},
+	{
+		Name:    "Add Invitations",
+		Version: 10,
+		Scripts: []string{
+			`ALTER TABLE Membership
+				ADD COLUMN Access Rights NOT NULL DEFAULT 'moderator'`,
+			`CREATE TABLE Invitations (
+				TokenHash BYTEA       NOT NULL PRIMARY KEY,
+				GroupID   TEXT        NOT NULL REFERENCES Groups(ID),
+				Access    Rights      NOT NULL,
+				CreatedBy TEXT        NOT NULL,
+				Expires   TIMESTAMPTZ NOT NULL,
+				UsedBy    TEXT        REFERENCES Users(ID),
+				Used      TIMESTAMPTZ
+			)`,
+			`CREATE OR REPLACE VIEW AccessView AS
+				WITH RECURSIVE Communities(GroupID, MemberID, Access, Path) AS (
+						SELECT Community.GroupID, Community.MemberID, Community.Access,
+							ARRAY[Community.GroupID, Community.MemberID]
+						FROM Community
+					UNION ALL
+						-- members of a community member inherit its grants,
+						-- limited by the weakest grant in the chain
+						SELECT Community.GroupID, Communities.MemberID,
+							LEAST(Community.Access, Communities.Access),
+							Community.GroupID || Communities.Path
+						FROM Community
+						JOIN Communities ON Communities.GroupID = Community.MemberID
+						WHERE NOT Community.GroupID = ANY(Communities.Path)
+				),
+				Accesses AS (
+					-- public pages
+					SELECT Groups.ID AS GroupID, Users.ID AS UserID, 'reader'::Rights AS Access
+					FROM Groups
+					CROSS JOIN Users
+					WHERE Groups.Public = true
+				UNION ALL
+					-- member of group
+					SELECT Membership.GroupID, Membership.UserID, Membership.Access
+					FROM Membership
+				UNION ALL
+					-- member of group owner
+					SELECT Groups.ID, Membership.UserID, Membership.Access
+					FROM Groups
+					JOIN Membership ON Membership.GroupID = Groups.OwnerID
+				UNION ALL
+					-- member of group community, directly or through nested communities
+					SELECT Communities.GroupID, Membership.UserID, LEAST(Communities.Access, Membership.Access)
+					FROM Communities
+					JOIN Membership ON Membership.GroupID = Communities.MemberID
+				)
+			SELECT Accesses.GroupID, Accesses.UserID, LEAST(MAX(Accesses.Access), Users.MaxAccess) AS Access
+			FROM Accesses
+			JOIN Users ON Users.ID = Accesses.UserID
+			GROUP BY Accesses.GroupID, Accesses.UserID, Users.ID
+			ORDER BY Accesses.GroupID, Accesses.UserID;`,
+		},
+	},
+	{
+		Name:    "Add Access Journal",
+		Version: 11,
+		Scripts: []string{
+			`CREATE TABLE AccessJournal (
+				Actor    TEXT  NOT NULL,
+				Action   TEXT  NOT NULL,
+				Target   TEXT  NOT NULL,
+				Data     JSONB NOT NULL,
+				Date     TIMESTAMP NOT NULL DEFAULT current_timestamp
+			)`,
+		},
+	},
+	{
+		Name:    "Add LRS Statements",
+		Version: 12,
+		Scripts: []string{
+			`CREATE TABLE LRSStatements (
+				ID       TEXT  NOT NULL PRIMARY KEY,
+				UserID   TEXT  NOT NULL REFERENCES Users(ID) ON DELETE CASCADE,
+				Verb     TEXT  NOT NULL,
+				ObjectID TEXT  NOT NULL,
+				Data     JSONB NOT NULL,
+				Stored   TIMESTAMP NOT NULL DEFAULT current_timestamp
+			)`,
+			`CREATE INDEX LRSStatementsUser ON LRSStatements (UserID, Stored)`,
+		},
+	},
+	{
+		Name:    "Add Page Aliases",
+		Version: 13,
+		Scripts: []string{
+			`CREATE TABLE Aliases (
+				Alias   TEXT NOT NULL PRIMARY KEY,
+				Target  TEXT NOT NULL,
+				Created TIMESTAMP NOT NULL DEFAULT current_timestamp
+			)`,
+			`CREATE INDEX AliasesTarget ON Aliases (Target)`,
+		},
+	},
+	{
+		Name:    "Add API Tokens",
+		Version: 14,
+		Scripts: []string{
+			`CREATE TABLE APITokens (
+				ID        SERIAL    NOT NULL PRIMARY KEY,
+				TokenHash BYTEA     NOT NULL UNIQUE,
+				UserID    TEXT      NOT NULL REFERENCES Users(ID) ON DELETE CASCADE,
+				Name      TEXT      NOT NULL DEFAULT '',
+				Scope     TEXT      NOT NULL,
+				Created   TIMESTAMP NOT NULL DEFAULT current_timestamp,
+				Revoked   TIMESTAMP
+			)`,
+			`CREATE INDEX APITokensUser ON APITokens (UserID)`,
+		},
+	},
+	{
+		Name:    "Add Page Locks",
+		Version: 15,
+		Scripts: []string{
+			`CREATE TABLE PageLocks (
+				Slug    TEXT      NOT NULL PRIMARY KEY,
+				Holder  TEXT      NOT NULL REFERENCES Users(ID) ON DELETE CASCADE,
+				Expires TIMESTAMP NOT NULL
+			)`,
+		},
+	},
+	{
+		Name:    "Add Frozen Groups",
+		Version: 16,
+		Scripts: []string{
+			`ALTER TABLE Groups ADD COLUMN Frozen BOOL NOT NULL DEFAULT FALSE`,
+		},
+	},
 }
 
 func (db *Database) createVersionTable() error {
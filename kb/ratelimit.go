@@ -0,0 +1,124 @@
+package kb
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RateLimiter is a token bucket limiter keyed by user or remote address.
+type RateLimiter struct {
+	// Rate is the number of requests refilled per second
+	Rate float64
+	// Burst is the maximum number of requests served at once
+	Burst int
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// NewRateLimiter creates a limiter, returns nil when rate or burst is <= 0
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 || burst <= 0 {
+		return nil
+	}
+	return &RateLimiter{
+		Rate:    rate,
+		Burst:   burst,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token for key, when none are available it
+// returns how long the caller should wait before retrying.
+func (limiter *RateLimiter) Allow(key string) (bool, time.Duration) {
+	if limiter == nil {
+		return true, 0
+	}
+
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := limiter.now()
+	b, ok := limiter.buckets[key]
+	if !ok {
+		limiter.prune(now)
+		b = &bucket{tokens: float64(limiter.Burst), last: now}
+		limiter.buckets[key] = b
+	}
+
+	b.tokens = math.Min(float64(limiter.Burst), b.tokens+now.Sub(b.last).Seconds()*limiter.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limiter.Rate * float64(time.Second))
+		return false, wait
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune removes buckets that have been refilled completely
+func (limiter *RateLimiter) prune(now time.Time) {
+	if len(limiter.buckets) < 1024 {
+		return
+	}
+	full := time.Duration(float64(limiter.Burst) / limiter.Rate * float64(time.Second))
+	for key, b := range limiter.buckets {
+		if now.Sub(b.last) >= full {
+			delete(limiter.buckets, key)
+		}
+	}
+}
+
+// check writes 429 Too Many Requests when key has exceeded its limit
+func (limiter *RateLimiter) check(w http.ResponseWriter, r *http.Request, key string) bool {
+	ok, wait := limiter.Allow(key)
+	if ok {
+		return true
+	}
+
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	WriteError(w, r, &HTTPError{
+		Status:  http.StatusTooManyRequests,
+		Code:    "rate-limited",
+		Message: "Too many requests, retry in " + strconv.Itoa(seconds) + "s.",
+	})
+	return false
+}
+
+// LimitByAddr limits unauthenticated requests by their remote address
+func (limiter *RateLimiter) LimitByAddr(next http.Handler) http.Handler {
+	if limiter == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !limiter.check(w, r, "addr:"+remoteHost(r)) {
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func remoteHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
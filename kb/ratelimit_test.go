@@ -0,0 +1,97 @@
+package kb
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type headerAuth struct{}
+
+func (headerAuth) Verify(w http.ResponseWriter, r *http.Request) (User, error) {
+	return User{ID: Slug(r.Header.Get("X-User"))}, nil
+}
+
+type okModule struct{}
+
+func (okModule) Info() Group        { return Group{ID: "test", Name: "Test"} }
+func (okModule) Pages() []PageEntry { return nil }
+func (okModule) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("OK"))
+}
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := NewRateLimiter(0.5, 2)
+	limiter.now = func() time.Time { return now }
+
+	server := NewServer(headerAuth{}, nil)
+	server.RateLimit = limiter
+	server.AddModule(okModule{})
+
+	request := func(user Slug) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/test=search", nil)
+		r.Header.Set("X-User", string(user))
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	for i := 0; i < 2; i++ {
+		if w := request("alice"); w.Code != http.StatusOK {
+			t.Fatalf("request %d: got status %d", i, w.Code)
+		}
+	}
+
+	w := request("alice")
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, expected %d", w.Code, http.StatusTooManyRequests)
+	}
+	if retry := w.Header().Get("Retry-After"); retry != "2" {
+		t.Errorf("got Retry-After %q, expected %q", retry, "2")
+	}
+
+	if w := request("bob"); w.Code != http.StatusOK {
+		t.Errorf("second user: got status %d", w.Code)
+	}
+
+	now = now.Add(2 * time.Second)
+	if w := request("alice"); w.Code != http.StatusOK {
+		t.Errorf("after refill: got status %d", w.Code)
+	}
+}
+
+func TestRateLimitByAddr(t *testing.T) {
+	limiter := NewRateLimiter(1, 1)
+	limiter.now = func() time.Time { return time.Time{} }
+	handler := limiter.LimitByAddr(okModule{})
+
+	request := func(addr string) int {
+		r := httptest.NewRequest("GET", "/system/auth/login", nil)
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	if code := request("10.0.0.1:1234"); code != http.StatusOK {
+		t.Errorf("got status %d", code)
+	}
+	if code := request("10.0.0.1:4321"); code != http.StatusTooManyRequests {
+		t.Errorf("same address: got status %d, expected %d", code, http.StatusTooManyRequests)
+	}
+	if code := request("10.0.0.2:1234"); code != http.StatusOK {
+		t.Errorf("other address: got status %d", code)
+	}
+}
+
+func TestRateLimitDisabled(t *testing.T) {
+	if limiter := NewRateLimiter(0, 10); limiter != nil {
+		t.Fatalf("expected nil limiter")
+	}
+	var limiter *RateLimiter
+	if ok, _ := limiter.Allow("alice"); !ok {
+		t.Errorf("nil limiter should allow everything")
+	}
+}
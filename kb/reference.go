@@ -0,0 +1,61 @@
+package kb
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// ReferenceError is returned for a reference item to an unknown site
+type ReferenceError struct {
+	ID   string
+	Site string
+}
+
+func (err ReferenceError) Error() string {
+	return fmt.Sprintf("reference %s: unknown site %q", err.ID, err.Site)
+}
+
+// ReferenceSite returns the host of a reference url,
+// empty for references within this site
+func ReferenceSite(rawurl string) string {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return rawurl
+	}
+	return u.Host
+}
+
+// ResolveReferences checks that each reference item in story, including
+// nested stories, points to a site accepted by known
+func ResolveReferences(story Story, known func(site string) bool) []error {
+	var errs []error
+	for _, item := range story {
+		if item.Type() == "reference" {
+			site := ReferenceSite(item.Val("url"))
+			if site != "" && !known(site) {
+				errs = append(errs, ReferenceError{ID: item.ID(), Site: site})
+			}
+		}
+		if nested := nestedStory(item); len(nested) > 0 {
+			errs = append(errs, ResolveReferences(nested, known)...)
+		}
+	}
+	return errs
+}
+
+// nestedStory returns the story of collapsible items
+func nestedStory(item Item) Story {
+	switch story := item["story"].(type) {
+	case Story:
+		return story
+	case []interface{}:
+		nested := Story{}
+		for _, v := range story {
+			if m, ok := v.(map[string]interface{}); ok {
+				nested = append(nested, Item(m))
+			}
+		}
+		return nested
+	}
+	return nil
+}
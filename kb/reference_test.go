@@ -0,0 +1,49 @@
+package kb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestResolveReferences(t *testing.T) {
+	known := func(site string) bool { return site == "kb.example.com" }
+
+	valid := Reference("Setup", "//kb.example.com/help=setup", "")
+	local := Reference("Billing", "/help=billing", "")
+	unknown := Reference("Other", "https://unknown.example.org/page", "")
+	nested := Reference("Nested", "//elsewhere.example.org/page", "")
+
+	story := Story{
+		valid,
+		local,
+		unknown,
+		Collapsible("More", Story{nested}),
+	}
+
+	errs := ResolveReferences(story, known)
+	if len(errs) != 2 {
+		t.Fatalf("got errors %v", errs)
+	}
+	for i, exp := range []ReferenceError{
+		{ID: unknown.ID(), Site: "unknown.example.org"},
+		{ID: nested.ID(), Site: "elsewhere.example.org"},
+	} {
+		if errs[i] != exp {
+			t.Errorf("got %v, expected %v", errs[i], exp)
+		}
+	}
+
+	// stories loaded from json contain plain maps
+	data, _ := json.Marshal(story)
+	var loaded Story
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if errs := ResolveReferences(loaded, known); len(errs) != 2 {
+		t.Errorf("loaded story: got errors %v", errs)
+	}
+
+	if errs := ResolveReferences(Story{valid, local}, known); len(errs) != 0 {
+		t.Errorf("valid story: got errors %v", errs)
+	}
+}
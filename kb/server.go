@@ -25,6 +25,9 @@ type Server struct {
 	Auth Auth
 	Database
 	Modules map[Slug]Module
+
+	// RateLimit limits requests per user, nil disables limiting
+	RateLimit *RateLimiter
 }
 
 func NewServer(auth Auth, database Database) *Server {
@@ -46,6 +49,10 @@ func (server *Server) AddModule(module Module) {
 }
 
 func (server *Server) login(w http.ResponseWriter, r *http.Request) (User, bool) {
+	if token, ok := bearerToken(r); ok {
+		return server.tokenLogin(w, r, token)
+	}
+
 	user, err := server.Auth.Verify(w, r)
 	if err != nil {
 		w.Header().Add("WWW-Authenticate", "X-Auth-Token")
@@ -53,6 +60,48 @@ func (server *Server) login(w http.ResponseWriter, r *http.Request) (User, bool)
 		http.Error(w, "Session expired!", http.StatusUnauthorized)
 		return User{}, false
 	}
+	setAccessUser(r, user.ID)
+	return user, true
+}
+
+// bearerToken returns the API token from the Authorization header
+func bearerToken(r *http.Request) (string, bool) {
+	auth := r.Header.Get("Authorization")
+	if len(auth) <= len("Bearer ") || !strings.EqualFold(auth[:len("Bearer ")], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(auth[len("Bearer "):]), true
+}
+
+// tokenLogin authenticates the request with an API token instead of a session
+func (server *Server) tokenLogin(w http.ResponseWriter, r *http.Request, token string) (User, bool) {
+	context := server.Context("")
+	apitoken, err := context.APITokens().VerifyToken(token)
+	if err != nil {
+		if err != ErrTokenNotExist {
+			log.Println("Verifying API token failed:", err)
+		}
+		w.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Invalid API token.", http.StatusUnauthorized)
+		return User{}, false
+	}
+
+	user, err := context.Users().ByID(apitoken.User)
+	if err != nil {
+		w.Header().Add("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Invalid API token.", http.StatusUnauthorized)
+		return User{}, false
+	}
+	setAccessUser(r, user.ID)
+
+	if !apitoken.Allows(r.Method) {
+		WriteError(w, r, &HTTPError{
+			Status:  http.StatusForbidden,
+			Code:    "read-only-token",
+			Message: "API token only allows reading.",
+		})
+		return User{}, false
+	}
 	return user, true
 }
 
@@ -61,12 +110,17 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	if !ok {
 		return
 	}
+	if !server.RateLimit.check(w, r, "user:"+string(user.ID)) {
+		return
+	}
+	if server.canonicalRedirect(w, r, user) {
+		return
+	}
 
 	groupID, pageID := TokenizeLink(r.URL.Path)
 	if groupID == "" {
-		http.Error(w, "No page owner specified:\n"+
-			"page links should have format owner=page-name.",
-			http.StatusBadRequest)
+		WriteError(w, r, BadRequest("No page owner specified:\n"+
+			"page links should have format owner=page-name."))
 		return
 	}
 
@@ -86,7 +140,11 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	switch rights {
 	case Blocked:
-		http.Error(w, "Not enough rights to view this content.", http.StatusForbidden)
+		WriteError(w, r, &HTTPError{
+			Status:  http.StatusForbidden,
+			Code:    "access-denied",
+			Message: "Not enough rights to view this content.",
+		})
 		return
 	case Reader:
 		allowedMethods = []string{"GET"}
@@ -95,7 +153,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case Moderator:
 		allowedMethods = []string{"GET", "POST", "PUT", "OVERWRITE", "DELETE"}
 	default:
-		log.Println("Invalid rights returned for user %s got %d.", user.ID, rights)
+		log.Printf("Invalid rights returned for user %s got %s.", user.ID, rights)
 		http.Error(w, "Invalid rights.", http.StatusInternalServerError)
 		return
 	}
@@ -118,7 +176,11 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	w.Header().Set("Allow", strings.Join(allowedMethods, ","))
 	if !allowed(r.Method, allowedMethods) {
-		http.Error(w, "Method "+r.Method+" not allowed.", http.StatusMethodNotAllowed)
+		WriteError(w, r, &HTTPError{
+			Status:  http.StatusMethodNotAllowed,
+			Code:    "method-not-allowed",
+			Message: "Method " + r.Method + " not allowed.",
+		})
 		return
 	}
 
@@ -129,9 +191,15 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "GET":
 		if versionedRequest {
 			if requestedVersionStr == "all" {
-				entries, err := pages.History(pageID)
+				offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+				limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+				history := pages.History
+				if r.URL.Query().Get("deletes") != "" {
+					history = pages.HistoryWithDeletes
+				}
+				entries, err := history(pageID, offset, limit)
 				if err != nil {
-					WriteResult(w, err)
+					WriteError(w, r, err)
 					return
 				}
 
@@ -145,7 +213,7 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 			} else {
 				data, err := pages.LoadRawVersion(pageID, requestedVersion)
 				if err != nil {
-					WriteResult(w, err)
+					WriteError(w, r, err)
 					return
 				}
 				// TODO: modify header
@@ -154,9 +222,16 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 				w.Write(data)
 			}
 		} else {
-			data, err := pages.LoadRaw(pageID)
+			data, err := pages.LoadRawCtx(r.Context(), pageID)
+			if errors.Is(err, ErrPageNotExist) {
+				// old slugs of renamed pages redirect to the page
+				if target, aerr := context.Aliases().Resolve(pageID); aerr == nil {
+					http.Redirect(w, r, "/"+string(target), http.StatusMovedPermanently)
+					return
+				}
+			}
 			if err != nil {
-				WriteResult(w, err)
+				WriteError(w, r, err)
 				return
 			}
 
@@ -168,32 +243,32 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "PUT", "OVERWRITE":
 		version, err := getExpectedVersion(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, BadRequest(err.Error()))
 			return
 		}
 
 		page, err := ReadJSONPage(r.Body)
 		r.Body.Close()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid JSON content: %s", err), http.StatusBadRequest)
+			WriteError(w, r, BadRequest(fmt.Sprintf("Invalid JSON content: %s", err)))
 			return
 		}
 
 		pageOwner, _ := TokenizeLink(string(page.Slug))
 		if pageOwner != groupID {
-			http.Error(w, "Invalid parameters specified.", http.StatusBadRequest)
+			WriteError(w, r, BadRequest("Invalid parameters specified."))
 			return
 		}
 
 		if page.Title == "" {
-			http.Error(w, "Page title is missing.", http.StatusBadRequest)
+			WriteError(w, r, BadRequest("Page title is missing."))
 			return
 		}
 
 		if r.Method == "PUT" {
-			WriteResult(w, pages.Create(page))
+			writeResult(w, r, pages.Create(page))
 		} else if r.Method == "OVERWRITE" {
-			WriteResult(w, pages.Overwrite(pageID, version, page))
+			writeResult(w, r, pages.Overwrite(pageID, version, page))
 		} else {
 			panic("Invalid method")
 		}
@@ -202,28 +277,28 @@ func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	case "POST":
 		version, err := getExpectedVersion(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, BadRequest(err.Error()))
 			return
 		}
 
 		action, err := ReadJSONAction(r.Body)
 		r.Body.Close()
 		if err != nil {
-			http.Error(w, fmt.Sprintf("Invalid JSON content: %s", err), http.StatusBadRequest)
+			WriteError(w, r, BadRequest(fmt.Sprintf("Invalid JSON content: %s", err)))
 			return
 		}
 
-		WriteResult(w, pages.Edit(pageID, version, action))
+		writeResult(w, r, pages.Edit(pageID, version, action))
 
 	// deleting a page
 	case "DELETE":
 		version, err := getExpectedVersion(r)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			WriteError(w, r, BadRequest(err.Error()))
 			return
 		}
 
-		WriteResult(w, pages.Delete(pageID, version))
+		writeResult(w, r, pages.Delete(pageID, version))
 	default:
 		panic("Invalid method " + r.Method)
 	}
@@ -311,16 +386,20 @@ func (server *Server) IndexContext(w http.ResponseWriter, r *http.Request) (Cont
 }
 
 func WriteResult(w http.ResponseWriter, err error) {
-	switch err {
-	case nil:
+	if err == nil {
 		w.WriteHeader(http.StatusOK)
-	case ErrPageExists:
-		http.Error(w, err.Error(), http.StatusForbidden)
-	case ErrPageNotExist:
-		http.Error(w, err.Error(), http.StatusNotFound)
-	default:
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	status, _ := ErrorStatus(err)
+	http.Error(w, err.Error(), status)
+}
+
+func writeResult(w http.ResponseWriter, r *http.Request, err error) {
+	if err == nil {
+		w.WriteHeader(http.StatusOK)
+		return
 	}
+	WriteError(w, r, err)
 }
 
 func (p *Page) WriteResponse(w http.ResponseWriter) error {
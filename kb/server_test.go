@@ -0,0 +1,163 @@
+package kb
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type aliasDatabase struct {
+	pages   map[Slug][]byte
+	aliases map[Slug]Slug
+}
+
+func (db aliasDatabase) Context(user Slug) Context { return aliasContext{db: db} }
+
+type aliasContext struct {
+	Context
+	db aliasDatabase
+}
+
+func (ctx aliasContext) Access() Access         { return readerAccess{} }
+func (ctx aliasContext) Pages(group Slug) Pages { return aliasPages{db: ctx.db} }
+func (ctx aliasContext) Aliases() Aliases       { return aliasResolver{db: ctx.db} }
+
+type readerAccess struct{ Access }
+
+func (readerAccess) Rights(group, user Slug) Rights { return Reader }
+
+type aliasPages struct {
+	Pages
+	db aliasDatabase
+}
+
+func (pages aliasPages) LoadRawCtx(ctx context.Context, id Slug) ([]byte, error) {
+	data, ok := pages.db.pages[id]
+	if !ok {
+		return nil, ErrPageNotExist
+	}
+	return data, nil
+}
+
+type aliasResolver struct {
+	Aliases
+	db aliasDatabase
+}
+
+func (aliases aliasResolver) Resolve(alias Slug) (Slug, error) {
+	target, ok := aliases.db.aliases[alias]
+	if !ok {
+		return "", ErrAliasNotExist
+	}
+	return target, nil
+}
+
+func TestServeAlias(t *testing.T) {
+	server := NewServer(headerAuth{}, aliasDatabase{
+		pages:   map[Slug][]byte{"help=new": []byte(`{"slug":"help=new"}`)},
+		aliases: map[Slug]Slug{"help=old": "help=new"},
+	})
+
+	request := func(path string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("X-User", "reader")
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("/help=new"); w.Code != http.StatusOK || w.Body.String() != `{"slug":"help=new"}` {
+		t.Errorf("page: got %d %q", w.Code, w.Body.String())
+	}
+
+	w := request("/help=old")
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "/help=new" {
+		t.Errorf("alias: got %d to %q", w.Code, w.Header().Get("Location"))
+	}
+
+	if w := request("/help=missing"); w.Code != http.StatusNotFound {
+		t.Errorf("missing: got %d", w.Code)
+	}
+}
+
+type tokenDatabase struct {
+	aliasDatabase
+	tokens map[string]APIToken
+}
+
+func (db tokenDatabase) Context(user Slug) Context {
+	return tokenContext{aliasContext{db: db.aliasDatabase}, db}
+}
+
+type tokenContext struct {
+	aliasContext
+	db tokenDatabase
+}
+
+func (ctx tokenContext) APITokens() APITokens { return tokenStore{db: ctx.db} }
+func (ctx tokenContext) Users() Users         { return tokenUsers{} }
+
+type tokenStore struct {
+	APITokens
+	db tokenDatabase
+}
+
+func (store tokenStore) VerifyToken(token string) (APIToken, error) {
+	apitoken, ok := store.db.tokens[token]
+	if !ok {
+		return APIToken{}, ErrTokenNotExist
+	}
+	return apitoken, nil
+}
+
+type tokenUsers struct{ Users }
+
+func (tokenUsers) ByID(id Slug) (User, error) { return User{ID: id}, nil }
+
+func TestServeAPIToken(t *testing.T) {
+	server := NewServer(headerAuth{}, tokenDatabase{
+		aliasDatabase: aliasDatabase{
+			pages: map[Slug][]byte{"help=page": []byte(`{"slug":"help=page"}`)},
+		},
+		tokens: map[string]APIToken{
+			"read-token": {ID: 1, User: "integration", Scope: ScopeRead},
+		},
+	})
+
+	request := func(method, token string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/help=page", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := request("GET", "read-token"); w.Code != http.StatusOK || w.Body.String() != `{"slug":"help=page"}` {
+		t.Errorf("read-only token: got %d %q", w.Code, w.Body.String())
+	}
+	if w := request("PUT", "read-token"); w.Code != http.StatusForbidden {
+		t.Errorf("writing with read-only token: got %d", w.Code)
+	}
+	// revoked tokens are not returned by VerifyToken
+	if w := request("GET", "revoked-token"); w.Code != http.StatusUnauthorized {
+		t.Errorf("revoked token: got %d", w.Code)
+	}
+}
+
+func TestAPITokenAllows(t *testing.T) {
+	read := APIToken{Scope: ScopeRead}
+	write := APIToken{Scope: ScopeReadWrite}
+	for _, method := range []string{"GET", "HEAD", "POST", "PUT", "DELETE"} {
+		readonly := method == "GET" || method == "HEAD"
+		if read.Allows(method) != readonly {
+			t.Errorf("read scope with %s: got %v", method, read.Allows(method))
+		}
+		if !write.Allows(method) {
+			t.Errorf("read-write scope with %s should be allowed", method)
+		}
+	}
+	if (APIToken{}).Allows("GET") {
+		t.Errorf("token without scope should not allow anything")
+	}
+}
@@ -0,0 +1,23 @@
+package kb
+
+import (
+	"context"
+	"io"
+	"net/http"
+)
+
+// Shutdown gracefully stops server and afterwards closes the databases.
+//
+// The listener stops accepting new connections immediately, callers
+// should remove the instance from the load balancer before calling
+// Shutdown to avoid refused requests. In-flight requests are allowed
+// to complete until ctx is done.
+func Shutdown(ctx context.Context, server *http.Server, databases ...io.Closer) error {
+	err := server.Shutdown(ctx)
+	for _, db := range databases {
+		if cerr := db.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
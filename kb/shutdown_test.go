@@ -0,0 +1,80 @@
+package kb
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+type testCloser struct{ closed bool }
+
+func (db *testCloser) Close() error {
+	db.closed = true
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://" + listener.Addr().String() + "/"
+
+	started, release := make(chan struct{}), make(chan struct{})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte("done"))
+		}),
+	}
+	served := make(chan error, 1)
+	go func() { served <- server.Serve(listener) }()
+
+	type result struct {
+		body string
+		err  error
+	}
+	inflight := make(chan result, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			inflight <- result{err: err}
+			return
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		inflight <- result{string(data), err}
+	}()
+	<-started
+
+	db := &testCloser{}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	shutdown := make(chan error, 1)
+	go func() { shutdown <- Shutdown(ctx, server, db) }()
+
+	if err := <-served; err != http.ErrServerClosed {
+		t.Fatalf("got serve error %v, expected %v", err, http.ErrServerClosed)
+	}
+	close(release)
+
+	if res := <-inflight; res.err != nil || res.body != "done" {
+		t.Errorf("in-flight request: got %q, %v", res.body, res.err)
+	}
+	if err := <-shutdown; err != nil {
+		t.Errorf("shutdown failed: %v", err)
+	}
+	if !db.closed {
+		t.Errorf("database was not closed")
+	}
+
+	client := &http.Client{Timeout: time.Second}
+	if resp, err := client.Get(url); err == nil {
+		resp.Body.Close()
+		t.Errorf("expected new requests to be refused")
+	}
+}
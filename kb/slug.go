@@ -41,6 +41,42 @@ func ValidateSlug(slug Slug) error {
 	return nil
 }
 
+// SlugStatus is the category of a slug checked by ValidateSlugs
+type SlugStatus string
+
+const (
+	SlugValid    SlugStatus = "valid"
+	SlugEmpty    SlugStatus = "empty"
+	SlugModified SlugStatus = "modified"
+)
+
+// SlugValidation is the result of validating a single slug
+type SlugValidation struct {
+	Slug   Slug       `json:"slug"`
+	Status SlugStatus `json:"status"`
+	// Corrected is the slugified form of a modified slug
+	Corrected Slug `json:"corrected,omitempty"`
+}
+
+// ValidateSlugs checks slugs in bulk with ValidateSlug,
+// results are in the same order as slugs
+func ValidateSlugs(slugs []Slug) []SlugValidation {
+	results := make([]SlugValidation, 0, len(slugs))
+	for _, slug := range slugs {
+		result := SlugValidation{Slug: slug, Status: SlugValid}
+		if err := ValidateSlug(slug); err != nil {
+			if len(slug) == 0 {
+				result.Status = SlugEmpty
+			} else {
+				result.Status = SlugModified
+				result.Corrected = Slugify(string(slug))
+			}
+		}
+		results = append(results, result)
+	}
+	return results
+}
+
 // Slugify converts text to a slug
 //
 // * numbers, '/', '=' are emitted
@@ -54,13 +90,22 @@ func ValidateSlug(slug Slug) error {
 // Example:
 //   "&Hello_世界/+!" ==> "amp-hello-世界/plus-excl"
 //   "Hello  World  //  Test" ==> "hello-world/test"
-func Slugify(s string) Slug {
+func Slugify(s string) Slug { return slugify(s, nil) }
+
+// SlugifyKeep converts text to a slug like Slugify,
+// but emits the runes in keep verbatim
+//
+// Example with keep = []rune("#+"):
+//   "C# and C++" ==> "c#-and-c++"
+func SlugifyKeep(s string, keep []rune) Slug { return slugify(s, keep) }
+
+func slugify(s string, keep []rune) Slug {
 	cutdash := true
 	emitdash := false
 
 	slug := make([]rune, 0, len(s))
 	for _, r := range s {
-		if unicode.IsNumber(r) || unicode.IsLetter(r) {
+		if unicode.IsNumber(r) || unicode.IsLetter(r) || containsRune(keep, r) {
 			if emitdash && !cutdash {
 				slug = append(slug, '-')
 			}
@@ -98,6 +143,79 @@ func Slugify(s string) Slug {
 	return Slug(slug)
 }
 
+func containsRune(runes []rune, r rune) bool {
+	for _, x := range runes {
+		if x == r {
+			return true
+		}
+	}
+	return false
+}
+
+// DefaultExtensions is a list of commonly imported file extensions
+var DefaultExtensions = []string{
+	"pdf", "txt", "rtf", "doc", "docx", "xls", "xlsx", "ppt", "pptx",
+	"htm", "html", "xml", "json", "csv", "dita", "ditamap",
+	"png", "jpg", "jpeg", "gif", "svg", "mp3", "mp4",
+	"zip", "gz", "h5p",
+}
+
+// Slugifier converts text to a slug with additional rules,
+// zero value behaves the same as Slugify
+type Slugifier struct {
+	// Extensions that are recognized in the last dot-segment of text
+	Extensions []string
+	// ExtensionSeparator is emitted between the name and a recognized
+	// extension, when empty the extension is dropped
+	ExtensionSeparator string
+	// Keep lists symbols that are emitted verbatim, e.g. "#+" for "C#" and "C++".
+	// Such slugs must be validated with Validate instead of ValidateSlug.
+	Keep []rune
+}
+
+// Slugify converts text to a slug
+//
+// Example with Extensions = DefaultExtensions:
+//   "report.pdf" ==> "report"
+//   "notes.v2" ==> "notes-v2"
+//   "archive.tar.gz" ==> "archive-tar"
+func (slugifier *Slugifier) Slugify(s string) Slug {
+	name, ext := slugifier.splitExtension(s)
+	if ext == "" {
+		return slugify(s, slugifier.Keep)
+	}
+	if slugifier.ExtensionSeparator == "" {
+		return slugify(name, slugifier.Keep)
+	}
+	return slugify(name+slugifier.ExtensionSeparator+ext, slugifier.Keep)
+}
+
+// Validate verifies whether slug is valid with the kept symbols
+func (slugifier *Slugifier) Validate(slug Slug) error {
+	if len(slug) == 0 {
+		return fmt.Errorf("slug cannot be empty")
+	}
+	if slug != slugify(string(slug), slugifier.Keep) {
+		return fmt.Errorf(`slugification modified the slug`)
+	}
+	return nil
+}
+
+// splitExtension separates a recognized extension from s
+func (slugifier *Slugifier) splitExtension(s string) (name, ext string) {
+	i := strings.LastIndex(s, ".")
+	if i <= 0 {
+		return s, ""
+	}
+	ext = s[i+1:]
+	for _, known := range slugifier.Extensions {
+		if strings.EqualFold(ext, known) {
+			return s[:i], ext
+		}
+	}
+	return s, ""
+}
+
 func TokenizeLink(link string) (owner, page Slug) {
 	if strings.HasPrefix(link, "/") {
 		link = link[1:]
@@ -42,3 +42,90 @@ func TestValidateSlug(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateSlugs(t *testing.T) {
+	got := ValidateSlugs([]Slug{"", "help=intro", "Help=Intro Page", "a//b", "küsimused"})
+	exp := []SlugValidation{
+		{Slug: "", Status: SlugEmpty},
+		{Slug: "help=intro", Status: SlugValid},
+		{Slug: "Help=Intro Page", Status: SlugModified, Corrected: "help=intro-page"},
+		{Slug: "a//b", Status: SlugModified, Corrected: "a/b"},
+		{Slug: "küsimused", Status: SlugValid},
+	}
+	if len(got) != len(exp) {
+		t.Fatalf("got %d results, expected %d", len(got), len(exp))
+	}
+	for i := range exp {
+		if got[i] != exp[i] {
+			t.Errorf("%q: got %+v, expected %+v", exp[i].Slug, got[i], exp[i])
+		}
+	}
+}
+
+func TestSlugifierExtensions(t *testing.T) {
+	drop := &Slugifier{Extensions: DefaultExtensions}
+	keep := &Slugifier{Extensions: DefaultExtensions, ExtensionSeparator: "/"}
+
+	cases := []struct {
+		In       string
+		Drop     Slug
+		Separate Slug
+	}{
+		{In: "report.pdf", Drop: "report", Separate: "report/pdf"},
+		{In: "Report.PDF", Drop: "report", Separate: "report/pdf"},
+		{In: "notes.v2", Drop: "notes-v2", Separate: "notes-v2"},
+		{In: "archive.tar.gz", Drop: "archive-tar", Separate: "archive-tar/gz"},
+		{In: ".pdf", Drop: "pdf", Separate: "pdf"},
+	}
+
+	for _, test := range cases {
+		if got := drop.Slugify(test.In); got != test.Drop {
+			t.Errorf("drop Slugify(%q): got %q expected %q", test.In, got, test.Drop)
+		}
+		if got := keep.Slugify(test.In); got != test.Separate {
+			t.Errorf("separate Slugify(%q): got %q expected %q", test.In, got, test.Separate)
+		}
+	}
+
+	var zero Slugifier
+	if got := zero.Slugify("report.pdf"); got != "report-pdf" {
+		t.Errorf("zero Slugifier: got %q", got)
+	}
+}
+
+func TestSlugifyKeep(t *testing.T) {
+	keep := []rune("#+")
+	cases := []struct {
+		In      string
+		Default Slug
+		Kept    Slug
+	}{
+		{"C#", "c-num", "c#"},
+		{"C++", "c-plus-plus", "c++"},
+		{"C# and C++ / F#", "c-num-and-c-plus-plus/f-num", "c#-and-c++/f#"},
+		{"Notes & C#", "notes-amp-c-num", "notes-amp-c#"},
+	}
+
+	slugifier := &Slugifier{Keep: keep}
+	for _, test := range cases {
+		if got := Slugify(test.In); got != test.Default {
+			t.Errorf("Slugify(%q): got %q expected %q", test.In, got, test.Default)
+		}
+		if got := SlugifyKeep(test.In, keep); got != test.Kept {
+			t.Errorf("SlugifyKeep(%q): got %q expected %q", test.In, got, test.Kept)
+		}
+		if got := slugifier.Slugify(test.In); got != test.Kept {
+			t.Errorf("Slugifier.Slugify(%q): got %q expected %q", test.In, got, test.Kept)
+		}
+
+		if got := SlugifyKeep(string(test.Kept), keep); got != test.Kept {
+			t.Errorf("not round-trippable %q: got %q", test.Kept, got)
+		}
+		if err := slugifier.Validate(test.Kept); err != nil {
+			t.Errorf("Validate(%q): %v", test.Kept, err)
+		}
+		if err := ValidateSlug(test.Kept); err == nil {
+			t.Errorf("ValidateSlug(%q): expected error without kept symbols", test.Kept)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package kb
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// Statement is an xAPI statement about the progress of a learner
+type Statement struct {
+	ID        string          `json:"id,omitempty"`
+	Actor     json.RawMessage `json:"actor"`
+	Verb      StatementVerb   `json:"verb"`
+	Object    StatementObject `json:"object"`
+	Result    json.RawMessage `json:"result,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	// Stored is set when the statement is recorded
+	Stored time.Time `json:"stored"`
+}
+
+// StatementVerb is the action of a Statement
+type StatementVerb struct {
+	// ID is an IRI, e.g. http://adlnet.gov/expapi/verbs/completed
+	ID      string            `json:"id"`
+	Display map[string]string `json:"display,omitempty"`
+}
+
+// StatementObject is the activity of a Statement
+type StatementObject struct {
+	ObjectType string          `json:"objectType,omitempty"`
+	ID         string          `json:"id"`
+	Definition json.RawMessage `json:"definition,omitempty"`
+}
+
+// Validate checks whether the required fields are present
+func (statement *Statement) Validate() error {
+	switch {
+	case len(statement.Actor) == 0 || string(statement.Actor) == "null":
+		return errors.New("Statement actor missing.")
+	case statement.Verb.ID == "":
+		return errors.New("Statement verb id missing.")
+	case statement.Object.ID == "":
+		return errors.New("Statement object id missing.")
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package kb
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestStatementValidate(t *testing.T) {
+	var statement Statement
+	err := json.Unmarshal([]byte(`{
+		"actor": {"mbox": "mailto:alice@example.com"},
+		"verb": {"id": "http://adlnet.gov/expapi/verbs/completed"},
+		"object": {"id": "http://example.com/lessons/abc"}
+	}`), &statement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := statement.Validate(); err != nil {
+		t.Errorf("valid statement: %v", err)
+	}
+
+	missing := statement
+	missing.Verb.ID = ""
+	if err := missing.Validate(); err == nil {
+		t.Error("expected error for missing verb")
+	}
+
+	missing = statement
+	missing.Actor = nil
+	if err := missing.Validate(); err == nil {
+		t.Error("expected error for missing actor")
+	}
+}
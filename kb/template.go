@@ -0,0 +1,58 @@
+package kb
+
+import (
+	"regexp"
+	"time"
+)
+
+var rxTemplateVar = regexp.MustCompile(`\{\{\s*([\w-]+)\s*\}\}`)
+
+// ExpandTemplateVars replaces {{name}} in text with vars[name],
+// unknown names are kept as is
+func ExpandTemplateVars(text string, vars map[string]string) string {
+	return rxTemplateVar.ReplaceAllStringFunc(text, func(match string) string {
+		name := rxTemplateVar.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// InstantiateTemplate creates a new page with the content of template.
+// Variables are expanded in the title and in the text of items,
+// including nested stories, and every item gets a new id.
+// The page starts at version 1 and is modified now.
+func InstantiateTemplate(template *Page, slug Slug, vars map[string]string) *Page {
+	page := &Page{
+		Slug:     slug,
+		Title:    ExpandTemplateVars(template.Title, vars),
+		Version:  1,
+		Story:    instantiateStory(template.Story, vars),
+		Modified: time.Now(),
+	}
+	if page.Title == "" {
+		_, title, _ := TokenizeLink3(string(slug))
+		page.Title = SlugToTitle(title)
+	}
+	return page
+}
+
+func instantiateStory(story Story, vars map[string]string) Story {
+	instance := make(Story, 0, len(story))
+	for _, item := range story {
+		copied := Item{}
+		for key, value := range item {
+			if text, ok := value.(string); ok && key != "id" && key != "type" {
+				value = ExpandTemplateVars(text, vars)
+			}
+			copied[key] = value
+		}
+		if nested := nestedStory(item); nested != nil {
+			copied["story"] = instantiateStory(nested, vars)
+		}
+		copied["id"] = NewID()
+		instance = append(instance, copied)
+	}
+	return instance
+}
@@ -0,0 +1,69 @@
+package kb
+
+import "testing"
+
+func TestExpandTemplateVars(t *testing.T) {
+	vars := map[string]string{"product": "Billing", "version": "2.1"}
+	got := ExpandTemplateVars("{{product}} {{ version }} uses {{unknown}}.", vars)
+	if exp := "Billing 2.1 uses {{unknown}}."; got != exp {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+}
+
+func TestInstantiateTemplate(t *testing.T) {
+	template := &Page{
+		Slug:  "templates=release-notes",
+		Title: "{{product}} Release Notes",
+		Story: Story{
+			Paragraph("Changes in {{product}} {{version}}."),
+			Tags("{{product}}", "release"),
+			Entry("Previous release", "", "help=previous"),
+		},
+	}
+	section := Paragraph("Known issues of {{product}}.")
+	template.Story.Append(Item{
+		"id":    NewID(),
+		"type":  "section",
+		"story": Story{section},
+	})
+
+	page := InstantiateTemplate(template, "help=billing-2-1", map[string]string{
+		"product": "Billing",
+		"version": "2.1",
+	})
+
+	if page.Slug != "help=billing-2-1" || page.Title != "Billing Release Notes" {
+		t.Errorf("got %q %q", page.Slug, page.Title)
+	}
+	if got := page.Story[0].Val("text"); got != "Changes in Billing 2.1." {
+		t.Errorf("paragraph: got %q", got)
+	}
+	if got := page.Story[1].Val("text"); got != "Billing, release" {
+		t.Errorf("tags: got %q", got)
+	}
+	nested := nestedStory(page.Story[3])
+	if len(nested) != 1 || nested[0].Val("text") != "Known issues of Billing." {
+		t.Errorf("nested: got %v", nested)
+	}
+
+	originals := append(Story{}, template.Story...)
+	originals = append(originals, section)
+	items := append(Story{}, page.Story...)
+	items = append(items, nested...)
+
+	ids := map[string]bool{}
+	for i, item := range items {
+		if item.ID() == "" || item.ID() == originals[i].ID() || ids[item.ID()] {
+			t.Errorf("item %d: id %q is not new", i, item.ID())
+		}
+		ids[item.ID()] = true
+	}
+	if template.Story[0].Val("text") != "Changes in {{product}} {{version}}." {
+		t.Errorf("template was modified")
+	}
+
+	untitled := InstantiateTemplate(&Page{}, "help=getting-started", nil)
+	if untitled.Title != "Getting Started" {
+		t.Errorf("title from slug: got %q", untitled.Title)
+	}
+}
@@ -0,0 +1,86 @@
+package kb
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// TLSConfig describes certificates for serving https directly,
+// instead of terminating TLS at a proxy
+type TLSConfig struct {
+	CertFile string
+	KeyFile  string
+
+	// Domains restricts the accepted server names to
+	// the listed domains and their subdomains
+	Domains []string
+}
+
+// ParseTLSConfig creates configuration from flag values,
+// domains are separated by commas
+func ParseTLSConfig(certfile, keyfile, domains string) (TLSConfig, error) {
+	conf := TLSConfig{
+		CertFile: strings.TrimSpace(certfile),
+		KeyFile:  strings.TrimSpace(keyfile),
+	}
+	for _, domain := range strings.Split(domains, ",") {
+		domain = strings.ToLower(strings.TrimSpace(domain))
+		if domain != "" {
+			conf.Domains = append(conf.Domains, domain)
+		}
+	}
+
+	if (conf.CertFile == "") != (conf.KeyFile == "") {
+		return conf, errors.New("both certificate and key file must be specified")
+	}
+	if !conf.Enabled() && len(conf.Domains) > 0 {
+		return conf, errors.New("domains specified without certificate")
+	}
+	return conf, nil
+}
+
+// Enabled returns whether TLS has been configured
+func (conf TLSConfig) Enabled() bool {
+	return conf.CertFile != "" && conf.KeyFile != ""
+}
+
+// HostPolicy returns a policy that accepts the domains and their subdomains,
+// the signature matches autocert.HostPolicy
+func HostPolicy(domains ...string) func(ctx context.Context, host string) error {
+	return func(ctx context.Context, host string) error {
+		host = strings.ToLower(strings.TrimSuffix(host, "."))
+		for _, domain := range domains {
+			if host == domain || strings.HasSuffix(host, "."+domain) {
+				return nil
+			}
+		}
+		return fmt.Errorf("host %q not allowed", host)
+	}
+}
+
+// Config loads the certificate and creates the tls.Config
+func (conf TLSConfig) Config() (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(conf.CertFile, conf.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+	}
+	if len(conf.Domains) > 0 {
+		policy := HostPolicy(conf.Domains...)
+		config.GetCertificate = func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if err := policy(context.Background(), hello.ServerName); err != nil {
+				return nil, err
+			}
+			return &cert, nil
+		}
+		config.Certificates = nil
+	}
+	return config, nil
+}
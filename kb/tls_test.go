@@ -0,0 +1,58 @@
+package kb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestParseTLSConfig(t *testing.T) {
+	conf, err := ParseTLSConfig("cert.pem", "key.pem", " KB.example.com, ,other.org ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !conf.Enabled() {
+		t.Errorf("expected TLS to be enabled")
+	}
+	if exp := []string{"kb.example.com", "other.org"}; !reflect.DeepEqual(conf.Domains, exp) {
+		t.Errorf("got domains %v, expected %v", conf.Domains, exp)
+	}
+
+	conf, err = ParseTLSConfig("", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.Enabled() {
+		t.Errorf("expected TLS to be disabled")
+	}
+
+	if _, err := ParseTLSConfig("cert.pem", "", ""); err == nil {
+		t.Errorf("expected error for missing key file")
+	}
+	if _, err := ParseTLSConfig("", "", "kb.example.com"); err == nil {
+		t.Errorf("expected error for domains without certificate")
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	policy := HostPolicy("kb.example.com")
+
+	cases := []struct {
+		Host    string
+		Allowed bool
+	}{
+		{"kb.example.com", true},
+		{"KB.Example.com.", true},
+		{"acme.kb.example.com", true},
+		{"example.com", false},
+		{"evilkb.example.com", false},
+		{"kb.example.com.evil.org", false},
+	}
+
+	for _, test := range cases {
+		err := policy(context.Background(), test.Host)
+		if allowed := err == nil; allowed != test.Allowed {
+			t.Errorf("%q: got allowed %v, expected %v", test.Host, allowed, test.Allowed)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"flag"
@@ -9,8 +10,11 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"regexp"
 	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/raintreeinc/knowledgebase/auth"
@@ -40,14 +44,51 @@ var (
 	database = flag.String("database", "user=root dbname=knowledgebase sslmode=disable", "database `params`")
 	domain   = flag.String("domain", "", "`domain`")
 
+	rightsCacheSize = flag.Int("rights-cache-size", pgdb.DefaultRightsCacheSize, "number of cached user rights, 0 disables caching")
+	rightsCacheTTL  = flag.Duration("rights-cache-ttl", pgdb.DefaultRightsCacheTTL, "how long user rights are cached")
+
+	dbMaxOpenConns    = flag.Int("db-max-open-conns", pgdb.DefaultMaxOpenConns, "maximum open database connections, 0 is unlimited")
+	dbMaxIdleConns    = flag.Int("db-max-idle-conns", pgdb.DefaultMaxIdleConns, "maximum idle database connections")
+	dbConnMaxLifetime = flag.Duration("db-conn-max-lifetime", pgdb.DefaultConnMaxLifetime, "how long a database connection is reused, 0 is forever")
+
+	memoryIndex = flag.Bool("memory-index", false, "serve page listings and recent changes from memory")
+
+	slowQuery = flag.Duration("slow-query", 0, "log database queries taking longer than `duration`, 0 disables logging")
+
+	referenceSites = flag.String("reference-sites", "", "comma separated `sites` allowed in reference items of new pages, empty allows any")
+
 	redirecthttps = flag.Bool("redirecthttps", false, "redirect http to https")
 
+	tlsCert    = flag.String("tls-cert", "", "TLS certificate `file`, serves https when specified")
+	tlsKey     = flag.String("tls-key", "", "TLS key `file`")
+	tlsDomains = flag.String("tls-domains", "", "comma separated `domains` accepted by TLS, including subdomains")
+
+	rateLimit = flag.Float64("rate-limit", 0, "requests per second allowed per user, 0 disables limiting")
+	rateBurst = flag.Int("rate-burst", 20, "requests per user served in a burst")
+
+	accessLog = flag.Bool("access-log", false, "write a JSON access log line per request to stdout")
+
+	allowedOrigins = flag.String("allowed-origins", "", "comma separated `origins` allowed to make cross-origin requests, e.g. https://*.example.com")
+
+	shutdownTimeout = flag.Duration("shutdown-timeout", 30*time.Second, "how long to wait for in-flight requests on shutdown")
+
 	development = flag.Bool("development", true, "development mode")
 	ditamap     = flag.String("dita", "", "ditamap file for showing live dita")
 
 	rules = flag.String("rules", "rules.json", "different rules for server")
 
 	clientdir = flag.String("client", "client", "client `directory`")
+
+	lmsBackend     = flag.String("lms-backend", "", "`storage` for LMS uploads, s3 or filesystem, defaults to $KB_LMS_BACKEND")
+	lmsDir         = flag.String("lms-dir", "", "`directory` for the LMS filesystem storage, defaults to $KB_LMS_DIR")
+	lmsBucket      = flag.String("lms-bucket", "", "S3 `bucket` for LMS lessons, defaults to $AWS_KB_BUCKET")
+	lmsVideoBucket = flag.String("lms-video-bucket", "", "S3 `bucket` for LMS videos, defaults to $AWS_KB_VIDEO_BUCKET")
+	lmsRegion      = flag.String("lms-region", "", "S3 `region` for LMS, defaults to $AWS_REGION")
+	lmsPrefix      = flag.String("lms-prefix", "", "`folder` for LMS lessons, defaults to $AWS_KB_PREFIX")
+	lmsVideoPrefix = flag.String("lms-video-prefix", "", "`folder` for LMS videos, defaults to $AWS_KB_VIDEO_PREFIX")
+	lmsVideoGroup  = flag.String("lms-video-group", "", "`group` whose readers may watch LMS videos, defaults to $KB_LMS_VIDEO_GROUP, empty allows every user")
+	lmsLessonGroup = flag.String("lms-lesson-group", "", "`group` whose editors may delete LMS lessons, defaults to $KB_LMS_LESSON_GROUP")
+	lmsWebhook     = flag.String("lms-webhook", "", "`url` notified about LMS uploads, defaults to $KB_LMS_WEBHOOK")
 )
 
 func main() {
@@ -100,22 +141,45 @@ func main() {
 	if err != nil {
 		log.Fatal(err)
 	}
+	db.CacheRights(*rightsCacheSize, *rightsCacheTTL)
+	db.ConfigurePool(pgdb.PoolConfig{
+		MaxOpenConns:    *dbMaxOpenConns,
+		MaxIdleConns:    *dbMaxIdleConns,
+		ConnMaxLifetime: *dbConnMaxLifetime,
+	})
+	db.CacheIndex(*memoryIndex)
+	if *slowQuery > 0 {
+		db.ObserveQueries(pgdb.SlowQueryLogger(*slowQuery))
+	}
+	if *referenceSites != "" {
+		sites := map[string]bool{*domain: true}
+		for _, site := range strings.Split(*referenceSites, ",") {
+			sites[strings.TrimSpace(site)] = true
+		}
+		db.ValidateReferences(func(site string) bool { return sites[site] })
+	}
 
 	log.Println("Initializing DB")
 	if err := db.Initialize(); err != nil {
 		log.Fatal(err)
 	}
+	if err := db.BuildIndex(); err != nil {
+		log.Fatal(err)
+	}
 	log.Println("DB Initialization complete.")
 
 	http.HandleFunc("/system/health", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "OK")
 	})
+	http.Handle("/healthz", kb.HealthHandler())
+	http.Handle("/readyz", kb.ReadyHandler(db))
 
 	// start auth server
 	ruleset := MustLoadRules(*rules)
 	authServer := auth.NewServer(ruleset, db)
+	limiter := kb.NewRateLimiter(*rateLimit, *rateBurst)
 	http.Handle("/system/auth/",
-		http.StripPrefix("/system/auth", authServer))
+		limiter.LimitByAddr(http.StripPrefix("/system/auth", authServer)))
 
 	if key := os.Getenv("GPLUS_KEY"); key != "" {
 		authServer.Provider["google"] = &provider.Google{
@@ -153,6 +217,7 @@ func main() {
 
 	// create server
 	server := kb.NewServer(authServer, db)
+	server.RateLimit = limiter
 
 	// add systems
 	server.AddModule(admin.New(server))
@@ -161,7 +226,20 @@ func main() {
 	server.AddModule(search.New(server))
 	server.AddModule(tag.New(server))
 	server.AddModule(user.New(server))
-	server.AddModule(lms.New(server))
+	server.AddModule(lms.New(server, lms.Config{
+		CreateGuest: os.Getenv("LMSTOKEN") != "",
+
+		Backend:     *lmsBackend,
+		Dir:         *lmsDir,
+		Bucket:      *lmsBucket,
+		VideoBucket: *lmsVideoBucket,
+		Region:      *lmsRegion,
+		Prefix:      *lmsPrefix,
+		VideoPrefix: *lmsVideoPrefix,
+		VideoGroup:  kb.Slug(*lmsVideoGroup),
+		LessonGroup: kb.Slug(*lmsLessonGroup),
+		WebhookURL:  *lmsWebhook,
+	}))
 	server.AddModule(dispatch.New(kb.Group{
 		ID:          "help",
 		Name:        "Help",
@@ -188,7 +266,49 @@ func main() {
 		}
 		server.ServeHTTP(w, r)
 	})
-	log.Fatal(http.ListenAndServe(*addr, nil))
+
+	tlsconf, err := kb.ParseTLSConfig(*tlsCert, *tlsKey, *tlsDomains)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var handler http.Handler = http.DefaultServeMux
+	if origins := kb.ParseOrigins(*allowedOrigins); len(origins) > 0 {
+		handler = kb.AllowOrigins(origins, handler)
+	}
+	if *accessLog {
+		handler = kb.AccessLog(os.Stdout, handler)
+	}
+	httpServer := &http.Server{Addr: *addr, Handler: handler}
+	if tlsconf.Enabled() {
+		httpServer.TLSConfig, err = tlsconf.Config()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	go func() {
+		var err error
+		if tlsconf.Enabled() {
+			err = httpServer.ListenAndServeTLS("", "")
+		} else {
+			err = httpServer.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	<-stop
+
+	log.Println("Shutting down")
+	ctx, cancel := context.WithTimeout(context.Background(), *shutdownTimeout)
+	defer cancel()
+	if err := kb.Shutdown(ctx, httpServer, db); err != nil {
+		log.Fatal(err)
+	}
 }
 
 type RuleSet struct {
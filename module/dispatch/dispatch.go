@@ -1,8 +1,12 @@
 package dispatch
 
 import (
+	"encoding/json"
+	"html"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/raintreeinc/knowledgebase/internal/natural"
 	"github.com/raintreeinc/knowledgebase/kb"
@@ -10,15 +14,23 @@ import (
 
 var _ kb.Module = &Module{}
 
+// DefaultVersionLimit is the number of versions listed before "Show all"
+const DefaultVersionLimit = 20
+
 type Module struct {
 	group  kb.Group
 	server *kb.Server
+
+	// VersionLimit caps the listed versions, <= 0 lists everything
+	VersionLimit int
 }
 
 func New(group kb.Group, server *kb.Server) *Module {
 	mod := &Module{
 		group:  group,
 		server: server,
+
+		VersionLimit: DefaultVersionLimit,
 	}
 	return mod
 }
@@ -49,38 +61,135 @@ func (mod *Module) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	kb.SortPageEntries(entries, func(a, b *kb.PageEntry) bool {
-		return natural.Less(string(b.Slug), string(a.Slug))
-	})
+	versions := mod.versions(entries)
+	if r.URL.Query().Get("sort") == "modified" {
+		kb.SortPageEntries(versions, func(a, b *kb.PageEntry) bool {
+			if !a.Modified.Equal(b.Modified) {
+				return a.Modified.After(b.Modified)
+			}
+			return natural.Less(string(b.Slug), string(a.Slug))
+		})
+	} else {
+		kb.SortPageEntries(versions, func(a, b *kb.PageEntry) bool {
+			return natural.Less(string(b.Slug), string(a.Slug))
+		})
+	}
+
+	if r.URL.Query().Get("format") == "json" {
+		writeVersions(w, versions, mod.versionLabel)
+		return
+	}
 
 	page := &kb.Page{Slug: pageID}
-	if len(entries) > 0 {
-		page.Title = entries[0].Title
-		if len(entries[0].Tags) > 0 {
-			page.Story.Append(kb.Tags(entries[0].Tags...))
+	if len(versions) > 0 {
+		page.Title = versions[0].Title
+		if len(versions[0].Tags) > 0 {
+			page.Story.Append(kb.Tags(versions[0].Tags...))
 		}
-		if entries[0].Synopsis != "" {
-			page.Story.Append(kb.Paragraph(entries[0].Synopsis))
+		// paragraph text is rendered as html, but synopsis is plain text
+		if versions[0].Synopsis != "" {
+			page.Story.Append(kb.Paragraph(html.EscapeString(versions[0].Synopsis)))
 		}
 	} else {
 		page.Title = kb.SlugToTitle(titleID)
 	}
 
-	if len(entries) == 0 {
+	if len(versions) == 0 {
 		page.Story.Append(kb.Paragraph("No pages."))
+
+		// a misspelled link should still lead somewhere
+		all, err := index.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		suggestions := mod.suggest(titleID, all)
+		if len(suggestions) > 0 {
+			page.Story.Append(kb.HTML("<h2>Did you mean</h2>"))
+			for _, suggestion := range suggestions {
+				page.Story.Append(kb.Entry(suggestion.Title, "", suggestion.Slug))
+			}
+		}
 	} else {
 		page.Story.Append(kb.HTML("<h2>Versions</h2>"))
 
-		prefix := string(mod.group.ID + "-")
-		for _, entry := range entries {
-			if !strings.HasPrefix(string(entry.Slug), prefix) {
-				continue
-			}
-			groupID, _ := kb.TokenizeLink(string(entry.Slug))
-			title := strings.TrimPrefix(string(groupID), prefix)
-			page.Story.Append(kb.Entry(title, "", entry.Slug))
+		shown := versions
+		_, all := r.URL.Query()["all"]
+		if !all && mod.VersionLimit > 0 && len(shown) > mod.VersionLimit {
+			shown = shown[:mod.VersionLimit]
+		}
+		for _, entry := range shown {
+			page.Story.Append(kb.Entry(mod.versionLabel(entry.Slug), "", entry.Slug))
+		}
+
+		if len(shown) < len(versions) {
+			query := r.URL.Query()
+			query.Set("all", "")
+			page.Story.Append(kb.Reference("Show all versions",
+				r.URL.Path+"?"+query.Encode(),
+				"Showing "+strconv.Itoa(len(shown))+" of "+strconv.Itoa(len(versions))+" versions."))
 		}
 	}
 
 	page.WriteResponse(w)
 }
+
+// Version is a single entry in the JSON listing of versions
+type Version struct {
+	Slug     kb.Slug   `json:"slug"`
+	Version  string    `json:"version"`
+	Title    string    `json:"title"`
+	Tags     []string  `json:"tags"`
+	Modified time.Time `json:"modified"`
+}
+
+// writeVersions writes the entries as a JSON array of Version.
+//
+// The web client requests pages with "Accept: application/json",
+// hence the JSON listing is selected with ?format=json instead.
+func writeVersions(w http.ResponseWriter, entries []kb.PageEntry, label func(kb.Slug) string) {
+	result := []Version{}
+	for _, entry := range entries {
+		tags := entry.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		result = append(result, Version{
+			Slug:     entry.Slug,
+			Version:  label(entry.Slug),
+			Title:    entry.Title,
+			Tags:     tags,
+			Modified: entry.Modified,
+		})
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		kb.WriteResult(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// versions returns entries that belong to a group of this module,
+// e.g. help-8-4=page for module help
+func (mod *Module) versions(entries []kb.PageEntry) []kb.PageEntry {
+	prefix := string(mod.group.ID) + "-"
+	versions := []kb.PageEntry{}
+	for _, entry := range entries {
+		owner, _ := kb.TokenizeLink(string(entry.Slug))
+		if strings.HasPrefix(string(owner), prefix) && len(owner) > len(prefix) {
+			versions = append(versions, entry)
+		}
+	}
+	return versions
+}
+
+// versionLabel returns the version part of the page owner,
+// e.g. "8-4" for help-8-4=page
+func (mod *Module) versionLabel(slug kb.Slug) string {
+	owner, _ := kb.TokenizeLink(string(slug))
+	return strings.TrimPrefix(string(owner), string(mod.group.ID)+"-")
+}
@@ -0,0 +1,300 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type testAuth struct{}
+
+func (testAuth) Verify(w http.ResponseWriter, r *http.Request) (kb.User, error) {
+	return kb.User{ID: "alice"}, nil
+}
+
+type testDatabase struct{ index *testIndex }
+
+func (db testDatabase) Context(user kb.Slug) kb.Context {
+	return testContext{user: user, index: db.index}
+}
+
+type testContext struct {
+	kb.Context
+	user  kb.Slug
+	index *testIndex
+}
+
+func (context testContext) ActiveUserID() kb.Slug       { return context.user }
+func (context testContext) Index(user kb.Slug) kb.Index { return context.index }
+
+type testIndex struct {
+	kb.Index
+	entries []kb.PageEntry
+}
+
+func (index *testIndex) ByTitle(suffix kb.Slug) ([]kb.PageEntry, error) {
+	matches := []kb.PageEntry{}
+	for _, entry := range index.entries {
+		_, title, _ := kb.TokenizeLink3(string(entry.Slug))
+		if title == suffix {
+			matches = append(matches, entry)
+		}
+	}
+	return matches, nil
+}
+
+func (index *testIndex) List() ([]kb.PageEntry, error) {
+	return append([]kb.PageEntry{}, index.entries...), nil
+}
+
+func newTestModule(entries ...kb.PageEntry) *Module {
+	index := &testIndex{entries: entries}
+	return New(kb.Group{ID: "help", Name: "Help"}, kb.NewServer(testAuth{}, testDatabase{index}))
+}
+
+func serve(t *testing.T, mod *Module, url string) *kb.Page {
+	t.Helper()
+	r := httptest.NewRequest("GET", url, nil)
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: got status %d: %s", url, w.Code, w.Body.String())
+	}
+
+	page := &kb.Page{}
+	if err := json.Unmarshal(w.Body.Bytes(), page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func itemsOfType(page *kb.Page, typ string) []kb.Item {
+	items := []kb.Item{}
+	for _, item := range page.Story {
+		if item.Type() == typ {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func versionTitles(page *kb.Page) []string {
+	titles := []string{}
+	for _, item := range itemsOfType(page, "entry") {
+		titles = append(titles, item.Val("title"))
+	}
+	return titles
+}
+
+func versionEntries() []kb.PageEntry {
+	day := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []kb.PageEntry{
+		{Slug: "help-8-4=setup", Title: "Setup", Modified: day.Add(1 * time.Hour)},
+		{Slug: "help-10-0=setup", Title: "Setup", Synopsis: "Latest", Modified: day.Add(2 * time.Hour)},
+		{Slug: "help-9-1=setup", Title: "Setup", Modified: day.Add(3 * time.Hour)},
+		{Slug: "community=setup", Title: "Community setup", Modified: day.Add(4 * time.Hour)},
+		{Slug: "help-9-0=setup", Title: "Setup", Modified: day},
+	}
+}
+
+func TestVersionsOrder(t *testing.T) {
+	mod := newTestModule(versionEntries()...)
+
+	page := serve(t, mod, "/help=setup")
+	if page.Title != "Setup" {
+		t.Errorf("got title %q", page.Title)
+	}
+	exp := []string{"10-0", "9-1", "9-0", "8-4"}
+	if got := versionTitles(page); !reflect.DeepEqual(got, exp) {
+		t.Errorf("by slug: got %v, expected %v", got, exp)
+	}
+	if items := itemsOfType(page, "paragraph"); len(items) != 1 || items[0].Val("text") != "Latest" {
+		t.Errorf("expected synopsis of the latest version, got %v", items)
+	}
+
+	page = serve(t, mod, "/help=setup?sort=modified")
+	exp = []string{"9-1", "10-0", "8-4", "9-0"}
+	if got := versionTitles(page); !reflect.DeepEqual(got, exp) {
+		t.Errorf("by modified: got %v, expected %v", got, exp)
+	}
+}
+
+func TestVersionsLimit(t *testing.T) {
+	mod := newTestModule(versionEntries()...)
+	mod.VersionLimit = 2
+
+	page := serve(t, mod, "/help=setup")
+	exp := []string{"10-0", "9-1"}
+	if got := versionTitles(page); !reflect.DeepEqual(got, exp) {
+		t.Errorf("limited: got %v, expected %v", got, exp)
+	}
+	refs := itemsOfType(page, "reference")
+	if len(refs) != 1 || refs[0].Val("url") != "/help=setup?all=" {
+		t.Fatalf("expected a show all link, got %v", refs)
+	}
+
+	page = serve(t, mod, refs[0].Val("url"))
+	if got := versionTitles(page); len(got) != 4 {
+		t.Errorf("show all: got %v", got)
+	}
+	if refs := itemsOfType(page, "reference"); len(refs) != 0 {
+		t.Errorf("show all: unexpected reference %v", refs)
+	}
+}
+
+func TestVersionsEmpty(t *testing.T) {
+	mod := newTestModule(kb.PageEntry{Slug: "community=setup", Title: "Community setup"})
+
+	page := serve(t, mod, "/help=setup")
+	if page.Title != "Setup" {
+		t.Errorf("got title %q", page.Title)
+	}
+	if got := versionTitles(page); len(got) != 0 {
+		t.Errorf("expected no versions, got %v", got)
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	mod := newTestModule(kb.PageEntry{
+		Slug:     "help-9-0=fees-and-charges",
+		Title:    "Fees & <Charges>",
+		Synopsis: "Use <b>only</b> when x < y & y > z.",
+	})
+
+	page := serve(t, mod, "/help=fees-and-charges")
+	if page.Title != "Fees & <Charges>" {
+		t.Errorf("got title %q", page.Title)
+	}
+
+	items := itemsOfType(page, "paragraph")
+	if len(items) != 1 {
+		t.Fatalf("expected synopsis paragraph, got %v", page.Story)
+	}
+	exp := "Use &lt;b&gt;only&lt;/b&gt; when x &lt; y &amp; y &gt; z."
+	if got := items[0].Val("text"); got != exp {
+		t.Errorf("got synopsis %q, expected %q", got, exp)
+	}
+
+	if got := versionTitles(page); !reflect.DeepEqual(got, []string{"9-0"}) {
+		t.Errorf("got versions %v", got)
+	}
+}
+
+func TestVersionsJSON(t *testing.T) {
+	mod := newTestModule(versionEntries()...)
+	mod.VersionLimit = 2
+
+	r := httptest.NewRequest("GET", "/help=setup?format=json&sort=modified", nil)
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("got content type %q", ct)
+	}
+
+	var versions []Version
+	if err := json.Unmarshal(w.Body.Bytes(), &versions); err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, version := range versions {
+		got = append(got, string(version.Slug)+" "+version.Version)
+	}
+	exp := []string{"help-9-1=setup 9-1", "help-10-0=setup 10-0", "help-8-4=setup 8-4", "help-9-0=setup 9-0"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v, expected %v", got, exp)
+	}
+	if versions[0].Title != "Setup" || versions[0].Modified.IsZero() || versions[0].Tags == nil {
+		t.Errorf("incomplete version %+v", versions[0])
+	}
+}
+
+func TestVersionsDefaultFormat(t *testing.T) {
+	mod := newTestModule(versionEntries()...)
+
+	r := httptest.NewRequest("GET", "/help=setup", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, r)
+
+	page := &kb.Page{}
+	if err := json.Unmarshal(w.Body.Bytes(), page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Slug != "help=setup" || len(versionTitles(page)) != 4 {
+		t.Errorf("expected the page with story, got %+v", page)
+	}
+}
+
+func TestSuggestionsExact(t *testing.T) {
+	mod := newTestModule(versionEntries()...)
+
+	page := serve(t, mod, "/help=setup")
+	for _, item := range itemsOfType(page, "html") {
+		if strings.Contains(item.Val("text"), "Did you mean") {
+			t.Errorf("unexpected suggestions for an exact title: %v", page.Story)
+		}
+	}
+}
+
+func TestSuggestionsTypo(t *testing.T) {
+	entries := append(versionEntries(),
+		kb.PageEntry{Slug: "help-9-0=backup", Title: "Backup"},
+		kb.PageEntry{Slug: "help-9-0=installation", Title: "Installation"},
+	)
+	mod := newTestModule(entries...)
+
+	page := serve(t, mod, "/help=setyp")
+	if got := versionTitles(page); !reflect.DeepEqual(got, []string{"Setup"}) {
+		t.Fatalf("got suggestions %v", got)
+	}
+	if slug := itemsOfType(page, "entry")[0].Val("link"); slug != "help=setup" {
+		t.Errorf("got suggestion link %q", slug)
+	}
+}
+
+func TestSuggestLimit(t *testing.T) {
+	entries := []kb.PageEntry{}
+	for _, title := range []string{"pages", "paged", "pager", "paget", "pagen", "pagex", "pageant"} {
+		entries = append(entries, kb.PageEntry{Slug: kb.Slug("help-1-0=" + title), Title: title})
+	}
+	mod := newTestModule()
+
+	suggestions := mod.suggest("page", entries)
+	if len(suggestions) != MaxSuggestions {
+		t.Fatalf("got %d suggestions, expected %d", len(suggestions), MaxSuggestions)
+	}
+	for _, suggestion := range suggestions {
+		if suggestion.Distance != 1 {
+			t.Errorf("got %+v, closest titles should come first", suggestion)
+		}
+	}
+}
+
+func TestLevenshtein(t *testing.T) {
+	tests := []struct {
+		a, b string
+		exp  int
+	}{
+		{"", "", 0},
+		{"setup", "setup", 0},
+		{"setup", "setyp", 1},
+		{"setup", "setu", 1},
+		{"setup", "sertup", 1},
+		{"kitten", "sitting", 3},
+		{"", "abc", 3},
+	}
+	for _, test := range tests {
+		if got := levenshtein(test.a, test.b); got != test.exp {
+			t.Errorf("levenshtein(%q, %q) = %d, expected %d", test.a, test.b, got, test.exp)
+		}
+	}
+}
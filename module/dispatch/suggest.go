@@ -0,0 +1,109 @@
+package dispatch
+
+import (
+	"sort"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// MaxSuggestions caps the "did you mean" suggestions for a missing title
+const MaxSuggestions = 5
+
+// Suggestion is a title of this module that is close to a missing title
+type Suggestion struct {
+	// Slug is the dispatch page of the title, e.g. help=setup
+	Slug  kb.Slug
+	Title string
+	// Distance is the number of edits from the requested title
+	Distance int
+}
+
+// suggest returns the closest titles of module versions in entries,
+// at most MaxSuggestions are returned
+func (mod *Module) suggest(titleID kb.Slug, entries []kb.PageEntry) []Suggestion {
+	limit := allowedDistance(titleID)
+
+	closest := map[kb.Slug]Suggestion{}
+	for _, entry := range mod.versions(entries) {
+		_, title, _ := kb.TokenizeLink3(string(entry.Slug))
+		if title == titleID {
+			continue
+		}
+		if _, seen := closest[title]; seen {
+			continue
+		}
+
+		distance := levenshtein(string(titleID), string(title))
+		if distance > limit {
+			continue
+		}
+		closest[title] = Suggestion{
+			Slug:     mod.group.ID + "=" + title,
+			Title:    entry.Title,
+			Distance: distance,
+		}
+	}
+
+	suggestions := make([]Suggestion, 0, len(closest))
+	for _, suggestion := range closest {
+		suggestions = append(suggestions, suggestion)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		a, b := suggestions[i], suggestions[j]
+		if a.Distance != b.Distance {
+			return a.Distance < b.Distance
+		}
+		return a.Slug < b.Slug
+	})
+	if len(suggestions) > MaxSuggestions {
+		suggestions = suggestions[:MaxSuggestions]
+	}
+	return suggestions
+}
+
+// allowedDistance returns how many edits are tolerated for a title,
+// short titles allow a single typo
+func allowedDistance(titleID kb.Slug) int {
+	n := len([]rune(string(titleID))) / 4
+	if n < 1 {
+		return 1
+	}
+	if n > 3 {
+		return 3
+	}
+	return n
+}
+
+// levenshtein returns the number of single rune insertions,
+// deletions and substitutions needed to change a into b
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	next := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		next[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			next[j] = min3(prev[j]+1, next[j-1]+1, prev[j-1]+cost)
+		}
+		prev, next = next, prev
+	}
+	return prev[len(rb)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"sort"
+	"strings"
 
 	"github.com/raintreeinc/ditaconvert"
 	"github.com/raintreeinc/knowledgebase/kb"
@@ -19,15 +20,28 @@ const (
 type Conversion struct {
 	Group   kb.Slug
 	Ditamap string
+	// SlugOverrides assigns slugs to topics by filename, regardless of their title
+	SlugOverrides map[string]kb.Slug
+	// HierarchicalSlugs prefixes slugs with the titles of the containing sections,
+	// e.g. "billing/posting-charges"
+	HierarchicalSlugs bool
+	// Titelize rewrites titles before they are converted to slugs,
+	// when nil titles are used as is
+	Titelize func(title string) string
 
 	Pages map[kb.Slug]*kb.Page
 	Raw   map[kb.Slug][]byte
 	Slugs []kb.Slug
 	Nav   *index.Item
-
-	LoadErrors    []error
-	MappingErrors []error
-	Errors        []ConversionError
+	// TopicSlugs maps topic paths to the slugs of their pages
+	TopicSlugs map[string]kb.Slug
+
+	LoadErrors      []error
+	MappingWarnings []error
+	MappingErrors   []error
+	Errors          []ConversionError
+	// UnresolvedLinks lists broken links of all pages
+	UnresolvedLinks []UnresolvedLink
 }
 
 func NewConversion(group kb.Slug, ditamap string) *Conversion {
@@ -39,6 +53,21 @@ func NewConversion(group kb.Slug, ditamap string) *Conversion {
 	}
 }
 
+// EnglishTitelize spells out symbols that would otherwise end up in slugs,
+// e.g. "Debits/Credits & Totals" becomes "Debits or Credits and Totals"
+var EnglishTitelize = strings.NewReplacer(
+	"/", " or ",
+	"&", " and ",
+).Replace
+
+// titleSlug converts a topic or section title to a slug
+func (context *Conversion) titleSlug(title string) kb.Slug {
+	if context.Titelize != nil {
+		title = context.Titelize(title)
+	}
+	return kb.Slugify(title)
+}
+
 type ConversionError struct {
 	Path   string
 	Slug   kb.Slug
@@ -53,17 +82,30 @@ func (context *Conversion) Run() {
 
 	context.LoadErrors = index.Errors
 
-	mapping, mappingErrors := RemapTitles(context, index)
+	mapping, mappingWarnings, mappingErrors := RemapTitles(context, index)
+	context.MappingWarnings = mappingWarnings
 	context.MappingErrors = mappingErrors
 
+	context.TopicSlugs = make(map[string]kb.Slug, len(mapping.ByTopic))
+	for topic, slug := range mapping.ByTopic {
+		context.TopicSlugs[topic.Path] = slug
+	}
+	if mapping.Glossary != nil {
+		for _, entry := range mapping.Glossary.Entries {
+			context.TopicSlugs[entry.Topic.Path] = kb.Slug(mapping.Glossary.Link(entry))
+		}
+	}
+
 	for slug, topic := range mapping.BySlug {
-		page, errs, fatal := (&PageConversion{
+		conversion := &PageConversion{
 			Conversion: context,
 			Mapping:    mapping,
 			Slug:       slug,
 			Index:      index,
 			Topic:      topic,
-		}).Convert()
+		}
+		page, errs, fatal := conversion.Convert()
+		context.UnresolvedLinks = append(context.UnresolvedLinks, conversion.UnresolvedLinks()...)
 
 		if fatal != nil {
 			context.Errors = append(context.Errors, ConversionError{
@@ -113,6 +155,21 @@ func (context *Conversion) Run() {
 		context.Slugs = append(context.Slugs, slug)
 	}
 
+	if mapping.Glossary != nil {
+		page, errs := ConvertGlossary(context, mapping, index)
+		if len(errs) > 0 {
+			context.Errors = append(context.Errors, ConversionError{
+				Slug:   page.Slug,
+				Errors: errs,
+			})
+		}
+		if data, err := json.Marshal(page); err == nil {
+			context.Pages[page.Slug] = page
+			context.Raw[page.Slug] = data
+			context.Slugs = append(context.Slugs, page.Slug)
+		}
+	}
+
 	sort.Slice(context.Slugs, func(i, j int) bool {
 		return context.Slugs[i] < context.Slugs[j]
 	})
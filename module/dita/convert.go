@@ -18,6 +18,31 @@ type PageConversion struct {
 	Index   *ditaconvert.Index
 	Topic   *ditaconvert.Topic
 	Context *ditaconvert.Context
+
+	unresolved []UnresolvedLink
+	// stepNumbers are the numbers of the list items being converted
+	stepNumbers []string
+}
+
+// UnresolvedLink is a link whose target topic or element was not found
+type UnresolvedLink struct {
+	// SourceTopic is the file containing the link
+	SourceTopic string
+	Href        string
+	Selector    string
+}
+
+// UnresolvedLinks lists the broken links found during Convert
+func (conversion *PageConversion) UnresolvedLinks() []UnresolvedLink {
+	return conversion.unresolved
+}
+
+func (conversion *PageConversion) addUnresolved(href, selector string) {
+	conversion.unresolved = append(conversion.unresolved, UnresolvedLink{
+		SourceTopic: conversion.Context.DecodingPath,
+		Href:        href,
+		Selector:    selector,
+	})
 }
 
 func (conversion *PageConversion) Convert() (page *kb.Page, errs []error, fatal error) {
@@ -33,9 +58,7 @@ func (conversion *PageConversion) Convert() (page *kb.Page, errs []error, fatal
 		Synopsis: topic.Synopsis,
 	}
 
-	context.Rules.Custom["a"] = conversion.ToSlug
-	context.Rules.Custom["img"] = conversion.InlineImage
-	context.Rules.Custom["imagemap"] = conversion.ConvertImageMap
+	context.Rules = conversion.Rules()
 
 	if err := context.Run(); err != nil {
 		return page, nil, err
@@ -53,6 +76,28 @@ func (conversion *PageConversion) Convert() (page *kb.Page, errs []error, fatal
 	return page, context.Errors, nil
 }
 
+// Rules returns the conversion rules of the knowledge base
+func (conversion *PageConversion) Rules() *ditaconvert.Rules {
+	return NewHTMLRulesWith(RuleOverrides{
+		Translate: hazardRules,
+		Callback: map[string]ditaconvert.TokenProcessor{
+			"a":                conversion.ToSlug,
+			"img":              conversion.InlineImage,
+			"imagemap":         conversion.ConvertImageMap,
+			"section":          conversion.ConvertSection,
+			"table":            conversion.ConvertTable,
+			"note":             conversion.ConvertNote,
+			"hazardstatement":  conversion.ConvertHazard,
+			"hazardsymbol":     conversion.ConvertHazardSymbol,
+			"term":             conversion.ConvertTerm,
+			"abbreviated-form": conversion.ConvertTerm,
+			"steps":            conversion.ConvertOrderedList,
+			"ol":               conversion.ConvertOrderedList,
+			"substeps":         conversion.ConvertSubsteps,
+		},
+	})
+}
+
 func (conversion *PageConversion) ConvertTags() []string {
 	raw := conversion.Topic.Original.Prolog.Keywords
 	for _, key := range conversion.Topic.Original.Prolog.ResourceID {
@@ -76,7 +121,16 @@ func (conversion *PageConversion) ToSlug(context *ditaconvert.Context, dec *xml.
 	var internal bool
 
 	href = getAttr(&start, "href")
-	if href != "" {
+	keyref := getAttr(&start, "keyref")
+	setAttr(&start, "keyref", "")
+
+	resolved := false
+	if keyref != "" {
+		// keyref takes precedence, href is only a fallback for undefined keys
+		href, title, desc, internal, resolved = conversion.ResolveKeyLinkInfo(keyref, href)
+		setAttr(&start, "href", href)
+	}
+	if !resolved && href != "" {
 		href, title, desc, internal = conversion.ResolveLinkInfo(href)
 		setAttr(&start, "href", href)
 	}
@@ -130,44 +184,180 @@ func (conversion *PageConversion) InlineImage(context *ditaconvert.Context, dec
 	href := getAttr(&start, "href")
 	setAttr(&start, "src", context.InlinedImageURL(href))
 	setAttr(&start, "href", "")
+	setAttr(&start, "width", imageDimension(getAttr(&start, "width")))
+	setAttr(&start, "height", imageDimension(getAttr(&start, "height")))
 
 	placement := getAttr(&start, "placement")
 	setAttr(&start, "placement", "")
-	if placement == "break" {
-		context.Encoder.WriteStart("p",
-			xml.Attr{Name: xml.Name{Local: "class"}, Value: "image"})
+
+	// img cannot have content, alt and title are moved to attributes or caption
+	var caption string
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ended := token.(xml.EndElement); ended {
+			break
+		}
+		child, isStart := token.(xml.StartElement)
+		if !isStart {
+			continue
+		}
+
+		var inner struct {
+			XML string `xml:",innerxml"`
+		}
+		if err := dec.DecodeElement(&inner, &child); err != nil {
+			return err
+		}
+		switch child.Name.Local {
+		case "alt":
+			setAttr(&start, "alt", textContent(inner.XML))
+		case "title":
+			caption = inner.XML
+		}
 	}
 
-	err := context.EmitWithChildren(dec, start)
+	if placement != "break" {
+		if caption != "" && getAttr(&start, "title") == "" {
+			setAttr(&start, "title", textContent(caption))
+		}
+		if err := context.Encoder.WriteStart("img", start.Attr...); err != nil {
+			return err
+		}
+		return context.Encoder.WriteEnd("img")
+	}
 
-	if placement == "break" {
-		context.Encoder.WriteEnd("p")
+	context.Encoder.WriteStart("p",
+		xml.Attr{Name: xml.Name{Local: "class"}, Value: "image"})
+	err := context.Encoder.WriteStart("img", start.Attr...)
+	if err == nil {
+		err = context.Encoder.WriteEnd("img")
+	}
+	if err == nil && caption != "" {
+		context.Encoder.WriteStart("figcaption")
+		err = context.Parse(caption)
+		context.Encoder.WriteEnd("figcaption")
 	}
+	context.Encoder.WriteEnd("p")
 
 	return err
 }
 
+// imageDimension converts a DITA width or height to an html attribute,
+// html dimensions are in pixels without an unit
+func imageDimension(value string) string {
+	return strings.TrimSuffix(strings.TrimSpace(value), "px")
+}
+
+// sections with this outputclass are converted to expandable details
+const collapsibleClass = "collapsible"
+
+func (conversion *PageConversion) ConvertSection(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	if getAttr(&start, "outputclass") != collapsibleClass {
+		start.Name.Local = "div"
+		setAttr(&start, "class", "section")
+		return context.EmitWithChildren(dec, start)
+	}
+
+	start.Name.Local = "details"
+	setAttr(&start, "class", "section "+collapsibleClass)
+	if err := context.Encoder.WriteXMLStart(&start); err != nil {
+		return err
+	}
+
+	hasSummary := false
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ended := token.(xml.EndElement); ended {
+			break
+		}
+
+		if title, isStart := token.(xml.StartElement); isStart && title.Name.Local == "title" && !hasSummary {
+			hasSummary = true
+			context.Encoder.WriteStart("summary",
+				xml.Attr{Name: xml.Name{Local: "class"}, Value: "sectiontitle"})
+			err = context.Recurse(dec)
+			context.Encoder.WriteEnd("summary")
+		} else {
+			err = context.Handle(dec, token)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	return context.Encoder.WriteEnd("details")
+}
+
 func (conversion *PageConversion) ResolveLinkInfo(url string) (href, title, synopsis string, internal bool) {
 	if strings.HasPrefix(url, "http:") || strings.HasPrefix(url, "https:") || strings.HasPrefix(url, "mailto:") {
 		return url, "", "", false
 	}
 	context := conversion.Context
 
-	var selector, hash string
+	var selector string
 	url, selector = ditaconvert.SplitLink(url)
-	if selector != "" {
-		hash = "#" + selector
-	}
 
 	name := context.DecodingPath
 	if url != "" {
 		name = path.Join(path.Dir(context.DecodingPath), url)
 	}
 
+	return conversion.resolveTopicLink(name, url, selector)
+}
+
+// ResolveKeyLinkInfo resolves keyref using the keydefs of the maps,
+// when the key is not defined it returns fallback unresolved
+func (conversion *PageConversion) ResolveKeyLinkInfo(keyref, fallback string) (href, title, synopsis string, internal, resolved bool) {
+	context := conversion.Context
+
+	// keyref is either "key" or "key/elementid"
+	key, element := keyref, ""
+	if i := strings.Index(keyref, "/"); i >= 0 {
+		key, element = keyref[:i], keyref[i+1:]
+	}
+
+	target, ok := context.Index.KeyDef[key]
+	if !ok {
+		context.Errors = append(context.Errors,
+			fmt.Errorf("keydef missing for %v (%v)", key, keyref))
+		return fallback, "", "", false, false
+	}
+
+	// keydef targets are relative to the index root, not the decoding path
+	name, selector := ditaconvert.SplitLink(target)
+	if element != "" {
+		if selector != "" {
+			selector += "/" + element
+		} else {
+			selector = element
+		}
+	}
+
+	href, title, synopsis, internal = conversion.resolveTopicLink(name, keyref, selector)
+	return href, title, synopsis, internal, true
+}
+
+// resolveTopicLink finds the slug and title for the topic at name,
+// url is only used for reporting errors
+func (conversion *PageConversion) resolveTopicLink(name, url, selector string) (href, title, synopsis string, internal bool) {
+	context := conversion.Context
+
+	var hash string
+	if selector != "" {
+		hash = "#" + selector
+	}
+
 	topic, ok := context.Index.Topics[ditaconvert.CanonicalPath(name)]
 	if !ok {
 		context.Errors = append(context.Errors,
 			fmt.Errorf("did not find topic %v [%v%v]", name, url, selector))
+		conversion.addUnresolved(url, selector)
 		return "", "", "", false
 	}
 
@@ -177,6 +367,7 @@ func (conversion *PageConversion) ResolveLinkInfo(url string) (href, title, syno
 		if err != nil {
 			context.Errors = append(context.Errors,
 				fmt.Errorf("unable to extract title from %v [%v%v]: %v", name, url, selector, err))
+			conversion.addUnresolved(url, selector)
 		}
 	}
 
@@ -187,6 +378,10 @@ func (conversion *PageConversion) ResolveLinkInfo(url string) (href, title, syno
 		}
 	}
 
+	if entry := conversion.Mapping.Glossary.Entry(topic); entry != nil {
+		return conversion.Mapping.Glossary.Link(entry), entry.Term, "", true
+	}
+
 	slug, ok := conversion.Mapping.ByTopic[topic]
 	if !ok {
 		return href, title, synopsis, false
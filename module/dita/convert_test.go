@@ -0,0 +1,210 @@
+package dita
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/raintreeinc/ditaconvert"
+	"github.com/raintreeinc/ditaconvert/dita"
+	"github.com/raintreeinc/ditaconvert/html"
+)
+
+func convertFragment(t *testing.T, fragment string) string {
+	t.Helper()
+
+	var out bytes.Buffer
+	conversion := &PageConversion{}
+	context := &ditaconvert.Context{
+		Rules:   conversion.Rules(),
+		Encoder: html.NewEncoder(&out),
+		Output:  &out,
+	}
+
+	if err := context.Parse(fragment); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+func TestConvertSection(t *testing.T) {
+	got := convertFragment(t, `<section outputclass="collapsible"><title>More</title><p>Hidden</p></section>`)
+	for _, exp := range []string{`<details`, `<summary class="sectiontitle">More</summary>`, `<p>Hidden</p>`, `</details>`} {
+		if !strings.Contains(got, exp) {
+			t.Errorf("missing %q in %q", exp, got)
+		}
+	}
+
+	got = convertFragment(t, `<section><title>Plain</title><p>Visible</p></section>`)
+	if strings.Contains(got, "<details") || !strings.Contains(got, `<div class="section">`) {
+		t.Errorf("plain section converted to %q", got)
+	}
+}
+
+// convertFixture converts testdata/name.dita and compares it to testdata/name.html
+func convertFixture(t *testing.T, name string) {
+	t.Helper()
+
+	fragment, err := ioutil.ReadFile("testdata/" + name + ".dita")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile("testdata/" + name + ".html")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := convertFragment(t, string(fragment))
+	if strings.TrimSpace(got) != strings.TrimSpace(string(expected)) {
+		t.Errorf("%s got:\n%s\nexpected:\n%s", name, got, expected)
+	}
+}
+
+func TestConvertTableSpans(t *testing.T) {
+	convertFixture(t, "table-span")
+}
+
+func TestConvertNotes(t *testing.T) {
+	for _, name := range []string{"note-warning", "note-tip", "note-bare", "hazard"} {
+		convertFixture(t, name)
+	}
+}
+
+func TestConvertSteps(t *testing.T) {
+	for _, name := range []string{"steps-start", "substeps"} {
+		convertFixture(t, name)
+	}
+
+	got := convertFragment(t, `<ol start="first"><li>One</li></ol>`)
+	if strings.Contains(got, "start=") {
+		t.Errorf("invalid start kept in %q", got)
+	}
+}
+
+func TestConvertImageAlt(t *testing.T) {
+	got := convertFragment(t, `<image href="https://example.com/a.png"><alt>Login <ph>dialog</ph></alt></image>`)
+	if !strings.Contains(got, `alt="Login dialog"`) {
+		t.Errorf("missing alt in %q", got)
+	}
+	if strings.Contains(got, "<alt>") || strings.Contains(got, "</img>") {
+		t.Errorf("alt element emitted as content in %q", got)
+	}
+
+	got = convertFragment(t, `<image href="https://example.com/a.png" alt="Attribute"/>`)
+	if !strings.Contains(got, `alt="Attribute"`) {
+		t.Errorf("missing alt in %q", got)
+	}
+}
+
+func TestConvertImageDimensions(t *testing.T) {
+	got := convertFragment(t, `<image href="https://example.com/a.png" width="300px" height="200"/>`)
+	for _, exp := range []string{`width="300"`, `height="200"`, `src="https://example.com/a.png"`} {
+		if !strings.Contains(got, exp) {
+			t.Errorf("missing %q in %q", exp, got)
+		}
+	}
+}
+
+func TestConvertImageBreak(t *testing.T) {
+	got := convertFragment(t, `<image href="https://example.com/a.png" placement="break"><alt>Chart</alt><title>Monthly <b>totals</b></title></image>`)
+	exp := `<p class="image"><img alt="Chart" src="https://example.com/a.png"><figcaption>Monthly <strong>totals</strong></figcaption></p>`
+	if !strings.Contains(got, exp) {
+		t.Errorf("got %q, expected %q", got, exp)
+	}
+}
+
+func newLinkConversion() *PageConversion {
+	index := ditaconvert.NewIndex(nil)
+	source := &ditaconvert.Topic{Path: "topics/source.dita"}
+	target := &ditaconvert.Topic{
+		Path:     "reference/target.dita",
+		Title:    "Target Topic",
+		Original: &dita.Topic{},
+		Raw:      []byte(`<topic id="target"><title>Target Topic</title><body><p id="para">Text</p></body></topic>`),
+	}
+	index.Topics[ditaconvert.CanonicalPath(source.Path)] = source
+	index.Topics[ditaconvert.CanonicalPath(target.Path)] = target
+	index.KeyDef["target"] = target.Path
+
+	mapping := NewTitleMapping()
+	mapping.ByTopic[target] = "target-topic"
+
+	conversion := &PageConversion{
+		Mapping: mapping,
+		Index:   index,
+		Topic:   source,
+	}
+	conversion.Context = ditaconvert.NewConversion(index, source)
+	conversion.Context.Rules = conversion.Rules()
+	return conversion
+}
+
+func TestConvertKeyRef(t *testing.T) {
+	conversion := newLinkConversion()
+	context := conversion.Context
+
+	if err := context.Parse(`<xref keyref="target"/>`); err != nil {
+		t.Fatal(err)
+	}
+	if err := context.Encoder.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	got := context.Output.String()
+	for _, exp := range []string{`href="target-topic"`, `data-link="target-topic"`, `>Target Topic</a>`} {
+		if !strings.Contains(got, exp) {
+			t.Errorf("missing %q in %q", exp, got)
+		}
+	}
+	if strings.Contains(got, "keyref") {
+		t.Errorf("keyref not removed in %q", got)
+	}
+	if len(context.Errors) > 0 {
+		t.Errorf("unexpected errors: %v", context.Errors)
+	}
+}
+
+func TestConvertUndefinedKeyRef(t *testing.T) {
+	conversion := newLinkConversion()
+	context := conversion.Context
+
+	if err := context.Parse(`<xref keyref="missing">Missing</xref>`); err != nil {
+		t.Fatal(err)
+	}
+
+	found := false
+	for _, err := range context.Errors {
+		if strings.Contains(err.Error(), "missing") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("undefined key was not reported: %v", context.Errors)
+	}
+}
+
+func TestConvertUnresolvedLinks(t *testing.T) {
+	conversion := newLinkConversion()
+	context := conversion.Context
+
+	err := context.Parse(`<p><xref href="missing.dita">Missing</xref><xref href="../reference/target.dita#target/nope">Bad</xref><xref href="../reference/target.dita#target/para">Good</xref></p>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exp := []UnresolvedLink{
+		{SourceTopic: "topics/source.dita", Href: "missing.dita"},
+		{SourceTopic: "topics/source.dita", Href: "../reference/target.dita", Selector: "target/nope"},
+	}
+	if got := conversion.UnresolvedLinks(); !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %+v, expected %+v", got, exp)
+	}
+	if len(context.Errors) != len(exp) {
+		t.Errorf("expected text errors for logs, got %v", context.Errors)
+	}
+}
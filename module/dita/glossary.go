@@ -0,0 +1,245 @@
+package dita
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/raintreeinc/ditaconvert"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// GlossaryTitle is the title of the page collecting all glossentry topics
+const GlossaryTitle = "Glossary"
+
+// GlossEntry is a term defined by a glossentry topic
+type GlossEntry struct {
+	Term string
+	// Abbreviation is the acronym or abbreviation of the term, if any
+	Abbreviation string
+	// Anchor is the id of the entry in the glossary page
+	Anchor string
+	Topic  *ditaconvert.Topic
+
+	// definition is the content of glossdef
+	definition string
+}
+
+// Glossary collects glossentry topics into a single page
+type Glossary struct {
+	Slug kb.Slug
+	// Entries are sorted by term
+	Entries []*GlossEntry
+	ByTopic map[*ditaconvert.Topic]*GlossEntry
+}
+
+type glossentryXML struct {
+	Term struct {
+		Content string `xml:",innerxml"`
+	} `xml:"glossterm"`
+	Definition struct {
+		Content string `xml:",innerxml"`
+	} `xml:"glossdef"`
+	Acronym      string `xml:"glossBody>glossAlt>glossAcronym"`
+	Abbreviation string `xml:"glossBody>glossAlt>glossAbbreviation"`
+}
+
+// isGlossEntry returns whether the topic is a glossentry
+func isGlossEntry(topic *ditaconvert.Topic) bool {
+	return topic.Original != nil && topic.Original.XMLName.Local == "glossentry"
+}
+
+// NewGlossary parses the glossentry topics, topics without a glossterm are reported as errors
+func NewGlossary(slug kb.Slug, topics []*ditaconvert.Topic) (glossary *Glossary, errors []error) {
+	glossary = &Glossary{
+		Slug:    slug,
+		ByTopic: make(map[*ditaconvert.Topic]*GlossEntry),
+	}
+
+	for _, topic := range topics {
+		var raw glossentryXML
+		if err := xml.Unmarshal(topic.Raw, &raw); err != nil {
+			errors = append(errors, fmt.Errorf("invalid glossentry \"%v\": %v", topic.Path, err))
+			continue
+		}
+
+		entry := &GlossEntry{
+			Term:         textContent(raw.Term.Content),
+			Abbreviation: strings.TrimSpace(raw.Acronym),
+			Topic:        topic,
+			definition:   raw.Definition.Content,
+		}
+		if entry.Abbreviation == "" {
+			entry.Abbreviation = strings.TrimSpace(raw.Abbreviation)
+		}
+		if entry.Term == "" {
+			errors = append(errors, fmt.Errorf("glossterm missing in \"%v\"", topic.Path))
+			continue
+		}
+
+		glossary.Entries = append(glossary.Entries, entry)
+		glossary.ByTopic[topic] = entry
+	}
+
+	sort.SliceStable(glossary.Entries, func(i, j int) bool {
+		a, b := strings.ToLower(glossary.Entries[i].Term), strings.ToLower(glossary.Entries[j].Term)
+		if a == b {
+			return glossary.Entries[i].Topic.Path < glossary.Entries[j].Topic.Path
+		}
+		return a < b
+	})
+
+	// anchors are assigned in sorted order, so that they are stable
+	used := make(map[string]bool)
+	for _, entry := range glossary.Entries {
+		base := string(kb.Slugify(entry.Term))
+		anchor := base
+		for n := 2; used[anchor]; n++ {
+			anchor = base + "-" + strconv.Itoa(n)
+		}
+		used[anchor] = true
+		entry.Anchor = anchor
+	}
+
+	return glossary, errors
+}
+
+// Entry returns the glossary entry of topic, or nil when it is not a glossentry
+func (glossary *Glossary) Entry(topic *ditaconvert.Topic) *GlossEntry {
+	if glossary == nil {
+		return nil
+	}
+	return glossary.ByTopic[topic]
+}
+
+// Link returns the link to the entry in the glossary page
+func (glossary *Glossary) Link(entry *GlossEntry) string {
+	return string(glossary.Slug) + "#" + entry.Anchor
+}
+
+// ConvertGlossary creates the glossary page, definitions are converted
+// in the context of their own topic so that relative links resolve
+func ConvertGlossary(conversion *Conversion, mapping *TitleMapping, index *ditaconvert.Index) (page *kb.Page, errs []error) {
+	glossary := mapping.Glossary
+	page = &kb.Page{
+		Slug:  glossary.Slug,
+		Title: GlossaryTitle,
+	}
+
+	var out strings.Builder
+	out.WriteString(`<dl class="glossary">`)
+	for _, entry := range glossary.Entries {
+		if entry.Topic.Modified.After(page.Modified) {
+			page.Modified = entry.Topic.Modified
+		}
+
+		definition := &PageConversion{
+			Conversion: conversion,
+			Mapping:    mapping,
+			Slug:       glossary.Slug,
+			Index:      index,
+			Topic:      entry.Topic,
+		}
+		definition.Context = ditaconvert.NewConversion(index, entry.Topic)
+		definition.Context.Rules = definition.Rules()
+		if err := definition.Context.Parse(entry.definition); err != nil {
+			errs = append(errs, fmt.Errorf("converting glossdef in \"%v\": %v", entry.Topic.Path, err))
+		}
+		if err := definition.Context.Encoder.Flush(); err != nil {
+			errs = append(errs, err)
+		}
+		errs = append(errs, definition.Context.Errors...)
+
+		term := html.EscapeString(entry.Term)
+		if entry.Abbreviation != "" {
+			term += ` (<abbr>` + html.EscapeString(entry.Abbreviation) + `</abbr>)`
+		}
+		out.WriteString(`<dt id="` + entry.Anchor + `">` + term + `</dt>`)
+		out.WriteString(`<dd>` + definition.Context.Output.String() + `</dd>`)
+	}
+	out.WriteString(`</dl>`)
+
+	page.Story.Append(kb.HTML(out.String()))
+	page.CanonicalizeIDs()
+	return page, errs
+}
+
+// glossaryTarget finds the glossary entry referenced by keyref or href
+func (conversion *PageConversion) glossaryTarget(keyref, href string) *GlossEntry {
+	if conversion.Mapping == nil || conversion.Mapping.Glossary == nil {
+		return nil
+	}
+	context := conversion.Context
+
+	var name string
+	if keyref != "" {
+		if i := strings.Index(keyref, "/"); i >= 0 {
+			keyref = keyref[:i]
+		}
+		target, ok := context.Index.KeyDef[keyref]
+		if !ok {
+			return nil
+		}
+		name, _ = ditaconvert.SplitLink(target)
+	} else if href != "" {
+		url, _ := ditaconvert.SplitLink(href)
+		name = path.Join(path.Dir(context.DecodingPath), url)
+	} else {
+		return nil
+	}
+
+	topic, ok := context.Index.Topics[ditaconvert.CanonicalPath(name)]
+	if !ok {
+		return nil
+	}
+	return conversion.Mapping.Glossary.Entry(topic)
+}
+
+// ConvertTerm links term and abbreviated-form to their entry in the glossary,
+// an empty abbreviated-form shows the abbreviation of the term
+func (conversion *PageConversion) ConvertTerm(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	keyref, href := getAttr(&start, "keyref"), getAttr(&start, "href")
+	abbreviated := start.Name.Local == "abbreviated-form"
+
+	entry := conversion.glossaryTarget(keyref, href)
+	if entry == nil {
+		if !abbreviated {
+			return context.EmitWithChildren(dec, xml.StartElement{
+				Name: xml.Name{Local: "dfn"},
+				Attr: []xml.Attr{{Name: xml.Name{Local: "class"}, Value: "term"}},
+			})
+		}
+		context.Errors = append(context.Errors, fmt.Errorf("glossary entry missing for abbreviated-form %v%v", keyref, href))
+		if err := dec.Skip(); err != nil {
+			return err
+		}
+		return context.Encoder.WriteRaw(html.EscapeString(keyref + href))
+	}
+
+	link := conversion.Mapping.Glossary.Link(entry)
+	if err := context.Encoder.WriteStart("a",
+		xml.Attr{Name: xml.Name{Local: "class"}, Value: "term"},
+		xml.Attr{Name: xml.Name{Local: "data-link"}, Value: link},
+		xml.Attr{Name: xml.Name{Local: "href"}, Value: link},
+		xml.Attr{Name: xml.Name{Local: "title"}, Value: entry.Term},
+	); err != nil {
+		return err
+	}
+
+	err, count := context.RecurseChildCount(dec)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		text := entry.Term
+		if abbreviated && entry.Abbreviation != "" {
+			text = entry.Abbreviation
+		}
+		context.Encoder.WriteRaw(html.EscapeString(text))
+	}
+	return context.Encoder.WriteEnd("a")
+}
@@ -0,0 +1,117 @@
+package dita
+
+import (
+	"encoding/xml"
+	"strings"
+	"testing"
+
+	"github.com/raintreeinc/ditaconvert"
+	"github.com/raintreeinc/ditaconvert/dita"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func newRawTopic(t *testing.T, path, raw string) *ditaconvert.Topic {
+	t.Helper()
+	original := &dita.Topic{}
+	if err := xml.Unmarshal([]byte(raw), original); err != nil {
+		t.Fatal(err)
+	}
+	return &ditaconvert.Topic{
+		Path:     path,
+		Title:    original.Title,
+		Raw:      []byte(raw),
+		Original: original,
+	}
+}
+
+func TestGlossary(t *testing.T) {
+	zeta := newRawTopic(t, "glossary/zeta.dita", `<glossentry id="zeta">
+		<glossterm>Zeta Report</glossterm>
+		<glossdef>Monthly summary, see <xref href="../topics/usage.dita"/>.</glossdef>
+	</glossentry>`)
+	api := newRawTopic(t, "glossary/api.dita", `<glossentry id="api">
+		<glossterm>Application Programming Interface</glossterm>
+		<glossdef>Rules for <b>programs</b> talking to each other.</glossdef>
+		<glossBody><glossAlt><glossAcronym>API</glossAcronym></glossAlt></glossBody>
+	</glossentry>`)
+	usage := newRawTopic(t, "topics/usage.dita", `<topic id="usage"><title>Usage</title><body>
+		<p>Call the <abbreviated-form keyref="api"/> or read the <term href="../glossary/zeta.dita">zeta</term>.</p>
+	</body></topic>`)
+
+	index := newTestIndex(zeta, api, usage)
+	index.KeyDef["api"] = api.Path
+
+	conversion := NewConversion("help", "")
+	mapping, _, errs := RemapTitles(conversion, index)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(mapping.BySlug) != 1 || mapping.ByTopic[usage] != "help=usage" {
+		t.Fatalf("glossentry topics should not get pages: %v", mapping.BySlug)
+	}
+
+	page, errs := ConvertGlossary(conversion, mapping, index)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if page.Slug != "help=glossary" || page.Title != GlossaryTitle {
+		t.Errorf("got page %v %q", page.Slug, page.Title)
+	}
+
+	got := page.Story[0].Val("text")
+	expected := []string{
+		`<dt id="application-programming-interface">Application Programming Interface (<abbr>API</abbr>)</dt>`,
+		`<dd>Rules for <strong>programs</strong> talking to each other.</dd>`,
+		`<dt id="zeta-report">Zeta Report</dt>`,
+		`href="help=usage"`,
+	}
+	last := -1
+	for _, exp := range expected {
+		at := strings.Index(got, exp)
+		if at < 0 {
+			t.Fatalf("missing %q in %q", exp, got)
+		}
+		if at < last {
+			t.Errorf("%q is out of order in %q", exp, got)
+		}
+		last = at
+	}
+
+	// links to glossentry topics point into the glossary
+	topic := &PageConversion{
+		Conversion: conversion,
+		Mapping:    mapping,
+		Slug:       "help=usage",
+		Index:      index,
+		Topic:      usage,
+	}
+	converted, errs, fatal := topic.Convert()
+	if fatal != nil || len(errs) > 0 {
+		t.Fatalf("converting usage: %v %v", fatal, errs)
+	}
+	text := converted.Story[len(converted.Story)-2].Val("text")
+	for _, exp := range []string{
+		`<a class="term" data-link="help=glossary#application-programming-interface" href="help=glossary#application-programming-interface" title="Application Programming Interface">API</a>`,
+		`<a class="term" data-link="help=glossary#zeta-report" href="help=glossary#zeta-report" title="Zeta Report">zeta</a>`,
+	} {
+		if !strings.Contains(text, exp) {
+			t.Errorf("missing %q in %q", exp, text)
+		}
+	}
+}
+
+func TestGlossarySlugClash(t *testing.T) {
+	existing := &ditaconvert.Topic{Path: "glossary.dita", Title: "Glossary"}
+	entry := newRawTopic(t, "term.dita", `<glossentry id="term"><glossterm>Term</glossterm><glossdef>Word</glossdef></glossentry>`)
+
+	mapping, _, errs := RemapTitles(NewConversion("help", ""), newTestIndex(existing, entry))
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if mapping.ByTopic[existing] != "help=glossary" {
+		t.Errorf("topic slug got %q", mapping.ByTopic[existing])
+	}
+	if mapping.Glossary.Slug != kb.Slug("help=glossary-2") {
+		t.Errorf("glossary slug got %q", mapping.Glossary.Slug)
+	}
+}
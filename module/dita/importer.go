@@ -0,0 +1,204 @@
+package dita
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+	"github.com/raintreeinc/knowledgebase/kb/items/index"
+)
+
+// ErrImportProblems is returned by Import when StopOnError is set
+// and the conversion reported errors
+var ErrImportProblems = errors.New("problems in conversion")
+
+// ImportOptions configures Import
+type ImportOptions struct {
+	// DryRun only converts and reports, nothing is written
+	DryRun bool
+	// Overwrite replaces all pages of the group,
+	// otherwise only changed pages are written
+	Overwrite bool
+	// StopOnError skips writing when the report has errors
+	StopOnError bool
+	// Progress is called for each written page
+	Progress func(description string, slug kb.Slug)
+}
+
+// ImportReport lists the result of converting a ditamap
+type ImportReport struct {
+	Group  kb.Slug
+	DryRun bool
+
+	// Slugs maps topic paths to the assigned slugs
+	Slugs map[string]kb.Slug
+
+	LoadErrors      []error
+	MappingWarnings []error
+	MappingErrors   []error
+	Errors          []ConversionError
+	UnresolvedLinks []UnresolvedLink
+
+	// number of pages written or skipped by the import
+	Created int
+	Updated int
+	Skipped int
+	Deleted int
+}
+
+// count records a page written by BatchReplace or BatchReplaceDelta
+func (report *ImportReport) count(description string) {
+	switch description {
+	case "added", "inserted":
+		report.Created++
+	case "updated":
+		report.Updated++
+	case "unchanged":
+		report.Skipped++
+	case "deleted":
+		report.Deleted++
+	}
+}
+
+// Report summarizes the conversion, Run must be called before
+func (context *Conversion) Report() *ImportReport {
+	report := &ImportReport{
+		Group: context.Group,
+		Slugs: make(map[string]kb.Slug, len(context.TopicSlugs)),
+
+		LoadErrors:      context.LoadErrors,
+		MappingWarnings: context.MappingWarnings,
+		MappingErrors:   context.MappingErrors,
+		Errors:          context.Errors,
+		UnresolvedLinks: context.UnresolvedLinks,
+	}
+	for path, slug := range context.TopicSlugs {
+		report.Slugs[path] = slug
+	}
+	return report
+}
+
+// HasErrors returns whether loading, mapping or converting a page failed
+func (report *ImportReport) HasErrors() bool {
+	if len(report.LoadErrors) > 0 || len(report.MappingErrors) > 0 {
+		return true
+	}
+	for _, err := range report.Errors {
+		if err.Fatal != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTo writes a readable report to w
+func (report *ImportReport) WriteTo(w io.Writer) (n int64, err error) {
+	printf := func(format string, args ...interface{}) {
+		if err != nil {
+			return
+		}
+		var written int
+		written, err = fmt.Fprintf(w, format, args...)
+		n += int64(written)
+	}
+	list := func(title string, errs []error) {
+		if len(errs) == 0 {
+			return
+		}
+		printf("== %s\n", title)
+		for _, e := range errs {
+			printf("%v\n", e)
+		}
+	}
+
+	if report.DryRun {
+		printf("== Dry run for %v, nothing was written\n", report.Group)
+	}
+
+	list("Index Errors", report.LoadErrors)
+	list("Mapping Warnings", report.MappingWarnings)
+	list("Mapping Errors", report.MappingErrors)
+
+	if len(report.Errors) > 0 {
+		printf("== Conversion Errors\n")
+		for _, conv := range report.Errors {
+			printf("%v: %v\n", conv.Path, conv.Slug)
+			if conv.Fatal != nil {
+				printf("\tFATAL: %v\n", conv.Fatal)
+			}
+			for _, e := range conv.Errors {
+				printf("\t%v\n", e)
+			}
+		}
+	}
+
+	if len(report.UnresolvedLinks) > 0 {
+		printf("== Unresolved Links\n")
+		for _, link := range report.UnresolvedLinks {
+			printf("%v: %v%v\n", link.SourceTopic, link.Href, selectorSuffix(link.Selector))
+		}
+	}
+
+	paths := make([]string, 0, len(report.Slugs))
+	for path := range report.Slugs {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	printf("== Slugs\n")
+	for _, path := range paths {
+		printf("%v -> %v\n", path, report.Slugs[path])
+	}
+
+	if !report.DryRun {
+		printf("== Created %v, updated %v, skipped %v, deleted %v\n",
+			report.Created, report.Updated, report.Skipped, report.Deleted)
+	}
+	return n, err
+}
+
+func selectorSuffix(selector string) string {
+	if selector == "" {
+		return ""
+	}
+	return "#" + selector
+}
+
+// Import runs the conversion and writes the pages with a navigation index to pages,
+// pages is not used for a dry run. Unless Overwrite is set, only new and changed
+// pages are written and pages of removed topics are deleted.
+func Import(context *Conversion, pages kb.Pages, options ImportOptions) (*ImportReport, error) {
+	context.Run()
+
+	report := context.Report()
+	report.DryRun = options.DryRun
+	if options.DryRun {
+		return report, nil
+	}
+	if options.StopOnError && report.HasErrors() {
+		return report, ErrImportProblems
+	}
+
+	indexslug := context.Group + "=index"
+	context.Pages[indexslug] = &kb.Page{
+		Slug:     indexslug,
+		Title:    "Index",
+		Synopsis: "Help navigation index",
+		Story: kb.Story{
+			index.New("index", context.Nav),
+		},
+	}
+
+	progress := func(description string, slug kb.Slug) {
+		report.count(description)
+		if options.Progress != nil {
+			options.Progress(description, slug)
+		}
+	}
+	if options.Overwrite {
+		return report, pages.BatchReplace(context.Pages, progress)
+	}
+	return report, pages.BatchReplaceDelta(context.Pages, progress)
+}
@@ -0,0 +1,190 @@
+package dita
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// writePages fails the test on any use
+type writePages struct {
+	kb.Pages
+	t *testing.T
+}
+
+func (pages writePages) BatchReplace(map[kb.Slug]*kb.Page, func(string, kb.Slug)) error {
+	pages.t.Error("BatchReplace called")
+	return nil
+}
+
+func (pages writePages) BatchReplaceDelta(map[kb.Slug]*kb.Page, func(string, kb.Slug)) error {
+	pages.t.Error("BatchReplaceDelta called")
+	return nil
+}
+
+func TestImportDryRun(t *testing.T) {
+	conversion := NewConversion("help", "testdata/bundle/bundle.ditamap")
+	report, err := Import(conversion, writePages{t: t}, ImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]kb.Slug{
+		"billing/overview.dita": "help=overview",
+		"reports/overview.dita": "help=overview-2",
+		"charges.dita":          "help=posting-charges",
+	}
+	for path, slug := range expected {
+		if got := report.Slugs[path]; got != slug {
+			t.Errorf("%v got %q, expected %q", path, got, slug)
+		}
+	}
+
+	if len(report.MappingWarnings) != 1 || !strings.Contains(report.MappingWarnings[0].Error(), "clashing title") {
+		t.Errorf("expected the clash to be reported, got %v", report.MappingWarnings)
+	}
+	if len(report.UnresolvedLinks) != 1 || report.UnresolvedLinks[0].Href != "missing.dita" {
+		t.Errorf("expected the missing link to be reported, got %+v", report.UnresolvedLinks)
+	}
+	if report.HasErrors() {
+		t.Errorf("unexpected errors: %v %v %v", report.LoadErrors, report.MappingErrors, report.Errors)
+	}
+
+	var out bytes.Buffer
+	if _, err := report.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	for _, exp := range []string{"Dry run", "clashing title", "charges.dita: missing.dita", "reports/overview.dita -> help=overview-2"} {
+		if !strings.Contains(out.String(), exp) {
+			t.Errorf("missing %q in report:\n%s", exp, out.String())
+		}
+	}
+}
+
+func TestImportStopOnError(t *testing.T) {
+	conversion := NewConversion("help", "testdata/bundle/missing.ditamap")
+	report, err := Import(conversion, writePages{t: t}, ImportOptions{StopOnError: true})
+	if err != ErrImportProblems {
+		t.Fatalf("got %v, expected ErrImportProblems", err)
+	}
+	if len(report.LoadErrors) == 0 {
+		t.Error("expected the missing map to be reported")
+	}
+}
+
+// hashPages keeps page hashes like pgdb.Pages.BatchReplaceDelta
+type hashPages struct {
+	kb.Pages
+	hashes  map[kb.Slug]string
+	written []kb.Slug
+}
+
+func (pages *hashPages) BatchReplaceDelta(replacement map[kb.Slug]*kb.Page, complete func(string, kb.Slug)) error {
+	for slug := range pages.hashes {
+		if _, exists := replacement[slug]; !exists {
+			delete(pages.hashes, slug)
+			complete("deleted", slug)
+		}
+	}
+	for slug, page := range replacement {
+		hash, err := page.Hash()
+		if err != nil {
+			return err
+		}
+		old, exists := pages.hashes[slug]
+		switch {
+		case old == string(hash):
+			complete("unchanged", slug)
+			continue
+		case exists:
+			complete("updated", slug)
+		default:
+			complete("added", slug)
+		}
+		pages.hashes[slug] = string(hash)
+		pages.written = append(pages.written, slug)
+	}
+	return nil
+}
+
+func copyBundle(t *testing.T) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"bundle.ditamap", "billing/overview.dita", "reports/overview.dita", "charges.dita"} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata/bundle", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(target, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestImportIncremental(t *testing.T) {
+	dir := copyBundle(t)
+	ditamap := filepath.Join(dir, "bundle.ditamap")
+	pages := &hashPages{hashes: map[kb.Slug]string{}}
+
+	report, err := Import(NewConversion("help", ditamap), pages, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 4 || report.Updated != 0 || report.Skipped != 0 || report.Deleted != 0 {
+		t.Errorf("first import: %+v", report)
+	}
+
+	charges := filepath.Join(dir, "charges.dita")
+	data, err := ioutil.ReadFile(charges)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = bytes.Replace(data, []byte("the missing topic"), []byte("nothing"), 1)
+	if err := ioutil.WriteFile(charges, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pages.written = nil
+	report, err = Import(NewConversion("help", ditamap), pages, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Created != 0 || report.Updated != 1 || report.Skipped != 3 || report.Deleted != 0 {
+		t.Errorf("second import: %+v", report)
+	}
+	if len(pages.written) != 1 || pages.written[0] != "help=posting-charges" {
+		t.Errorf("expected only the changed page to be written, got %v", pages.written)
+	}
+
+	// removing a topic from the map deletes its page
+	mapdata, err := ioutil.ReadFile(ditamap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapdata = bytes.Replace(mapdata, []byte(`<topicref href="reports/overview.dita"/>`), nil, 1)
+	if err := ioutil.WriteFile(ditamap, mapdata, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	pages.written = nil
+	report, err = Import(NewConversion("help", ditamap), pages, ImportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Deleted != 1 || report.Created != 0 {
+		t.Errorf("third import: %+v", report)
+	}
+	if _, exists := pages.hashes["help=overview-2"]; exists {
+		t.Error("page of the removed topic was not deleted")
+	}
+}
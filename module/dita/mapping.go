@@ -3,6 +3,8 @@ package dita
 import (
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/raintreeinc/ditaconvert"
 	"github.com/raintreeinc/knowledgebase/kb"
@@ -13,6 +15,8 @@ type TitleMapping struct {
 	Topics  map[string]*ditaconvert.Topic
 	BySlug  map[kb.Slug]*ditaconvert.Topic
 	ByTopic map[*ditaconvert.Topic]kb.Slug
+	// Glossary collects the glossentry topics, which do not get pages of their own
+	Glossary *Glossary
 }
 
 func NewTitleMapping() *TitleMapping {
@@ -37,28 +41,106 @@ func (m *TitleMapping) TopicsSorted() (r []*ditaconvert.Topic) {
 	return r
 }
 
-func RemapTitles(conversion *Conversion, index *ditaconvert.Index) (*TitleMapping, []error) {
-	var errors []error
+// RemapTitles assigns slugs to topics based on their titles,
+// topics are processed in path order so that the assignment is stable.
+// Clashing titles are disambiguated with a numeric suffix and reported as warnings.
+//
+// Topics in conversion.SlugOverrides take the given slug before any titles are
+// assigned, so titles clashing with an override are disambiguated instead.
+func RemapTitles(conversion *Conversion, index *ditaconvert.Index) (mapping *TitleMapping, warnings, errors []error) {
+	mapping = NewTitleMapping()
 
-	mapping := NewTitleMapping()
-
-	// assign slugs to topics
+	topics := make([]*ditaconvert.Topic, 0, len(index.Topics))
 	for _, topic := range index.Topics {
-		slug := conversion.Group + "=" + kb.Slugify(topic.Title)
+		topics = append(topics, topic)
+	}
+	sort.Sort(byTopicPath(topics))
+
+	// assign overridden slugs
+	overridden := make(map[*ditaconvert.Topic]bool)
+	for name, slug := range conversion.SlugOverrides {
+		topic, ok := index.Topics[ditaconvert.CanonicalPath(name)]
+		if !ok {
+			errors = append(errors, fmt.Errorf("slug override \"%v\" for missing topic \"%v\"", slug, name))
+			continue
+		}
+		if !strings.Contains(string(slug), "=") {
+			slug = conversion.Group + "=" + slug
+		}
+		overridden[topic] = true
+		mapping.ByTopic[topic] = slug
+	}
+	for _, topic := range topics {
+		if !overridden[topic] {
+			continue
+		}
+		slug := mapping.ByTopic[topic]
 		if other, clash := mapping.BySlug[slug]; clash {
-			errors = append(errors, fmt.Errorf("clashing title \"%v\" in \"%v\" and \"%v\"", topic.Title, topic.Path, other.Path))
+			errors = append(errors, fmt.Errorf("slug override \"%v\" used for \"%v\" and \"%v\"", slug, other.Path, topic.Path))
+			delete(mapping.ByTopic, topic)
 			continue
 		}
+		mapping.BySlug[slug] = topic
+	}
+
+	var parents map[*ditaconvert.Topic]kb.Slug
+	if conversion.HierarchicalSlugs {
+		parents = make(map[*ditaconvert.Topic]kb.Slug)
+		conversion.collectParents(parents, index.Nav, "")
+	}
+
+	// glossentry topics are merged into the glossary
+	var glossentries []*ditaconvert.Topic
 
+	// assign slugs to topics
+	for _, topic := range topics {
+		if overridden[topic] {
+			continue
+		}
+		if isGlossEntry(topic) {
+			glossentries = append(glossentries, topic)
+			continue
+		}
 		if topic.Title == "" {
 			errors = append(errors, fmt.Errorf("title missing in \"%v\"", topic.Path))
 			continue
 		}
 
+		base := conversion.Group + "=" + conversion.titleSlug(topic.Title)
+		if parent := parents[topic]; parent != "" {
+			base = conversion.Group + "=" + parent + "/" + conversion.titleSlug(topic.Title)
+		}
+		slug := base
+		if other, clash := mapping.BySlug[base]; clash {
+			for n := 2; ; n++ {
+				slug = base + kb.Slug("-"+strconv.Itoa(n))
+				if _, taken := mapping.BySlug[slug]; !taken {
+					break
+				}
+			}
+			if overridden[other] {
+				warnings = append(warnings, fmt.Errorf("title \"%v\" in \"%v\" clashes with slug override of \"%v\", using \"%v\"", topic.Title, topic.Path, other.Path, slug))
+			} else {
+				warnings = append(warnings, fmt.Errorf("clashing title \"%v\" in \"%v\" and \"%v\", using \"%v\"", topic.Title, topic.Path, other.Path, slug))
+			}
+		}
+
 		mapping.BySlug[slug] = topic
 		mapping.ByTopic[topic] = slug
 	}
 
+	if len(glossentries) > 0 {
+		base := conversion.Group + "=" + conversion.titleSlug(GlossaryTitle)
+		slug := base
+		for n := 2; mapping.BySlug[slug] != nil; n++ {
+			slug = base + kb.Slug("-"+strconv.Itoa(n))
+		}
+
+		var glossaryErrors []error
+		mapping.Glossary, glossaryErrors = NewGlossary(slug, glossentries)
+		errors = append(errors, glossaryErrors...)
+	}
+
 	/* Code for promoting to shorter titles
 	for prev, topic := range mapping.BySlug {
 		if topic.ShortTitle == "" || len(topic.Title) <= len(topic.ShortTitle) {
@@ -78,7 +160,32 @@ func RemapTitles(conversion *Conversion, index *ditaconvert.Index) (*TitleMappin
 	}
 	*/
 
-	return mapping, errors
+	return mapping, warnings, errors
+}
+
+// collectParents finds the slug prefix of each topic from the titles of
+// the navigation entries containing it, the first occurrence is used
+func (conversion *Conversion) collectParents(parents map[*ditaconvert.Topic]kb.Slug, entry *ditaconvert.Entry, prefix kb.Slug) {
+	for _, child := range entry.Children {
+		if child.Topic != nil {
+			if _, seen := parents[child.Topic]; !seen {
+				parents[child.Topic] = prefix
+			}
+		}
+		if len(child.Children) == 0 {
+			continue
+		}
+
+		childprefix := prefix
+		if section := conversion.titleSlug(child.Title); section != "-" {
+			if prefix != "" {
+				childprefix = prefix + "/" + section
+			} else {
+				childprefix = section
+			}
+		}
+		conversion.collectParents(parents, child, childprefix)
+	}
 }
 
 func (mapping *TitleMapping) EntryToIndexItem(entry *ditaconvert.Entry) *index.Item {
@@ -87,6 +194,12 @@ func (mapping *TitleMapping) EntryToIndexItem(entry *ditaconvert.Entry) *index.I
 	}
 	if entry.Topic != nil {
 		item.Slug = mapping.ByTopic[entry.Topic]
+		if gloss := mapping.Glossary.Entry(entry.Topic); gloss != nil {
+			item.Slug = kb.Slug(mapping.Glossary.Link(gloss))
+			if item.Title == "" {
+				item.Title = gloss.Term
+			}
+		}
 	}
 
 	for _, child := range entry.Children {
@@ -0,0 +1,186 @@
+package dita
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/raintreeinc/ditaconvert"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func newTestIndex(topics ...*ditaconvert.Topic) *ditaconvert.Index {
+	index := ditaconvert.NewIndex(nil)
+	for _, topic := range topics {
+		index.Topics[ditaconvert.CanonicalPath(topic.Path)] = topic
+	}
+	return index
+}
+
+func TestRemapTitlesClash(t *testing.T) {
+	for run := 0; run < 20; run++ {
+		first := &ditaconvert.Topic{Path: "a/overview.dita", Title: "Overview"}
+		second := &ditaconvert.Topic{Path: "b/overview.dita", Title: "Overview"}
+		third := &ditaconvert.Topic{Path: "c/overview.dita", Title: "Overview"}
+		index := newTestIndex(third, second, first)
+
+		mapping, warnings, errs := RemapTitles(NewConversion("help", ""), index)
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if len(warnings) != 2 {
+			t.Errorf("expected 2 warnings, got %v", warnings)
+		}
+
+		expected := map[*ditaconvert.Topic]kb.Slug{
+			first:  "help=overview",
+			second: "help=overview-2",
+			third:  "help=overview-3",
+		}
+		for topic, slug := range expected {
+			if got := mapping.ByTopic[topic]; got != slug {
+				t.Fatalf("run %d: %v got %q, expected %q", run, topic.Path, got, slug)
+			}
+			if mapping.BySlug[slug] != topic {
+				t.Fatalf("run %d: %q does not map back to %v", run, slug, topic.Path)
+			}
+		}
+	}
+}
+
+func TestRemapTitlesMissingTitle(t *testing.T) {
+	index := newTestIndex(&ditaconvert.Topic{Path: "untitled.dita"})
+	mapping, _, errs := RemapTitles(NewConversion("help", ""), index)
+	if len(errs) != 1 || len(mapping.BySlug) != 0 {
+		t.Errorf("expected an error for the missing title, got %v %v", errs, mapping.BySlug)
+	}
+}
+
+func TestRemapTitlesOverride(t *testing.T) {
+	legacy := &ditaconvert.Topic{Path: "billing/Charges.dita", Title: "Posting Charges"}
+	auto := &ditaconvert.Topic{Path: "billing/legacy.dita", Title: "Old Charges"}
+	index := newTestIndex(legacy, auto)
+
+	conversion := NewConversion("help", "")
+	conversion.SlugOverrides = map[string]kb.Slug{
+		"billing/charges.dita": "old-charges",
+	}
+
+	mapping, warnings, errs := RemapTitles(conversion, index)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if got := mapping.ByTopic[legacy]; got != "help=old-charges" {
+		t.Errorf("override got %q", got)
+	}
+	if got := mapping.ByTopic[auto]; got != "help=old-charges-2" {
+		t.Errorf("auto slug got %q", got)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected clash with override to be reported, got %v", warnings)
+	}
+}
+
+func TestRemapTitlesOverrideClash(t *testing.T) {
+	first := &ditaconvert.Topic{Path: "a.dita", Title: "A"}
+	second := &ditaconvert.Topic{Path: "b.dita", Title: "B"}
+	index := newTestIndex(first, second)
+
+	conversion := NewConversion("help", "")
+	conversion.SlugOverrides = map[string]kb.Slug{
+		"a.dita":       "help=legacy",
+		"b.dita":       "legacy",
+		"missing.dita": "other",
+	}
+
+	mapping, _, errs := RemapTitles(conversion, index)
+	if len(errs) != 2 {
+		t.Errorf("expected duplicate override and missing topic errors, got %v", errs)
+	}
+	if mapping.BySlug["help=legacy"] != first {
+		t.Errorf("first override did not win: %v", mapping.BySlug)
+	}
+	if _, ok := mapping.ByTopic[second]; ok {
+		t.Errorf("clashing override was assigned: %v", mapping.ByTopic[second])
+	}
+}
+
+func TestRemapTitlesHierarchical(t *testing.T) {
+	billing := &ditaconvert.Topic{Path: "billing.dita", Title: "Billing"}
+	charges := &ditaconvert.Topic{Path: "billing/charges.dita", Title: "Posting Charges"}
+	billingOverview := &ditaconvert.Topic{Path: "billing/overview.dita", Title: "Overview"}
+	billingOverview2 := &ditaconvert.Topic{Path: "billing/overview2.dita", Title: "Overview"}
+	reportsOverview := &ditaconvert.Topic{Path: "reports/overview.dita", Title: "Overview"}
+	index := newTestIndex(billing, charges, billingOverview, billingOverview2, reportsOverview)
+
+	index.Nav.Children = []*ditaconvert.Entry{
+		{Title: "Billing", Topic: billing, Children: []*ditaconvert.Entry{
+			{Title: "Posting Charges", Topic: charges},
+			{Title: "Overview", Topic: billingOverview},
+			{Title: "Overview", Topic: billingOverview2},
+		}},
+		{Title: "Reports", Children: []*ditaconvert.Entry{
+			{Title: "Overview", Topic: reportsOverview},
+		}},
+	}
+
+	conversion := NewConversion("help", "")
+	conversion.HierarchicalSlugs = true
+	mapping, warnings, errs := RemapTitles(conversion, index)
+	if len(errs) > 0 {
+		t.Fatalf("unexpected errors: %v", errs)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected a single clash in billing, got %v", warnings)
+	}
+
+	expected := map[*ditaconvert.Topic]kb.Slug{
+		billing:          "help=billing",
+		charges:          "help=billing/posting-charges",
+		billingOverview:  "help=billing/overview",
+		billingOverview2: "help=billing/overview-2",
+		reportsOverview:  "help=reports/overview",
+	}
+	for topic, slug := range expected {
+		if got := mapping.ByTopic[topic]; got != slug {
+			t.Errorf("%v got %q, expected %q", topic.Path, got, slug)
+		}
+	}
+	if len(mapping.ByTopic) != len(mapping.BySlug) {
+		t.Errorf("ByTopic and BySlug differ: %v %v", mapping.ByTopic, mapping.BySlug)
+	}
+	for slug, topic := range mapping.BySlug {
+		if mapping.ByTopic[topic] != slug {
+			t.Errorf("%q maps to %v, which maps to %q", slug, topic.Path, mapping.ByTopic[topic])
+		}
+	}
+}
+
+func TestRemapTitlesTitelize(t *testing.T) {
+	newIndex := func() (*ditaconvert.Index, *ditaconvert.Topic) {
+		topic := &ditaconvert.Topic{Path: "ab.dita", Title: "A/B Testing & Reports"}
+		return newTestIndex(topic), topic
+	}
+
+	tests := []struct {
+		titelize func(string) string
+		expected kb.Slug
+	}{
+		{nil, "help=a/b-testing-amp-reports"},
+		{EnglishTitelize, "help=a-or-b-testing-and-reports"},
+		{strings.NewReplacer("&", " und ").Replace, "help=a/b-testing-und-reports"},
+	}
+
+	for _, test := range tests {
+		index, topic := newIndex()
+		conversion := NewConversion("help", "")
+		conversion.Titelize = test.titelize
+
+		mapping, _, errs := RemapTitles(conversion, index)
+		if len(errs) > 0 {
+			t.Fatalf("unexpected errors: %v", errs)
+		}
+		if got := mapping.ByTopic[topic]; got != test.expected {
+			t.Errorf("got %q, expected %q", got, test.expected)
+		}
+	}
+}
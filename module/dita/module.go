@@ -85,6 +85,9 @@ func (mod *Module) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		for _, err := range cache.MappingErrors {
 			page.Story.Append(kb.Paragraph(err.Error()))
 		}
+		for _, warning := range cache.MappingWarnings {
+			page.Story.Append(kb.Paragraph("Warning: " + warning.Error()))
+		}
 
 		page.Story.Append(kb.HTML("<h3>Converting</h3>"))
 		for _, errs := range cache.Errors {
@@ -0,0 +1,98 @@
+package dita
+
+import (
+	"encoding/xml"
+	"html"
+	"strings"
+
+	"github.com/raintreeinc/ditaconvert"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// noteIcons are the icons for note types, other types use note-outline
+var noteIcons = map[string]string{
+	"tip":         "lightbulb-outline",
+	"caution":     "alert",
+	"warning":     "alert",
+	"danger":      "alert-octagon",
+	"Extra":       "key",
+	"Rev-Edition": "elevation-rise",
+	"PDF":         "book-open",
+}
+
+// noteType returns the type of a note or hazardstatement, defaulting to note
+func noteType(start *xml.StartElement) string {
+	typ := getAttr(start, "type")
+	if typ == "other" {
+		typ = getAttr(start, "othertype")
+	}
+	if typ == "" {
+		typ = "note"
+	}
+	setAttr(start, "type", "")
+	setAttr(start, "othertype", "")
+	return typ
+}
+
+func noteClass(typ string) string {
+	return "note note-" + string(kb.Slugify(typ))
+}
+
+func writeNoteIcon(context *ditaconvert.Context, typ string) error {
+	icon, ok := noteIcons[typ]
+	if !ok {
+		icon = "note-outline"
+	}
+	return context.Encoder.WriteRaw(`<i class="mdi mdi-` + icon + `" title="` + html.EscapeString(typ) + `"></i> `)
+}
+
+// ConvertNote converts a note to a div with a class for its type
+func (conversion *PageConversion) ConvertNote(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	typ := noteType(&start)
+	setAttr(&start, "class", noteClass(typ))
+
+	if err := context.Encoder.WriteStart("div", start.Attr...); err != nil {
+		return err
+	}
+	writeNoteIcon(context, typ)
+	context.Encoder.WriteStart("span")
+	err := context.Recurse(dec)
+	context.Encoder.WriteEnd("span")
+	context.Encoder.WriteEnd("div")
+	return err
+}
+
+// ConvertHazard converts a hazardstatement to a note with its signal word,
+// the messagepanel and hazardsymbol children are converted by hazardRules
+func (conversion *PageConversion) ConvertHazard(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	typ := noteType(&start)
+	setAttr(&start, "class", noteClass(typ)+" hazard")
+
+	if err := context.Encoder.WriteStart("div", start.Attr...); err != nil {
+		return err
+	}
+	context.Encoder.WriteStart("div",
+		xml.Attr{Name: xml.Name{Local: "class"}, Value: "signalword"})
+	writeNoteIcon(context, typ)
+	context.Encoder.WriteRaw(html.EscapeString(strings.ToUpper(typ)))
+	context.Encoder.WriteEnd("div")
+
+	err := context.Recurse(dec)
+	context.Encoder.WriteEnd("div")
+	return err
+}
+
+// ConvertHazardSymbol converts a hazardsymbol to an inline image
+func (conversion *PageConversion) ConvertHazardSymbol(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	start.Name.Local = "img"
+	setAttr(&start, "class", "hazardsymbol")
+	return conversion.InlineImage(context, dec, start)
+}
+
+// hazardRules renames the parts of a hazardstatement to divs with classes
+var hazardRules = map[string]ditaconvert.Renaming{
+	"messagepanel": {Name: "div", AddClass: "messagepanel"},
+	"typeofhazard": {Name: "div", AddClass: "typeofhazard"},
+	"consequence":  {Name: "div", AddClass: "consequence"},
+	"howtoavoid":   {Name: "div", AddClass: "howtoavoid"},
+}
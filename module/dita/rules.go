@@ -0,0 +1,66 @@
+package dita
+
+import "github.com/raintreeinc/ditaconvert"
+
+// RuleOverrides adds or replaces conversion rules on top of the defaults
+type RuleOverrides struct {
+	// Translate renames elements, optionally adding a class
+	Translate map[string]ditaconvert.Renaming
+	// Remove skips elements with their content, false restores a default
+	Remove map[string]bool
+	// Unwrap emits only the content of elements, false restores a default
+	Unwrap map[string]bool
+	// Callback handles elements with custom code
+	Callback map[string]ditaconvert.TokenProcessor
+}
+
+// NewHTMLRules returns the default rules for converting DITA to HTML
+func NewHTMLRules() *ditaconvert.Rules {
+	return NewHTMLRulesWith(RuleOverrides{})
+}
+
+// NewHTMLRulesWith returns the default rules with overrides applied,
+// the returned rules do not share maps with other calls
+func NewHTMLRulesWith(overrides RuleOverrides) *ditaconvert.Rules {
+	base := ditaconvert.NewDefaultRules()
+	rules := &ditaconvert.Rules{
+		CustomResolveLink: base.CustomResolveLink,
+
+		Rename: make(map[string]ditaconvert.Renaming, len(base.Rename)+len(overrides.Translate)),
+		Skip:   make(map[string]bool, len(base.Skip)+len(overrides.Remove)),
+		Unwrap: make(map[string]bool, len(base.Unwrap)+len(overrides.Unwrap)),
+		Custom: make(map[string]ditaconvert.TokenProcessor, len(base.Custom)+len(overrides.Callback)),
+	}
+
+	for tag, renaming := range base.Rename {
+		rules.Rename[tag] = renaming
+	}
+	for tag, renaming := range overrides.Translate {
+		rules.Rename[tag] = renaming
+	}
+
+	mergeFlags(rules.Skip, base.Skip, overrides.Remove)
+	mergeFlags(rules.Unwrap, base.Unwrap, overrides.Unwrap)
+
+	for tag, process := range base.Custom {
+		rules.Custom[tag] = process
+	}
+	for tag, process := range overrides.Callback {
+		rules.Custom[tag] = process
+	}
+
+	return rules
+}
+
+func mergeFlags(target, base, overrides map[string]bool) {
+	for tag, enabled := range base {
+		target[tag] = enabled
+	}
+	for tag, enabled := range overrides {
+		if enabled {
+			target[tag] = true
+		} else {
+			delete(target, tag)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package dita
+
+import (
+	"encoding/xml"
+	"testing"
+
+	"github.com/raintreeinc/ditaconvert"
+)
+
+func TestNewHTMLRulesWith(t *testing.T) {
+	callback := func(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+		return dec.Skip()
+	}
+	rules := NewHTMLRulesWith(RuleOverrides{
+		Translate: map[string]ditaconvert.Renaming{
+			"xref": {Name: "span", AddClass: "ref"},
+			"kbd":  {Name: "kbd"},
+		},
+		Remove:   map[string]bool{"draft-comment": false, "secret": true},
+		Unwrap:   map[string]bool{"wrapper": true},
+		Callback: map[string]ditaconvert.TokenProcessor{"custom": callback},
+	})
+
+	if renaming := rules.Rename["xref"]; renaming.Name != "span" || renaming.AddClass != "ref" {
+		t.Errorf("xref not replaced: %+v", renaming)
+	}
+	if _, ok := rules.Rename["kbd"]; !ok {
+		t.Error("kbd mapping not added")
+	}
+	if !rules.Skip["secret"] || !rules.Unwrap["wrapper"] || rules.Custom["custom"] == nil {
+		t.Error("overrides not added")
+	}
+	if _, ok := rules.Skip["draft-comment"]; ok {
+		t.Error("draft-comment was not restored")
+	}
+
+	defaults := ditaconvert.NewDefaultRules()
+	if rules.Rename["image"] != defaults.Rename["image"] || !rules.Unwrap["tgroup"] {
+		t.Error("defaults were not kept")
+	}
+	if len(rules.Custom) != len(defaults.Custom)+1 {
+		t.Errorf("expected %d callbacks, got %d", len(defaults.Custom)+1, len(rules.Custom))
+	}
+}
+
+func TestNewHTMLRulesNotShared(t *testing.T) {
+	first := NewHTMLRules()
+	first.Rename["xref"] = ditaconvert.Renaming{Name: "span"}
+	first.Skip["p"] = true
+
+	second := NewHTMLRules()
+	if second.Rename["xref"].Name != "a" {
+		t.Errorf("xref mapping was mutated: %+v", second.Rename["xref"])
+	}
+	if second.Skip["p"] {
+		t.Error("skip rules were mutated")
+	}
+}
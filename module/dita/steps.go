@@ -0,0 +1,86 @@
+package dita
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"github.com/raintreeinc/ditaconvert"
+)
+
+// isListItem returns whether tag is an item of an ordered list
+func isListItem(tag string) bool {
+	return tag == "li" || tag == "step" || tag == "substep"
+}
+
+// ConvertOrderedList converts steps and ol to an ol, keeping @start
+func (conversion *PageConversion) ConvertOrderedList(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	first := 1
+	if value := getAttr(&start, "start"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			context.Errors = append(context.Errors, fmt.Errorf("invalid list start %q", value))
+			setAttr(&start, "start", "")
+		} else {
+			first = n
+		}
+	}
+
+	start.Name.Local = "ol"
+	return conversion.convertListItems(context, dec, start, "", first)
+}
+
+// ConvertSubsteps converts substeps to a nested ol, the items are numbered
+// with the number of the containing step, e.g. 2.1, 2.2
+func (conversion *PageConversion) ConvertSubsteps(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	prefix := ""
+	if n := len(conversion.stepNumbers); n > 0 {
+		prefix = conversion.stepNumbers[n-1] + "."
+	}
+
+	start.Name.Local = "ol"
+	setAttr(&start, "class", "substeps")
+	return conversion.convertListItems(context, dec, start, prefix, 1)
+}
+
+// convertListItems emits the list with its items numbered from number,
+// when prefix is set items get their full number in data-step
+func (conversion *PageConversion) convertListItems(context *ditaconvert.Context, dec *xml.Decoder, list xml.StartElement, prefix string, number int) error {
+	if err := context.Encoder.WriteXMLStart(&list); err != nil {
+		return err
+	}
+
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if _, ended := token.(xml.EndElement); ended {
+			break
+		}
+
+		item, isStart := token.(xml.StartElement)
+		if !isStart || !isListItem(item.Name.Local) || context.ShouldSkip(token) || ditaconvert.IsConref(token) {
+			if err := context.Handle(dec, token); err != nil {
+				return err
+			}
+			continue
+		}
+
+		label := prefix + strconv.Itoa(number)
+		item.Name.Local = "li"
+		if prefix != "" {
+			setAttr(&item, "data-step", label)
+		}
+
+		conversion.stepNumbers = append(conversion.stepNumbers, label)
+		err = context.EmitWithChildren(dec, item)
+		conversion.stepNumbers = conversion.stepNumbers[:len(conversion.stepNumbers)-1]
+		if err != nil {
+			return err
+		}
+		number++
+	}
+
+	return context.Encoder.WriteEnd(list.Name.Local)
+}
@@ -0,0 +1,220 @@
+package dita
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/raintreeinc/ditaconvert"
+	"github.com/raintreeinc/ditaconvert/table"
+)
+
+// calsTable is a CALS table, unlike table.XML it keeps all header rows
+type calsTable struct {
+	table.Attributes
+	calsTableInner
+}
+type calsTableInner struct {
+	Groups []calsGroup `xml:"tgroup"`
+}
+
+type calsGroup struct {
+	table.Attributes
+	calsGroupInner
+}
+type calsGroupInner struct {
+	Columns []table.ColSpec `xml:"colspec"`
+	Head    []table.Row     `xml:"thead>row"`
+	Rows    []table.Row     `xml:"tbody>row"`
+}
+
+func (el *calsTable) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	el.Attr = append(el.Attr, start.Attr...)
+	return d.DecodeElement(&el.calsTableInner, &start)
+}
+
+func (el *calsGroup) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	el.Attr = append(el.Attr, start.Attr...)
+	return d.DecodeElement(&el.calsGroupInner, &start)
+}
+
+// tableLayout tracks column names of a tgroup and cells taken by rowspans
+type tableLayout struct {
+	names  map[string]int
+	widths map[int]string
+	// rowsTaken[column] is the number of following rows covered by a rowspan
+	rowsTaken map[int]int
+	errors    []error
+}
+
+func newTableLayout(columns []table.ColSpec) *tableLayout {
+	layout := &tableLayout{
+		names:     map[string]int{},
+		widths:    map[int]string{},
+		rowsTaken: map[int]int{},
+	}
+	for i, spec := range columns {
+		index := i
+		if spec.Num > 0 {
+			index = spec.Num - 1
+		}
+		if spec.Name != "" {
+			layout.names[strings.ToLower(spec.Name)] = index
+		}
+		if spec.Width != "" {
+			layout.widths[index] = strings.TrimRight(spec.Width, "*") + "%"
+		}
+	}
+	return layout
+}
+
+func (layout *tableLayout) column(name string) (int, bool) {
+	index, ok := layout.names[strings.ToLower(name)]
+	if !ok {
+		layout.errors = append(layout.errors, fmt.Errorf("unknown table column %q", name))
+	}
+	return index, ok
+}
+
+// span converts CALS spanning attributes of the entries to colspan and rowspan,
+// it returns the width of each entry that covers a single column
+func (layout *tableLayout) span(row *table.Row) (widths []string) {
+	taken := layout.rowsTaken
+	layout.rowsTaken = map[int]int{}
+	for column, rows := range taken {
+		if rows > 1 {
+			layout.rowsTaken[column] = rows - 1
+		}
+	}
+
+	column := 0
+	for i := range row.Entries {
+		entry := &row.Entries[i]
+		for taken[column] > 0 {
+			column++
+		}
+
+		first, last := column, column
+		if name := entry.GetAttr("colname"); name != "" {
+			if index, ok := layout.column(name); ok {
+				first, last = index, index
+			}
+		}
+		if startName, endName := entry.Bounds(); startName != "" || endName != "" {
+			if startName != "" {
+				if index, ok := layout.column(startName); ok {
+					first = index
+				}
+			}
+			last = first
+			if endName != "" {
+				if index, ok := layout.column(endName); ok && index >= first {
+					last = index
+				}
+			}
+		}
+		entry.ClearBounds()
+		entry.SetAttr("colname", "")
+
+		if last > first {
+			entry.SetAttr("colspan", strconv.Itoa(last-first+1))
+		}
+
+		if morerows := entry.GetAttr("morerows"); morerows != "" {
+			entry.SetAttr("morerows", "")
+			rows, err := strconv.Atoi(morerows)
+			if err != nil || rows < 0 {
+				layout.errors = append(layout.errors, fmt.Errorf("invalid morerows %q", morerows))
+			} else if rows > 0 {
+				entry.SetAttr("rowspan", strconv.Itoa(rows+1))
+				for c := first; c <= last; c++ {
+					layout.rowsTaken[c] = rows
+				}
+			}
+		}
+
+		width := ""
+		if first == last {
+			width = layout.widths[first]
+		}
+		widths = append(widths, width)
+
+		column = last + 1
+	}
+	return widths
+}
+
+// ConvertTable converts CALS tables, translating namest/nameend to colspan and morerows to rowspan
+func (conversion *PageConversion) ConvertTable(context *ditaconvert.Context, dec *xml.Decoder, start xml.StartElement) error {
+	var t calsTable
+	if err := dec.DecodeElement(&t, &start); err != nil {
+		return err
+	}
+
+	var err error
+	emitStart := func(tag string, attrs ...xml.Attr) {
+		if err == nil {
+			err = context.Encoder.WriteStart(tag, attrs...)
+		}
+	}
+	emitEnd := func(tag string) {
+		if err == nil {
+			err = context.Encoder.WriteEnd(tag)
+		}
+	}
+	emitRows := func(layout *tableLayout, rows []table.Row, cell string) {
+		for _, row := range rows {
+			if !isWebAudience(row.GetAttr("audience"), row.GetAttr("print"), row.GetAttr("deliveryTarget")) {
+				continue
+			}
+			widths := layout.span(&row)
+
+			emitStart("tr", row.Attr...)
+			for i, entry := range row.Entries {
+				if cell == "th" && widths[i] != "" {
+					entry.SetAttr("style", "width:"+widths[i]+";")
+				}
+				emitStart(cell, entry.Attr...)
+				if err == nil {
+					err = context.Parse(string(entry.Content))
+				}
+				emitEnd(cell)
+			}
+			emitEnd("tr")
+		}
+	}
+
+	emitStart("div", t.Attr...)
+	for _, group := range t.Groups {
+		layout := newTableLayout(group.Columns)
+		group.SetAttr("cols", "")
+
+		emitStart("table", group.Attr...)
+		if len(group.Head) > 0 {
+			emitStart("thead")
+			emitRows(layout, group.Head, "th")
+			emitEnd("thead")
+		}
+		// rowspans do not continue from the header to the body
+		layout.rowsTaken = map[int]int{}
+
+		emitStart("tbody")
+		emitRows(layout, group.Rows, "td")
+		emitEnd("tbody")
+		emitEnd("table")
+
+		context.Errors = append(context.Errors, layout.errors...)
+	}
+	emitEnd("div")
+
+	return err
+}
+
+// isWebAudience matches the filtering of ditaconvert
+func isWebAudience(audience string, print, deliveryTarget string) bool {
+	return !(audience == "html" ||
+		audience == "print" ||
+		print == "printonly" ||
+		(deliveryTarget != "" && !strings.Contains(" "+deliveryTarget+" ", " KB ")))
+}
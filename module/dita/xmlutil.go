@@ -3,6 +3,7 @@ package dita
 import (
 	"encoding/xml"
 	"sort"
+	"strings"
 )
 
 func getAttr(n *xml.StartElement, key string) (val string) {
@@ -45,3 +46,19 @@ func setAttr(n *xml.StartElement, key, val string) {
 	})
 	sort.Sort(attrByName(n.Attr))
 }
+
+// textContent returns the text of an xml fragment without markup
+func textContent(fragment string) string {
+	var text strings.Builder
+	dec := xml.NewDecoder(strings.NewReader(fragment))
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			break
+		}
+		if data, ok := token.(xml.CharData); ok {
+			text.Write(data)
+		}
+	}
+	return strings.Join(strings.Fields(text.String()), " ")
+}
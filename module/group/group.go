@@ -1,6 +1,7 @@
 package group
 
 import (
+	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
@@ -93,6 +94,15 @@ func (mod *Module) pages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if r.FormValue("format") == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+string(info.ID)+`.csv"`)
+		if err := context.Pages(info.ID).ExportCSV(w); err != nil {
+			log.Printf("Exporting %v failed: %v", info.ID, err)
+		}
+		return
+	}
+
 	entries, err := context.Index(context.ActiveUserID()).ByGroup(info.ID)
 	if err != nil {
 		kb.WriteResult(w, err)
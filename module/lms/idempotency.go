@@ -0,0 +1,93 @@
+package lms
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+// DefaultIdempotencyWindow is how long a repeated upload returns the first result
+const DefaultIdempotencyWindow = time.Hour
+
+// idempotencyHeader identifies retries of the same upload
+const idempotencyHeader = "Idempotency-Key"
+
+// idempotency remembers upload results by key, so that retried requests
+// return the location of the first upload instead of uploading again
+type idempotency struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	results map[string]*uploadResult
+}
+
+type uploadResult struct {
+	done     chan struct{}
+	location string
+	err      error
+	// expires is zero while the upload is in progress
+	expires time.Time
+}
+
+// newIdempotency creates the cache, window <= 0 disables it
+func newIdempotency(window time.Duration) *idempotency {
+	if window <= 0 {
+		return nil
+	}
+	return &idempotency{
+		window:  window,
+		now:     time.Now,
+		results: make(map[string]*uploadResult),
+	}
+}
+
+// idempotencyKey reads the key from the header or the idempotencyKey form value
+func idempotencyKey(r *http.Request) string {
+	if key := r.Header.Get(idempotencyHeader); key != "" {
+		return key
+	}
+	return r.URL.Query().Get("idempotencyKey")
+}
+
+// do runs upload once per key, requests with the same key wait for the
+// first one and get its location. Failed uploads are not remembered.
+func (cache *idempotency) do(key string, upload func() (string, error)) (string, error) {
+	if cache == nil || key == "" {
+		return upload()
+	}
+
+	cache.mu.Lock()
+	cache.prune()
+	if result, ok := cache.results[key]; ok {
+		cache.mu.Unlock()
+		<-result.done
+		return result.location, result.err
+	}
+	result := &uploadResult{done: make(chan struct{})}
+	cache.results[key] = result
+	cache.mu.Unlock()
+
+	result.location, result.err = upload()
+
+	cache.mu.Lock()
+	if result.err != nil {
+		delete(cache.results, key)
+	} else {
+		result.expires = cache.now().Add(cache.window)
+	}
+	cache.mu.Unlock()
+	close(result.done)
+
+	return result.location, result.err
+}
+
+// prune removes expired results, must be called with mu held
+func (cache *idempotency) prune() {
+	now := cache.now()
+	for key, result := range cache.results {
+		if !result.expires.IsZero() && now.After(result.expires) {
+			delete(cache.results, key)
+		}
+	}
+}
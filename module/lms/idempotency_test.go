@@ -0,0 +1,147 @@
+package lms
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// countingStorage counts the stored files
+type countingStorage struct {
+	Storage
+	mu   sync.Mutex
+	puts int
+}
+
+func (storage *countingStorage) Put(bucket, key, contentType string, body io.Reader) (string, error) {
+	storage.mu.Lock()
+	storage.puts++
+	storage.mu.Unlock()
+	return storage.Storage.Put(bucket, key, contentType, body)
+}
+
+func idempotentModule(t *testing.T) (*Module, *countingStorage, func()) {
+	mod, cleanup := webhookModule(t, nil)
+	storage := &countingStorage{Storage: mod.config.storage}
+	mod.config.storage = storage
+	mod.uploads = newIdempotency(time.Hour)
+	return mod, storage, cleanup
+}
+
+func TestUploadContentIdempotency(t *testing.T) {
+	mod, storage, cleanup := idempotentModule(t)
+	defer cleanup()
+
+	upload := func(key string) string {
+		r := uploadRequest(t, "lesson.zip", lessonPackage)
+		if key != "" {
+			r.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		mod.uploadContent(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("upload failed: %d %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	first := upload("retry-1")
+	if second := upload("retry-1"); second != first {
+		t.Errorf("got %q, expected %q", second, first)
+	}
+	if storage.puts != 1 {
+		t.Errorf("expected a single upload, got %d", storage.puts)
+	}
+
+	upload("retry-2")
+	upload("")
+	if storage.puts != 3 {
+		t.Errorf("expected uploads for new keys, got %d", storage.puts)
+	}
+}
+
+func TestUploadVideoIdempotency(t *testing.T) {
+	mod, storage, cleanup := idempotentModule(t)
+	defer cleanup()
+
+	upload := func(user kb.Slug) string {
+		var body bytes.Buffer
+		form := multipart.NewWriter(&body)
+		form.WriteField("environment", "prod")
+		form.WriteField("clientID", "client")
+		form.WriteField("guid", "guid-"+string(user))
+		part, _ := form.CreateFormFile("file", "training.mp4")
+		part.Write([]byte("video"))
+		form.Close()
+
+		r := httptest.NewRequest("POST", "/lms=/uploadVideo/?idempotencyKey=abc", &body)
+		r.Header.Set("Content-Type", form.FormDataContentType())
+		w := httptest.NewRecorder()
+		mod.server = kb.NewServer(testAuth{user}, testDatabase{})
+		mod.uploadVideo(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("upload failed: %d %s", w.Code, w.Body.String())
+		}
+		return w.Body.String()
+	}
+
+	first := upload("alice")
+	if second := upload("alice"); second != first {
+		t.Errorf("got %q, expected %q", second, first)
+	}
+	if storage.puts != 1 {
+		t.Errorf("expected a single upload, got %d", storage.puts)
+	}
+
+	// keys are scoped by user, so bob's upload is not replaced by alice's
+	if other := upload("bob"); other == first {
+		t.Errorf("bob got the upload of alice %q", other)
+	}
+	if storage.puts != 2 {
+		t.Errorf("expected an upload for another user, got %d", storage.puts)
+	}
+}
+
+func TestIdempotencyExpiry(t *testing.T) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newIdempotency(time.Minute)
+	cache.now = func() time.Time { return now }
+
+	uploads := 0
+	upload := func() (string, error) {
+		uploads++
+		return "location", nil
+	}
+
+	cache.do("key", upload)
+	now = now.Add(30 * time.Second)
+	cache.do("key", upload)
+	if uploads != 1 {
+		t.Errorf("within window: got %d uploads", uploads)
+	}
+
+	now = now.Add(time.Minute)
+	cache.do("key", upload)
+	if uploads != 2 {
+		t.Errorf("after window: got %d uploads", uploads)
+	}
+}
+
+func TestIdempotencyFailure(t *testing.T) {
+	cache := newIdempotency(time.Minute)
+
+	if _, err := cache.do("key", func() (string, error) { return "", io.ErrUnexpectedEOF }); err == nil {
+		t.Fatal("expected error")
+	}
+	location, err := cache.do("key", func() (string, error) { return "location", nil })
+	if err != nil || location != "location" {
+		t.Errorf("retry after failure: got %q, %v", location, err)
+	}
+}
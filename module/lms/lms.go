@@ -1,12 +1,19 @@
 package lms
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"text/template"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/raintreeinc/knowledgebase/kb"
@@ -15,15 +22,152 @@ import (
 var _ kb.Module = &Module{}
 
 type Module struct {
-	server *kb.Server
-	router *mux.Router
+	server  *kb.Server
+	router  *mux.Router
+	config  Config
+	webhook *webhook
+	uploads *idempotency
 }
 
+// Config for the LMS module, empty fields are read from the environment
+type Config struct {
+	// CreateGuest creates the guest user used for LMS uploads
+	CreateGuest bool
+
+	// Backend is BackendS3 or BackendFilesystem, defaults to $KB_LMS_BACKEND or BackendS3
+	Backend string
+	// Dir is the root of the filesystem backend, defaults to $KB_LMS_DIR
+	Dir string
+
+	// Bucket for lessons, defaults to $AWS_KB_BUCKET
+	Bucket string
+	// VideoBucket for videos, defaults to $AWS_KB_VIDEO_BUCKET
+	VideoBucket string
+	// Region of the buckets, defaults to $AWS_REGION
+	Region string
+	// Prefix is the folder of lessons in Bucket, defaults to $AWS_KB_PREFIX
+	Prefix string
+	// VideoPrefix is the folder of videos in VideoBucket, defaults to $AWS_KB_VIDEO_PREFIX
+	VideoPrefix string
+
+	// VideoGroup is the group whose readers may watch, list and delete videos,
+	// defaults to $KB_LMS_VIDEO_GROUP; when empty every user may
+	VideoGroup kb.Slug
+	// LessonGroup is the group whose editors may delete lessons, defaults to $KB_LMS_LESSON_GROUP
+	LessonGroup kb.Slug
+	// MaxVideoLinkExpiry limits how long signed video links are valid,
+	// defaults to DefaultMaxVideoLinkExpiry
+	MaxVideoLinkExpiry time.Duration
+
+	// WebhookURL is notified about uploaded content, defaults to $KB_LMS_WEBHOOK
+	WebhookURL string
+
+	// IdempotencyWindow is how long uploads are remembered by their
+	// Idempotency-Key, defaults to DefaultIdempotencyWindow, < 0 disables
+	IdempotencyWindow time.Duration
+
+	// MaxVideoSize limits the size of uploaded videos in bytes,
+	// defaults to DefaultMaxVideoSize
+	MaxVideoSize int64
+
+	// storage is created from the other settings, unless set by tests
+	storage Storage
+}
+
+func (config Config) withDefaults() Config {
+	if config.Backend == "" {
+		config.Backend = getEnvWithDefault("KB_LMS_BACKEND", BackendS3)
+	}
+	if config.Dir == "" {
+		config.Dir = getEnvWithDefault("KB_LMS_DIR", "lms")
+	}
+	if config.Bucket == "" {
+		config.Bucket = getEnvWithDefault("AWS_KB_BUCKET", "rt-knowledge-base-dev")
+	}
+	if config.VideoBucket == "" {
+		config.VideoBucket = getEnvWithDefault("AWS_KB_VIDEO_BUCKET", "rt-kb-videos")
+	}
+	if config.Region == "" {
+		config.Region = getEnvWithDefault("AWS_REGION", "us-east-1")
+	}
+	if config.Prefix == "" {
+		config.Prefix = getEnvWithDefault("AWS_KB_PREFIX", "H5P/lessons/")
+	}
+	config.Prefix = strings.Trim(config.Prefix, "/") + "/"
+	if config.VideoPrefix == "" {
+		config.VideoPrefix = getEnvWithDefault("AWS_KB_VIDEO_PREFIX", "videos/")
+	}
+	config.VideoPrefix = strings.Trim(config.VideoPrefix, "/") + "/"
+	if config.VideoGroup == "" {
+		if group := os.Getenv("KB_LMS_VIDEO_GROUP"); group != "" {
+			config.VideoGroup = kb.Slugify(group)
+		}
+	}
+	if config.LessonGroup == "" {
+		config.LessonGroup = kb.Slugify(getEnvWithDefault("KB_LMS_LESSON_GROUP", "lms-lessons"))
+	}
+	if config.MaxVideoLinkExpiry <= 0 {
+		config.MaxVideoLinkExpiry = DefaultMaxVideoLinkExpiry
+	}
+	if config.WebhookURL == "" {
+		config.WebhookURL = os.Getenv("KB_LMS_WEBHOOK")
+	}
+	if config.IdempotencyWindow == 0 {
+		config.IdempotencyWindow = DefaultIdempotencyWindow
+	}
+	if config.MaxVideoSize <= 0 {
+		config.MaxVideoSize = DefaultMaxVideoSize
+	}
+
+	if config.storage == nil {
+		switch config.Backend {
+		case BackendS3:
+			config.storage = s3Storage{region: config.Region}
+		case BackendFilesystem:
+			storage, err := newFSStorage(config.Dir)
+			if err != nil {
+				panic("Unable to create LMS storage: " + err.Error())
+			}
+			config.storage = storage
+		default:
+			panic("Unknown LMS backend " + config.Backend)
+		}
+	}
+	return config
+}
+
+// lessonURI returns the location of the lesson entry page
+func (config Config) lessonURI(lessonID string) string {
+	return config.storage.Location(config.Bucket, config.Prefix+lessonID+"/template.html")
+}
+
+// lessonID extracts the lesson from an object key in Bucket
+func (config Config) lessonID(key string) string {
+	if !strings.HasPrefix(key, config.Prefix) {
+		return ""
+	}
+	key = strings.TrimPrefix(key, config.Prefix)
+	if i := strings.Index(key, "/"); i >= 0 {
+		return key[:i]
+	}
+	return ""
+}
+
+// guestName and guestEmail identify the user that LMSTOKEN logins are mapped to
+const (
+	guestName  = "lmsuser"
+	guestEmail = "lmsuser@raintreeinc.com"
+)
+
 // New LMS module that acts as a limited LRS
-func New(server *kb.Server) *Module {
+func New(server *kb.Server, config Config) *Module {
+	config = config.withDefaults()
 	mod := &Module{
-		server: server,
-		router: mux.NewRouter(),
+		server:  server,
+		router:  mux.NewRouter(),
+		config:  config,
+		webhook: newWebhook(config.WebhookURL),
+		uploads: newIdempotency(config.IdempotencyWindow),
 	}
 	mod.init()
 	return mod
@@ -43,14 +187,25 @@ func (mod *Module) init() {
 	// create temp folder for uploads
 	path, _ := os.Getwd()
 	_ = os.Mkdir(filepath.FromSlash(path+"/temp/"), 666)
-	mod.createUser()
+	if mod.config.CreateGuest {
+		err := mod.server.Database.Context("admin").Users().EnsureGuest(guestName, guestEmail, kb.Reader)
+		if err != nil {
+			log.Println("Creating LMS user failed:", err)
+		}
+	}
 
 	mod.router.HandleFunc("/lms=lesson", mod.handler).Methods("GET")
 	mod.router.HandleFunc("/lms=/uploadContent/", mod.getLessonList).Methods("GET")  // list all existing lessons
 	mod.router.HandleFunc("/lms=/uploadContent/", mod.uploadContent).Methods("POST") // create new lesson
+	mod.router.HandleFunc("/lms=/deleteContent/", mod.deleteLesson).Methods("POST")
 	mod.router.HandleFunc("/lms=/uploadVideo/", mod.uploadVideo).Methods("POST")
 	mod.router.HandleFunc("/lms=/uploadVideo/", mod.getSignedVideoLink).Methods("GET")
+	mod.router.HandleFunc("/lms=/uploadURL/", mod.getUploadURL).Methods("GET")
 	mod.router.HandleFunc("/lms=/deleteVideo/", mod.deleteVideo).Methods("POST")
+	mod.router.HandleFunc("/lms=/videoList/", mod.getVideoList).Methods("GET")
+	mod.router.HandleFunc("/lms=/statements/", mod.postStatements).Methods("POST")
+	mod.router.HandleFunc("/lms=/statements/", mod.getStatements).Methods("GET")
+	mod.router.HandleFunc(filesURL+"{bucket}/{key:.+}", mod.serveFile).Methods("GET")
 }
 
 type lessonData struct {
@@ -83,12 +238,7 @@ func (mod *Module) handler(w http.ResponseWriter, r *http.Request) {
 	if strings.HasPrefix(r.URL.RawQuery, "id=") {
 		// todo: validate empty & existence, extract to func
 		lessonID := strings.Replace(r.URL.RawQuery, "id=", "", 1)
-		bucket := getEnvWithDefault("AWS_KB_BUCKET", "rt-knowledge-base-dev")
-		uri := "https://" + bucket + ".s3.amazonaws.com/H5P/lessons/" + lessonID + "/template.html"
-
-		w.Header().Set("Content-Type", "application/json") //MIME to application/json
-		w.WriteHeader(http.StatusOK)                       //status code 200, OK
-		//w.Write([]byte(lessonID))                          //body text
+		uri := mod.config.lessonURI(lessonID)
 
 		lesson := lessonData{
 			LessonID: lessonID,
@@ -96,10 +246,16 @@ func (mod *Module) handler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		t, err := template.New("webpage").Parse(lessonTemplate)
-		check(err)
+		if err != nil {
+			kb.WriteResult(w, err)
+			return
+		}
 
-		err = t.Execute(w, lesson)
-		check(err)
+		w.Header().Set("Content-Type", "application/json") //MIME to application/json
+		w.WriteHeader(http.StatusOK)                       //status code 200, OK
+		if err := t.Execute(w, lesson); err != nil {
+			log.Println("Rendering lesson failed:", err)
+		}
 
 		// todo: send back iframe;
 		// start by sending back just 1 existing page from DB
@@ -110,25 +266,6 @@ func (mod *Module) handler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-//  Create default user for LMS uploads
-func (mod *Module) createUser() {
-	name := "lmsuser"
-	_, err := mod.server.Database.Context("admin").Users().ByID(kb.Slugify(name))
-
-	if err == kb.ErrUserNotExist {
-		user := kb.User{
-			AuthID:       name,
-			AuthProvider: "guest",
-			ID:           kb.Slugify(name),
-			Email:        "lmsuser@raintreeinc.com",
-			Name:         name,
-			MaxAccess:    kb.Reader,
-		}
-
-		_ = mod.server.Database.Context("admin").Users().Create(user)
-	}
-}
-
 func (mod *Module) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	mod.router.ServeHTTP(w, r)
 }
@@ -143,56 +280,313 @@ func (mod *Module) Pages() []kb.PageEntry {
 }
 
 func (mod *Module) getLessonList(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	ListLessonsFromBucket(w)
+	mod.config.ListLessons(w, r)
 }
 
+// uploadContent stores a lesson packaged as H5P or zip and notifies the webhook
 func (mod *Module) uploadContent(w http.ResponseWriter, r *http.Request) {
+	context, ok := mod.server.UserContext(w, r)
+	if !ok {
+		return
+	}
+
 	err, fileNameWithPath := saveFileFromHttpRequestToServer(r)
 	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+	defer os.Remove(fileNameWithPath)
+
+	if err := checkPackage(fileNameWithPath); err != nil {
 		kb.WriteResult(w, err)
 		return
 	}
 
-	if uploadError, uploadedFilePath := uploadFileFromServerToS3(fileNameWithPath); uploadError == nil {
-		fmt.Fprintf(w, uploadedFilePath)
-	} else {
-		fmt.Fprintf(w, uploadError.Error())
+	key := idempotencyKey(r)
+	if key == "" {
+		key = r.FormValue("idempotencyKey")
+	}
+	if key != "" {
+		key = "content/" + string(context.ActiveUserID()) + "/" + key
 	}
 
-	_ = os.Remove(fileNameWithPath)
+	uploadedFilePath, err := mod.uploads.do(key, func() (string, error) {
+		uploadError, uploadedFilePath := mod.config.uploadFile(fileNameWithPath)
+		if uploadError != nil {
+			return "", uploadError
+		}
+		mod.webhook.notify(uploadEvent{
+			LessonID:   mod.config.lessonID(mod.config.keyOf(mod.config.Bucket, uploadedFilePath)),
+			URL:        uploadedFilePath,
+			UploadedBy: context.ActiveUserID(),
+		})
+		return uploadedFilePath, nil
+	})
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+	fmt.Fprint(w, uploadedFilePath)
+}
+
+// deleteLesson removes all files of lesson ?id= from the bucket,
+// only editors of LessonGroup may delete lessons
+func (mod *Module) deleteLesson(w http.ResponseWriter, r *http.Request) {
+	context, ok := mod.server.UserContext(w, r)
+	if !ok {
+		return
+	}
+
+	user := context.ActiveUserID()
+	if context.Access().Rights(mod.config.LessonGroup, user).Level() < kb.Rights(kb.Editor).Level() {
+		kb.WriteError(w, r, kb.ErrAccessDenied)
+		return
+	}
+	kb.WriteResult(w, mod.config.deleteLesson(r.FormValue("id")))
 }
 
-// todo: return nil if req. values are empty?
+// uploadVideo streams the video to storage without keeping it on the server
+//
+// The Idempotency-Key must be given as a header or in the query,
+// since the form is streamed.
 func (mod *Module) uploadVideo(w http.ResponseWriter, r *http.Request) {
-	err, fileNameWithPath := saveFileFromHttpRequestToServer(r)
+	context, ok := mod.server.UserContext(w, r)
+	if !ok {
+		return
+	}
+
+	key := idempotencyKey(r)
+	if key != "" {
+		key = "video/" + string(context.ActiveUserID()) + "/" + key
+	}
+	uploadedFilePath, err := mod.uploads.do(key, func() (string, error) {
+		return mod.config.streamVideo(r)
+	})
 	if err != nil {
 		kb.WriteResult(w, err)
 		return
 	}
+	fmt.Fprint(w, uploadedFilePath)
+}
+
+// getUploadURL returns a presigned url for uploading ?name= directly to S3,
+// with ?kind=video it takes the same parameters as uploadVideo
+func (mod *Module) getUploadURL(w http.ResponseWriter, r *http.Request) {
+	if _, ok := mod.server.UserContext(w, r); !ok {
+		return
+	}
 
-	environment := r.FormValue("environment")
-	clientID := r.FormValue("clientID")
-	guid := r.FormValue("guid")
-	if uploadError, uploadedFilePath := uploadVideoFileFromServerToS3(fileNameWithPath, clientID, environment, guid); uploadError == nil {
-		fmt.Fprintf(w, uploadedFilePath)
-	} else {
-		fmt.Fprintf(w, uploadError.Error())
+	var target uploadTarget
+	var err error
+	name := r.FormValue("name")
+	switch r.FormValue("kind") {
+	case "video":
+		target, err = mod.config.presignVideoUpload(name,
+			r.FormValue("clientID"), r.FormValue("environment"), r.FormValue("guid"))
+	case "", "content":
+		target, err = mod.config.presignContentUpload(name)
+	default:
+		err = kb.BadRequest("Unknown upload kind.")
+	}
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
 	}
 
-	_ = os.Remove(fileNameWithPath)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(target)
 }
 
+// videoAccess verifies that the user is an admin or a reader of VideoGroup,
+// any logged in user has access when VideoGroup is not configured
+func (mod *Module) videoAccess(w http.ResponseWriter, r *http.Request) bool {
+	context, ok := mod.server.UserContext(w, r)
+	if !ok {
+		return false
+	}
+	if mod.config.VideoGroup == "" {
+		return true
+	}
+
+	user := context.ActiveUserID()
+	access := context.Access()
+	if !access.IsAdmin(user) &&
+		access.Rights(mod.config.VideoGroup, user).Level() < kb.Rights(kb.Reader).Level() {
+		kb.WriteError(w, r, kb.ErrAccessDenied)
+		return false
+	}
+	return true
+}
+
+// getSignedVideoLink signs a link to video ?key= for readers of VideoGroup,
+// ?expires= is the validity in seconds, at most MaxVideoLinkExpiry
 func (mod *Module) getSignedVideoLink(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, getSignedLink(r.FormValue("key"), "rt-kb-videos"))
+	if !mod.videoAccess(w, r) {
+		return
+	}
+
+	expires := DefaultVideoLinkExpiry
+	if param := r.FormValue("expires"); param != "" {
+		seconds, err := strconv.Atoi(param)
+		if err != nil {
+			kb.WriteError(w, r, kb.BadRequest("Invalid expires."))
+			return
+		}
+		expires = time.Duration(seconds) * time.Second
+	}
+
+	link, err := mod.config.signedVideoLink(r.FormValue("key"), expires)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+	fmt.Fprint(w, link)
 }
 
+// getVideoList lists uploaded videos, optionally filtered by
+// ?environment=, ?clientID= and ?guid=; ?token= continues a previous page
+func (mod *Module) getVideoList(w http.ResponseWriter, r *http.Request) {
+	if !mod.videoAccess(w, r) {
+		return
+	}
+
+	limit := 0
+	if param := r.FormValue("limit"); param != "" {
+		var err error
+		limit, err = strconv.Atoi(param)
+		if err != nil {
+			kb.WriteError(w, r, kb.BadRequest("Invalid limit."))
+			return
+		}
+	}
+
+	page, err := mod.config.listVideos(
+		r.FormValue("environment"), r.FormValue("clientID"), r.FormValue("guid"),
+		r.FormValue("token"), limit)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(page)
+}
+
+// deleteVideo removes video ?key=, only readers of VideoGroup may delete videos
 func (mod *Module) deleteVideo(w http.ResponseWriter, r *http.Request) {
-	fmt.Fprintf(w, deleteVideoFileFromS3(r.FormValue("key"), "rt-kb-videos"))
+	if !mod.videoAccess(w, r) {
+		return
+	}
+	if err := mod.config.deleteVideoFile(r.FormValue("key")); err != nil {
+		kb.WriteResult(w, err)
+		return
+	}
+	fmt.Fprint(w, "OK")
+}
+
+// serveFile serves files of the filesystem backend,
+// files outside of Bucket require a link from SignedURL
+func (mod *Module) serveFile(w http.ResponseWriter, r *http.Request) {
+	storage, ok := mod.config.storage.(*fsStorage)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	bucket, key := mux.Vars(r)["bucket"], mux.Vars(r)["key"]
+	if bucket != mod.config.Bucket && !storage.verify(bucket, key, r.URL.Query()) {
+		kb.WriteError(w, r, kb.ErrAccessDenied)
+		return
+	}
+
+	name, err := storage.path(bucket, key)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+	if info, err := os.Stat(name); err != nil || info.IsDir() {
+		kb.WriteError(w, r, errFileNotExist)
+		return
+	}
+	http.ServeFile(w, r, name)
 }
 
-func check(err error) {
+// postStatements records a single xAPI statement or an array of them
+// for the authenticated user and responds with the statement ids
+func (mod *Module) postStatements(w http.ResponseWriter, r *http.Request) {
+	context, ok := mod.server.UserContext(w, r)
+	if !ok {
+		return
+	}
+
+	statements, err := readStatements(r.Body)
 	if err != nil {
-		println(err)
+		kb.WriteError(w, r, kb.BadRequest(err.Error()))
+		return
+	}
+	for i := range statements {
+		if err := statements[i].Validate(); err != nil {
+			kb.WriteError(w, r, kb.BadRequest(err.Error()))
+			return
+		}
+	}
+
+	ids := []string{}
+	for _, statement := range statements {
+		id, err := context.Statements().Record(statement)
+		if err != nil {
+			kb.WriteError(w, r, err)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ids)
+}
+
+// getStatements lists statements of ?actor=, by default of the authenticated user
+func (mod *Module) getStatements(w http.ResponseWriter, r *http.Request) {
+	context, ok := mod.server.UserContext(w, r)
+	if !ok {
+		return
+	}
+
+	actor := context.ActiveUserID()
+	if param := r.FormValue("actor"); param != "" {
+		actor = kb.Slugify(param)
+	}
+
+	statements, err := context.Statements().ByActor(actor)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	var result struct {
+		Statements []kb.Statement `json:"statements"`
+	}
+	result.Statements = statements
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func readStatements(r io.Reader) ([]kb.Statement, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		var statements []kb.Statement
+		err := json.Unmarshal(trimmed, &statements)
+		return statements, err
+	}
+
+	var statement kb.Statement
+	if err := json.Unmarshal(data, &statement); err != nil {
+		return nil, err
 	}
+	return []kb.Statement{statement}, nil
 }
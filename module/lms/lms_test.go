@@ -0,0 +1,92 @@
+package lms
+
+import (
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestConfigPrefix(t *testing.T) {
+	config := Config{
+		Bucket:      "tenant-bucket",
+		VideoBucket: "tenant-videos",
+		Region:      "eu-west-1",
+		Prefix:      "tenant/lessons",
+	}.withDefaults()
+
+	if config.Prefix != "tenant/lessons/" {
+		t.Errorf("prefix not normalized: %q", config.Prefix)
+	}
+
+	exp := "https://tenant-bucket.s3.amazonaws.com/tenant/lessons/abc/template.html"
+	if got := config.lessonURI("abc"); got != exp {
+		t.Errorf("lessonURI: got %q exp %q", got, exp)
+	}
+
+	if got := config.lessonID("tenant/lessons/abc/content/x.json"); got != "abc" {
+		t.Errorf("lessonID: got %q", got)
+	}
+	if got := config.lessonID("H5P/lessons/abc/template.html"); got != "" {
+		t.Errorf("lessonID outside prefix: got %q", got)
+	}
+
+	mod := &Module{config: config}
+	w := httptest.NewRecorder()
+	mod.handler(w, httptest.NewRequest("GET", "/lms=lesson?id=abc", nil))
+	if !strings.Contains(w.Body.String(), exp) {
+		t.Errorf("handler does not reference %q:\n%s", exp, w.Body.String())
+	}
+}
+
+func TestConfigEnvFallback(t *testing.T) {
+	defer restoreEnv("AWS_KB_BUCKET", "AWS_KB_PREFIX")()
+	os.Setenv("AWS_KB_BUCKET", "env-bucket")
+	os.Unsetenv("AWS_KB_PREFIX")
+
+	config := Config{Prefix: "configured/"}.withDefaults()
+	if config.Bucket != "env-bucket" {
+		t.Errorf("bucket: got %q", config.Bucket)
+	}
+	if config.Prefix != "configured/" {
+		t.Errorf("prefix: got %q", config.Prefix)
+	}
+}
+
+func restoreEnv(keys ...string) func() {
+	values := map[string]*string{}
+	for _, key := range keys {
+		if value, ok := os.LookupEnv(key); ok {
+			values[key] = &value
+		} else {
+			values[key] = nil
+		}
+	}
+	return func() {
+		for key, value := range values {
+			if value == nil {
+				os.Unsetenv(key)
+			} else {
+				os.Setenv(key, *value)
+			}
+		}
+	}
+}
+
+func TestReadStatements(t *testing.T) {
+	single := `{"actor":{"name":"Alice"},"verb":{"id":"http://adlnet.gov/expapi/verbs/completed"},"object":{"id":"lesson"}}`
+
+	statements, err := readStatements(strings.NewReader(single))
+	if err != nil || len(statements) != 1 || statements[0].Verb.ID != "http://adlnet.gov/expapi/verbs/completed" {
+		t.Errorf("single: got %+v %v", statements, err)
+	}
+
+	statements, err = readStatements(strings.NewReader(" [" + single + "," + single + "]"))
+	if err != nil || len(statements) != 2 {
+		t.Errorf("array: got %+v %v", statements, err)
+	}
+
+	if _, err := readStatements(strings.NewReader("{")); err == nil {
+		t.Error("expected error for invalid json")
+	}
+}
@@ -0,0 +1,205 @@
+package lms
+
+import (
+	"context"
+	"io"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+var _ Storage = s3Storage{}
+var _ uploadSigner = s3Storage{}
+
+// s3Storage keeps files in S3 buckets
+type s3Storage struct {
+	region string
+	// client is used instead of creating a new session, for tests
+	client s3iface.S3API
+}
+
+// newS3 creates a client for the configured region.
+// Uses ENV variables AWS_ACCESS_KEY_ID & AWS_SECRET_ACCESS_KEY
+func (storage s3Storage) newS3() (s3iface.S3API, error) {
+	if storage.client != nil {
+		return storage.client, nil
+	}
+	sess, err := session.NewSession(&aws.Config{Region: aws.String(storage.region)})
+	if err != nil {
+		return nil, err
+	}
+	return s3.New(sess), nil
+}
+
+// Location returns the public location of key in bucket
+func (storage s3Storage) Location(bucket, key string) string {
+	return "https://" + bucket + ".s3.amazonaws.com/" + key
+}
+
+// Put uploads body in parts, without knowing its size in advance
+func (storage s3Storage) Put(bucket, key, contentType string, body io.Reader) (string, error) {
+	svc, err := storage.newS3()
+	if err != nil {
+		return "", err
+	}
+
+	// To abort the upload if it takes more than timeout seconds
+	ctx, cancelFn := context.WithTimeout(context.Background(), timeout)
+	defer cancelFn()
+
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	uploader := s3manager.NewUploaderWithClient(svc)
+	if _, err := uploader.UploadWithContext(ctx, input); err != nil {
+		return "", err
+	}
+
+	log.Println("HTTP -> S3 upload complete: " + key)
+	return storage.Location(bucket, key), nil
+}
+
+func (storage s3Storage) Get(bucket, key string) (io.ReadCloser, error) {
+	svc, err := storage.newS3()
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := svc.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+		return nil, errFileNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (storage s3Storage) Delete(bucket, key string) error {
+	svc, err := storage.newS3()
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (storage s3Storage) SignedURL(bucket, key string, expires time.Duration) (string, error) {
+	svc, err := storage.newS3()
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := svc.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
+
+func (storage s3Storage) SignedUploadURL(bucket, key string, expires time.Duration) (string, error) {
+	svc, err := storage.newS3()
+	if err != nil {
+		return "", err
+	}
+
+	req, _ := svc.PutObjectRequest(&s3.PutObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return req.Presign(expires)
+}
+
+func (storage s3Storage) List(bucket, prefix string) ([]string, error) {
+	svc, err := storage.newS3()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	err = svc.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, item := range page.Contents {
+			keys = append(keys, *item.Key)
+		}
+		// continue with the next page
+		return true
+	})
+	return keys, err
+}
+
+func (storage s3Storage) ListPage(bucket, prefix, token string, limit int) ([]string, string, error) {
+	svc, err := storage.newS3()
+	if err != nil {
+		return nil, "", err
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(limit)),
+	}
+	if token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	page, err := svc.ListObjectsV2(input)
+	if err != nil {
+		return nil, "", err
+	}
+
+	keys := []string{}
+	for _, item := range page.Contents {
+		keys = append(keys, *item.Key)
+	}
+	next := ""
+	if aws.BoolValue(page.IsTruncated) {
+		next = aws.StringValue(page.NextContinuationToken)
+	}
+	return keys, next, nil
+}
+
+// todo: error out only if bucket does not exist and err. happens; i.e ignore bucket exists errors
+func (storage s3Storage) createBucket(bucketName string) error {
+	svc, err := storage.newS3()
+	if err != nil {
+		return err
+	}
+
+	_, err = svc.CreateBucket(&s3.CreateBucketInput{
+		Bucket: aws.String("rt-videos-" + bucketName),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = svc.WaitUntilBucketExists(&s3.HeadBucketInput{
+		Bucket: aws.String(bucketName),
+	})
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package lms
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// Storage keeps uploaded lessons and videos,
+// keys are relative paths separated by "/"
+type Storage interface {
+	// Put stores body under key and returns its public location
+	Put(bucket, key, contentType string, body io.Reader) (string, error)
+	Get(bucket, key string) (io.ReadCloser, error)
+	Delete(bucket, key string) error
+	// SignedURL returns a link to key that is valid for the expires duration
+	SignedURL(bucket, key string, expires time.Duration) (string, error)
+	// List returns all keys that start with prefix
+	List(bucket, prefix string) ([]string, error)
+	// ListPage returns at most limit keys that start with prefix, continuing
+	// after token from a previous page; next is empty on the last page
+	ListPage(bucket, prefix, token string, limit int) (keys []string, next string, err error)
+	// Location returns the public location of key
+	Location(bucket, key string) string
+}
+
+// uploadSigner is implemented by storages that accept direct uploads
+type uploadSigner interface {
+	SignedUploadURL(bucket, key string, expires time.Duration) (string, error)
+}
+
+// Storage backends for Config.Backend
+const (
+	BackendS3         = "s3"
+	BackendFilesystem = "filesystem"
+)
+
+var errFileNotExist = &kb.HTTPError{
+	Status:  http.StatusNotFound,
+	Code:    "not-found",
+	Message: "File does not exist.",
+}
+
+var errInvalidKey = kb.BadRequest("Invalid file name.")
+
+// filesURL is where the module serves files of the filesystem backend
+const filesURL = "/lms=/files/"
+
+var _ Storage = &fsStorage{}
+
+// fsStorage keeps files in dir, each bucket in a separate folder
+type fsStorage struct {
+	dir string
+	// signingKey is used for signing links to files
+	signingKey []byte
+}
+
+func newFSStorage(dir string) (*fsStorage, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return &fsStorage{dir: dir, signingKey: key}, nil
+}
+
+// path converts a key to a file path, ensuring it stays inside the bucket
+func (storage *fsStorage) path(bucket, key string) (string, error) {
+	if bucket == "" || strings.ContainsAny(bucket, `/\`) || bucket == "." || bucket == ".." {
+		return "", errInvalidKey
+	}
+	clean := path.Clean("/" + key)
+	if key == "" || clean == "/" || clean != "/"+key {
+		return "", errInvalidKey
+	}
+	return filepath.Join(storage.dir, bucket, filepath.FromSlash(clean)), nil
+}
+
+func (storage *fsStorage) Location(bucket, key string) string {
+	return filesURL + bucket + "/" + key
+}
+
+func (storage *fsStorage) Put(bucket, key, contentType string, body io.Reader) (string, error) {
+	name, err := storage.path(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return "", err
+	}
+
+	// write to a temporary file, such that readers never see partial files
+	file, err := ioutil.TempFile(filepath.Dir(name), ".upload-")
+	if err != nil {
+		return "", err
+	}
+	_, err = io.Copy(file, body)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), name)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", err
+	}
+
+	return storage.Location(bucket, key), nil
+}
+
+func (storage *fsStorage) Get(bucket, key string) (io.ReadCloser, error) {
+	name, err := storage.path(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(name)
+	if os.IsNotExist(err) {
+		return nil, errFileNotExist
+	}
+	return file, err
+}
+
+func (storage *fsStorage) Delete(bucket, key string) error {
+	name, err := storage.path(bucket, key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(name); err != nil {
+		if os.IsNotExist(err) {
+			return errFileNotExist
+		}
+		return err
+	}
+
+	// remove folders that became empty, failing at the first non-empty one
+	root := filepath.Join(storage.dir, bucket)
+	for dir := filepath.Dir(name); dir != root && strings.HasPrefix(dir, root); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+func (storage *fsStorage) List(bucket, prefix string) ([]string, error) {
+	root := filepath.Join(storage.dir, bucket)
+
+	// only walk the folder that can contain the prefix
+	start := root
+	if i := strings.LastIndex(prefix, "/"); i >= 0 {
+		dir, err := storage.path(bucket, prefix[:i])
+		if err != nil {
+			return nil, err
+		}
+		start = dir
+	}
+
+	keys := []string{}
+	err := filepath.Walk(start, func(name string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, name)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	return keys, err
+}
+
+// ListPage uses the last key of the previous page as the token
+func (storage *fsStorage) ListPage(bucket, prefix, token string, limit int) ([]string, string, error) {
+	keys, err := storage.List(bucket, prefix)
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Strings(keys)
+
+	start := sort.SearchStrings(keys, token)
+	if start < len(keys) && keys[start] == token {
+		start++
+	}
+	keys = keys[start:]
+
+	if len(keys) <= limit {
+		return keys, "", nil
+	}
+	keys = keys[:limit]
+	return keys, keys[len(keys)-1], nil
+}
+
+func (storage *fsStorage) SignedURL(bucket, key string, expires time.Duration) (string, error) {
+	if _, err := storage.path(bucket, key); err != nil {
+		return "", err
+	}
+
+	deadline := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+	query := url.Values{}
+	query.Set("expires", deadline)
+	query.Set("signature", storage.sign(bucket, key, deadline))
+	return storage.Location(bucket, key) + "?" + query.Encode(), nil
+}
+
+func (storage *fsStorage) sign(bucket, key, deadline string) string {
+	mac := hmac.New(sha256.New, storage.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%s", bucket, key, deadline)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify checks a link created by SignedURL
+func (storage *fsStorage) verify(bucket, key string, query url.Values) bool {
+	deadline := query.Get("expires")
+	unix, err := strconv.ParseInt(deadline, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return false
+	}
+	expected := storage.sign(bucket, key, deadline)
+	return hmac.Equal([]byte(expected), []byte(query.Get("signature")))
+}
@@ -0,0 +1,300 @@
+package lms
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func filesystemConfig(t *testing.T) (Config, string) {
+	dir, err := ioutil.TempDir("", "lms-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := Config{
+		Backend:     BackendFilesystem,
+		Dir:         dir,
+		Bucket:      "lessons",
+		VideoBucket: "videos",
+	}.withDefaults()
+	return config, dir
+}
+
+func TestFilesystemLessonCycle(t *testing.T) {
+	config, dir := filesystemConfig(t)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "template.html")
+	if err := ioutil.WriteFile(source, []byte("<html>lesson</html>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	err, location := config.uploadSingleFile(config.Prefix+"abc/template.html", source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if location != config.lessonURI("abc") {
+		t.Errorf("unexpected location %q", location)
+	}
+	if _, err := config.storage.Put(config.Bucket, config.Prefix+"abc/content/data.json", "", strings.NewReader("{}")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.storage.Put(config.Bucket, config.Prefix+"xyz/template.html", "", strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	config.ListLessons(w, httptest.NewRequest("GET", "/lms=/uploadContent/", nil))
+	var result struct {
+		Lessons []string `json:"lessons"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Lessons) != 2 || result.Lessons[0] != config.lessonURI("abc") || result.Lessons[1] != config.lessonURI("xyz") {
+		t.Errorf("unexpected lessons %v", result.Lessons)
+	}
+
+	file, err := config.storage.Get(config.Bucket, config.Prefix+"abc/template.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := ioutil.ReadAll(file)
+	file.Close()
+	if string(data) != "<html>lesson</html>" {
+		t.Errorf("unexpected content %q", data)
+	}
+
+	if err := config.deleteLesson("abc"); err != nil {
+		t.Fatal(err)
+	}
+	keys, err := config.storage.List(config.Bucket, config.Prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != config.Prefix+"xyz/template.html" {
+		t.Errorf("unexpected keys after delete %v", keys)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "lessons", "H5P", "lessons", "abc")); !os.IsNotExist(err) {
+		t.Errorf("lesson folder was not removed: %v", err)
+	}
+	if err := config.deleteLesson("abc"); err != errLessonNotExist {
+		t.Errorf("deleting twice: got %v", err)
+	}
+}
+
+func TestFilesystemInvalidKeys(t *testing.T) {
+	config, dir := filesystemConfig(t)
+	defer os.RemoveAll(dir)
+
+	for _, key := range []string{"", "../escape", "a/../../escape", "/absolute", "a//b"} {
+		if _, err := config.storage.Put(config.Bucket, key, "", strings.NewReader("x")); err != errInvalidKey {
+			t.Errorf("%q: expected invalid key, got %v", key, err)
+		}
+	}
+	if _, err := config.storage.Put("..", "escape", "", strings.NewReader("x")); err != errInvalidKey {
+		t.Errorf("bucket ..: expected invalid key, got %v", err)
+	}
+}
+
+func TestFilesystemSignedVideo(t *testing.T) {
+	config, dir := filesystemConfig(t)
+	defer os.RemoveAll(dir)
+	mod := &Module{config: config}
+
+	location, err := config.storage.Put(config.VideoBucket, "videos/intro.mp4", "video/mp4", strings.NewReader("video"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts := strings.SplitN(strings.TrimPrefix(u.Path, filesURL), "/", 2)
+		r := httptest.NewRequest("GET", target, nil)
+		r = mux.SetURLVars(r, map[string]string{"bucket": parts[0], "key": parts[1]})
+		w := httptest.NewRecorder()
+		mod.serveFile(w, r)
+		return w
+	}
+
+	if w := serve(location); w.Code != http.StatusForbidden {
+		t.Errorf("unsigned video: got %d", w.Code)
+	}
+
+	link, err := config.signedVideoLink(location, DefaultVideoLinkExpiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed, err := base64.StdEncoding.DecodeString(link)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := serve(string(signed)); w.Code != http.StatusOK || w.Body.String() != "video" {
+		t.Errorf("signed video: got %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(strings.Replace(string(signed), "intro", "other", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("signature reused for other file: got %d", w.Code)
+	}
+
+	if err := config.deleteVideoFile(location); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := config.storage.Get(config.VideoBucket, "videos/intro.mp4"); err != errFileNotExist {
+		t.Errorf("video not deleted: %v", err)
+	}
+
+	if _, err := config.presignContentUpload("image.png"); err != errUploadURLUnsupported {
+		t.Errorf("direct upload: got %v", err)
+	}
+}
+
+func TestSignedVideoLinkExpiry(t *testing.T) {
+	config, dir := filesystemConfig(t)
+	defer os.RemoveAll(dir)
+
+	key := config.VideoPrefix + "prod/client/2021/guid_intro.mp4"
+	for _, test := range []struct {
+		Expires time.Duration
+		Valid   bool
+	}{
+		{time.Second, true},
+		{config.MaxVideoLinkExpiry, true},
+		{config.MaxVideoLinkExpiry + time.Second, false},
+		{0, false},
+		{-time.Minute, false},
+	} {
+		_, err := config.signedVideoLink(key, test.Expires)
+		if test.Valid && err != nil {
+			t.Errorf("%v: unexpected error %v", test.Expires, err)
+		}
+		if !test.Valid && err == nil {
+			t.Errorf("%v: expected expiry to be rejected", test.Expires)
+		}
+	}
+}
+
+func TestSignedVideoLinkPrefix(t *testing.T) {
+	config, dir := filesystemConfig(t)
+	defer os.RemoveAll(dir)
+
+	for _, key := range []string{
+		"lessons/secret.mp4",
+		config.VideoPrefix + "../lessons/secret.mp4",
+		config.storage.Location(config.VideoBucket, "other/secret.mp4"),
+	} {
+		if _, err := config.signedVideoLink(key, time.Minute); err != errVideoKeyOutsidePrefix {
+			t.Errorf("%q: got %v, expected key to be rejected", key, err)
+		}
+	}
+}
+
+func TestSignedVideoLinkAccess(t *testing.T) {
+	mod, cleanup := webhookModule(t, nil)
+	defer cleanup()
+
+	request := func(user kb.Slug, handler http.HandlerFunc, method, query string) *httptest.ResponseRecorder {
+		mod.server = kb.NewServer(testAuth{user}, testDatabase{})
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, "/lms=/uploadVideo/?"+query, nil))
+		return w
+	}
+
+	key := "key=" + url.QueryEscape(mod.config.VideoPrefix+"prod/client/2021/guid_intro.mp4")
+	if w := request("mallory", mod.getSignedVideoLink, "GET", key); w.Code != http.StatusOK {
+		t.Errorf("without video group: got %d %s", w.Code, w.Body.String())
+	}
+
+	mod.config.VideoGroup = "lms-videos"
+	if w := request("alice", mod.getSignedVideoLink, "GET", key+"&expires=60"); w.Code != http.StatusOK {
+		t.Errorf("reader: got %d %s", w.Code, w.Body.String())
+	}
+	if w := request("admin", mod.getSignedVideoLink, "GET", key); w.Code != http.StatusOK {
+		t.Errorf("admin: got %d %s", w.Code, w.Body.String())
+	}
+	if w := request("alice", mod.getSignedVideoLink, "GET", key+"&expires=999999"); w.Code != http.StatusBadRequest {
+		t.Errorf("expiry over maximum: got %d", w.Code)
+	}
+	if w := request("mallory", mod.getSignedVideoLink, "GET", key); w.Code != http.StatusForbidden {
+		t.Errorf("user without access: got %d", w.Code)
+	}
+	if w := request("mallory", mod.getVideoList, "GET", ""); w.Code != http.StatusForbidden {
+		t.Errorf("listing without access: got %d", w.Code)
+	}
+	if w := request("mallory", mod.deleteVideo, "POST", key); w.Code != http.StatusForbidden {
+		t.Errorf("deleting without access: got %d", w.Code)
+	}
+	if w := request("alice", mod.getVideoList, "GET", ""); w.Code != http.StatusOK {
+		t.Errorf("listing as reader: got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestDeleteLessonAccess(t *testing.T) {
+	mod, cleanup := webhookModule(t, nil)
+	defer cleanup()
+
+	config := mod.config
+	if _, err := config.storage.Put(config.Bucket, config.Prefix+"abc/template.html", "", strings.NewReader("")); err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(user kb.Slug) *httptest.ResponseRecorder {
+		mod.server = kb.NewServer(testAuth{user}, testDatabase{})
+		w := httptest.NewRecorder()
+		mod.deleteLesson(w, httptest.NewRequest("POST", "/lms=/deleteContent/?id=abc", nil))
+		return w
+	}
+
+	if w := request("alice"); w.Code != http.StatusForbidden {
+		t.Errorf("reader: got %d", w.Code)
+	}
+	if _, err := config.storage.Get(config.Bucket, config.Prefix+"abc/template.html"); err != nil {
+		t.Errorf("lesson deleted by reader: %v", err)
+	}
+	if w := request("editor"); w.Code != http.StatusOK {
+		t.Errorf("editor: got %d %s", w.Code, w.Body.String())
+	}
+	if _, err := config.storage.Get(config.Bucket, config.Prefix+"abc/template.html"); err != errFileNotExist {
+		t.Errorf("lesson not deleted by editor: %v", err)
+	}
+}
+
+func TestFilesystemListPage(t *testing.T) {
+	config, dir := filesystemConfig(t)
+	defer os.RemoveAll(dir)
+
+	for _, key := range []string{"videos/a/1.mp4", "videos/a-b/2.mp4", "videos/b/3.mp4"} {
+		if _, err := config.storage.Put(config.VideoBucket, key, "", strings.NewReader("")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	keys, next, err := config.storage.ListPage(config.VideoBucket, "videos/", "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 || keys[0] != "videos/a-b/2.mp4" || keys[1] != "videos/a/1.mp4" || next == "" {
+		t.Fatalf("first page: got %v %q", keys, next)
+	}
+
+	keys, next, err = config.storage.ListPage(config.VideoBucket, "videos/", next, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "videos/b/3.mp4" || next != "" {
+		t.Errorf("last page: got %v %q", keys, next)
+	}
+}
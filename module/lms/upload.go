@@ -0,0 +1,565 @@
+package lms
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+const timeout = 60 * 60 * time.Second // max time for single upload (1h)
+
+// videoKey returns the location of an uploaded video in VideoBucket
+func (config Config) videoKey(fileName, clientID, environment, guid string) string {
+	year := strconv.Itoa(time.Now().Year())
+	return config.VideoPrefix + environment + "/" + clientID + "/" + year + "/" + guid + "_" + filepath.Base(fileName)
+}
+
+// Limits for a single page of listVideos
+const (
+	defaultVideoPageSize = 100
+	maxVideoPageSize     = 1000
+)
+
+// videoPage is a single page of uploaded videos
+type videoPage struct {
+	Videos []string `json:"videos"`
+	// Next continues the listing, it is empty on the last page
+	Next string `json:"next,omitempty"`
+}
+
+// listVideos lists keys of uploaded videos, filtered by the values used in uploadVideo.
+// Filters that are not a prefix of the key are applied per page, such pages may be shorter.
+func (config Config) listVideos(environment, clientID, guid, token string, limit int) (videoPage, error) {
+	if limit <= 0 {
+		limit = defaultVideoPageSize
+	}
+	if limit > maxVideoPageSize {
+		limit = maxVideoPageSize
+	}
+
+	prefix := config.VideoPrefix
+	if environment != "" {
+		prefix += environment + "/"
+		if clientID != "" {
+			prefix += clientID + "/"
+		}
+	}
+
+	keys, next, err := config.storage.ListPage(config.VideoBucket, prefix, token, limit)
+	if err != nil {
+		return videoPage{}, err
+	}
+
+	page := videoPage{Videos: []string{}, Next: next}
+	for _, key := range keys {
+		// videos/environment/clientID/year/guid_name
+		parts := strings.SplitN(strings.TrimPrefix(key, config.VideoPrefix), "/", 4)
+		if len(parts) != 4 {
+			continue
+		}
+		if clientID != "" && parts[1] != clientID {
+			continue
+		}
+		if guid != "" && !strings.HasPrefix(parts[3], guid+"_") {
+			continue
+		}
+		page.Videos = append(page.Videos, key)
+	}
+	return page, nil
+}
+
+// DefaultMaxVideoSize is the default for Config.MaxVideoSize (2GB)
+const DefaultMaxVideoSize = 2 << 30
+
+var errVideoTooLarge = kb.BadRequest("Upload error: video is too large.")
+
+// sizeLimiter fails with errVideoTooLarge once more than remaining bytes are read
+type sizeLimiter struct {
+	reader    io.Reader
+	remaining int64
+	exceeded  bool
+}
+
+func (limiter *sizeLimiter) Read(p []byte) (int, error) {
+	n, err := limiter.reader.Read(p)
+	limiter.remaining -= int64(n)
+	if limiter.remaining < 0 {
+		limiter.exceeded = true
+		return n, errVideoTooLarge
+	}
+	return n, err
+}
+
+// videoTypes are used when the browser does not send the type of the video
+var videoTypes = map[string]string{
+	".avi":  "video/x-msvideo",
+	".m4v":  "video/x-m4v",
+	".mkv":  "video/x-matroska",
+	".mov":  "video/quicktime",
+	".mp4":  "video/mp4",
+	".mpeg": "video/mpeg",
+	".mpg":  "video/mpeg",
+	".ogv":  "video/ogg",
+	".webm": "video/webm",
+	".wmv":  "video/x-ms-wmv",
+}
+
+// videoContentType returns the declared type of the part,
+// falling back to the extension for generic types
+func videoContentType(part *multipart.Part) string {
+	contentType, _, _ := mime.ParseMediaType(part.Header.Get("Content-Type"))
+	if contentType != "" && contentType != "application/octet-stream" {
+		return contentType
+	}
+
+	ext := strings.ToLower(filepath.Ext(part.FileName()))
+	if videoType, ok := videoTypes[ext]; ok {
+		return videoType
+	}
+	if byExtension := mime.TypeByExtension(ext); byExtension != "" {
+		return byExtension
+	}
+	return contentType
+}
+
+// maxFormValueSize limits the form values read while streaming uploads
+const maxFormValueSize = 1 << 10
+
+// streamVideo uploads the "file" part of a multipart request directly to storage;
+// the values environment, clientID and guid must precede the file or be given in the query.
+// Files that are not videos or are larger than MaxVideoSize are rejected.
+// Returns the location if successful
+func (config Config) streamVideo(r *http.Request) (string, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return "", kb.BadRequest("Upload error: " + err.Error())
+	}
+
+	values := r.URL.Query()
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return "", kb.BadRequest("Upload error: file missing.")
+		}
+		if err != nil {
+			return "", kb.BadRequest("Upload error: " + err.Error())
+		}
+
+		if part.FormName() != "file" {
+			value, err := ioutil.ReadAll(io.LimitReader(part, maxFormValueSize))
+			if err != nil {
+				return "", err
+			}
+			values.Set(part.FormName(), string(value))
+			continue
+		}
+
+		if part.FileName() == "" {
+			return "", kb.BadRequest("Upload error: file name missing.")
+		}
+
+		contentType := videoContentType(part)
+		if !strings.HasPrefix(contentType, "video/") {
+			return "", kb.BadRequest("Upload error: " + part.FileName() + " is not a video.")
+		}
+
+		key := config.videoKey(part.FileName(), values.Get("clientID"), values.Get("environment"), values.Get("guid"))
+		limiter := &sizeLimiter{reader: part, remaining: config.MaxVideoSize}
+		location, err := config.storage.Put(config.VideoBucket, key, contentType, limiter)
+		if limiter.exceeded {
+			// storage may wrap the error of the reader
+			return "", errVideoTooLarge
+		}
+		return location, err
+	}
+}
+
+// uploadURLExpiry is how long a presigned upload url is valid
+const uploadURLExpiry = 15 * time.Minute
+
+var errUploadURLUnsupported = &kb.HTTPError{
+	Status:  http.StatusNotImplemented,
+	Code:    "not-supported",
+	Message: "Storage does not support direct uploads.",
+}
+
+// uploadTarget describes where the browser should upload a file
+type uploadTarget struct {
+	// URL accepts a PUT request with the file contents
+	URL string `json:"url"`
+	Key string `json:"key"`
+	// Location is where the file can be found after uploading
+	Location string    `json:"location"`
+	Expires  time.Time `json:"expires"`
+}
+
+// presignVideoUpload creates an upload url for a video,
+// the video ends up at the same key as with uploadVideo
+func (config Config) presignVideoUpload(fileName, clientID, environment, guid string) (uploadTarget, error) {
+	return config.presignUpload(config.VideoBucket, config.videoKey(fileName, clientID, environment, guid))
+}
+
+// presignContentUpload creates an upload url for a single content file,
+// H5P packages must be unpacked on the server and cannot be uploaded directly
+func (config Config) presignContentUpload(fileName string) (uploadTarget, error) {
+	if strings.EqualFold(filepath.Ext(fileName), ".h5p") {
+		return uploadTarget{}, kb.BadRequest("H5P packages must be uploaded through /lms=/uploadContent/.")
+	}
+	return config.presignUpload(config.Bucket, filepath.Base(fileName))
+}
+
+func (config Config) presignUpload(bucket, key string) (uploadTarget, error) {
+	if path.Base(key) == "." || path.Base(key) == "/" {
+		return uploadTarget{}, kb.BadRequest("File name missing.")
+	}
+
+	signer, ok := config.storage.(uploadSigner)
+	if !ok {
+		return uploadTarget{}, errUploadURLUnsupported
+	}
+
+	expires := time.Now().Add(uploadURLExpiry)
+	urlStr, err := signer.SignedUploadURL(bucket, key, uploadURLExpiry)
+	if err != nil {
+		return uploadTarget{}, err
+	}
+
+	return uploadTarget{
+		URL:      urlStr,
+		Key:      key,
+		Location: config.storage.Location(bucket, key),
+		Expires:  expires,
+	}, nil
+}
+
+// keyOf converts a location returned by Put to a key
+func (config Config) keyOf(bucket, location string) string {
+	return strings.TrimPrefix(location, config.storage.Location(bucket, ""))
+}
+
+// Deletes single video file, key may also be its location
+func (config Config) deleteVideoFile(key string) error {
+	return config.storage.Delete(config.VideoBucket, config.keyOf(config.VideoBucket, key))
+}
+
+// Expiry of links from signedVideoLink
+const (
+	DefaultVideoLinkExpiry    = 8 * time.Hour
+	DefaultMaxVideoLinkExpiry = 24 * time.Hour
+)
+
+var errVideoKeyOutsidePrefix = kb.BadRequest("Video key is outside of the video folder.")
+
+// signedVideoLink returns a base64 encoded link to a video that is valid
+// for expires, key may also be its location and must be inside VideoPrefix
+func (config Config) signedVideoLink(key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > config.MaxVideoLinkExpiry {
+		return "", kb.BadRequest("Link expiry must be between 1s and " + config.MaxVideoLinkExpiry.String() + ".")
+	}
+
+	key = config.keyOf(config.VideoBucket, key)
+	if !strings.HasPrefix(key, config.VideoPrefix) || path.Clean(key) != key {
+		return "", errVideoKeyOutsidePrefix
+	}
+
+	urlStr, err := config.storage.SignedURL(config.VideoBucket, key, expires)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(urlStr)), nil
+}
+
+var errLessonNotExist = &kb.HTTPError{
+	Status:  http.StatusNotFound,
+	Code:    "not-found",
+	Message: "Lesson does not exist.",
+}
+
+// validLessonID checks whether id can be safely used as a folder name
+func validLessonID(id string) bool {
+	return id != "" &&
+		string(kb.Slugify(id)) == id &&
+		!strings.ContainsAny(id, "/=")
+}
+
+// Deletes all files of a lesson
+func (config Config) deleteLesson(lessonID string) error {
+	if !validLessonID(lessonID) {
+		return kb.BadRequest("Invalid lesson id.")
+	}
+
+	keys, err := config.storage.List(config.Bucket, config.Prefix+lessonID+"/")
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return errLessonNotExist
+	}
+
+	for _, key := range keys {
+		if err := config.storage.Delete(config.Bucket, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// zipSignatures start every zip archive, including H5P packages
+var zipSignatures = [][]byte{
+	[]byte("PK\x03\x04"),
+	[]byte("PK\x05\x06"), // empty archive
+}
+
+// checkPackage verifies that the uploaded file is a zip archive by its
+// contents, the extension is not trusted
+func checkPackage(fileNameWithPath string) error {
+	file, err := os.Open(fileNameWithPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(file, header); err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return err
+	}
+	for _, signature := range zipSignatures {
+		if bytes.Equal(header, signature) {
+			return nil
+		}
+	}
+	return kb.BadRequest("Upload error: lessons must be H5P or zip packages.")
+}
+
+// Uploads single file from the server; Returns its location if successful
+func (config Config) uploadFile(fileNameWithPath string) (error, string) {
+	fileExtension := strings.ToUpper(filepath.Ext(fileNameWithPath))
+
+	if fileExtension == ".H5P" {
+		return config.unzipAndUploadH5P(fileNameWithPath)
+	}
+	return config.uploadSingleFile("", fileNameWithPath)
+}
+
+func (config Config) unzipAndUploadH5P(fileNameWithPath string) (error, string) {
+	guid := strings.Replace(uuid.New().String(), "-", "", -1)
+	unzipPath := getTempPath(guid + "/")
+
+	err := Unzip(fileNameWithPath, unzipPath)
+	if err != nil {
+		return err, ""
+	}
+	// go through unzipped files, upload everything except dir's
+	err = filepath.Walk(unzipPath,
+		func(fileNameWithPath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+
+			if !info.IsDir() {
+				fileNameWithoutTempPath := strings.Replace(fileNameWithPath, getTempPath(""), "", -1)
+				key := filepath.FromSlash(config.Prefix + fileNameWithoutTempPath)
+				key = strings.Replace(key, string(filepath.Separator), "/", -1) // fix path for storage
+				err, _ := config.uploadSingleFile(key, fileNameWithPath)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	_ = os.RemoveAll(unzipPath)
+	if err != nil {
+		return err, ""
+	}
+
+	// upload template.html as it's needed to show the H5P content
+	workingDir, _ := os.Getwd()
+	fileNameWithPath = filepath.FromSlash(workingDir + "/client/H5Ptemplate.html")
+	return config.uploadSingleFile(config.Prefix+guid+"/template.html", fileNameWithPath)
+}
+
+// Uploads single file from the server to Bucket; Returns its location if successful
+// full key can be specified (optional)
+func (config Config) uploadSingleFile(key, fileNameWithPath string) (error, string) {
+	if key == "" {
+		key = filepath.Base(fileNameWithPath) // upload to Root dir if no specific path given
+	}
+
+	file, err := os.Open(fileNameWithPath)
+	if err != nil {
+		return err, ""
+	}
+	defer file.Close()
+
+	location, err := config.storage.Put(config.Bucket, key, getContentType(fileNameWithPath), file)
+	if err != nil {
+		return err, ""
+	}
+	return nil, location
+}
+
+func getContentType(fileNameWithPath string) string {
+	fileExtension := strings.ToUpper(filepath.Ext(fileNameWithPath))
+	if fileExtension == ".HTML" {
+		return "text/html"
+	} else if fileExtension == ".CSS" {
+		return "text/css"
+	} else if fileExtension == ".JS" {
+		return "text/javascript"
+	} else if fileExtension == ".JSON" {
+		return "application/json"
+	} else {
+		file, err := os.Open(fileNameWithPath)
+		if err != nil {
+			return "binary/octet-stream"
+		}
+		defer file.Close()
+
+		header := make([]byte, 512)
+		n, _ := file.Read(header)
+		return http.DetectContentType(header[:n])
+	}
+}
+
+func getEnvWithDefault(key, fallback string) string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	return value
+}
+
+func getTempPath(append string) string {
+	workingDir, _ := os.Getwd()
+	workingDir += "/temp/" + append
+
+	return filepath.FromSlash(workingDir)
+}
+
+// ListLessons writes the entry pages of all lessons as JSON
+func (config Config) ListLessons(w http.ResponseWriter, r *http.Request) {
+	keys, err := config.storage.List(config.Bucket, config.Prefix)
+	if err != nil {
+		kb.WriteError(w, r, fmt.Errorf("Unable to list all items from bucket %q, %v", config.Bucket, err))
+		return
+	}
+
+	var result struct {
+		Lessons []string `json:"lessons"`
+	}
+
+	lessonID := ""
+	for _, key := range keys {
+		id := config.lessonID(key)
+		if id != "" && id != lessonID {
+			lessonID = id
+			result.Lessons = append(result.Lessons, config.lessonURI(lessonID))
+		}
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// Saves single(first) file from http request to temp folder. Expects form key to be "file".
+// on success returns full path to the received file
+// todo: return 400 in case input was invalid
+func saveFileFromHttpRequestToServer(r *http.Request) (error, string) {
+	file, fileHeader, fileErr := r.FormFile("file")
+
+	if fileErr != nil {
+		log.Println(fileErr)
+		log.Println("Content type was: " + r.Header.Get("Content-type"))
+		return fileErr, ""
+	}
+	if file == nil || fileHeader == nil {
+		return errors.New("Upload error: file and/or header missing."), ""
+	}
+
+	fileNameWithPath := getTempPath(fileHeader.Filename)
+
+	f, err := os.Create(fileNameWithPath)
+	if err != nil {
+		return err, ""
+	}
+	io.Copy(f, file)
+	defer f.Close()
+
+	log.Println("HTTP -> Server upload complete. Received file: " + fileHeader.Filename)
+	return nil, fileNameWithPath
+}
+
+func Unzip(src, dest string) error {
+	r, err := zip.OpenReader(src)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	os.MkdirAll(dest, 0644)
+
+	// Closure to address file descriptors issue with all the deferred .Close() methods
+	extractAndWriteFile := func(f *zip.File) error {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		path := filepath.Join(dest, f.Name)
+		// Check for ZipSlip (Directory traversal)
+		if !strings.HasPrefix(path, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("illegal file path: %s", path)
+		}
+
+		if f.FileInfo().IsDir() {
+			os.MkdirAll(path, f.Mode())
+		} else {
+			os.MkdirAll(filepath.Dir(path), f.Mode())
+			f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, f.Mode())
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			_, err = io.Copy(f, rc)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, f := range r.File {
+		err := extractAndWriteFile(f)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,434 @@
+package lms
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// mockS3 keeps objects of a single bucket in memory
+type mockS3 struct {
+	s3iface.S3API
+	objects map[string]bool
+}
+
+func (m *mockS3) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	page := &s3.ListObjectsV2Output{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, *input.Prefix) {
+			page.Contents = append(page.Contents, &s3.Object{Key: aws.String(key)})
+		}
+	}
+	fn(page, true)
+	return nil
+}
+
+func (m *mockS3) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	delete(m.objects, *input.Key)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func TestDeleteLesson(t *testing.T) {
+	mock := &mockS3{objects: map[string]bool{
+		"H5P/lessons/abc/template.html":     true,
+		"H5P/lessons/abc/content/data.json": true,
+		"H5P/lessons/abcd/template.html":    true,
+	}}
+	config := Config{Bucket: "bucket", storage: s3Storage{client: mock}}.withDefaults()
+
+	if err := config.deleteLesson("abc"); err != nil {
+		t.Fatal(err)
+	}
+	if len(mock.objects) != 1 || !mock.objects["H5P/lessons/abcd/template.html"] {
+		t.Errorf("unexpected objects left: %v", mock.objects)
+	}
+
+	err := config.deleteLesson("abc")
+	if status, _ := kb.ErrorStatus(err); status != http.StatusNotFound {
+		t.Errorf("deleting missing lesson: got %v", err)
+	}
+}
+
+func TestDeleteLessonInvalidID(t *testing.T) {
+	mock := &mockS3{objects: map[string]bool{
+		"H5P/lessons/abc/template.html": true,
+	}}
+	config := Config{Bucket: "bucket", storage: s3Storage{client: mock}}.withDefaults()
+
+	for _, id := range []string{"", "../abc", "abc/", "ABC", "a b"} {
+		err := config.deleteLesson(id)
+		var herr *kb.HTTPError
+		if !errors.As(err, &herr) || herr.Status != http.StatusBadRequest {
+			t.Errorf("%q: expected bad request, got %v", id, err)
+		}
+	}
+	if len(mock.objects) != 1 {
+		t.Errorf("objects were deleted: %v", mock.objects)
+	}
+}
+
+func presignConfig(t *testing.T) Config {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-west-1"),
+		Credentials: credentials.NewStaticCredentials("AKID", "SECRET", ""),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return Config{
+		Bucket:      "tenant-bucket",
+		VideoBucket: "tenant-videos",
+		Region:      "eu-west-1",
+		storage:     s3Storage{client: s3.New(sess)},
+	}.withDefaults()
+}
+
+func TestPresignUpload(t *testing.T) {
+	config := presignConfig(t)
+
+	target, err := config.presignVideoUpload("intro.mp4", "client", "prod", "guid")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(target.Key, "videos/prod/client/") || !strings.HasSuffix(target.Key, "/guid_intro.mp4") {
+		t.Errorf("unexpected key %q", target.Key)
+	}
+	u, err := url.Parse(target.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(u.Host, "tenant-videos.") || u.Path != "/"+target.Key {
+		t.Errorf("url does not target bucket and key: %v", u)
+	}
+	if u.Query().Get("X-Amz-Expires") != "900" {
+		t.Errorf("url expiry: got %q", u.Query().Get("X-Amz-Expires"))
+	}
+	if time.Until(target.Expires) <= 0 || time.Until(target.Expires) > uploadURLExpiry {
+		t.Errorf("unexpected expiry %v", target.Expires)
+	}
+	if target.Location != "https://tenant-videos.s3.amazonaws.com/"+target.Key {
+		t.Errorf("unexpected location %q", target.Location)
+	}
+
+	target, err = config.presignContentUpload("image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.Key != "image.png" || !strings.Contains(target.URL, "tenant-bucket") {
+		t.Errorf("content upload: got %+v", target)
+	}
+
+	if _, err := config.presignContentUpload("lesson.h5p"); err == nil {
+		t.Error("expected H5P packages to be rejected")
+	}
+	if _, err := config.presignContentUpload(""); err == nil {
+		t.Error("expected missing name to be rejected")
+	}
+}
+
+// mockUploader counts the bytes of a multipart upload,
+// other requests are only built by S3API but never sent
+type mockUploader struct {
+	s3iface.S3API
+
+	mu       sync.Mutex
+	key      string
+	received int64
+	parts    int
+}
+
+func (m *mockUploader) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	n, err := io.Copy(ioutil.Discard, input.Body)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.key = *input.Key
+	m.received += n
+	m.parts++
+	return &s3.PutObjectOutput{}, err
+}
+
+func (m *mockUploader) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.key = *input.Key
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload")}, nil
+}
+
+func (m *mockUploader) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	n, err := io.Copy(ioutil.Discard, input.Body)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.received += n
+	m.parts++
+	return &s3.UploadPartOutput{ETag: aws.String("etag")}, err
+}
+
+func (m *mockUploader) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	return &s3.CompleteMultipartUploadOutput{}, nil
+}
+
+// zeroReader produces n zero bytes
+type zeroReader struct{ n int64 }
+
+func (z *zeroReader) Read(p []byte) (int, error) {
+	if z.n <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > z.n {
+		p = p[:z.n]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	z.n -= int64(len(p))
+	return len(p), nil
+}
+
+func TestStreamVideoUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lms")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// uploads must not touch the working directory or the temp directory
+	workingDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(workingDir)
+	defer restoreEnv("TMPDIR")()
+	os.Setenv("TMPDIR", dir)
+
+	const size = 12 << 20
+
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		form.WriteField("environment", "prod")
+		form.WriteField("clientID", "client")
+		form.WriteField("guid", "guid")
+		part, err := form.CreateFormFile("file", "training.mp4")
+		if err == nil {
+			_, err = io.Copy(part, &zeroReader{size})
+		}
+		if err == nil {
+			err = form.Close()
+		}
+		writer.CloseWithError(err)
+	}()
+
+	r := httptest.NewRequest("POST", "/lms=/uploadVideo/", body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	mock := &mockUploader{S3API: presignConfig(t).storage.(s3Storage).client}
+	config := Config{VideoBucket: "videos", storage: s3Storage{client: mock}}.withDefaults()
+	location, err := config.streamVideo(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if mock.received != size {
+		t.Errorf("received %d bytes, expected %d", mock.received, size)
+	}
+	if mock.parts < 2 {
+		t.Errorf("expected a multipart upload, got %d parts", mock.parts)
+	}
+	if !strings.HasPrefix(mock.key, "videos/prod/client/") || !strings.HasSuffix(mock.key, "/guid_training.mp4") {
+		t.Errorf("unexpected key %q", mock.key)
+	}
+	if location != "https://videos.s3.amazonaws.com/"+mock.key {
+		t.Errorf("unexpected location %q", location)
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range files {
+		t.Errorf("temporary file created: %s", file.Name())
+	}
+}
+
+func TestStreamVideoUploadMissingFile(t *testing.T) {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("guid", "guid")
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/lms=/uploadVideo/", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+
+	config := Config{storage: s3Storage{client: &mockUploader{}}}.withDefaults()
+	_, err := config.streamVideo(r)
+	if status, _ := kb.ErrorStatus(err); status != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %v", err)
+	}
+}
+
+// ListObjectsV2 returns sorted keys in pages of MaxKeys,
+// the continuation token is the index of the next key
+func (m *mockS3) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	keys := []string{}
+	for key := range m.objects {
+		if strings.HasPrefix(key, *input.Prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	start := 0
+	if input.ContinuationToken != nil {
+		start, _ = strconv.Atoi(*input.ContinuationToken)
+	}
+	end := start + int(*input.MaxKeys)
+	if end > len(keys) {
+		end = len(keys)
+	}
+
+	out := &s3.ListObjectsV2Output{IsTruncated: aws.Bool(end < len(keys))}
+	for _, key := range keys[start:end] {
+		out.Contents = append(out.Contents, &s3.Object{Key: aws.String(key)})
+	}
+	if end < len(keys) {
+		out.NextContinuationToken = aws.String(strconv.Itoa(end))
+	}
+	return out, nil
+}
+
+func TestListVideos(t *testing.T) {
+	mock := &mockS3{objects: map[string]bool{
+		"videos/prod/alpha/2020/g1_intro.mp4": true,
+		"videos/prod/alpha/2021/g2_outro.mp4": true,
+		"videos/prod/beta/2021/g3_intro.mp4":  true,
+		"videos/test/alpha/2021/g4_intro.mp4": true,
+		"videos/test/beta/2021/g5_intro.mp4":  true,
+	}}
+	config := Config{VideoBucket: "videos", storage: s3Storage{client: mock}}.withDefaults()
+
+	var all []string
+	token := ""
+	pages := 0
+	for {
+		page, err := config.listVideos("", "", "", token, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		all = append(all, page.Videos...)
+		if page.Next == "" {
+			break
+		}
+		token = page.Next
+	}
+	if pages != 3 || len(all) != 5 {
+		t.Errorf("got %d videos in %d pages: %v", len(all), pages, all)
+	}
+
+	page, err := config.listVideos("prod", "alpha", "", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := []string{"videos/prod/alpha/2020/g1_intro.mp4", "videos/prod/alpha/2021/g2_outro.mp4"}
+	if !reflect.DeepEqual(page.Videos, exp) || page.Next != "" {
+		t.Errorf("filtered by prefix: got %+v", page)
+	}
+
+	page, err = config.listVideos("", "beta", "g5", "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page.Videos, []string{"videos/test/beta/2021/g5_intro.mp4"}) {
+		t.Errorf("filtered by client and guid: got %+v", page)
+	}
+}
+
+func TestUploadContentRejectsNonPackage(t *testing.T) {
+	mod, cleanup := webhookModule(t, nil)
+	defer cleanup()
+
+	// the extension is not trusted
+	w := httptest.NewRecorder()
+	mod.uploadContent(w, uploadRequest(t, "lesson.h5p", "plain text"))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request, got %d %s", w.Code, w.Body.String())
+	}
+
+	if _, err := os.Stat(filepath.Join(mod.config.Dir, "lessons", "lesson.h5p")); !os.IsNotExist(err) {
+		t.Errorf("rejected file was stored: %v", err)
+	}
+}
+
+// videoRequest creates a request for uploadVideo
+func videoRequest(t *testing.T, name string, size int64) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	form.WriteField("environment", "prod")
+	form.WriteField("clientID", "client")
+	form.WriteField("guid", "guid")
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(part, &zeroReader{size})
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/lms=/uploadVideo/", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+func TestUploadVideoValidation(t *testing.T) {
+	mod, cleanup := webhookModule(t, nil)
+	defer cleanup()
+	mod.config.MaxVideoSize = 100
+
+	cases := []struct {
+		Name   string
+		Size   int64
+		Status int
+	}{
+		{"training.mp4", 100, http.StatusOK},
+		{"training.mp4", 101, http.StatusBadRequest},
+		{"notes.txt", 10, http.StatusBadRequest},
+	}
+
+	for _, test := range cases {
+		w := httptest.NewRecorder()
+		mod.uploadVideo(w, videoRequest(t, test.Name, test.Size))
+		if w.Code != test.Status {
+			t.Errorf("%s (%d bytes): got %d %s, expected %d", test.Name, test.Size, w.Code, w.Body.String(), test.Status)
+		}
+	}
+
+	keys, err := mod.config.storage.List(mod.config.VideoBucket, "videos/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 {
+		t.Errorf("expected only the valid video to be stored, got %v", keys)
+	}
+}
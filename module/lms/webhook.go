@@ -0,0 +1,88 @@
+package lms
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// uploadEvent is sent to the webhook after content is uploaded
+type uploadEvent struct {
+	LessonID   string  `json:"lessonID"`
+	URL        string  `json:"url"`
+	UploadedBy kb.Slug `json:"uploadedBy"`
+}
+
+// webhook notifies downstream systems about uploaded content,
+// a nil webhook does nothing
+type webhook struct {
+	url    string
+	client *http.Client
+	// retries after the first failed attempt, the delay doubles each time
+	retries int
+	backoff time.Duration
+}
+
+func newWebhook(url string) *webhook {
+	if url == "" {
+		return nil
+	}
+	return &webhook{
+		url:     url,
+		client:  &http.Client{Timeout: 10 * time.Second},
+		retries: 5,
+		backoff: time.Second,
+	}
+}
+
+// notify delivers the event in the background
+func (hook *webhook) notify(event uploadEvent) {
+	if hook == nil {
+		return
+	}
+	go hook.deliver(event)
+}
+
+func (hook *webhook) deliver(event uploadEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	delay := hook.backoff
+	for attempt := 0; ; attempt++ {
+		err = hook.post(data)
+		if err == nil {
+			return nil
+		}
+		if attempt >= hook.retries {
+			break
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+
+	log.Printf("LMS webhook %s failed for %q: %v", hook.url, event.URL, err)
+	return err
+}
+
+func (hook *webhook) post(data []byte) error {
+	resp, err := hook.client.Post(hook.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected response %s", resp.Status)
+	}
+	return nil
+}
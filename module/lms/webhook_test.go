@@ -0,0 +1,164 @@
+package lms
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type testAuth struct{ user kb.Slug }
+
+func (auth testAuth) Verify(w http.ResponseWriter, r *http.Request) (kb.User, error) {
+	return kb.User{ID: auth.user}, nil
+}
+
+type testDatabase struct{}
+
+func (testDatabase) Context(user kb.Slug) kb.Context { return testContext{user: user} }
+
+// testContext only knows the active user
+type testContext struct {
+	kb.Context
+	user kb.Slug
+}
+
+func (context testContext) ActiveUserID() kb.Slug { return context.user }
+func (context testContext) Access() kb.Access     { return testAccess{} }
+
+// testAccess allows alice to read the default video and lesson groups
+// and editor to edit the default lesson group
+type testAccess struct{ kb.Access }
+
+func (testAccess) Rights(group, user kb.Slug) kb.Rights {
+	switch {
+	case group == "lms-lessons" && user == "editor":
+		return kb.Editor
+	case (group == "lms-videos" || group == "lms-lessons") && user == "alice":
+		return kb.Reader
+	}
+	return kb.Blocked
+}
+
+func (testAccess) IsAdmin(user kb.Slug) bool { return user == "admin" }
+
+// lessonPackage starts with the zip signature expected by uploadContent
+const lessonPackage = "PK\x03\x04lesson"
+
+// uploadRequest creates a request for uploadContent
+func uploadRequest(t *testing.T, name, content string) *http.Request {
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(content))
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/lms=/uploadContent/", &body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	return r
+}
+
+// webhookModule creates a module using filesystem storage in a temporary working directory
+func webhookModule(t *testing.T, hook *webhook) (*Module, func()) {
+	config, dir := filesystemConfig(t)
+
+	workingDir, _ := os.Getwd()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	os.Mkdir(filepath.Join(dir, "temp"), 0755)
+
+	mod := &Module{
+		server:  kb.NewServer(testAuth{"alice"}, testDatabase{}),
+		config:  config,
+		webhook: hook,
+	}
+	return mod, func() {
+		os.Chdir(workingDir)
+		os.RemoveAll(dir)
+	}
+}
+
+func TestWebhookPayload(t *testing.T) {
+	events := make(chan uploadEvent, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event uploadEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Error(err)
+		}
+		events <- event
+	}))
+	defer ts.Close()
+
+	mod, cleanup := webhookModule(t, newWebhook(ts.URL))
+	defer cleanup()
+
+	w := httptest.NewRecorder()
+	mod.uploadContent(w, uploadRequest(t, "lesson.zip", lessonPackage))
+	if w.Code != http.StatusOK {
+		t.Fatalf("upload failed: %d %s", w.Code, w.Body.String())
+	}
+
+	select {
+	case event := <-events:
+		exp := uploadEvent{URL: w.Body.String(), UploadedBy: "alice"}
+		if event != exp {
+			t.Errorf("got %+v, expected %+v", event, exp)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not called")
+	}
+}
+
+func TestWebhookFailure(t *testing.T) {
+	var attempts int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&attempts, 1)
+		time.Sleep(50 * time.Millisecond)
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	hook := newWebhook(ts.URL)
+	hook.retries = 2
+	hook.backoff = time.Millisecond
+
+	mod, cleanup := webhookModule(t, hook)
+	defer cleanup()
+
+	// the upload must not wait for or depend on the webhook
+	w := httptest.NewRecorder()
+	mod.uploadContent(w, uploadRequest(t, "lesson.zip", lessonPackage))
+	if w.Code != http.StatusOK || w.Body.String() != mod.config.storage.Location(mod.config.Bucket, "lesson.zip") {
+		t.Fatalf("upload failed: %d %s", w.Code, w.Body.String())
+	}
+	if n := atomic.LoadInt32(&attempts); n > 1 {
+		t.Errorf("upload waited for %d webhook attempts", n)
+	}
+
+	if err := hook.deliver(uploadEvent{URL: "retry"}); err == nil {
+		t.Error("expected delivery to fail")
+	}
+	time.Sleep(100 * time.Millisecond)
+	// 3 attempts from the upload and 3 from deliver
+	if n := atomic.LoadInt32(&attempts); n != 6 {
+		t.Errorf("expected 6 attempts, got %d", n)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(mod.config.Dir, "lessons", "lesson.zip"))
+	if err != nil || string(data) != lessonPackage {
+		t.Errorf("uploaded file: got %q %v", data, err)
+	}
+}
@@ -0,0 +1,113 @@
+package page
+
+import (
+	"encoding/xml"
+	"net/http"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"feed"`
+	XMLNS   string      `xml:"xmlns,attr"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID      string     `xml:"id"`
+	Title   string     `xml:"title"`
+	Link    atomLink   `xml:"link"`
+	Updated string     `xml:"updated"`
+	Author  atomAuthor `xml:"author"`
+	Summary string     `xml:"summary,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+// recentChangesFeed writes the recent changes in readable groups as an Atom feed,
+// it takes the same parameters as recentChanges
+func (mod *Module) recentChangesFeed(w http.ResponseWriter, r *http.Request) {
+	limit, since, err := changesParams(r)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	_, index, ok := mod.server.IndexContext(w, r)
+	if !ok {
+		return
+	}
+
+	title := "Recent Changes"
+	var entries []kb.PageEntry
+	if actor := r.URL.Query().Get("user"); actor != "" {
+		title += " by " + actor
+		entries, err = index.RecentChangesByActor(kb.Slugify(actor), limit, since)
+	} else {
+		entries, err = index.RecentChangesSince(limit, "", since)
+	}
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	base := baseURL(r)
+	feed := atomFeed{
+		XMLNS: atomNamespace,
+		ID:    base + "/page=recent-changes",
+		Title: title,
+		Links: []atomLink{
+			{Href: base + r.URL.RequestURI(), Rel: "self"},
+			{Href: base + "/page=recent-changes"},
+		},
+		Entries: []atomEntry{},
+	}
+
+	var updated time.Time
+	for _, entry := range entries {
+		if entry.Modified.After(updated) {
+			updated = entry.Modified
+		}
+
+		author := string(entry.ModifiedBy)
+		if author == "" {
+			author = "unknown"
+		}
+		feed.Entries = append(feed.Entries, atomEntry{
+			ID:      base + "/" + string(entry.Slug),
+			Title:   entry.Title,
+			Link:    atomLink{Href: base + "/" + string(entry.Slug)},
+			Updated: entry.Modified.UTC().Format(time.RFC3339),
+			Author:  atomAuthor{Name: author},
+			Summary: entry.Synopsis,
+		})
+	}
+	if updated.IsZero() {
+		updated = time.Now()
+	}
+	feed.Updated = updated.UTC().Format(time.RFC3339)
+
+	data, err := xml.MarshalIndent(feed, "", "\t")
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/atom+xml")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
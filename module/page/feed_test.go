@@ -0,0 +1,73 @@
+package page
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func getFeed(t *testing.T, mod *Module, query string) atomFeed {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "http://kb.example.com/page=recent-changes.atom"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%q: got status %d", query, w.Code)
+	}
+	if contentType := w.Header().Get("Content-Type"); contentType != "application/atom+xml" {
+		t.Errorf("%q: got content type %q", query, contentType)
+	}
+
+	var feed atomFeed
+	if err := xml.Unmarshal(w.Body.Bytes(), &feed); err != nil {
+		t.Fatalf("%q: malformed xml: %v", query, err)
+	}
+	return feed
+}
+
+func TestRecentChangesFeed(t *testing.T) {
+	mod := newTestModule(30)
+	index := mod.server.Database.(testDatabase).index
+	index.entries = append([]kb.PageEntry{{
+		Slug:     "secret=plans",
+		Title:    "Plans",
+		Modified: testNow.Add(time.Hour),
+	}}, index.entries...)
+
+	feed := getFeed(t, mod, "?limit=5")
+	if feed.XMLName.Space != atomNamespace {
+		t.Errorf("got namespace %q", feed.XMLName.Space)
+	}
+	if feed.ID == "" || feed.Title == "" || feed.Updated != testNow.Format(time.RFC3339) {
+		t.Errorf("invalid feed header: %+v", feed)
+	}
+	if len(feed.Entries) != 5 {
+		t.Fatalf("got %d entries, expected 5", len(feed.Entries))
+	}
+
+	first := feed.Entries[0]
+	if first.Title != "Page 0" ||
+		first.ID != "http://kb.example.com/help=page-0" ||
+		first.Link.Href != first.ID ||
+		first.Updated != testNow.Format(time.RFC3339) ||
+		first.Author.Name != "alice" {
+		t.Errorf("got entry %+v", first)
+	}
+	for _, entry := range feed.Entries {
+		if strings.Contains(entry.ID, "secret") {
+			t.Errorf("unreadable change listed: %s", entry.ID)
+		}
+		if entry.Author.Name == "" || entry.Updated == "" {
+			t.Errorf("incomplete entry %+v", entry)
+		}
+	}
+
+	if feed := getFeed(t, mod, ""); len(feed.Entries) != DefaultRecentChanges {
+		t.Errorf("got %d entries, expected %d", len(feed.Entries), DefaultRecentChanges)
+	}
+}
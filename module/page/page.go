@@ -1,8 +1,12 @@
 package page
 
 import (
+	"encoding/json"
 	"html"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/raintreeinc/knowledgebase/kb"
@@ -13,12 +17,15 @@ var _ kb.Module = &Module{}
 type Module struct {
 	server *kb.Server
 	router *mux.Router
+
+	sitemapLimit int
 }
 
 func New(server *kb.Server) *Module {
 	mod := &Module{
-		server: server,
-		router: mux.NewRouter(),
+		server:       server,
+		router:       mux.NewRouter(),
+		sitemapLimit: SitemapLimit,
 	}
 	mod.init()
 	return mod
@@ -48,6 +55,10 @@ func (mod *Module) Pages() []kb.PageEntry {
 func (mod *Module) init() {
 	mod.router.HandleFunc("/page=pages", mod.pages).Methods("GET")
 	mod.router.HandleFunc("/page=recent-changes", mod.recentChanges).Methods("GET")
+	mod.router.HandleFunc("/page=recent-changes.atom", mod.recentChangesFeed).Methods("GET")
+	mod.router.HandleFunc("/page=raw", mod.raw).Methods("GET")
+	mod.router.HandleFunc("/page=outline", mod.outline).Methods("GET")
+	mod.router.HandleFunc("/page=sitemap.xml", mod.sitemap).Methods("GET")
 }
 
 func (mod *Module) ServeHTTP(w http.ResponseWriter, r *http.Request) {
@@ -65,9 +76,9 @@ func (mod *Module) pages(w http.ResponseWriter, r *http.Request) {
 		Title: "Pages",
 	}
 
-	entries, err := index.List()
+	entries, err := index.ListCtx(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 
@@ -75,21 +86,72 @@ func (mod *Module) pages(w http.ResponseWriter, r *http.Request) {
 	page.WriteResponse(w)
 }
 
+const (
+	// DefaultRecentChanges is the number of changes listed per group
+	DefaultRecentChanges = 10
+	MaxRecentChanges     = 200
+)
+
+// changesParams reads ?limit= and ?since= of recent changes
+func changesParams(r *http.Request) (limit int, since time.Time, err error) {
+	limit = DefaultRecentChanges
+	if param := r.URL.Query().Get("limit"); param != "" {
+		n, err := strconv.Atoi(param)
+		if err != nil || n <= 0 {
+			return 0, since, kb.BadRequest("limit must be a positive number")
+		}
+		limit = n
+	}
+	if limit > MaxRecentChanges {
+		limit = MaxRecentChanges
+	}
+
+	if param := r.URL.Query().Get("since"); param != "" {
+		since, err = time.Parse(time.RFC3339, param)
+		if err != nil {
+			return 0, since, kb.BadRequest("since must be a RFC3339 timestamp")
+		}
+	}
+	return limit, since, nil
+}
+
 func (mod *Module) recentChanges(w http.ResponseWriter, r *http.Request) {
+	limit, since, err := changesParams(r)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
 	context, index, ok := mod.server.IndexContext(w, r)
 	if !ok {
 		return
 	}
 
+	if actor := r.URL.Query().Get("user"); actor != "" {
+		entries, err := index.RecentChangesByActor(kb.Slugify(actor), limit, since)
+		if err != nil {
+			kb.WriteError(w, r, err)
+			return
+		}
+
+		page := &kb.Page{
+			Slug:  "page=recent-changes",
+			Title: "Recent Changes by " + actor,
+			Story: kb.StoryFromEntries(entries),
+		}
+		page.WriteResponse(w)
+		return
+	}
+
 	user, err := context.Users().ByID(context.ActiveUserID())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 
 	groups, err := index.Groups(kb.Reader)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 	kb.SortGroupsByPriority(user, groups)
@@ -100,9 +162,14 @@ func (mod *Module) recentChanges(w http.ResponseWriter, r *http.Request) {
 	}
 
 	for _, group := range groups {
-		entries, err := index.RecentChangesByGroup(10, group.ID)
+		var entries []kb.PageEntry
+		if since.IsZero() {
+			entries, err = index.RecentChangesByGroup(limit, group.ID)
+		} else {
+			entries, err = index.RecentChangesSince(limit, group.ID, since)
+		}
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			kb.WriteError(w, r, err)
 			return
 		}
 
@@ -116,3 +183,78 @@ func (mod *Module) recentChanges(w http.ResponseWriter, r *http.Request) {
 
 	page.WriteResponse(w)
 }
+
+// load reads page ?slug= for the current user
+func (mod *Module) load(w http.ResponseWriter, r *http.Request) (*kb.Page, bool) {
+	context, ok := mod.server.UserContext(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	groupID, pageID := kb.TokenizeLink(r.URL.Query().Get("slug"))
+	if groupID == "" {
+		kb.WriteError(w, r, kb.BadRequest("slug must have format owner=page-name"))
+		return nil, false
+	}
+
+	rights := context.Access().Rights(groupID, context.ActiveUserID())
+	if rights.Level() < kb.Rights(kb.Reader).Level() {
+		kb.WriteError(w, r, &kb.HTTPError{
+			Status:  http.StatusForbidden,
+			Code:    "access-denied",
+			Message: "Not enough rights to view this content.",
+		})
+		return nil, false
+	}
+
+	page, err := context.Pages(groupID).LoadCtx(r.Context(), pageID)
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return nil, false
+	}
+	return page, true
+}
+
+// raw writes the JSON of page ?slug=, the ETag is the page version
+func (mod *Module) raw(w http.ResponseWriter, r *http.Request) {
+	page, ok := mod.load(w, r)
+	if !ok {
+		return
+	}
+
+	etag := `"` + strconv.Itoa(page.Version) + `"`
+	w.Header().Set("ETag", etag)
+	if etagMatches(r.Header.Get("If-None-Match"), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	page.WriteResponse(w)
+}
+
+// outline writes the headings of page ?slug= as JSON, see kb.Outline
+func (mod *Module) outline(w http.ResponseWriter, r *http.Request) {
+	page, ok := mod.load(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := json.Marshal(kb.Outline(page))
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// etagMatches checks whether the If-None-Match header contains etag
+func etagMatches(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+	return false
+}
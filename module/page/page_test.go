@@ -0,0 +1,317 @@
+package page
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type testAuth struct{}
+
+func (testAuth) Verify(w http.ResponseWriter, r *http.Request) (kb.User, error) {
+	return kb.User{ID: "alice"}, nil
+}
+
+type testDatabase struct {
+	index *testIndex
+	pages testPages
+}
+
+func (db testDatabase) Context(user kb.Slug) kb.Context {
+	return testContext{user: user, index: db.index, pages: db.pages}
+}
+
+type testContext struct {
+	kb.Context
+	user  kb.Slug
+	index *testIndex
+	pages testPages
+}
+
+func (context testContext) ActiveUserID() kb.Slug        { return context.user }
+func (context testContext) Index(user kb.Slug) kb.Index  { return context.index }
+func (context testContext) Users() kb.Users              { return testUsers{} }
+func (context testContext) Access() kb.Access            { return testAccess{} }
+func (context testContext) Pages(group kb.Slug) kb.Pages { return context.pages }
+
+// testAccess allows reading only the help group
+type testAccess struct{ kb.Access }
+
+func (testAccess) Rights(group, user kb.Slug) kb.Rights {
+	if group == "help" {
+		return kb.Reader
+	}
+	return kb.Blocked
+}
+
+type testPages struct {
+	kb.Pages
+	pages map[kb.Slug]*kb.Page
+}
+
+func (pages testPages) LoadCtx(ctx context.Context, id kb.Slug) (*kb.Page, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	page, ok := pages.pages[id]
+	if !ok {
+		return nil, kb.ErrPageNotExist
+	}
+	return page, nil
+}
+
+type testUsers struct{ kb.Users }
+
+func (testUsers) ByID(id kb.Slug) (kb.User, error) { return kb.User{ID: id}, nil }
+
+// testIndex has a single group with pages modified one hour apart
+type testIndex struct {
+	kb.Index
+	entries []kb.PageEntry
+}
+
+func (index *testIndex) Groups(min kb.Rights) ([]kb.Group, error) {
+	return []kb.Group{{ID: "help", Name: "Help"}}, nil
+}
+
+// ListCtx returns only entries of readable groups, like pgdb
+func (index *testIndex) ListCtx(ctx context.Context) ([]kb.PageEntry, error) {
+	entries := []kb.PageEntry{}
+	for _, entry := range index.entries {
+		owner, _ := kb.TokenizeLink(string(entry.Slug))
+		if (testAccess{}).Rights(owner, "alice") != kb.Blocked {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (index *testIndex) RecentChangesByGroup(n int, groupID kb.Slug) ([]kb.PageEntry, error) {
+	return index.RecentChangesSince(n, groupID, time.Time{})
+}
+
+func (index *testIndex) RecentChangesSince(n int, groupID kb.Slug, since time.Time) ([]kb.PageEntry, error) {
+	entries := []kb.PageEntry{}
+	for _, entry := range index.entries {
+		owner, _ := kb.TokenizeLink(string(entry.Slug))
+		if (testAccess{}).Rights(owner, "alice") == kb.Blocked {
+			continue
+		}
+		if len(entries) < n && entry.Modified.After(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func (index *testIndex) RecentChangesByActor(actor kb.Slug, n int, since time.Time) ([]kb.PageEntry, error) {
+	if actor != "alice" {
+		return nil, kb.ErrAccessDenied
+	}
+	entries := []kb.PageEntry{}
+	for _, entry := range index.entries {
+		if len(entries) < n && entry.Synopsis == "by "+string(actor) && entry.Modified.After(since) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+var testNow = time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func newTestModule(pages int) *Module {
+	index := &testIndex{}
+	for i := 0; i < pages; i++ {
+		actor := []string{"alice", "bob"}[i%2]
+		index.entries = append(index.entries, kb.PageEntry{
+			Slug:       kb.Slug("help=page-" + strconv.Itoa(i)),
+			Title:      "Page " + strconv.Itoa(i),
+			Synopsis:   "by " + actor,
+			Modified:   testNow.Add(-time.Duration(i) * time.Hour),
+			ModifiedBy: kb.Slug(actor),
+		})
+	}
+	return New(kb.NewServer(testAuth{}, testDatabase{index: index}))
+}
+
+func TestRecentChanges(t *testing.T) {
+	mod := newTestModule(300)
+
+	tests := []struct {
+		query   string
+		entries int
+	}{
+		{"", DefaultRecentChanges},
+		{"?limit=25", 25},
+		{"?limit=1000", MaxRecentChanges},
+		{"?since=" + testNow.Add(-3*time.Hour-time.Minute).Format(time.RFC3339), 4},
+		{"?since=" + testNow.Add(-100*time.Hour).Format(time.RFC3339) + "&limit=50", 50},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=recent-changes"+test.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%q: got status %d", test.query, w.Code)
+		}
+
+		var page kb.Page
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+		entries := 0
+		for _, item := range page.Story {
+			if item.Type() == "entry" {
+				entries++
+			}
+		}
+		if entries != test.entries {
+			t.Errorf("%q: got %d entries, expected %d", test.query, entries, test.entries)
+		}
+	}
+}
+
+func TestRecentChangesInvalid(t *testing.T) {
+	mod := newTestModule(1)
+	for _, query := range []string{"?limit=ten", "?limit=-1", "?since=yesterday"} {
+		w := httptest.NewRecorder()
+		mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=recent-changes"+query, nil))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%q: got status %d, expected %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
+
+func TestRecentChangesByActor(t *testing.T) {
+	mod := newTestModule(10)
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=recent-changes?user=alice&limit=3", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	var page kb.Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Story) != 3 {
+		t.Fatalf("got %d items, expected 3", len(page.Story))
+	}
+	for _, item := range page.Story {
+		if item.Val("text") != "by alice" {
+			t.Errorf("change of other user listed: %v", item)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=recent-changes?user=bob", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("listing changes of other user: got status %d", w.Code)
+	}
+
+	// alice changed pages 0, 2, 4, ... one hour apart, since keeps pages 0 and 2
+	since := testNow.Add(-3 * time.Hour).Format(time.RFC3339)
+	w = httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=recent-changes?user=alice&since="+since, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("with since: got status %d", w.Code)
+	}
+	page = kb.Page{}
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if len(page.Story) != 2 {
+		t.Errorf("with since: got %d items, expected 2", len(page.Story))
+	}
+}
+
+func TestRawPage(t *testing.T) {
+	pages := testPages{pages: map[kb.Slug]*kb.Page{
+		"help=intro": {Slug: "help=intro", Title: "Intro", Version: 3},
+	}}
+	mod := New(kb.NewServer(testAuth{}, testDatabase{index: &testIndex{}, pages: pages}))
+
+	request := func(slug, etag string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/page=raw?slug="+slug, nil)
+		if etag != "" {
+			r.Header.Set("If-None-Match", etag)
+		}
+		w := httptest.NewRecorder()
+		mod.ServeHTTP(w, r)
+		return w
+	}
+
+	// cache miss
+	w := request("help=intro", `"2"`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+	if etag := w.Header().Get("ETag"); etag != `"3"` {
+		t.Errorf("got ETag %q", etag)
+	}
+	var page kb.Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Slug != "help=intro" || page.Version != 3 {
+		t.Errorf("got page %+v", page)
+	}
+
+	// cache hit
+	w = request("help=intro", `"3"`)
+	if w.Code != http.StatusNotModified || w.Body.Len() != 0 {
+		t.Errorf("got status %d with %q", w.Code, w.Body.String())
+	}
+
+	if w := request("help=missing", ""); w.Code != http.StatusNotFound {
+		t.Errorf("missing page: got status %d", w.Code)
+	}
+	if w := request("secret=intro", ""); w.Code != http.StatusForbidden {
+		t.Errorf("blocked group: got status %d", w.Code)
+	}
+}
+
+func TestOutline(t *testing.T) {
+	pages := testPages{pages: map[kb.Slug]*kb.Page{
+		"help=intro": {Slug: "help=intro", Title: "Intro", Story: kb.Story{
+			kb.HTML("<h2>Setup</h2><h3>Files</h3>"),
+		}},
+	}}
+	mod := New(kb.NewServer(testAuth{}, testDatabase{index: &testIndex{}, pages: pages}))
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=outline?slug=help=intro", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d", w.Code)
+	}
+
+	var outline []kb.OutlineEntry
+	if err := json.Unmarshal(w.Body.Bytes(), &outline); err != nil {
+		t.Fatal(err)
+	}
+	if len(outline) != 2 || outline[0].ID != "setup" || outline[1].Level != 3 {
+		t.Errorf("got %+v", outline)
+	}
+}
+
+func TestRawPageCancelled(t *testing.T) {
+	pages := testPages{pages: map[kb.Slug]*kb.Page{
+		"help=intro": {Slug: "help=intro", Title: "Intro", Version: 3},
+	}}
+	mod := New(kb.NewServer(testAuth{}, testDatabase{index: &testIndex{}, pages: pages}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=raw?slug=help=intro", nil).WithContext(ctx))
+	if w.Code == http.StatusOK {
+		t.Errorf("request context was not passed to the database")
+	}
+}
@@ -0,0 +1,129 @@
+package page
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+// SitemapLimit is the maximum number of urls in a single sitemap,
+// larger sitemaps are split and listed in a sitemap index
+const SitemapLimit = 50000
+
+const sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+type sitemapURLSet struct {
+	XMLName xml.Name     `xml:"urlset"`
+	XMLNS   string       `xml:"xmlns,attr"`
+	URLs    []sitemapURL `xml:"url"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	XMLNS    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapURL `xml:"sitemap"`
+}
+
+// baseURL returns the scheme and host the request was made to
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+func lastmod(modified time.Time) string {
+	if modified.IsZero() {
+		return ""
+	}
+	return modified.UTC().Format(time.RFC3339)
+}
+
+// sitemap lists all pages readable by the user, when there are more than
+// SitemapLimit pages it writes an index of ?part= sitemaps instead
+func (mod *Module) sitemap(w http.ResponseWriter, r *http.Request) {
+	_, index, ok := mod.server.IndexContext(w, r)
+	if !ok {
+		return
+	}
+
+	entries, err := index.ListCtx(r.Context())
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	base := baseURL(r)
+	limit := mod.sitemapLimit
+	parts := (len(entries) + limit - 1) / limit
+
+	var result interface{}
+	if param := r.URL.Query().Get("part"); param != "" {
+		part, err := strconv.Atoi(param)
+		if err != nil || part < 1 || part > parts {
+			kb.WriteError(w, r, kb.BadRequest("part must be between 1 and "+strconv.Itoa(parts)))
+			return
+		}
+		entries = entries[(part-1)*limit:]
+		if len(entries) > limit {
+			entries = entries[:limit]
+		}
+		result = urlSet(base, entries)
+	} else if parts > 1 {
+		sitemaps := sitemapIndex{XMLNS: sitemapNamespace}
+		for part := 1; part <= parts; part++ {
+			// a part is as recent as its most recently modified page
+			var modified time.Time
+			for _, entry := range entries[(part-1)*limit : partEnd(part, limit, len(entries))] {
+				if entry.Modified.After(modified) {
+					modified = entry.Modified
+				}
+			}
+			sitemaps.Sitemaps = append(sitemaps.Sitemaps, sitemapURL{
+				Loc:     base + "/page=sitemap.xml?part=" + strconv.Itoa(part),
+				LastMod: lastmod(modified),
+			})
+		}
+		result = sitemaps
+	} else {
+		result = urlSet(base, entries)
+	}
+
+	data, err := xml.MarshalIndent(result, "", "\t")
+	if err != nil {
+		kb.WriteError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	w.Write([]byte(xml.Header))
+	w.Write(data)
+}
+
+func urlSet(base string, entries []kb.PageEntry) sitemapURLSet {
+	set := sitemapURLSet{XMLNS: sitemapNamespace, URLs: []sitemapURL{}}
+	for _, entry := range entries {
+		set.URLs = append(set.URLs, sitemapURL{
+			Loc:     base + "/" + string(entry.Slug),
+			LastMod: lastmod(entry.Modified),
+		})
+	}
+	return set
+}
+
+// partEnd returns the end of entries in the sitemap part
+func partEnd(part, limit, total int) int {
+	if end := part * limit; end < total {
+		return end
+	}
+	return total
+}
@@ -0,0 +1,80 @@
+package page
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func getSitemap(t *testing.T, mod *Module, query string, v interface{}) {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "http://kb.example.com/page=sitemap.xml"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%q: got status %d", query, w.Code)
+	}
+	if !strings.HasPrefix(w.Body.String(), xml.Header) {
+		t.Errorf("%q: missing xml header", query)
+	}
+	if err := xml.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%q: malformed xml: %v", query, err)
+	}
+}
+
+func TestSitemap(t *testing.T) {
+	mod := newTestModule(3)
+	index := mod.server.Database.(testDatabase).index
+	index.entries = append(index.entries, kb.PageEntry{Slug: "secret=plans"})
+
+	var sitemap sitemapURLSet
+	getSitemap(t, mod, "", &sitemap)
+
+	if sitemap.XMLName.Space != sitemapNamespace {
+		t.Errorf("got namespace %q", sitemap.XMLName.Space)
+	}
+	if len(sitemap.URLs) != 3 {
+		t.Fatalf("got %d urls, expected 3", len(sitemap.URLs))
+	}
+	for _, url := range sitemap.URLs {
+		if strings.Contains(url.Loc, "secret") {
+			t.Errorf("unreadable page listed: %s", url.Loc)
+		}
+	}
+	if exp := "http://kb.example.com/help=page-0"; sitemap.URLs[0].Loc != exp {
+		t.Errorf("got loc %q, expected %q", sitemap.URLs[0].Loc, exp)
+	}
+	if exp := "2020-01-01T12:00:00Z"; sitemap.URLs[0].LastMod != exp {
+		t.Errorf("got lastmod %q, expected %q", sitemap.URLs[0].LastMod, exp)
+	}
+}
+
+func TestSitemapIndex(t *testing.T) {
+	mod := newTestModule(5)
+	mod.sitemapLimit = 2
+
+	var index sitemapIndex
+	getSitemap(t, mod, "", &index)
+	if len(index.Sitemaps) != 3 {
+		t.Fatalf("got %d sitemaps, expected 3", len(index.Sitemaps))
+	}
+	if exp := "http://kb.example.com/page=sitemap.xml?part=3"; index.Sitemaps[2].Loc != exp {
+		t.Errorf("got loc %q, expected %q", index.Sitemaps[2].Loc, exp)
+	}
+
+	var last sitemapURLSet
+	getSitemap(t, mod, "?part=3", &last)
+	if len(last.URLs) != 1 || !strings.HasSuffix(last.URLs[0].Loc, "/help=page-4") {
+		t.Errorf("got %+v", last.URLs)
+	}
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/page=sitemap.xml?part=4", nil))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("part out of range: got status %d", w.Code)
+	}
+}
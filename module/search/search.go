@@ -2,7 +2,9 @@ package search
 
 import (
 	"net/http"
+	"net/url"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/gorilla/mux"
@@ -59,7 +61,7 @@ func (mod *Module) pages(w http.ResponseWriter, r *http.Request) {
 
 	entries, err := index.List()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 
@@ -102,19 +104,32 @@ func (mod *Module) search(w http.ResponseWriter, r *http.Request) {
 	}
 
 	q := r.URL.Query().Get("q")
+	tags := r.URL.Query()["tag"]
 	filter := r.Header.Get("X-Filter")
 
+	offset, _ := strconv.Atoi(r.URL.Query().Get("offset"))
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	offset, limit = kb.SearchWindow(offset, limit)
+
 	var entries []kb.PageEntry
+	var total int
 	var err error
-	if filter == "" {
-		entries, err = index.Search(q)
-	} else {
-		filter = string(kb.Slugify(filter))
-		entries, err = index.SearchFilter(q, "help-", "help-"+filter)
+	exclude, include := "", ""
+	if filter != "" {
+		exclude, include = "help-", "help-"+string(kb.Slugify(filter))
+	}
+
+	switch {
+	case len(tags) > 0:
+		entries, total, err = index.SearchFilteredCtx(r.Context(), q, tags, exclude, include, offset, limit)
+	case filter == "":
+		entries, total, err = index.SearchCtx(r.Context(), q, offset, limit)
+	default:
+		entries, total, err = index.SearchFilterCtx(r.Context(), q, exclude, include, offset, limit)
 	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 
@@ -125,5 +140,26 @@ func (mod *Module) search(w http.ResponseWriter, r *http.Request) {
 		Title: "Search \"" + q + "\"",
 		Story: kb.StoryFromEntries(entries),
 	}
+
+	prev, next := "", ""
+	if offset > 0 {
+		prev = windowURL(r.URL, offset-limit, limit)
+	}
+	if offset+len(entries) < total {
+		next = windowURL(r.URL, offset+limit, limit)
+	}
+	page.Story.Append(kb.Pagination(offset, len(entries), total, prev, next))
+
 	page.WriteResponse(w)
 }
+
+// windowURL returns the search url with a different window
+func windowURL(u *url.URL, offset, limit int) string {
+	if offset < 0 {
+		offset = 0
+	}
+	query := u.Query()
+	query.Set("offset", strconv.Itoa(offset))
+	query.Set("limit", strconv.Itoa(limit))
+	return u.Path + "?" + query.Encode()
+}
@@ -0,0 +1,248 @@
+package search
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+type testAuth struct{}
+
+func (testAuth) Verify(w http.ResponseWriter, r *http.Request) (kb.User, error) {
+	return kb.User{ID: "alice"}, nil
+}
+
+type testDatabase struct{ index *testIndex }
+
+func (db testDatabase) Context(user kb.Slug) kb.Context {
+	return testContext{user: user, index: db.index}
+}
+
+type testContext struct {
+	kb.Context
+	user  kb.Slug
+	index *testIndex
+}
+
+func (context testContext) ActiveUserID() kb.Slug       { return context.user }
+func (context testContext) Index(user kb.Slug) kb.Index { return context.index }
+
+// testIndex matches every page on search
+type testIndex struct {
+	kb.Index
+	entries []kb.PageEntry
+}
+
+func (index *testIndex) SearchCtx(ctx context.Context, text string, offset, limit int) ([]kb.PageEntry, int, error) {
+	offset, limit = kb.SearchWindow(offset, limit)
+	total := len(index.entries)
+	if offset > total {
+		offset = total
+	}
+	end := offset + limit
+	if end > total {
+		end = total
+	}
+	return index.entries[offset:end], total, nil
+}
+
+func (index *testIndex) SearchFilteredCtx(ctx context.Context, text string, tags []string, exclude, include string, offset, limit int) ([]kb.PageEntry, int, error) {
+	wanted := kb.SlugifyTags(tags)
+	matches := &testIndex{}
+	for _, entry := range index.entries {
+		if !strings.Contains(entry.Title, text) {
+			continue
+		}
+		owner, _ := kb.TokenizeLink(string(entry.Slug))
+		if exclude != "" && strings.HasPrefix(string(owner), exclude) && owner != kb.Slug(include) {
+			continue
+		}
+		has := map[string]bool{}
+		for _, tag := range kb.SlugifyTags(entry.Tags) {
+			has[tag] = true
+		}
+		all := true
+		for _, tag := range wanted {
+			all = all && has[tag]
+		}
+		if all {
+			matches.entries = append(matches.entries, entry)
+		}
+	}
+	return matches.SearchCtx(ctx, text, offset, limit)
+}
+
+func newTestModule(pages int) *Module {
+	index := &testIndex{}
+	for i := 0; i < pages; i++ {
+		slug := kb.Slug("help=page-" + strconv.Itoa(i))
+		index.entries = append(index.entries, kb.PageEntry{Slug: slug, Title: string(slug)})
+	}
+	return New(kb.NewServer(testAuth{}, testDatabase{index}))
+}
+
+func TestSearchWindow(t *testing.T) {
+	mod := newTestModule(120)
+
+	tests := []struct {
+		query   string
+		entries int
+		prev    bool
+		next    bool
+	}{
+		{"q=page", 50, false, true},
+		{"q=page&offset=100", 20, true, false},
+		{"q=page&offset=40&limit=30", 30, true, true},
+		{"q=page&offset=200", 0, true, false},
+		{"q=page&limit=1000", 120, false, false},
+		{"q=page&offset=-5&limit=-1", 50, false, true},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		mod.ServeHTTP(w, httptest.NewRequest("GET", "/search=search?"+test.query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s: got status %d", test.query, w.Code)
+		}
+
+		var page kb.Page
+		if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+			t.Fatal(err)
+		}
+
+		entries := 0
+		var pagination kb.Item
+		for _, item := range page.Story {
+			switch item.Type() {
+			case "entry":
+				entries++
+			case "pagination":
+				pagination = item
+			}
+		}
+
+		if entries != test.entries {
+			t.Errorf("%s: got %d entries, expected %d", test.query, entries, test.entries)
+		}
+		if pagination == nil {
+			t.Errorf("%s: missing pagination", test.query)
+			continue
+		}
+		if total, _ := pagination["total"].(float64); total != 120 {
+			t.Errorf("%s: got total %v", test.query, pagination["total"])
+		}
+		if hasPrev := pagination["prev"] != ""; hasPrev != test.prev {
+			t.Errorf("%s: prev link %q", test.query, pagination["prev"])
+		}
+		if hasNext := pagination["next"] != ""; hasNext != test.next {
+			t.Errorf("%s: next link %q", test.query, pagination["next"])
+		}
+	}
+}
+
+// searchEntries returns the slugs of entries found by the query
+func searchEntries(t *testing.T, mod *Module, query string) []kb.Slug {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/search=search?"+query, nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("%s: got status %d", query, w.Code)
+	}
+
+	var page kb.Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	slugs := []kb.Slug{}
+	for _, item := range page.Story {
+		if item.Type() == "entry" {
+			slugs = append(slugs, kb.Slug(item.Val("link")))
+		}
+	}
+	return slugs
+}
+
+func TestSearchTags(t *testing.T) {
+	index := &testIndex{entries: []kb.PageEntry{
+		{Slug: "help=billing-charges", Title: "Billing charges", Tags: []string{"Billing", "Finance"}},
+		{Slug: "help=billing-reports", Title: "Billing reports", Tags: []string{"Billing", "Reports"}},
+		{Slug: "help=finance-reports", Title: "Finance reports", Tags: []string{"Finance", "Reports"}},
+	}}
+	mod := New(kb.NewServer(testAuth{}, testDatabase{index}))
+
+	tests := []struct {
+		query    string
+		expected []kb.Slug
+	}{
+		{"q=Billing&tag=billing", []kb.Slug{"help=billing-charges", "help=billing-reports"}},
+		{"q=reports&tag=Reports", []kb.Slug{"help=billing-reports", "help=finance-reports"}},
+		{"q=reports&tag=reports&tag=finance", []kb.Slug{"help=finance-reports"}},
+		{"q=Billing&tag=billing&tag=finance", []kb.Slug{"help=billing-charges"}},
+		{"q=Billing&tag=billing&tag=missing", []kb.Slug{}},
+	}
+	for _, test := range tests {
+		got := searchEntries(t, mod, test.query)
+		if !reflect.DeepEqual(got, test.expected) {
+			t.Errorf("%s: got %v, expected %v", test.query, got, test.expected)
+		}
+	}
+}
+
+func TestSearchTagsFilter(t *testing.T) {
+	index := &testIndex{entries: []kb.PageEntry{
+		{Slug: "help=billing-charges", Title: "Billing charges", Tags: []string{"Billing"}},
+		{Slug: "help-10=billing-charges", Title: "Billing charges", Tags: []string{"Billing"}},
+		{Slug: "help-11=billing-charges", Title: "Billing charges", Tags: []string{"Billing"}},
+		{Slug: "help-11=billing-reports", Title: "Billing reports", Tags: []string{"Reports"}},
+	}}
+	mod := New(kb.NewServer(testAuth{}, testDatabase{index}))
+
+	r := httptest.NewRequest("GET", "/search=search?q=Billing&tag=billing", nil)
+	r.Header.Set("X-Filter", "11")
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, r)
+
+	var page kb.Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	got := []kb.Slug{}
+	for _, item := range page.Story {
+		if item.Type() == "entry" {
+			got = append(got, kb.Slug(item.Val("link")))
+		}
+	}
+	expected := []kb.Slug{"help=billing-charges", "help-11=billing-charges"}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestSearchHighlight(t *testing.T) {
+	index := &testIndex{entries: []kb.PageEntry{{
+		Slug:      "help=billing",
+		Title:     "Billing",
+		Highlight: kb.Highlight("Posting charges to an account.", "charges", kb.HighlightLength),
+	}}}
+	mod := New(kb.NewServer(testAuth{}, testDatabase{index}))
+
+	w := httptest.NewRecorder()
+	mod.ServeHTTP(w, httptest.NewRequest("GET", "/search=search?q=charges", nil))
+
+	var page kb.Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if got := page.Story[0].Val("highlight"); !strings.Contains(got, kb.HighlightStart+"charges"+kb.HighlightEnd) {
+		t.Errorf("highlight not in entry item: %q", got)
+	}
+}
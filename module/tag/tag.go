@@ -78,7 +78,7 @@ func (mod *Module) pages(w http.ResponseWriter, r *http.Request, tag kb.Slug) {
 	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 
@@ -99,7 +99,7 @@ func (mod *Module) tags(w http.ResponseWriter, r *http.Request) {
 
 	entries, err := index.Tags()
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 
@@ -144,7 +144,7 @@ func (mod *Module) first(w http.ResponseWriter, r *http.Request, tag kb.Slug) {
 	}
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		kb.WriteError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,63 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func init() {
+	Register(Command{
+		Name: "create-token",
+		Desc: "Create API token for a user",
+		Run:  CreateToken,
+	})
+	Register(Command{
+		Name: "revoke-token",
+		Desc: "Revoke API token",
+		Run:  RevokeToken,
+	})
+}
+
+func CreateToken(DB kb.Database, fs *flag.FlagSet, args []string) {
+	user := fs.String("user", "", "user the token authenticates as")
+	name := fs.String("name", "", "name describing the integration")
+	write := fs.Bool("write", false, "allow modifying requests")
+	fs.Parse(args)
+
+	if *user == "" {
+		fmt.Println("user must be specified")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	scope := kb.ScopeRead
+	if *write {
+		scope = kb.ScopeReadWrite
+	}
+
+	token, err := DB.Context(kb.Slugify(*user)).APITokens().CreateToken(*name, scope)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	fmt.Println(token)
+}
+
+func RevokeToken(DB kb.Database, fs *flag.FlagSet, args []string) {
+	id := fs.Int64("id", 0, "id of the token")
+	fs.Parse(args)
+
+	if *id <= 0 {
+		fmt.Println("id must be specified")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	if err := DB.Context("admin").APITokens().RevokeToken(*id); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,35 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func init() {
+	Register(Command{
+		Name: "freeze-group",
+		Desc: "Make group pages read-only",
+		Run:  FreezeGroup,
+	})
+}
+
+func FreezeGroup(DB kb.Database, fs *flag.FlagSet, args []string) {
+	group := fs.String("group", "", "group to freeze")
+	unfreeze := fs.Bool("unfreeze", false, "allow writes again")
+	fs.Parse(args)
+
+	if *group == "" {
+		fmt.Println("group must be specified")
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	err := DB.Context("admin").Access().SetFrozen(kb.Slugify(*group), !*unfreeze)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
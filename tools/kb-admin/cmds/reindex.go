@@ -0,0 +1,45 @@
+package cmds
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/raintreeinc/knowledgebase/kb"
+)
+
+func init() {
+	Register(Command{
+		Name: "reindex",
+		Desc: "Recompute synopsis and tags of pages",
+		Run:  Reindex,
+	})
+}
+
+func Reindex(DB kb.Database, fs *flag.FlagSet, args []string) {
+	group := fs.String("group", "", "group to reindex, all groups when empty")
+	fs.Parse(args)
+
+	context := DB.Context("admin")
+
+	groups := []kb.Slug{kb.Slugify(*group)}
+	if *group == "" {
+		all, err := context.Groups().List()
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		groups = groups[:0]
+		for _, group := range all {
+			groups = append(groups, group.ID)
+		}
+	}
+
+	for _, id := range groups {
+		if err := context.Pages(id).Reindex(); err != nil {
+			fmt.Printf("%s: %v\n", id, err)
+			os.Exit(1)
+		}
+		fmt.Printf("%s reindexed\n", id)
+	}
+}
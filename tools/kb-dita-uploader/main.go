@@ -14,7 +14,6 @@ import (
 	_ "github.com/lib/pq"
 
 	"github.com/raintreeinc/knowledgebase/kb"
-	"github.com/raintreeinc/knowledgebase/kb/items/index"
 	"github.com/raintreeinc/knowledgebase/kb/pgdb"
 	"github.com/raintreeinc/knowledgebase/module/dita"
 )
@@ -24,6 +23,7 @@ var (
 	configfile = flag.String("config", "kb-dita-uploader.json", "configuration file")
 	stoponerr  = flag.Bool("stop", false, "don't upload if there are problems in converting")
 	killonerr  = flag.Bool("kill", false, "don't try upload other mappings")
+	dryrun     = flag.Bool("dry-run", false, "only report slugs and problems, don't write to the database")
 )
 
 func main() {
@@ -87,7 +87,7 @@ func Upload(name string, config *Config) error {
 	}
 
 	if p == nil {
-		return fmt.Errorf("no mapping named ", name)
+		return fmt.Errorf("no mapping named %v", name)
 	}
 
 	log.Println()
@@ -98,54 +98,17 @@ func Upload(name string, config *Config) error {
 
 	owner := kb.Slugify(p.Group)
 	conversion := dita.NewConversion(owner, p.Ditamap)
-
-	log.Println("== Running Conversion")
-	conversion.Run()
-
-	if len(conversion.LoadErrors) > 0 {
-		log.Println("== Index Errors")
-		for _, err := range conversion.LoadErrors {
-			log.Println(err)
-		}
-		if *stoponerr {
-			return errors.New("errors in index")
-		}
-	}
-
-	if len(conversion.MappingErrors) > 0 {
-		log.Println("== Mapping Errors")
-		for _, err := range conversion.MappingErrors {
-			log.Println(err)
-		}
-		if *stoponerr {
-			return errors.New("errors in index")
-		}
-	}
-
-	if len(conversion.Errors) > 0 {
-		log.Println("== Conversion Errors")
-		for _, err := range conversion.Errors {
-			log.Println(err.Path+":", err.Slug)
-			if err.Fatal != nil {
-				log.Println("\tFATAL:", err.Fatal)
-				if *stoponerr {
-					return errors.New("conversion error")
-				}
-			}
-			for _, err := range err.Errors {
-				log.Println("\t", err)
-			}
-		}
+	conversion.SlugOverrides = p.SlugOverrides
+	conversion.HierarchicalSlugs = p.HierarchicalSlugs
+	if p.EnglishTitles {
+		conversion.Titelize = dita.EnglishTitelize
 	}
 
-	indexslug := kb.Slug(owner + "=index")
-	conversion.Pages[indexslug] = &kb.Page{
-		Slug:     indexslug,
-		Title:    "Index",
-		Synopsis: "Help navigation index",
-		Story: kb.Story{
-			index.New("index", conversion.Nav),
-		},
+	if *dryrun {
+		log.Println("== Running Conversion")
+		report, err := dita.Import(conversion, nil, dita.ImportOptions{DryRun: true})
+		report.WriteTo(log.Writer())
+		return err
 	}
 
 	log.Println()
@@ -171,14 +134,7 @@ func Upload(name string, config *Config) error {
 		return err
 	}
 
-	log.Println()
-	log.Println("== Uploading")
-	log.Println()
-
 	complete := 0
-	total := len(conversion.Pages)
-
-	pages := DB.Context("admin").Pages(owner)
 	callback := func(description string, slug kb.Slug) {
 		if description != "deleted" {
 			complete++
@@ -186,14 +142,16 @@ func Upload(name string, config *Config) error {
 		if description == "unchanged" {
 			return
 		}
-		log.Printf("%04d/%04d : %-10s %v\n", complete, total, description, slug)
-	}
-	if *overwrite {
-		err = pages.BatchReplace(conversion.Pages, callback)
-	} else {
-		err = pages.BatchReplaceDelta(conversion.Pages, callback)
+		log.Printf("%04d/%04d : %-10s %v\n", complete, len(conversion.Pages), description, slug)
 	}
 
+	log.Println("== Running Conversion and Uploading")
+	report, err := dita.Import(conversion, DB.Context("admin").Pages(owner), dita.ImportOptions{
+		Overwrite:   *overwrite,
+		StopOnError: *stoponerr,
+		Progress:    callback,
+	})
+	report.WriteTo(log.Writer())
 	return err
 }
 
@@ -201,6 +159,12 @@ type CopyParams struct {
 	Group       string
 	Ditamap     string
 	Description string
+	// SlugOverrides preserves legacy slugs, keyed by topic filename
+	SlugOverrides map[string]kb.Slug
+	// HierarchicalSlugs prefixes slugs with the containing sections
+	HierarchicalSlugs bool
+	// EnglishTitles spells out "/" and "&" in slugs as "or" and "and"
+	EnglishTitles bool
 }
 
 type Config struct {
@@ -231,7 +195,7 @@ func (c *Config) LoadEnv() {
 	c.RDS.Port = os.Getenv("RDS_PORT")
 }
 
-func (c *Config) ReadFrom(r io.Reader) error {
+func (c *Config) Decode(r io.Reader) error {
 	return json.NewDecoder(r).Decode(c)
 }
 
@@ -241,7 +205,7 @@ func (c *Config) ReadFromFile(filename string) error {
 		return err
 	}
 	defer file.Close()
-	return c.ReadFrom(file)
+	return c.Decode(file)
 }
 
 func (c *Config) ConnectionParams() string {